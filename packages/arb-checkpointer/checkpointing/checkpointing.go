@@ -30,10 +30,12 @@ type RollupCheckpointer interface {
 	Initialized() bool
 	HasCheckpointedState() bool
 	RestoreLatestState(context.Context, arbbridge.ChainTimeGetter, func([]byte, ckptcontext.RestoreContext, *common.BlockId) error) error
+	RestoreStateAtOrBefore(context.Context, arbbridge.ChainTimeGetter, *common.TimeBlocks, func([]byte, ckptcontext.RestoreContext, *common.BlockId) error) error
 	GetInitialMachine() (machine.Machine, error)
 	AsyncSaveCheckpoint(blockId *common.BlockId, contents []byte, cpCtx *ckptcontext.CheckpointContext) <-chan error
 
 	MaxReorgHeight() *big.Int
+	Close()
 }
 
 const checkpointDatabasePathBase = "/tmp/arb-validator-checkpoint-"
@@ -37,6 +37,7 @@ import (
 
 var errNoCheckpoint = errors.New("cannot restore because no checkpoint exists")
 var errNoMatchingCheckpoint = errors.New("cannot restore because no matching checkpoint exists")
+var errCheckpointerClosed = errors.New("checkpointer is closed")
 
 type IndexedCheckpointer struct {
 	*sync.Mutex
@@ -44,6 +45,11 @@ type IndexedCheckpointer struct {
 	bs                    machine.BlockStore
 	nextCheckpointToWrite *writableCheckpoint
 	maxReorgHeight        *big.Int
+
+	// closing is closed to stop the daemons, which are tracked by daemons
+	closing   chan struct{}
+	closeOnce sync.Once
+	daemons   sync.WaitGroup
 }
 
 func NewIndexedCheckpointer(
@@ -63,8 +69,33 @@ func NewIndexedCheckpointer(
 		return nil, err
 	}
 
+	ret.daemons.Add(2)
+	go ret.writeDaemon()
+	go ret.cleanupDaemon()
+	return ret, nil
+}
+
+// NewIndexedArchiveCheckpointer creates a checkpointer which never deletes
+// old checkpoints so that the state at any height can be reconstructed
+func NewIndexedArchiveCheckpointer(
+	rollupAddr common.Address,
+	databasePath string,
+	maxReorgHeight *big.Int,
+	forceFreshStart bool,
+) (*IndexedCheckpointer, error) {
+	ret, err := newIndexedCheckpointer(
+		rollupAddr,
+		databasePath,
+		new(big.Int).Set(maxReorgHeight),
+		forceFreshStart,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret.daemons.Add(1)
 	go ret.writeDaemon()
-	go cleanupDaemon(ret.bs, ret.db, maxReorgHeight)
 	return ret, nil
 }
 
@@ -92,14 +123,27 @@ func newIndexedCheckpointer(
 	}
 
 	return &IndexedCheckpointer{
-		new(sync.Mutex),
-		cCheckpointer,
-		cCheckpointer.GetBlockStore(),
-		nil,
-		maxReorgHeight,
+		Mutex:          new(sync.Mutex),
+		db:             cCheckpointer,
+		bs:             cCheckpointer.GetBlockStore(),
+		maxReorgHeight: maxReorgHeight,
+		closing:        make(chan struct{}),
 	}, nil
 }
 
+// Close stops the checkpointer after writing the most recent checkpoint
+// passed to AsyncSaveCheckpoint and then closes the underlying storage. The
+// checkpointer must not be used after it's closed
+func (cp *IndexedCheckpointer) Close() {
+	cp.closeOnce.Do(func() {
+		close(cp.closing)
+		cp.daemons.Wait()
+		cp.Lock()
+		defer cp.Unlock()
+		cp.db.CloseCheckpointStorage()
+	})
+}
+
 func (cp *IndexedCheckpointer) Initialize(arbitrumCodeFilePath string) error {
 	return cp.db.Initialize(arbitrumCodeFilePath)
 }
@@ -143,6 +187,14 @@ func (cp *IndexedCheckpointer) AsyncSaveCheckpoint(
 
 	errChan := make(chan error, 1)
 
+	select {
+	case <-cp.closing:
+		errChan <- errCheckpointerClosed
+		close(errChan)
+		return errChan
+	default:
+	}
+
 	if cp.nextCheckpointToWrite != nil {
 		cp.nextCheckpointToWrite.errChan <- errors.New("replaced by newer checkpoint")
 		close(cp.nextCheckpointToWrite.errChan)
@@ -162,6 +214,12 @@ func (cp *IndexedCheckpointer) RestoreLatestState(ctx context.Context, clnt arbb
 	return restoreLatestState(ctx, cp.bs, cp.db, clnt, unmarshalFunc)
 }
 
+// RestoreStateAtOrBefore restores the most recent checkpoint at or below the
+// given height which unmarshalFunc accepts
+func (cp *IndexedCheckpointer) RestoreStateAtOrBefore(ctx context.Context, clnt arbbridge.ChainTimeGetter, height *common.TimeBlocks, unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error) error {
+	return restoreStateAtOrBefore(ctx, cp.bs, cp.db, clnt, height, unmarshalFunc)
+}
+
 func restoreLatestState(
 	ctx context.Context,
 	bs machine.BlockStore,
@@ -172,15 +230,48 @@ func restoreLatestState(
 	if bs.IsBlockStoreEmpty() {
 		return errNoCheckpoint
 	}
+	return restoreStateAtOrBefore(ctx, bs, db, clnt, bs.MaxBlockStoreHeight(), unmarshalFunc)
+}
+
+func restoreStateAtOrBefore(
+	ctx context.Context,
+	bs machine.BlockStore,
+	db machine.CheckpointStorage,
+	clnt arbbridge.ChainTimeGetter,
+	startHeight *common.TimeBlocks,
+	unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error,
+) error {
+	if bs.IsBlockStoreEmpty() {
+		return errNoCheckpoint
+	}
 
-	startHeight := bs.MaxBlockStoreHeight()
+	if maxHeight := bs.MaxBlockStoreHeight(); startHeight.Cmp(maxHeight) > 0 {
+		startHeight = maxHeight
+	}
 	lowestHeight := bs.MinBlockStoreHeight()
 
+	// Walk the local index and only ask the L1 for the canonical block at
+	// heights where a checkpoint was actually saved
 	for height := startHeight; height.Cmp(lowestHeight) >= 0; height = common.NewTimeBlocks(new(big.Int).Sub(height.AsInt(), big.NewInt(1))) {
+		blockIds := bs.BlocksAtHeight(height)
+		if len(blockIds) == 0 {
+			continue
+		}
 		onchainId, err := clnt.BlockIdForHeight(ctx, height)
 		if err != nil {
 			return err
 		}
+		found := false
+		for _, id := range blockIds {
+			if id.Equals(onchainId) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			// Only checkpoints from reorged blocks are at this height
+			continue
+		}
 		blockData, err := bs.GetBlock(onchainId)
 		if err != nil {
 			// If no record was found, try the next block
@@ -201,25 +292,36 @@ func restoreLatestState(
 }
 
 func (cp *IndexedCheckpointer) writeDaemon() {
+	defer cp.daemons.Done()
 	ticker := time.NewTicker(common.NewTimeBlocksInt(2).Duration())
 	defer ticker.Stop()
 	for {
-		<-ticker.C
-		cp.Lock()
-		checkpoint := cp.nextCheckpointToWrite
-		cp.nextCheckpointToWrite = nil
-		cp.Unlock()
-		if checkpoint != nil {
-			err := writeCheckpoint(cp.bs, cp.db, checkpoint)
-			if err != nil {
-				log.Println("Error writing checkpoint: {}", err)
-			}
-			checkpoint.errChan <- err
-			close(checkpoint.errChan)
+		select {
+		case <-cp.closing:
+			// Flush the pending checkpoint so that no progress is lost
+			cp.writePendingCheckpoint()
+			return
+		case <-ticker.C:
+			cp.writePendingCheckpoint()
 		}
 	}
 }
 
+func (cp *IndexedCheckpointer) writePendingCheckpoint() {
+	cp.Lock()
+	checkpoint := cp.nextCheckpointToWrite
+	cp.nextCheckpointToWrite = nil
+	cp.Unlock()
+	if checkpoint != nil {
+		err := writeCheckpoint(cp.bs, cp.db, checkpoint)
+		if err != nil {
+			log.Println("Error writing checkpoint: {}", err)
+		}
+		checkpoint.errChan <- err
+		close(checkpoint.errChan)
+	}
+}
+
 func writeCheckpoint(bs machine.BlockStore, db machine.CheckpointStorage, wc *writableCheckpoint) error {
 	// save values and machines
 	if err := ckptcontext.SaveCheckpointContext(db, wc.ckpCtx); err != nil {
@@ -242,12 +344,17 @@ func writeCheckpoint(bs machine.BlockStore, db machine.CheckpointStorage, wc *wr
 	return nil
 }
 
-func cleanupDaemon(bs machine.BlockStore, db machine.CheckpointStorage, maxReorgHeight *big.Int) {
+func (cp *IndexedCheckpointer) cleanupDaemon() {
+	defer cp.daemons.Done()
 	ticker := time.NewTicker(common.NewTimeBlocksInt(25).Duration())
 	defer ticker.Stop()
 	for {
-		<-ticker.C
-		cleanup(bs, db, maxReorgHeight)
+		select {
+		case <-cp.closing:
+			return
+		case <-ticker.C:
+			cleanup(cp.bs, cp.db, cp.maxReorgHeight)
+		}
 	}
 }
 
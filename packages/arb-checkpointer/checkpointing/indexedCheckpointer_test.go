@@ -358,3 +358,30 @@ func TestCleanup(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCloseFlushesCheckpoint(t *testing.T) {
+	var rollupAddr common.Address
+	cp, err := NewIndexedCheckpointer(rollupAddr, dbPath, maxReorgHeight, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errChan := cp.AsyncSaveCheckpoint(initialEntryBlockId, checkpointData, ckptcontext.NewCheckpointContext())
+	cp.Close()
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-cp.AsyncSaveCheckpoint(laterEntryBlockId, checkpointData2, ckptcontext.NewCheckpointContext()); err != errCheckpointerClosed {
+		t.Error("checkpoint saved after close")
+	}
+
+	cp, err = newIndexedCheckpointer(rollupAddr, dbPath, maxReorgHeight, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.db.CloseCheckpointStorage()
+
+	if _, err := cp.bs.GetBlock(initialEntryBlockId); err != nil {
+		t.Error("pending checkpoint wasn't written on close")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/arboscontracts"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
@@ -33,6 +34,12 @@ type ArbConnection struct {
 	// to the hash of the actual arbitrum transaction sent. This is a stopgap around
 	// abigen support for EIP 155
 	sentTransactions map[ethcommon.Hash]ethcommon.Hash
+	// If set, log subscriptions are streamed from the aggregator's websocket
+	// endpoint instead of being polled
+	subClient *ethclient.Client
+	// If set, transactions the aggregator refuses or doesn't include in time
+	// are sent to the L1 inbox directly
+	fallback *inboxFallback
 }
 
 func Dial(url string, pk *ecdsa.PrivateKey, rollupAddress common.Address) *ArbConnection {
@@ -43,6 +50,24 @@ func Dial(url string, pk *ecdsa.PrivateKey, rollupAddress common.Address) *ArbCo
 	)
 }
 
+// DialWithSubscriptions is the same as Dial, but also connects to the
+// aggregator's websocket endpoint at wsURL which is used to stream logs
+func DialWithSubscriptions(
+	ctx context.Context,
+	url string,
+	wsURL string,
+	pk *ecdsa.PrivateKey,
+	rollupAddress common.Address,
+) (*ArbConnection, error) {
+	subClient, err := ethclient.DialContext(ctx, wsURL)
+	if err != nil {
+		return nil, errors2.Wrap(err, "couldn't connect to websocket endpoint")
+	}
+	conn := Dial(url, pk, rollupAddress)
+	conn.subClient = subClient
+	return conn, nil
+}
+
 func NewArbConnection(connection ValidatorProxy, pk *ecdsa.PrivateKey, rollupAddress common.Address) *ArbConnection {
 	return &ArbConnection{
 		proxy:            connection,
@@ -236,13 +261,19 @@ func (conn *ArbConnection) SendTransaction(ctx context.Context, tx *types.Transa
 	}
 	conn.sentTransactions[tx.Hash()] = signedTx.Hash()
 	txHash, err := conn.proxy.SendTransaction(ctx, signedTx)
-	if err != nil {
-		return err
-	}
-	if txHash.ToEthHash() != signedTx.Hash() {
+	if err == nil && txHash.ToEthHash() != signedTx.Hash() {
 		return errors.New("send transaction returned wrong address")
 	}
-	return nil
+	// Transactions the aggregator rejected as invalid would be rejected from
+	// the inbox as well, so every other failure falls back to the inbox
+	if conn.fallback != nil && (err == nil || (!rejectedAsInvalid(err) && ctx.Err() == nil)) {
+		if err != nil {
+			log.Println("Aggregator didn't accept transaction, sending it to the inbox:", err)
+		}
+		conn.fallback.watch(conn.proxy, signedTx, err == nil)
+		return nil
+	}
+	return err
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -278,6 +309,9 @@ func (conn *ArbConnection) SubscribeFilterLogs(
 	query ethereum.FilterQuery,
 	ch chan<- types.Log,
 ) (ethereum.Subscription, error) {
+	if conn.subClient != nil {
+		return conn.subClient.SubscribeFilterLogs(ctx, query, ch)
+	}
 	return newSubscription(ctx, conn, query, ch), nil
 }
 
@@ -0,0 +1,263 @@
+package goarbitrum
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+// inclusionPollInterval is how often a transaction sent through the
+// aggregator is checked for inclusion before the fallback deadline
+const inclusionPollInterval = 5 * time.Second
+
+// maxFinishedSubmissions is how many submissions which are no longer being
+// watched are kept so that their outcome can still be looked up
+const maxFinishedSubmissions = 1000
+
+type SubmissionPath int
+
+const (
+	// ViaAggregator means the transaction was accepted by the aggregator
+	ViaAggregator SubmissionPath = iota
+	// ViaInbox means the transaction was sent to the L1 inbox directly
+	// because the aggregator was unreachable, refused it or didn't include it
+	// in time
+	ViaInbox
+)
+
+func (p SubmissionPath) String() string {
+	switch p {
+	case ViaAggregator:
+		return "aggregator"
+	case ViaInbox:
+		return "inbox"
+	default:
+		return "unknown"
+	}
+}
+
+// Submission describes how a transaction sent by an ArbConnection with the
+// inbox fallback enabled reached the chain
+type Submission struct {
+	Path SubmissionPath
+	// Included is true once the aggregator reports the transaction's result.
+	// Since a signed transaction has the same id whichever way it's sent,
+	// this covers both paths
+	Included bool
+	// Delivered is the inbox message if the transaction was sent to the
+	// inbox directly and the L1 transaction succeeded
+	Delivered *arbbridge.MessageDeliveredEvent
+	// Err is set if sending the transaction to the inbox failed
+	Err error
+
+	// finished is set once the transaction is no longer being watched
+	finished bool
+}
+
+type inboxFallback struct {
+	ctx          context.Context
+	inbox        arbbridge.GlobalInbox
+	deadline     time.Duration
+	pollInterval time.Duration
+
+	sync.Mutex
+	submissions map[ethcommon.Hash]*Submission
+	// finished holds the submissions which are no longer being watched in
+	// the order they finished so that the oldest can be pruned
+	finished []ethcommon.Hash
+}
+
+// EnableInboxFallback makes the connection send transactions directly to the
+// L1 inbox when the aggregator can't be reached or doesn't include them within
+// deadline or refuses them for its own reasons, such as a full queue.
+// Transactions the aggregator rejects as invalid are returned as errors since
+// ArbOS would reject them as well. inbox must be authenticated with an L1
+// account which can pay for the transactions. Transactions are watched until
+// ctx is cancelled.
+//
+// If a transaction is both included by the aggregator and delivered to the
+// inbox, the second copy is rejected by ArbOS since its nonce was used
+func (conn *ArbConnection) EnableInboxFallback(
+	ctx context.Context,
+	inbox arbbridge.GlobalInbox,
+	deadline time.Duration,
+) {
+	conn.fallback = &inboxFallback{
+		ctx:          ctx,
+		inbox:        inbox,
+		deadline:     deadline,
+		pollInterval: inclusionPollInterval,
+		submissions:  make(map[ethcommon.Hash]*Submission),
+	}
+}
+
+// TransactionSubmission returns how a transaction was sent or nil if it
+// wasn't sent by this connection with the inbox fallback enabled. Only the
+// most recent maxFinishedSubmissions transactions which were included or
+// sent to the inbox are remembered
+func (conn *ArbConnection) TransactionSubmission(ctx context.Context, txHash ethcommon.Hash) *Submission {
+	if conn.fallback == nil {
+		return nil
+	}
+	if realHash, ok := conn.sentTransactions[txHash]; ok {
+		txHash = realHash
+	}
+	sub := conn.fallback.get(txHash)
+	if sub == nil || sub.Included {
+		return sub
+	}
+	if val, err := conn.proxy.GetRequestResult(ctx, common.NewHashFromEth(txHash)); err == nil && val != nil {
+		sub = conn.fallback.finish(txHash, func(sub *Submission) {
+			sub.Included = true
+		})
+	}
+	return sub
+}
+
+// aggregatorUnreachable returns true if err is a failure to reach the
+// aggregator rather than the aggregator rejecting a request
+func aggregatorUnreachable(err error) bool {
+	_, ok := err.(*unreachableError)
+	return ok
+}
+
+// invalidTxErrors are the reasons the aggregator rejects a transaction for
+// which ArbOS would reject it as well
+var invalidTxErrors = []error{
+	core.ErrNonceTooLow,
+	core.ErrInsufficientFunds,
+	types.ErrInvalidSig,
+	types.ErrInvalidChainId,
+}
+
+// rejectedAsInvalid returns true if err is the aggregator rejecting a
+// transaction which would be rejected if it were sent to the inbox, as
+// opposed to the aggregator refusing it for its own reasons. Errors reach the
+// client as messages so they're compared by message
+func rejectedAsInvalid(err error) bool {
+	if aggregatorUnreachable(err) {
+		return false
+	}
+	for _, invalidErr := range invalidTxErrors {
+		if err.Error() == invalidErr.Error() {
+			return true
+		}
+	}
+	return false
+}
+
+// watch tracks tx until it's included or sent to the inbox. If the aggregator
+// accepted it, it's given until the deadline to be included before it's sent
+// to the inbox
+func (f *inboxFallback) watch(proxy ValidatorProxy, tx *types.Transaction, accepted bool) {
+	txHash := tx.Hash()
+	f.Lock()
+	f.submissions[txHash] = &Submission{Path: ViaAggregator}
+	f.Unlock()
+
+	go func() {
+		if accepted && f.waitForInclusion(proxy, txHash) {
+			f.finish(txHash, func(sub *Submission) {
+				sub.Included = true
+			})
+			return
+		}
+		if err := f.ctx.Err(); err != nil {
+			f.finish(txHash, func(sub *Submission) {
+				sub.Err = err
+			})
+			return
+		}
+		if accepted {
+			log.Println("Transaction", txHash.Hex(), "wasn't included by the aggregator, sending it to the inbox")
+		}
+		ev, err := f.sendToInbox(tx)
+		if err != nil {
+			log.Println("Error sending transaction", txHash.Hex(), "to the inbox:", err)
+		}
+		f.finish(txHash, func(sub *Submission) {
+			sub.Path = ViaInbox
+			sub.Delivered = ev
+			sub.Err = err
+		})
+	}()
+}
+
+func (f *inboxFallback) waitForInclusion(proxy ValidatorProxy, txHash ethcommon.Hash) bool {
+	ctx, cancel := context.WithTimeout(f.ctx, f.deadline)
+	defer cancel()
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+	for {
+		val, err := proxy.GetRequestResult(ctx, common.NewHashFromEth(txHash))
+		if err == nil && val != nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *inboxFallback) sendToInbox(tx *types.Transaction) (*arbbridge.MessageDeliveredEvent, error) {
+	msg, err := message.NewL2Message(message.SignedTransaction{Tx: tx})
+	if err != nil {
+		return nil, err
+	}
+	ev, err := f.inbox.SendL2Message(f.ctx, msg.AsData())
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+func (f *inboxFallback) get(txHash ethcommon.Hash) *Submission {
+	f.Lock()
+	defer f.Unlock()
+	sub, ok := f.submissions[txHash]
+	if !ok {
+		return nil
+	}
+	ret := *sub
+	return &ret
+}
+
+// finish applies change to the submission of txHash and stops it from being
+// watched. Once more than maxFinishedSubmissions have finished, the oldest is
+// removed. It returns a copy of the result
+func (f *inboxFallback) finish(txHash ethcommon.Hash, change func(sub *Submission)) *Submission {
+	f.Lock()
+	defer f.Unlock()
+	sub, ok := f.submissions[txHash]
+	if !ok {
+		return nil
+	}
+	change(sub)
+	ret := *sub
+	if sub.finished {
+		return &ret
+	}
+	sub.finished = true
+	ret.finished = true
+	f.finished = append(f.finished, txHash)
+	if len(f.finished) > maxFinishedSubmissions {
+		oldest := f.finished[0]
+		f.finished = f.finished[1:]
+		// The transaction may have been sent again since it finished
+		if old, ok := f.submissions[oldest]; ok && old.finished {
+			delete(f.submissions, oldest)
+		}
+	}
+	return &ret
+}
@@ -0,0 +1,290 @@
+package goarbitrum
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+// testAggregator speaks the aggregator's json-rpc protocol. It accepts every
+// transaction unless rejectWith or status is set and reports them as
+// included once included is set
+type testAggregator struct {
+	sync.Mutex
+	rejectWith string
+	status     int
+	included   bool
+}
+
+func (a *testAggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+	if a.status != 0 {
+		w.WriteHeader(a.status)
+		return
+	}
+	var req struct {
+		Method string                     `json:"method"`
+		Params [1]evm.SendTransactionArgs `json:"params"`
+		ID     json.RawMessage            `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result interface{}
+	var errMessage interface{}
+	switch req.Method {
+	case Namespace + ".SendTransaction":
+		if a.rejectWith != "" {
+			errMessage = a.rejectWith
+		} else if tx, err := decodeTestTx(req.Params[0].SignedTransaction); err != nil {
+			errMessage = err.Error()
+		} else {
+			result = &evm.SendTransactionReply{TransactionHash: tx.Hash().Hex()}
+		}
+	case Namespace + ".GetRequestResult":
+		reply := &evm.GetRequestResultReply{}
+		if a.included {
+			var buf bytes.Buffer
+			_ = value.MarshalValue(value.NewInt64Value(0), &buf)
+			reply.RawVal = hexutil.Encode(buf.Bytes())
+		}
+		result = reply
+	default:
+		errMessage = "unexpected method " + req.Method
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": result,
+		"error":  errMessage,
+		"id":     req.ID,
+	})
+}
+
+func decodeTestTx(data string) (*types.Transaction, error) {
+	txData, err := hexutil.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	return tx, rlp.DecodeBytes(txData, tx)
+}
+
+func (a *testAggregator) setIncluded() {
+	a.Lock()
+	defer a.Unlock()
+	a.included = true
+}
+
+// testInbox records the messages sent to it. Calls to any other method panic
+type testInbox struct {
+	arbbridge.GlobalInbox
+	sent chan []byte
+}
+
+func (i *testInbox) SendL2Message(ctx context.Context, data []byte) (arbbridge.MessageDeliveredEvent, error) {
+	i.sent <- data
+	return arbbridge.MessageDeliveredEvent{}, nil
+}
+
+func newFallbackTestConnection(t *testing.T, agg *testAggregator, deadline time.Duration) (*ArbConnection, *testInbox, *httptest.Server, func()) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(agg)
+	ctx, cancel := context.WithCancel(context.Background())
+	inbox := &testInbox{sent: make(chan []byte, 1)}
+	conn := NewArbConnection(NewValidatorProxyImpl(server.URL), key, common.Address{})
+	conn.EnableInboxFallback(ctx, inbox, deadline)
+	conn.fallback.pollInterval = 10 * time.Millisecond
+	return conn, inbox, server, func() {
+		cancel()
+		server.Close()
+	}
+}
+
+func sendTestTx(t *testing.T, conn *ArbConnection) (ethcommon.Hash, error) {
+	t.Helper()
+	tx := types.NewTransaction(0, ethcommon.Address{1}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	err := conn.SendTransaction(context.Background(), tx)
+	// The connection signs the transaction and TransactionSubmission accepts
+	// either hash
+	return tx.Hash(), err
+}
+
+func waitForInbox(t *testing.T, inbox *testInbox) {
+	t.Helper()
+	select {
+	case <-inbox.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transaction wasn't sent to the inbox")
+	}
+}
+
+func waitForSubmission(t *testing.T, conn *ArbConnection, txHash ethcommon.Hash, done func(*Submission) bool) *Submission {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		sub := conn.TransactionSubmission(context.Background(), txHash)
+		if sub != nil && done(sub) {
+			return sub
+		}
+	}
+	t.Fatal("submission didn't finish")
+	return nil
+}
+
+func TestFallbackRejected(t *testing.T) {
+	for _, rejection := range invalidTxErrors {
+		t.Run(rejection.Error(), func(t *testing.T) {
+			agg := &testAggregator{rejectWith: rejection.Error()}
+			conn, inbox, _, cleanup := newFallbackTestConnection(t, agg, time.Hour)
+			defer cleanup()
+
+			txHash, err := sendTestTx(t, conn)
+			if err == nil || err.Error() != agg.rejectWith {
+				t.Fatal("rejection wasn't returned", err)
+			}
+			if conn.TransactionSubmission(context.Background(), txHash) != nil {
+				t.Error("rejected transaction is being watched")
+			}
+			select {
+			case <-inbox.sent:
+				t.Error("rejected transaction was sent to the inbox")
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestFallbackRefused(t *testing.T) {
+	for _, refusal := range []string{"transaction queue is full", "tx aggregator is not running"} {
+		t.Run(refusal, func(t *testing.T) {
+			conn, inbox, _, cleanup := newFallbackTestConnection(t, &testAggregator{rejectWith: refusal}, time.Hour)
+			defer cleanup()
+
+			txHash, err := sendTestTx(t, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitForInbox(t, inbox)
+			sub := waitForSubmission(t, conn, txHash, func(sub *Submission) bool { return sub.finished })
+			if sub.Path != ViaInbox || sub.Delivered == nil || sub.Err != nil {
+				t.Errorf("wrong submission %+v", sub)
+			}
+		})
+	}
+}
+
+func TestFallbackUnreachable(t *testing.T) {
+	tests := []struct {
+		name      string
+		makeAgg   func() *testAggregator
+		closeConn bool
+	}{
+		{"connection refused", func() *testAggregator { return &testAggregator{} }, true},
+		{"unavailable", func() *testAggregator { return &testAggregator{status: http.StatusServiceUnavailable} }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, inbox, server, cleanup := newFallbackTestConnection(t, test.makeAgg(), time.Hour)
+			defer cleanup()
+			if test.closeConn {
+				server.Close()
+			}
+
+			txHash, err := sendTestTx(t, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitForInbox(t, inbox)
+			sub := waitForSubmission(t, conn, txHash, func(sub *Submission) bool { return sub.finished })
+			if sub.Path != ViaInbox || sub.Delivered == nil || sub.Err != nil {
+				t.Errorf("wrong submission %+v", sub)
+			}
+		})
+	}
+}
+
+func TestFallbackInclusionTimeout(t *testing.T) {
+	conn, inbox, _, cleanup := newFallbackTestConnection(t, &testAggregator{}, 50*time.Millisecond)
+	defer cleanup()
+
+	txHash, err := sendTestTx(t, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForInbox(t, inbox)
+	sub := waitForSubmission(t, conn, txHash, func(sub *Submission) bool { return sub.finished })
+	if sub.Path != ViaInbox || sub.Delivered == nil {
+		t.Errorf("wrong submission %+v", sub)
+	}
+}
+
+func TestFallbackIncluded(t *testing.T) {
+	agg := &testAggregator{}
+	conn, inbox, _, cleanup := newFallbackTestConnection(t, agg, time.Hour)
+	defer cleanup()
+
+	txHash, err := sendTestTx(t, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.setIncluded()
+	sub := waitForSubmission(t, conn, txHash, func(sub *Submission) bool { return sub.Included })
+	if sub.Path != ViaAggregator || !sub.finished {
+		t.Errorf("wrong submission %+v", sub)
+	}
+	select {
+	case <-inbox.sent:
+		t.Error("included transaction was sent to the inbox")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFallbackPrunesFinished(t *testing.T) {
+	f := &inboxFallback{submissions: make(map[ethcommon.Hash]*Submission)}
+	pending := ethcommon.Hash{0xff}
+	f.submissions[pending] = &Submission{}
+	var hashes []ethcommon.Hash
+	for i := 0; i <= maxFinishedSubmissions; i++ {
+		txHash := ethcommon.BigToHash(big.NewInt(int64(i)))
+		f.submissions[txHash] = &Submission{}
+		f.finish(txHash, func(sub *Submission) {
+			sub.Included = true
+		})
+		// Finishing twice doesn't count the submission again
+		f.finish(txHash, func(sub *Submission) {})
+		hashes = append(hashes, txHash)
+	}
+	if f.get(hashes[0]) != nil {
+		t.Error("oldest finished submission wasn't pruned")
+	}
+	if f.get(hashes[1]) == nil || f.get(hashes[maxFinishedSubmissions]) == nil {
+		t.Error("pruned too many submissions")
+	}
+	if f.get(pending) == nil {
+		t.Error("pruned submission which is still being watched")
+	}
+	if len(f.submissions) != maxFinishedSubmissions+1 {
+		t.Error("kept", len(f.submissions), "submissions")
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/gorilla/rpc v1.2.0
 	github.com/offchainlabs/arbitrum/packages/arb-evm v0.7.1
 	github.com/offchainlabs/arbitrum/packages/arb-util v0.7.1
+	github.com/offchainlabs/arbitrum/packages/arb-validator-core v0.7.1
 	github.com/pkg/errors v0.9.1
 )
 
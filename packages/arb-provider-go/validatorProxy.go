@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -85,6 +86,16 @@ func (vp *ValidatorProxyImpl) SendTransaction(ctx context.Context, tx *types.Tra
 	return common.HexToHash(response.TransactionHash), nil
 }
 
+// unreachableError is returned when a request doesn't get a reply from the
+// aggregator itself, as opposed to an error the aggregator replied with
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return e.err.Error()
+}
+
 func (vp *ValidatorProxyImpl) doCall(ctx context.Context, methodName string, request interface{}, response interface{}) error {
 	msg, err := json.EncodeClientRequest(Namespace+"."+methodName, request)
 	if err != nil {
@@ -101,9 +112,12 @@ func (vp *ValidatorProxyImpl) doCall(ctx context.Context, methodName string, req
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Println("doCall error:", err)
-		return err
+		return &unreachableError{err}
 	}
 	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &unreachableError{fmt.Errorf("aggregator returned %v", resp.Status)}
+	}
 	ret := json.DecodeClientResponse(resp.Body, response)
 	if ret != nil {
 		log.Println("ValProxy.doCall: error in json.Dec from", methodName, ":", ret)
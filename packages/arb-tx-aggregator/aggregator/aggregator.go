@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum/trie"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
@@ -30,10 +31,13 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/gasprice"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
@@ -43,24 +47,31 @@ import (
 type Server struct {
 	client      ethutils.EthClient
 	chain       common.Address
-	batch       *batcher.Batcher
+	batch       batcher.TransactionBatcher
 	db          *txdb.TxDB
+	oracle      *gasprice.Oracle
 	maxCallTime time.Duration
 	maxCallGas  *big.Int
+
+	// maxLogBlockRange and maxLogResults limit log queries when non-zero
+	maxLogBlockRange uint64
+	maxLogResults    int
 }
 
 // NewServer returns a new instance of the Server class
 func NewServer(
 	client ethutils.EthClient,
-	batch *batcher.Batcher,
+	batch batcher.TransactionBatcher,
 	rollupAddress common.Address,
 	db *txdb.TxDB,
+	oracle *gasprice.Oracle,
 ) *Server {
 	return &Server{
 		client:      client,
 		chain:       rollupAddress,
 		batch:       batch,
 		db:          db,
+		oracle:      oracle,
 		maxCallTime: 0,
 		maxCallGas:  big.NewInt(100000000),
 	}
@@ -72,6 +83,19 @@ func (m *Server) SendTransaction(tx *types.Transaction) (common.Hash, error) {
 	return m.batch.SendTransaction(tx)
 }
 
+// SetLogLimits bounds the number of blocks a log query can cover and the
+// number of logs it can return. Zero means there is no limit
+func (m *Server) SetLogLimits(maxBlockRange uint64, maxResults int) {
+	m.maxLogBlockRange = maxBlockRange
+	m.maxLogResults = maxResults
+}
+
+// MaxLogBlockRange returns the most blocks a log query can cover or zero if
+// there is no limit
+func (m *Server) MaxLogBlockRange() uint64 {
+	return m.maxLogBlockRange
+}
+
 //FindLogs takes a set of parameters and return the list of all logs that match
 //the query
 func (m *Server) FindLogs(ctx context.Context, fromHeight, toHeight *uint64, addresses []ethcommon.Address, topics [][]ethcommon.Hash) ([]evm.FullLog, error) {
@@ -80,13 +104,35 @@ func (m *Server) FindLogs(ctx context.Context, fromHeight, toHeight *uint64, add
 		topicGroups = append(topicGroups, common.HashArrayFromEth(group))
 	}
 
-	return m.db.FindLogs(
+	if m.maxLogBlockRange > 0 {
+		startHeight := uint64(0)
+		if fromHeight != nil {
+			startHeight = *fromHeight
+		}
+		endHeight := m.GetBlockCount()
+		if toHeight != nil && *toHeight < endHeight {
+			endHeight = *toHeight
+		}
+		if endHeight >= startHeight && endHeight-startHeight+1 > m.maxLogBlockRange {
+			return nil, fmt.Errorf("log query exceeds the maximum range of %v blocks", m.maxLogBlockRange)
+		}
+	}
+
+	logs, err := m.db.FindLogs(
 		ctx,
 		fromHeight,
 		toHeight,
 		common.AddressArrayFromEth(addresses),
 		topicGroups,
+		m.maxLogResults,
 	)
+	if err == txdb.ErrTooManyLogs {
+		return nil, fmt.Errorf("log query returned more than %v results", m.maxLogResults)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
 }
 
 func (m *Server) GetBlockCount() uint64 {
@@ -251,6 +297,15 @@ func GetTransaction(msg evm.IncomingRequest) (*types.Transaction, error) {
 	return ethMsg.AsEthTx(), nil
 }
 
+// SuggestGasPrice returns the gas price recommended by the gas price oracle
+func (m *Server) SuggestGasPrice() *big.Int {
+	return m.oracle.SuggestGasPrice()
+}
+
+func (m *Server) FeeHistory(blockCount uint64, newestBlock uint64, percentiles []float64) (*gasprice.FeeHistory, error) {
+	return m.oracle.FeeHistory(blockCount, newestBlock, percentiles)
+}
+
 func (m *Server) AdjustGas(msg message.ContractTransaction) message.ContractTransaction {
 	if msg.MaxGas.Cmp(big.NewInt(0)) == 0 || msg.MaxGas.Cmp(m.maxCallGas) > 0 {
 		msg.MaxGas = m.maxCallGas
@@ -277,10 +332,10 @@ func (m *Server) GetSnapshot(ctx context.Context, blockHeight uint64) (*snapshot
 	if err != nil {
 		return nil, err
 	}
-	return m.db.GetSnapshot(inbox.ChainTime{
+	return m.db.GetSnapshot(ctx, inbox.ChainTime{
 		BlockNum:  common.NewTimeBlocks(height),
 		Timestamp: new(big.Int).SetUint64(header.Time),
-	}), nil
+	})
 }
 
 func (m *Server) LatestSnapshot() *snapshot.Snapshot {
@@ -291,6 +346,24 @@ func (m *Server) PendingSnapshot() *snapshot.Snapshot {
 	return m.batch.PendingSnapshot()
 }
 
+// GetTransactionStatus returns the last known state of a transaction sent to
+// this aggregator or nil if the transaction is unknown
+func (m *Server) GetTransactionStatus(txHash ethcommon.Hash) (*txindex.Entry, error) {
+	return m.batch.TransactionStatus(txHash)
+}
+
+func (m *Server) QueueStats() batcher.QueueStats {
+	return m.batch.QueueStats()
+}
+
 func (m *Server) PendingTransactionCount(account common.Address) *uint64 {
 	return m.batch.PendingTransactionCount(account)
 }
+
+func (m *Server) SubscribeBlockEvents(ch chan<- *txdb.BlockEvent) event.Subscription {
+	return m.db.SubscribeBlockEvents(ch)
+}
+
+func (m *Server) SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription {
+	return m.batch.SubscribeNewTransactions(ch)
+}
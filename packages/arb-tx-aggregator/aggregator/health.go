@@ -0,0 +1,120 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds how long a health check waits for the L1 node
+const healthCheckTimeout = 5 * time.Second
+
+// HealthStatus reports how far the aggregator is behind L1 and whether it's
+// able to accept transactions
+type HealthStatus struct {
+	// L1Head is the latest L1 block or nil if the L1 node couldn't be reached
+	L1Head *uint64 `json:"l1Head"`
+	// LatestBlock is the latest L1 block whose messages have been processed
+	LatestBlock uint64 `json:"latestBlock"`
+	// SyncStart is the block processing last started from after a restart
+	SyncStart *uint64 `json:"syncStart,omitempty"`
+	// AtHead is set once the aggregator has caught up with L1
+	AtHead       bool `json:"atHead"`
+	BatcherValid bool `json:"batcherValid"`
+	// LastBatchReceipt is when a batch was last confirmed on L1
+	LastBatchReceipt *time.Time `json:"lastBatchReceipt,omitempty"`
+	Error            string     `json:"error,omitempty"`
+}
+
+// Healthy returns an error if the aggregator has failed in a way that
+// requires it to be restarted
+func (s *HealthStatus) Healthy() error {
+	if !s.BatcherValid {
+		return errors.New("batcher failed")
+	}
+	return nil
+}
+
+// Ready returns an error if the aggregator shouldn't be sent requests
+func (s *HealthStatus) Ready() error {
+	if err := s.Healthy(); err != nil {
+		return err
+	}
+	if s.L1Head == nil {
+		return errors.New("can't reach L1 node")
+	}
+	if !s.AtHead {
+		return errors.New("catching up with L1")
+	}
+	return nil
+}
+
+func (m *Server) HealthStatus(ctx context.Context) *HealthStatus {
+	status := &HealthStatus{
+		AtHead:       m.db.IsAtHead(),
+		BatcherValid: m.batch.Valid(),
+	}
+	if latest := m.db.LatestBlockId(); latest != nil {
+		status.LatestBlock = latest.Height.AsInt().Uint64()
+	}
+	if start := m.db.SyncStart(); start != nil {
+		syncStart := start.AsInt().Uint64()
+		status.SyncStart = &syncStart
+	}
+	if lastReceipt := m.batch.LastBatchReceipt(); !lastReceipt.IsZero() {
+		status.LastBatchReceipt = &lastReceipt
+	}
+	header, err := m.client.HeaderByNumber(ctx, nil)
+	if err == nil {
+		l1Head := header.Number.Uint64()
+		status.L1Head = &l1Head
+	}
+	return status
+}
+
+// HealthHandler serves the aggregator's health status. It responds with
+// status 503 if the aggregator needs to be restarted
+func HealthHandler(m *Server) http.Handler {
+	return healthHandler(m, (*HealthStatus).Healthy)
+}
+
+// ReadyHandler serves the aggregator's health status. It responds with
+// status 503 if the aggregator is still catching up or otherwise shouldn't
+// be sent requests
+func ReadyHandler(m *Server) http.Handler {
+	return healthHandler(m, (*HealthStatus).Ready)
+}
+
+func healthHandler(m *Server, check func(*HealthStatus) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+		status := m.HealthStatus(ctx)
+		code := http.StatusOK
+		if err := check(status); err != nil {
+			status.Error = err.Error()
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
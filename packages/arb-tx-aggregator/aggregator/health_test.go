@@ -0,0 +1,209 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/checkpointing"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/membridge"
+)
+
+// healthBatcher reports a fixed batcher state. Calls to any other method
+// panic
+type healthBatcher struct {
+	batcher.TransactionBatcher
+	valid       bool
+	lastReceipt time.Time
+}
+
+func (b *healthBatcher) Valid() bool {
+	return b.valid
+}
+
+func (b *healthBatcher) LastBatchReceipt() time.Time {
+	return b.lastReceipt
+}
+
+// healthL1Client reports a fixed L1 head or fails if head is nil
+type healthL1Client struct {
+	ethutils.EthClient
+	head *big.Int
+}
+
+func (c *healthL1Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if c.head == nil {
+		return nil, errors.New("L1 node unreachable")
+	}
+	return &types.Header{Number: c.head}, nil
+}
+
+// newHealthTestServer returns a server whose database has processed the
+// current block of a fresh chain. The returned function removes the database
+func newHealthTestServer(t *testing.T, l1 *healthL1Client, batch *healthBatcher) (*Server, *txdb.TxDB, func()) {
+	t.Helper()
+	ctx := context.Background()
+	dbPath, err := ioutil.TempDir("", "health-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := checkpointing.NewIndexedCheckpointer(common.RandAddress(), dbPath, big.NewInt(100), true)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		cp.Close()
+		os.RemoveAll(dbPath)
+	}
+	if err := cp.Initialize(arbos.Path()); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	clnt := membridge.NewArbClient(membridge.NewChain())
+	db, err := txdb.New(ctx, clnt, cp, cp.GetAggregatorStore(), common.RandAddress(), nil)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	blockId, err := clnt.CurrentBlockId(ctx)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := db.AddMessages(ctx, nil, blockId); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return NewServer(l1, batch, common.RandAddress(), db, nil), db, cleanup
+}
+
+func TestHealthStatus(t *testing.T) {
+	ctx := context.Background()
+	l1 := &healthL1Client{}
+	receipt := time.Unix(1600000000, 0)
+	srv, db, cleanup := newHealthTestServer(t, l1, &healthBatcher{valid: true, lastReceipt: receipt})
+	defer cleanup()
+	latest := db.LatestBlockId().Height.AsInt().Uint64()
+
+	status := srv.HealthStatus(ctx)
+	if status.L1Head != nil {
+		t.Error("unreachable L1 node reported head", *status.L1Head)
+	}
+	if status.LatestBlock != latest || status.SyncStart != nil || status.AtHead {
+		t.Error("wrong status before catching up", status.LatestBlock, status.SyncStart, status.AtHead)
+	}
+	if status.LastBatchReceipt == nil || !status.LastBatchReceipt.Equal(receipt) {
+		t.Error("wrong last batch receipt", status.LastBatchReceipt)
+	}
+	if err := status.Healthy(); err != nil {
+		t.Error("valid aggregator isn't healthy:", err)
+	}
+	if err := status.Ready(); err == nil {
+		t.Error("aggregator without L1 node is ready")
+	}
+
+	l1.head = big.NewInt(int64(latest) + 10)
+	db.StartCatchup()
+	status = srv.HealthStatus(ctx)
+	if status.L1Head == nil || *status.L1Head != latest+10 {
+		t.Error("wrong L1 head", status.L1Head)
+	}
+	if status.SyncStart == nil || *status.SyncStart != latest {
+		t.Error("wrong sync start", status.SyncStart)
+	}
+	if err := status.Ready(); err == nil {
+		t.Error("aggregator catching up is ready")
+	}
+
+	db.NowAtHead()
+	if !db.IsAtHead() {
+		t.Fatal("database isn't at head")
+	}
+	if err := srv.HealthStatus(ctx).Ready(); err != nil {
+		t.Error("aggregator at head isn't ready:", err)
+	}
+
+	// Restarting from a checkpoint makes the aggregator catch up again
+	db.StartCatchup()
+	if db.IsAtHead() {
+		t.Error("database at head after restarting catch up")
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		valid        bool
+		atHead       bool
+		healthStatus int
+		readyStatus  int
+	}{
+		{"ready", true, true, http.StatusOK, http.StatusOK},
+		{"catching up", true, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"batcher failed", false, true, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, db, cleanup := newHealthTestServer(t, &healthL1Client{head: big.NewInt(1)}, &healthBatcher{valid: test.valid})
+			defer cleanup()
+			if test.atHead {
+				db.NowAtHead()
+			}
+			for _, check := range []struct {
+				handler http.Handler
+				status  int
+			}{
+				{HealthHandler(srv), test.healthStatus},
+				{ReadyHandler(srv), test.readyStatus},
+			} {
+				rec := httptest.NewRecorder()
+				check.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+				if rec.Code != check.status {
+					t.Error("responded with status", rec.Code, "but expected", check.status)
+				}
+				var status HealthStatus
+				if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+					t.Fatal(err)
+				}
+				if (status.Error == "") != (check.status == http.StatusOK) {
+					t.Errorf("status %v has error %q", rec.Code, status.Error)
+				}
+				if status.BatcherValid != test.valid || status.AtHead != test.atHead {
+					t.Error("wrong status", status.BatcherValid, status.AtHead)
+				}
+			}
+		})
+	}
+}
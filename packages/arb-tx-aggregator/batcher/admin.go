@@ -0,0 +1,164 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+)
+
+// The methods in this file let an operator inspect and control a running
+// batcher
+
+var ErrTxNotQueued = errors.New("transaction is not queued")
+
+// QueuedTransactions returns the queued transactions of each account in
+// nonce order
+func (m *Batcher) QueuedTransactions() map[ethcommon.Address][]QueuedTx {
+	m.Lock()
+	defer m.Unlock()
+	queued := make(map[ethcommon.Address][]QueuedTx, len(m.queuedTxes.queues))
+	for account, queue := range m.queuedTxes.queues {
+		txes := make([]QueuedTx, 0, len(queue.txesByNonce))
+		for _, tx := range queue.txesByNonce {
+			txes = append(txes, tx)
+		}
+		sort.Slice(txes, func(i, j int) bool {
+			return txes[i].Tx.Nonce() < txes[j].Tx.Nonce()
+		})
+		queued[account] = txes
+	}
+	return queued
+}
+
+// DropTransaction removes a queued transaction so that it's never batched,
+// along with the account's later queued transactions which can't be included
+// without it. It returns the hashes of every removed transaction in nonce
+// order. Transactions which have already been added to a batch can't be
+// dropped
+func (m *Batcher) DropTransaction(txHash ethcommon.Hash) ([]ethcommon.Hash, error) {
+	m.Lock()
+	defer m.Unlock()
+	for account, queue := range m.queuedTxes.queues {
+		for nonce, tx := range queue.txesByNonce {
+			if tx.Tx.Hash() != txHash {
+				continue
+			}
+			dropped := m.queuedTxes.removeFrom(account, nonce, "dropped by operator")
+			m.markDropped(dropped)
+			hashes := make([]ethcommon.Hash, 0, len(dropped))
+			for _, d := range dropped {
+				hashes = append(hashes, d.tx.Hash())
+			}
+			return hashes, nil
+		}
+	}
+	return nil, ErrTxNotQueued
+}
+
+// FlushBatch sends the pending batch immediately, even if posting is paused,
+// and returns the number of transactions it contained
+func (m *Batcher) FlushBatch() int {
+	m.Lock()
+	defer m.Unlock()
+	count := len(m.pendingBatch.appliedTxes)
+	log.Println("Flushing pending batch with", count, "transactions")
+	m.sendBatch(m.ctx)
+	return count
+}
+
+// SetPaused stops or resumes sending new batches. Transactions are still
+// accepted into the queue and batches which were already sent are still
+// confirmed and resent while posting is paused
+func (m *Batcher) SetPaused(paused bool) {
+	m.Lock()
+	defer m.Unlock()
+	if paused != m.paused {
+		log.Println("Batch posting paused:", paused)
+	}
+	m.paused = paused
+}
+
+func (m *Batcher) Paused() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.paused
+}
+
+// SetMaxBatchTime changes how long a batch which isn't full waits before it's
+// sent. It doesn't change how often sent batches are checked for receipts
+func (m *Batcher) SetMaxBatchTime(maxBatchTime time.Duration) error {
+	if maxBatchTime <= 0 {
+		return errors.New("max batch time must be positive")
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.maxBatchTime = maxBatchTime
+	return nil
+}
+
+func (m *Batcher) MaxBatchTime() time.Duration {
+	m.Lock()
+	defer m.Unlock()
+	return m.maxBatchTime
+}
+
+// SentBatch is a batch which was sent to L1 but hasn't been confirmed yet
+type SentBatch struct {
+	*txindex.Batch
+	// SentAt is when the batch was first sent or the zero time if it was sent
+	// before the aggregator restarted
+	SentAt time.Time
+}
+
+// PendingSentBatches returns the batches waiting for confirmation in the
+// order they were sent
+func (m *Batcher) PendingSentBatches() []SentBatch {
+	m.Lock()
+	defer m.Unlock()
+	batches := make([]SentBatch, 0, m.pendingSentBatches.Len())
+	for e := m.pendingSentBatches.Front(); e != nil; e = e.Next() {
+		batch := e.Value.(*txindex.Batch)
+		batches = append(batches, SentBatch{
+			Batch: &txindex.Batch{
+				Seq:     batch.Seq,
+				TxHash:  batch.TxHash,
+				L1Block: batch.L1Block,
+				Txes:    batch.Txes,
+				From:    batch.From,
+				Nonce:   batch.Nonce,
+			},
+			SentAt: m.batchSentAt[batch.Seq],
+		})
+	}
+	return batches
+}
+
+// PendingBatchTransactions returns the transactions which have been added to
+// the batch that hasn't been sent yet
+func (m *Batcher) PendingBatchTransactions() []*types.Transaction {
+	m.Lock()
+	defer m.Unlock()
+	return append([]*types.Transaction(nil), m.pendingBatch.appliedTxes...)
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
+)
+
+// adminInbox records the batches sent to it and serves the messages in
+// delivered, keyed by L1 block. Calls to any other method panic
+type adminInbox struct {
+	arbbridge.GlobalInbox
+	ctxs      []context.Context
+	batches   [][]byte
+	delivered map[uint64][]byte
+	// queries records the block ranges of calls to GetDeliveredEvents
+	queries [][2]uint64
+}
+
+func (i *adminInbox) GetDeliveredEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int) ([]arbbridge.MessageDeliveredEvent, error) {
+	i.queries = append(i.queries, [2]uint64{fromBlock.Uint64(), toBlock.Uint64()})
+	var events []arbbridge.MessageDeliveredEvent
+	for height := fromBlock.Uint64(); height <= toBlock.Uint64(); height++ {
+		if data, ok := i.delivered[height]; ok {
+			events = append(events, arbbridge.MessageDeliveredEvent{Message: inbox.InboxMessage{Data: data}})
+		}
+	}
+	return events, nil
+}
+
+func (i *adminInbox) SendL2MessageNoWait(ctx context.Context, data []byte) (common.Hash, error) {
+	i.ctxs = append(i.ctxs, ctx)
+	i.batches = append(i.batches, data)
+	return common.Hash{1}, nil
+}
+
+// adminL1Client reports a fixed L1 head and doesn't know any transactions
+type adminL1Client struct {
+	ethutils.EthClient
+}
+
+func (c *adminL1Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(10)}, nil
+}
+
+func (c *adminL1Client) TransactionByHash(ctx context.Context, txHash ethcommon.Hash) (*types.Transaction, bool, error) {
+	return nil, false, errors.New("not found")
+}
+
+func newAdminTestBatcher(t *testing.T, ctx context.Context) (*Batcher, *adminInbox, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "batcher-admin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txIndex, err := txindex.Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	inbox := &adminInbox{}
+	m := &Batcher{
+		signer:             testSigner,
+		client:             &adminL1Client{},
+		globalInbox:        inbox,
+		maxBatchSize:       DefaultConfig.MaxBatchSize,
+		txIndex:            txIndex,
+		valid:              true,
+		maxBatchTime:       time.Second,
+		queuedTxes:         newTxQueues(QueueConfig{}),
+		pendingBatch:       newPendingBatch(nil, DefaultConfig.MaxBatchSize, testSigner),
+		pendingSentBatches: list.New(),
+		batchSentAt:        make(map[uint64]time.Time),
+		batchRetries:       make(map[uint64]int),
+		ctx:                ctx,
+	}
+	return m, inbox, func() {
+		_ = txIndex.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFlushBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, inbox, cleanup := newAdminTestBatcher(t, ctx)
+	defer cleanup()
+	m.SetPaused(true)
+
+	if count := m.FlushBatch(); count != 0 || len(inbox.batches) != 0 {
+		t.Fatal("empty batch was sent")
+	}
+
+	key, _ := newTestKey(t)
+	txes := []*types.Transaction{signedTx(t, key, 0, 1), signedTx(t, key, 1, 1)}
+	m.pendingBatch.appliedTxes = txes
+	if count := m.FlushBatch(); count != len(txes) {
+		t.Error("flushed", count, "transactions but expected", len(txes))
+	}
+	if len(inbox.batches) != 1 {
+		t.Fatal("flushing sent", len(inbox.batches), "batches")
+	}
+	// The batch is sent with the batcher's context so that it isn't
+	// cancelled when the admin request finishes
+	if inbox.ctxs[0] != ctx {
+		t.Error("batch wasn't sent with the batcher's context")
+	}
+	if len(m.pendingBatch.appliedTxes) != 0 {
+		t.Error("pending batch wasn't reset")
+	}
+
+	sent := m.PendingSentBatches()
+	if len(sent) != 1 {
+		t.Fatal("expected 1 sent batch but got", len(sent))
+	}
+	if sent[0].TxHash != (common.Hash{1}).ToEthHash() || sent[0].L1Block != 10 || len(sent[0].Txes) != len(txes) {
+		t.Error("wrong sent batch", sent[0].TxHash.Hex(), sent[0].L1Block, len(sent[0].Txes))
+	}
+	entry, err := m.txIndex.Get(txes[0].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || entry.Status != txindex.Batched {
+		t.Error("flushed transaction isn't marked batched", entry)
+	}
+}
+
+func TestDropTransactionRemovesLaterNonces(t *testing.T) {
+	m, _, cleanup := newAdminTestBatcher(t, context.Background())
+	defer cleanup()
+	key, account := newTestKey(t)
+	var txes []*types.Transaction
+	for nonce := uint64(0); nonce < 4; nonce++ {
+		tx := signedTx(t, key, nonce, 1)
+		admit(t, m.queuedTxes, tx)
+		if err := m.txIndex.MarkQueued(tx); err != nil {
+			t.Fatal(err)
+		}
+		txes = append(txes, tx)
+	}
+
+	// Dropping a stuck nonce also drops the later nonces which depend on it
+	dropped, err := m.DropTransaction(txes[1].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 3 || dropped[0] != txes[1].Hash() || dropped[1] != txes[2].Hash() || dropped[2] != txes[3].Hash() {
+		t.Error("wrong transactions dropped", dropped)
+	}
+	checkQueuedNonces(t, m.queuedTxes, account, 0)
+	for _, tx := range txes[1:] {
+		entry, err := m.txIndex.Get(tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil || entry.Status != txindex.Failed {
+			t.Error("dropped transaction wasn't marked failed", entry)
+		}
+	}
+
+	dropped, err = m.DropTransaction(txes[0].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 1 || dropped[0] != txes[0].Hash() {
+		t.Error("wrong transactions dropped", dropped)
+	}
+	checkQueuedNonces(t, m.queuedTxes, account)
+	if _, err := m.DropTransaction(txes[0].Hash()); err != ErrTxNotQueued {
+		t.Error("dropped transaction twice", err)
+	}
+}
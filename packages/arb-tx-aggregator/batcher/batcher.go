@@ -26,81 +26,173 @@ import (
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/gasprice"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
 )
 
-const maxBatchSize ethcommon.StorageSize = 120000
+type Config struct {
+	// MaxBatchTime is the longest a transaction waits before its batch is
+	// sent if the batch doesn't fill up
+	MaxBatchTime time.Duration
+	// MaxBatchSize is the size at which a batch is sent immediately
+	MaxBatchSize ethcommon.StorageSize
+	// KeepPendingState executes transactions as they're batched so that
+	// they're reflected in queries against the pending block
+	KeepPendingState bool
+	Ordering         OrderingPolicy
+	Queue            QueueConfig
+}
+
+var DefaultConfig = Config{
+	MaxBatchTime: 10 * time.Second,
+	MaxBatchSize: 120000,
+	Ordering:     RandomPolicy{},
+	Queue:        DefaultQueueConfig,
+}
+
+// shutdownFlushTimeout is how long the batcher waits to send its last batch
+// when it's stopped
+const shutdownFlushTimeout = 30 * time.Second
+
+var (
+	queueDepthGauge      = arbmetrics.NewGauge("arb/batcher/queue/depth")
+	batchTxesHistogram   = arbmetrics.NewHistogram("arb/batcher/batch/txes")
+	batchBytesHistogram  = arbmetrics.NewHistogram("arb/batcher/batch/bytes")
+	batchLatencyTimer    = arbmetrics.NewTimer("arb/batcher/batch/latency")
+	batchesPostedCounter = arbmetrics.NewCounter("arb/batcher/batch/posted")
+	batchResubmitCounter = arbmetrics.NewCounter("arb/batcher/batch/resubmitted")
+	batchesFailedCounter = arbmetrics.NewCounter("arb/batcher/batch/failed")
+)
 
+// ErrNotRunning is returned for transactions sent after the batcher failed
+var ErrNotRunning = errors.New("tx aggregator is not running")
+
+// TransactionBatcher accepts transactions from users on behalf of the
+// aggregator. It's implemented by Batcher, which posts batches itself, and by
+// forwarder.Forwarder, which relays transactions to other aggregators
 type TransactionBatcher interface {
 	PendingTransactionCount(account common.Address) *uint64
 	SendTransaction(tx *types.Transaction) (common.Hash, error)
-	PendingSnapshot() (*snapshot.Snapshot, bool)
-}
-
-type pendingSentBatch struct {
-	txHash common.Hash
-	txes   []*types.Transaction
+	PendingSnapshot() *snapshot.Snapshot
+	TransactionStatus(txHash ethcommon.Hash) (*txindex.Entry, error)
+	QueueStats() QueueStats
+	SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription
+	// Valid returns false if the batcher failed in a way that requires the
+	// aggregator to be restarted
+	Valid() bool
+	// LastBatchReceipt returns when a batch was last confirmed on L1
+	LastBatchReceipt() time.Time
 }
 
 type Batcher struct {
 	signer      types.Signer
 	client      ethutils.EthClient
 	globalInbox arbbridge.GlobalInbox
+	txManager   *ethbridge.TxManager
 
 	keepPendingState bool
+	maxBatchSize     ethcommon.StorageSize
 
-	db *txdb.TxDB
+	db      *txdb.TxDB
+	txIndex *txindex.Index
+	oracle  *gasprice.Oracle
+	policy  OrderingPolicy
 
 	sync.Mutex
 	valid bool
+	// paused stops new batches from being sent until it's cleared
+	paused       bool
+	maxBatchTime time.Duration
 
 	queuedTxes         *txQueues
 	pendingBatch       *pendingBatch
 	pendingSentBatches *list.List
+	nextBatchSeq       uint64
+	// batchSentAt records when each batch sent since startup was first sent
+	batchSentAt map[uint64]time.Time
+	// batchRetries counts how many times each pending batch has been retried
+	// since startup
+	batchRetries map[uint64]int
+	// lastBatchReceipt is when a batch was last confirmed on L1
+	lastBatchReceipt time.Time
+
+	newTxFeed event.Feed
+
+	// ctx is the context passed to NewBatcher. Batches sent on behalf of
+	// callers use it so that they aren't tied to a caller's request
+	ctx context.Context
+	// stopped tracks the goroutines which run until the context passed to
+	// NewBatcher is cancelled
+	stopped sync.WaitGroup
 }
 
 func NewBatcher(
 	ctx context.Context,
 	db *txdb.TxDB,
+	txIndex *txindex.Index,
+	oracle *gasprice.Oracle,
 	rollupAddress common.Address,
 	client ethutils.EthClient,
 	globalInbox arbbridge.GlobalInbox,
-	maxBatchTime time.Duration,
-	keepPendingState bool,
+	txManager *ethbridge.TxManager,
+	cfg Config,
 ) *Batcher {
+	maxBatchTime := cfg.MaxBatchTime
+	keepPendingState := cfg.KeepPendingState
+	policy := cfg.Ordering
 	signer := types.NewEIP155Signer(message.ChainAddressToID(rollupAddress))
 	server := &Batcher{
 		signer:             signer,
 		client:             client,
 		globalInbox:        globalInbox,
+		txManager:          txManager,
 		keepPendingState:   keepPendingState,
+		maxBatchSize:       cfg.MaxBatchSize,
+		maxBatchTime:       maxBatchTime,
 		db:                 db,
+		txIndex:            txIndex,
+		oracle:             oracle,
+		policy:             policy,
 		valid:              true,
-		queuedTxes:         newTxQueues(),
-		pendingBatch:       newPendingBatch(db.LatestSnapshot(), maxBatchSize, signer),
+		queuedTxes:         newTxQueues(cfg.Queue),
+		pendingBatch:       newPendingBatch(db.LatestSnapshot(), cfg.MaxBatchSize, signer),
 		pendingSentBatches: list.New(),
+		batchSentAt:        make(map[uint64]time.Time),
+		batchRetries:       make(map[uint64]int),
+		ctx:                ctx,
 	}
 
+	server.recover(ctx)
+
+	server.stopped.Add(3)
+	go server.indexIncludedTransactions(ctx)
 	go func() {
+		defer server.stopped.Done()
 		lastBatch := time.Now()
 		ticker := time.NewTicker(time.Millisecond * 100)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
+				server.flush()
 				return
 
 			case <-ticker.C:
 				server.Lock()
+				server.markDropped(server.queuedTxes.expire(time.Now()))
+				queueDepthGauge.Update(int64(server.queuedTxes.size()))
 				for {
-					tx, accountIndex, cont := server.pendingBatch.popRandomTx(server.queuedTxes, signer)
+					tx, account, cont := server.pendingBatch.popTx(server.queuedTxes, policy, signer)
 					if tx != nil {
 						if keepPendingState {
 							newSnap := server.pendingBatch.snap.Clone()
@@ -109,21 +201,27 @@ func NewBatcher(
 							server.Lock()
 							if err != nil {
 								log.Println("Aggregator ignored invalid tx", err)
+								server.markFailed([]*types.Transaction{tx}, err.Error())
 								continue
 							}
 							server.pendingBatch.updateSnap(newSnap)
 						}
 						server.pendingBatch.addIncludedTx(tx)
-						server.queuedTxes.maybeRemoveAccountAtIndex(accountIndex)
+						server.queuedTxes.maybeRemoveAccount(account)
 					}
-					if server.pendingBatch.full || (!cont && time.Since(lastBatch) > maxBatchTime) {
+					if !server.paused && (server.pendingBatch.full || (!cont && time.Since(lastBatch) > server.maxBatchTime)) {
 						lastBatch = time.Now()
 						server.sendBatch(ctx)
+					} else if server.pendingBatch.full {
+						// Batch posting is paused so wait for it to resume
+						cont = false
 					}
 
 					if !cont {
+						discarded := server.pendingBatch.popDiscardedTxes()
 						// If we didn't fill the last batch, pause for more transactions
 						server.Unlock()
+						server.markFailed(discarded, "nonce too low")
 						break
 					}
 				}
@@ -133,6 +231,7 @@ func NewBatcher(
 	}()
 
 	go func() {
+		defer server.stopped.Done()
 		ticker := time.NewTicker(maxBatchTime)
 		defer ticker.Stop()
 		for {
@@ -146,20 +245,28 @@ func NewBatcher(
 				// from pendingSentBatches, so pendingSentBatches.Front() is
 				// guaranteed not to change when the server lock is released
 				for server.pendingSentBatches.Len() > 0 {
-					batch := server.pendingSentBatches.Front().Value.(*pendingSentBatch)
-					txHash := batch.txHash.ToEthHash()
+					batch := server.pendingSentBatches.Front().Value.(*txindex.Batch)
 					server.Unlock()
-					receipt, err := ethbridge.WaitForReceiptWithResultsSimple(ctx, client, txHash)
-					if err != nil || receipt.Status != 1 {
-						// batch failed
-						log.Fatal("Error submitted batch", err)
+					receipt, err := server.waitForBatch(ctx, batch)
+					if ctx.Err() != nil {
+						return
+					}
+					if err != nil {
+						server.retryBatch(ctx, batch, err)
+						server.Lock()
+						continue
 					}
 
 					log.Println("Got receipt for batch in tx", receipt.TxHash.Hex(), "completed at block", receipt.BlockNumber, "using", receipt.GasUsed, "gas")
+					if tx, _, err := client.TransactionByHash(ctx, receipt.TxHash); err == nil {
+						oracle.AddBatch(receipt.GasUsed, tx.GasPrice(), len(batch.Txes))
+					} else {
+						log.Println("Error getting batch transaction", err)
+					}
 
 					// batch succeeded
 					server.Lock()
-					server.pendingSentBatches.Remove(server.pendingSentBatches.Front())
+					server.completeFrontBatch()
 				}
 				server.Unlock()
 			}
@@ -168,38 +275,84 @@ func NewBatcher(
 	return server
 }
 
+// flush sends the transactions which have been added to the pending batch
+// so that they aren't delayed until the aggregator restarts. Transactions that
+// are still queued and batches which weren't confirmed are persisted in the
+// tx index and are recovered on restart
+func (m *Batcher) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	m.Lock()
+	defer m.Unlock()
+	if !m.paused {
+		m.sendBatch(ctx)
+	}
+	log.Println("Batcher stopped with", m.queuedTxes.size(), "queued transactions and", m.pendingSentBatches.Len(), "unconfirmed batches")
+}
+
+// Valid returns false if the batcher hit an error which stops it from
+// sending batches
+func (m *Batcher) Valid() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.valid
+}
+
+// LastBatchReceipt returns when a batch was last confirmed on L1 or the zero
+// time if none has been confirmed since startup
+func (m *Batcher) LastBatchReceipt() time.Time {
+	m.Lock()
+	defer m.Unlock()
+	return m.lastBatchReceipt
+}
+
+// Wait blocks until the batcher has stopped after the context passed to
+// NewBatcher is cancelled
+func (m *Batcher) Wait() {
+	m.stopped.Wait()
+}
+
 func (m *Batcher) sendBatch(ctx context.Context) {
 	txes := m.pendingBatch.appliedTxes
 	if len(txes) == 0 {
 		return
 	}
-	batchTxes := make([]message.AbstractL2Message, 0, len(txes))
-	for _, tx := range txes {
-		batchTxes = append(batchTxes, message.SignedTransaction{Tx: tx})
-	}
-	batchTx, err := message.NewTransactionBatchFromMessages(batchTxes)
+	data, err := batchData(txes)
 	if err != nil {
 		log.Println("transaction aggregator failed: ", err)
 		m.valid = false
 		return
 	}
+	batch := &txindex.Batch{Seq: m.nextBatchSeq, Txes: txes}
+	if header, err := m.client.HeaderByNumber(ctx, nil); err == nil {
+		batch.L1Block = header.Number.Uint64()
+	} else if latest := m.db.LatestBlockId(); latest != nil {
+		// The observer lags the L1 so the batch can't be delivered before
+		// the last block it processed
+		log.Println("Error getting L1 block number", err)
+		batch.L1Block = latest.Height.AsInt().Uint64()
+	} else {
+		log.Println("Error getting L1 block number", err)
+	}
 	log.Println("Submitting batch with", len(txes), "transactions")
-	txHash, err := m.globalInbox.SendL2MessageNoWait(
-		ctx,
-		message.NewSafeL2Message(batchTx).AsData(),
-	)
-
+	batchTxesHistogram.Update(int64(len(txes)))
+	batchBytesHistogram.Update(int64(len(data)))
+	m.batchSentAt[batch.Seq] = time.Now()
+	txHash, err := m.globalInbox.SendL2MessageNoWait(ctx, data)
 	if err != nil {
-		log.Println("transaction aggregator failed: ", err)
-		m.valid = false
-		return
+		// The batch is still recorded so that it will be resent
+		log.Println("Error submitting batch", err)
+	} else {
+		batch.TxHash = txHash.ToEthHash()
+		batch.From, batch.Nonce = m.batchTxSender(ctx, batch.TxHash)
 	}
 
-	m.pendingBatch = newPendingBatchFromExisting(m.pendingBatch, maxBatchSize)
-	m.pendingSentBatches.PushBack(&pendingSentBatch{
-		txHash: txHash,
-		txes:   txes,
-	})
+	if err := m.txIndex.MarkBatched(batch); err != nil {
+		log.Println("Error updating tx index", err)
+	}
+	m.nextBatchSeq++
+	m.pendingBatch = newPendingBatchFromExisting(m.pendingBatch, m.maxBatchSize)
+	m.pendingSentBatches.PushBack(batch)
 }
 
 func (m *Batcher) PendingSnapshot() *snapshot.Snapshot {
@@ -234,11 +387,25 @@ func (m *Batcher) SendTransaction(tx *types.Transaction) (common.Hash, error) {
 
 	txHash := common.NewHashFromEth(tx.Hash())
 
+	if err := m.queueTransaction(tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := m.txIndex.MarkQueued(tx); err != nil {
+		log.Println("Error updating tx index", err)
+	}
+
+	// Notify outside of the lock since subscribers may call back into the
+	// batcher
+	m.newTxFeed.Send(tx)
+	return txHash, nil
+}
+
+func (m *Batcher) queueTransaction(tx *types.Transaction) error {
 	m.Lock()
 	defer m.Unlock()
 
 	if !m.valid {
-		return common.Hash{}, errors.New("tx aggregator is not running")
+		return ErrNotRunning
 	}
 
 	if m.keepPendingState {
@@ -246,15 +413,95 @@ func (m *Batcher) SendTransaction(tx *types.Transaction) (common.Hash, error) {
 		m.setupPending()
 
 		if err := m.pendingBatch.checkValidForQueue(tx); err != nil {
-			return common.Hash{}, err
+			return err
 		}
 	}
 
-	if err := m.queuedTxes.addTransaction(tx, m.signer); err != nil {
-		return common.Hash{}, err
+	dropped, err := m.queuedTxes.admitTransaction(tx, m.signer)
+	m.markDropped(dropped)
+	return err
+}
+
+// SubscribeNewTransactions registers ch to receive every transaction accepted
+// into the queue
+func (m *Batcher) SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription {
+	return m.newTxFeed.Subscribe(ch)
+}
+
+// QueueStats summarizes the transactions waiting in the batcher queue
+type QueueStats struct {
+	Policy   string
+	Accounts int
+	Queued   int
+	// Buckets counts queued transactions by the policy's bucket
+	Buckets map[string]int
+}
+
+func (m *Batcher) QueueStats() QueueStats {
+	m.Lock()
+	defer m.Unlock()
+	stats := QueueStats{
+		Policy:   m.policy.Name(),
+		Accounts: len(m.queuedTxes.accounts),
+		Buckets:  make(map[string]int),
 	}
+	now := time.Now()
+	m.queuedTxes.forEach(func(tx QueuedTx) {
+		stats.Queued++
+		stats.Buckets[m.policy.Bucket(tx, now)]++
+	})
+	return stats
+}
 
-	return txHash, nil
+// TransactionStatus returns the last known state of a transaction sent to
+// this aggregator or nil if the transaction is unknown
+func (m *Batcher) TransactionStatus(txHash ethcommon.Hash) (*txindex.Entry, error) {
+	return m.txIndex.Get(txHash)
+}
+
+func (m *Batcher) markFailed(txes []*types.Transaction, reason string) {
+	if len(txes) == 0 {
+		return
+	}
+	hashes := make([]ethcommon.Hash, 0, len(txes))
+	for _, tx := range txes {
+		hashes = append(hashes, tx.Hash())
+	}
+	if err := m.txIndex.MarkFailed(hashes, reason); err != nil {
+		log.Println("Error updating tx index", err)
+	}
+}
+
+// markDropped records why each of the given transactions was removed from
+// the queue
+func (m *Batcher) markDropped(dropped []droppedTx) {
+	for _, d := range dropped {
+		log.Println("Dropped queued transaction", d.tx.Hash().Hex(), d.reason)
+		m.markFailed([]*types.Transaction{d.tx}, d.reason)
+	}
+}
+
+// indexIncludedTransactions records the block and position of every
+// transaction from this aggregator once its result is saved
+func (m *Batcher) indexIncludedTransactions(ctx context.Context) {
+	defer m.stopped.Done()
+	blocks := make(chan *txdb.BlockEvent, 128)
+	sub := m.db.SubscribeBlockEvents(blocks)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-blocks:
+			blockNum := ev.BlockInfo.BlockNum.Uint64()
+			for _, res := range ev.Results {
+				txHash := res.IncomingRequest.MessageID.ToEthHash()
+				if err := m.txIndex.MarkIncluded(txHash, blockNum, res.TxIndex.Uint64()); err != nil {
+					log.Println("Error updating tx index", err)
+				}
+			}
+		}
+	}
 }
 
 func (m *Batcher) setupPending() {
@@ -265,8 +512,8 @@ func (m *Batcher) setupPending() {
 		// have invalid sequence numbers
 		n := m.pendingSentBatches.Front()
 		for n != nil {
-			item := n.Value.(*pendingSentBatch)
-			for _, tx := range item.txes {
+			item := n.Value.(*txindex.Batch)
+			for _, tx := range item.Txes {
 				var err error
 				newSnap, err := snapWithTx(snap, tx, m.signer)
 				if err != nil {
@@ -281,6 +528,6 @@ func (m *Batcher) setupPending() {
 			// If there's an error here, just throw out the tx
 			_ = m.queuedTxes.addTransaction(tx, m.signer)
 		}
-		m.pendingBatch = newPendingBatch(snap, maxBatchSize, m.signer)
+		m.pendingBatch = newPendingBatch(snap, m.maxBatchSize, m.signer)
 	}
 }
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// QueuedTx is a transaction waiting in the batcher queue
+type QueuedTx struct {
+	Tx *types.Transaction
+	// Arrival orders transactions by when they were accepted by the batcher
+	Arrival  uint64
+	Received time.Time
+}
+
+// OrderingPolicy decides which account's next transaction is added to the
+// pending batch. Transactions from a single account are always included in
+// nonce order.
+type OrderingPolicy interface {
+	Name() string
+
+	// Order is given the lowest nonce queued transaction from each account
+	// and returns the indexes of the candidates in the order they should be
+	// considered
+	Order(candidates []QueuedTx) []int
+
+	// Bucket groups queued transactions for reporting queue statistics
+	Bucket(tx QueuedTx, now time.Time) string
+}
+
+const (
+	RandomOrdering   = "random"
+	FIFOOrdering     = "fifo"
+	GasPriceOrdering = "gasprice"
+)
+
+// NewOrderingPolicy returns the policy with the given name
+func NewOrderingPolicy(name string) (OrderingPolicy, error) {
+	switch name {
+	case RandomOrdering:
+		return RandomPolicy{}, nil
+	case FIFOOrdering:
+		return FIFOPolicy{}, nil
+	case GasPriceOrdering:
+		return GasPricePolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ordering policy %v", name)
+	}
+}
+
+// RandomPolicy starts at a random account and considers the rest in turn
+type RandomPolicy struct{}
+
+func (RandomPolicy) Name() string {
+	return RandomOrdering
+}
+
+func (RandomPolicy) Order(candidates []QueuedTx) []int {
+	order := make([]int, 0, len(candidates))
+	start := int(rand.Int31n(int32(len(candidates))))
+	for i := range candidates {
+		order = append(order, (start+i)%len(candidates))
+	}
+	return order
+}
+
+func (RandomPolicy) Bucket(QueuedTx, time.Time) string {
+	return "queued"
+}
+
+// FIFOPolicy includes transactions in the order they were received
+type FIFOPolicy struct{}
+
+func (FIFOPolicy) Name() string {
+	return FIFOOrdering
+}
+
+func (FIFOPolicy) Order(candidates []QueuedTx) []int {
+	return sortedIndexes(candidates, func(a, b QueuedTx) bool {
+		return a.Arrival < b.Arrival
+	})
+}
+
+func (FIFOPolicy) Bucket(tx QueuedTx, now time.Time) string {
+	age := now.Sub(tx.Received)
+	switch {
+	case age < 10*time.Second:
+		return "<10s"
+	case age < time.Minute:
+		return "<1m"
+	case age < 10*time.Minute:
+		return "<10m"
+	default:
+		return ">=10m"
+	}
+}
+
+// GasPricePolicy includes the highest paying transactions first, breaking
+// ties by arrival
+type GasPricePolicy struct{}
+
+func (GasPricePolicy) Name() string {
+	return GasPriceOrdering
+}
+
+func (GasPricePolicy) Order(candidates []QueuedTx) []int {
+	return sortedIndexes(candidates, func(a, b QueuedTx) bool {
+		if cmp := a.Tx.GasPrice().Cmp(b.Tx.GasPrice()); cmp != 0 {
+			return cmp > 0
+		}
+		return a.Arrival < b.Arrival
+	})
+}
+
+var gasPriceBuckets = []struct {
+	max  *big.Int
+	name string
+}{
+	{big.NewInt(1), "0"},
+	{big.NewInt(params.GWei), "<1gwei"},
+	{big.NewInt(10 * params.GWei), "<10gwei"},
+	{big.NewInt(100 * params.GWei), "<100gwei"},
+}
+
+func (GasPricePolicy) Bucket(tx QueuedTx, _ time.Time) string {
+	for _, bucket := range gasPriceBuckets {
+		if tx.Tx.GasPrice().Cmp(bucket.max) < 0 {
+			return bucket.name
+		}
+	}
+	return ">=100gwei"
+}
+
+func sortedIndexes(candidates []QueuedTx, less func(a, b QueuedTx) bool) []int {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(candidates[order[i]], candidates[order[j]])
+	})
+	return order
+}
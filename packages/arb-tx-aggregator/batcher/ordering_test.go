@@ -0,0 +1,260 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"crypto/ecdsa"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var testPolicies = []OrderingPolicy{RandomPolicy{}, FIFOPolicy{}, GasPricePolicy{}}
+
+// newTestBatch returns a pending batch which treats every account as having
+// sent no transactions yet
+func newTestBatch(accounts ...common.Address) *pendingBatch {
+	batch := newPendingBatch(nil, 1000000, testSigner)
+	for _, account := range accounts {
+		batch.txCounts[account] = 0
+	}
+	return batch
+}
+
+// drain pops transactions from q into batch the same way the batcher does
+// until none can be included and returns them in the order they were
+// included
+func drain(q *txQueues, batch *pendingBatch, policy OrderingPolicy) []*types.Transaction {
+	var included []*types.Transaction
+	for {
+		tx, account, ok := batch.popTx(q, policy, testSigner)
+		if !ok {
+			return included
+		}
+		if tx != nil {
+			batch.addIncludedTx(tx)
+			q.maybeRemoveAccount(account)
+			included = append(included, tx)
+		}
+	}
+}
+
+func sender(t *testing.T, tx *types.Transaction) common.Address {
+	t.Helper()
+	from, err := types.Sender(testSigner, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return from
+}
+
+func checkIncluded(t *testing.T, included []*types.Transaction, expected ...*types.Transaction) {
+	t.Helper()
+	if len(included) != len(expected) {
+		t.Fatalf("included %v txes instead of %v", len(included), len(expected))
+	}
+	for i, tx := range included {
+		if tx.Hash() != expected[i].Hash() {
+			t.Errorf("tx %v has nonce %v from %v but expected nonce %v from %v",
+				i, tx.Nonce(), sender(t, tx).Hex(), expected[i].Nonce(), sender(t, expected[i]).Hex())
+		}
+	}
+}
+
+func TestPoliciesKeepNonceOrder(t *testing.T) {
+	const accountCount = 4
+	const txesPerAccount = 6
+	for _, policy := range testPolicies {
+		t.Run(policy.Name(), func(t *testing.T) {
+			keys := make([]*ecdsa.PrivateKey, 0, accountCount)
+			accounts := make([]common.Address, 0, accountCount)
+			for i := 0; i < accountCount; i++ {
+				key, account := newTestKey(t)
+				keys = append(keys, key)
+				accounts = append(accounts, account)
+			}
+
+			// Later nonces pay more and arrive first so that any policy
+			// which looked past an account's lowest nonce would reorder them
+			var txes []*types.Transaction
+			for i, key := range keys {
+				for nonce := txesPerAccount - 1; nonce >= 0; nonce-- {
+					txes = append(txes, signedTx(t, key, uint64(nonce), int64(1+nonce*10+i)))
+				}
+			}
+			rand.Shuffle(len(txes), func(i, j int) {
+				txes[i], txes[j] = txes[j], txes[i]
+			})
+			q := newTxQueues(QueueConfig{})
+			for _, tx := range txes {
+				admit(t, q, tx)
+			}
+
+			included := drain(q, newTestBatch(accounts...), policy)
+			if len(included) != len(txes) {
+				t.Fatalf("included %v of %v txes", len(included), len(txes))
+			}
+			nextNonce := make(map[common.Address]uint64)
+			for _, tx := range included {
+				from := sender(t, tx)
+				if tx.Nonce() != nextNonce[from] {
+					t.Fatalf("included nonce %v from %v before nonce %v", tx.Nonce(), from.Hex(), nextNonce[from])
+				}
+				nextNonce[from]++
+			}
+			if len(q.accounts) != 0 || q.size() != 0 {
+				t.Error("queue wasn't emptied")
+			}
+		})
+	}
+}
+
+func TestFIFOOrder(t *testing.T) {
+	keyA, accountA := newTestKey(t)
+	keyB, accountB := newTestKey(t)
+	a0 := signedTx(t, keyA, 0, 1)
+	b0 := signedTx(t, keyB, 0, 100)
+	a1 := signedTx(t, keyA, 1, 1)
+	b1 := signedTx(t, keyB, 1, 100)
+
+	q := newTxQueues(QueueConfig{})
+	for _, tx := range []*types.Transaction{a0, b0, a1, b1} {
+		admit(t, q, tx)
+	}
+	checkIncluded(t, drain(q, newTestBatch(accountA, accountB), FIFOPolicy{}), a0, b0, a1, b1)
+}
+
+func TestGasPriceOrder(t *testing.T) {
+	keyA, accountA := newTestKey(t)
+	keyB, accountB := newTestKey(t)
+	keyC, accountC := newTestKey(t)
+	a0 := signedTx(t, keyA, 0, 1)
+	a1 := signedTx(t, keyA, 1, 1000)
+	b0 := signedTx(t, keyB, 0, 50)
+	c0 := signedTx(t, keyC, 0, 50)
+
+	q := newTxQueues(QueueConfig{})
+	for _, tx := range []*types.Transaction{a0, a1, b0, c0} {
+		admit(t, q, tx)
+	}
+	// a1 pays the most but can't be included before a0 and ties between b0
+	// and c0 are broken by arrival
+	included := drain(q, newTestBatch(accountA, accountB, accountC), GasPricePolicy{})
+	checkIncluded(t, included, b0, c0, a0, a1)
+}
+
+func TestPopTxSkipsNonceGap(t *testing.T) {
+	for _, policy := range testPolicies {
+		t.Run(policy.Name(), func(t *testing.T) {
+			gapKey, gapAccount := newTestKey(t)
+			key, account := newTestKey(t)
+			gapped := signedTx(t, gapKey, 1, 1000)
+			ready := signedTx(t, key, 0, 1)
+
+			q := newTxQueues(QueueConfig{})
+			admit(t, q, gapped)
+			admit(t, q, ready)
+			checkIncluded(t, drain(q, newTestBatch(gapAccount, account), policy), ready)
+			checkQueuedNonces(t, q, gapAccount, 1)
+
+			// Once the gap is filled both are included in order
+			filler := signedTx(t, gapKey, 0, 1)
+			admit(t, q, filler)
+			checkIncluded(t, drain(q, newTestBatch(gapAccount, account), policy), filler, gapped)
+		})
+	}
+}
+
+func TestPopTxDiscardsUsedNonce(t *testing.T) {
+	key, account := newTestKey(t)
+	stale := signedTx(t, key, 0, 1)
+	next := signedTx(t, key, 1, 1)
+
+	q := newTxQueues(QueueConfig{})
+	admit(t, q, stale)
+	admit(t, q, next)
+	batch := newTestBatch()
+	batch.txCounts[account] = 1
+	checkIncluded(t, drain(q, batch, FIFOPolicy{}), next)
+
+	discarded := batch.popDiscardedTxes()
+	if len(discarded) != 1 || discarded[0].Hash() != stale.Hash() {
+		t.Error("tx with used nonce wasn't discarded", discarded)
+	}
+}
+
+func TestQueueStatsBuckets(t *testing.T) {
+	now := time.Now()
+	key, account := newTestKey(t)
+	ages := []time.Duration{time.Second, 30 * time.Second, 40 * time.Second, 5 * time.Minute, time.Hour}
+	prices := []int64{0, params.GWei / 2, 5 * params.GWei, 50 * params.GWei, 500 * params.GWei}
+
+	q := newTxQueues(QueueConfig{})
+	for i := range ages {
+		admit(t, q, signedTx(t, key, uint64(i), prices[i]))
+	}
+	queue := q.queues[account]
+	for nonce, tx := range queue.txesByNonce {
+		tx.Received = now.Add(-ages[nonce])
+		queue.txesByNonce[nonce] = tx
+	}
+
+	tests := []struct {
+		policy  OrderingPolicy
+		buckets map[string]int
+	}{
+		{RandomPolicy{}, map[string]int{"queued": 5}},
+		{FIFOPolicy{}, map[string]int{"<10s": 1, "<1m": 2, "<10m": 1, ">=10m": 1}},
+		{GasPricePolicy{}, map[string]int{"0": 1, "<1gwei": 1, "<10gwei": 1, "<100gwei": 1, ">=100gwei": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.Name(), func(t *testing.T) {
+			b := &Batcher{policy: test.policy, queuedTxes: q}
+			stats := b.QueueStats()
+			if stats.Policy != test.policy.Name() || stats.Accounts != 1 || stats.Queued != len(ages) {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			if len(stats.Buckets) != len(test.buckets) {
+				t.Fatalf("got buckets %v instead of %v", stats.Buckets, test.buckets)
+			}
+			for bucket, count := range test.buckets {
+				if stats.Buckets[bucket] != count {
+					t.Errorf("bucket %v has %v txes instead of %v", bucket, stats.Buckets[bucket], count)
+				}
+			}
+		})
+	}
+}
+
+func TestNewOrderingPolicy(t *testing.T) {
+	for _, policy := range testPolicies {
+		parsed, err := NewOrderingPolicy(policy.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != policy {
+			t.Errorf("%v parsed as %v", policy.Name(), parsed.Name())
+		}
+	}
+	if _, err := NewOrderingPolicy("lifo"); err == nil {
+		t.Error("unknown policy was accepted")
+	}
+}
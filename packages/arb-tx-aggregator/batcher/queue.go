@@ -3,8 +3,11 @@ package batcher
 import (
 	"container/heap"
 	"errors"
+	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
+	"sort"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
@@ -36,32 +39,97 @@ func (h *TxHeap) Pop() interface{} {
 
 type txQueue struct {
 	txes        TxHeap
-	txesByNonce map[uint64]*types.Transaction
+	txesByNonce map[uint64]QueuedTx
 	maxNonce    uint64
 }
 
 func newTxQueue() *txQueue {
 	return &txQueue{
 		txes:        nil,
-		txesByNonce: make(map[uint64]*types.Transaction),
+		txesByNonce: make(map[uint64]QueuedTx),
 		maxNonce:    0,
 	}
 }
 
-func (q *txQueue) addTransaction(tx *types.Transaction) error {
-	if _, ok := q.txesByNonce[tx.Nonce()]; ok {
-		return errors.New("transaction replacement not supported")
+func (q *txQueue) addTransaction(tx QueuedTx) error {
+	if _, ok := q.txesByNonce[tx.Tx.Nonce()]; ok {
+		return errors.New("transaction with nonce already queued")
 	}
 
-	q.txesByNonce[tx.Nonce()] = tx
-	heap.Push(&q.txes, tx)
+	q.txesByNonce[tx.Tx.Nonce()] = tx
+	heap.Push(&q.txes, tx.Tx)
 
-	if tx.Nonce() > q.maxNonce {
-		q.maxNonce = tx.Nonce()
+	if tx.Tx.Nonce() > q.maxNonce {
+		q.maxNonce = tx.Tx.Nonce()
 	}
 	return nil
 }
 
+// replace swaps a queued transaction for tx which has the same nonce and
+// returns the transaction that was replaced
+func (q *txQueue) replace(tx QueuedTx) QueuedTx {
+	nonce := tx.Tx.Nonce()
+	old := q.txesByNonce[nonce]
+	for i := range q.txes {
+		if q.txes[i].Nonce() == nonce {
+			// The nonce is unchanged so the heap is still ordered
+			q.txes[i] = tx.Tx
+			break
+		}
+	}
+	q.txesByNonce[nonce] = tx
+	return old
+}
+
+// remove drops the transaction with the given nonce from the queue
+func (q *txQueue) remove(nonce uint64) {
+	for i := range q.txes {
+		if q.txes[i].Nonce() == nonce {
+			heap.Remove(&q.txes, i)
+			break
+		}
+	}
+	delete(q.txesByNonce, nonce)
+	if nonce == q.maxNonce {
+		q.maxNonce = 0
+		if last, ok := q.tail(); ok {
+			q.maxNonce = last.Tx.Nonce()
+		}
+	}
+}
+
+// removeFrom drops the transaction with the given nonce along with every
+// later transaction since they couldn't be included without it. It returns
+// the removed transactions in nonce order
+func (q *txQueue) removeFrom(nonce uint64) []QueuedTx {
+	var removed []QueuedTx
+	for n, tx := range q.txesByNonce {
+		if n >= nonce {
+			removed = append(removed, tx)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Tx.Nonce() < removed[j].Tx.Nonce()
+	})
+	for i := len(removed) - 1; i >= 0; i-- {
+		q.remove(removed[i].Tx.Nonce())
+	}
+	return removed
+}
+
+// tail returns the queued transaction with the highest nonce
+func (q *txQueue) tail() (QueuedTx, bool) {
+	var last QueuedTx
+	found := false
+	for nonce, tx := range q.txesByNonce {
+		if !found || nonce > last.Tx.Nonce() {
+			last = tx
+			found = true
+		}
+	}
+	return last, found
+}
+
 func (q *txQueue) Empty() bool {
 	return len(q.txes) == 0
 }
@@ -70,24 +138,77 @@ func (q *txQueue) Peek() *types.Transaction {
 	return q.txes[0]
 }
 
+func (q *txQueue) peekQueued() QueuedTx {
+	return q.txesByNonce[q.txes[0].Nonce()]
+}
+
 func (q *txQueue) Pop() *types.Transaction {
 	tx := heap.Pop(&q.txes).(*types.Transaction)
 	delete(q.txesByNonce, tx.Nonce())
 	return tx
 }
 
+// QueueConfig limits which transactions are accepted into the batcher queue
+// and how long they can stay there. Zero values disable the corresponding
+// limit
+type QueueConfig struct {
+	// PriceBump is the minimum percentage by which the gas price of a
+	// transaction must exceed that of the queued transaction with the same
+	// nonce in order to replace it
+	PriceBump uint64
+	// MaxPerAccount is the maximum number of queued transactions from a
+	// single account
+	MaxPerAccount int
+	// MaxQueued is the maximum number of queued transactions from all
+	// accounts
+	MaxQueued int
+	// TTL is how long a transaction can wait in the queue before it's dropped
+	TTL time.Duration
+}
+
+var DefaultQueueConfig = QueueConfig{
+	PriceBump:     10,
+	MaxPerAccount: 64,
+	MaxQueued:     4096,
+	TTL:           3 * time.Hour,
+}
+
+var (
+	ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
+	ErrAccountQueueFull   = errors.New("too many queued transactions from account")
+	ErrQueueFull          = errors.New("transaction queue is full")
+)
+
+// droppedTx is a transaction removed from the queue before being batched
+type droppedTx struct {
+	tx     *types.Transaction
+	reason string
+}
+
 type txQueues struct {
 	queues   map[common.Address]*txQueue
 	accounts []common.Address
+	cfg      QueueConfig
+
+	nextArrival uint64
 }
 
-func newTxQueues() *txQueues {
+func newTxQueues(cfg QueueConfig) *txQueues {
 	return &txQueues{
 		queues:   make(map[common.Address]*txQueue),
 		accounts: nil,
+		cfg:      cfg,
 	}
 }
 
+func (q *txQueues) newQueuedTx(tx *types.Transaction) QueuedTx {
+	queuedTx := QueuedTx{Tx: tx, Arrival: q.nextArrival, Received: time.Now()}
+	q.nextArrival++
+	return queuedTx
+}
+
+// addTransaction queues tx without applying any limits. It fails if a
+// transaction with the same nonce is already queued
 func (q *txQueues) addTransaction(tx *types.Transaction, signer types.Signer) error {
 	sender, _ := types.Sender(signer, tx)
 	queue, ok := q.queues[sender]
@@ -96,27 +217,175 @@ func (q *txQueues) addTransaction(tx *types.Transaction, signer types.Signer) er
 		q.queues[sender] = queue
 		q.accounts = append(q.accounts, sender)
 	}
-	return queue.addTransaction(tx)
+	return queue.addTransaction(q.newQueuedTx(tx))
+}
+
+// admitTransaction queues a transaction submitted by a user. A queued
+// transaction with the same nonce is replaced if tx pays a high enough gas
+// price. If the queue is full, the cheapest transaction that can be removed
+// without leaving a nonce gap is evicted to make room. It returns the
+// transactions which were removed from the queue
+func (q *txQueues) admitTransaction(tx *types.Transaction, signer types.Signer) ([]droppedTx, error) {
+	sender, _ := types.Sender(signer, tx)
+	queue, ok := q.queues[sender]
+	if ok {
+		if old, ok := queue.txesByNonce[tx.Nonce()]; ok {
+			if !priceBumped(old.Tx.GasPrice(), tx.GasPrice(), q.cfg.PriceBump) {
+				return nil, ErrReplaceUnderpriced
+			}
+			queue.replace(q.newQueuedTx(tx))
+			reason := fmt.Sprintf("replaced by transaction %v", tx.Hash().Hex())
+			return []droppedTx{{tx: old.Tx, reason: reason}}, nil
+		}
+	}
+
+	var dropped []droppedTx
+	if ok && q.cfg.MaxPerAccount > 0 && len(queue.txesByNonce) >= q.cfg.MaxPerAccount {
+		// Only make room for a transaction which comes before the account's
+		// last queued transaction since otherwise it couldn't be included
+		// until every earlier transaction was
+		last, _ := queue.tail()
+		if tx.Nonce() > last.Tx.Nonce() {
+			return nil, ErrAccountQueueFull
+		}
+		q.removeTx(sender, last.Tx.Nonce())
+		dropped = append(dropped, droppedTx{tx: last.Tx, reason: "evicted from full account queue"})
+	} else if q.cfg.MaxQueued > 0 && q.size() >= q.cfg.MaxQueued {
+		account, victim, found := q.cheapestEvictable(sender, tx)
+		if !found {
+			return nil, ErrQueueFull
+		}
+		q.removeTx(account, victim.Tx.Nonce())
+		dropped = append(dropped, droppedTx{tx: victim.Tx, reason: "evicted from full queue"})
+	}
+
+	if err := q.addTransaction(tx, signer); err != nil {
+		return dropped, err
+	}
+	return dropped, nil
+}
+
+// cheapestEvictable returns the last queued transaction of the account whose
+// last transaction pays the lowest gas price, as long as it pays less than tx
+func (q *txQueues) cheapestEvictable(sender common.Address, tx *types.Transaction) (common.Address, QueuedTx, bool) {
+	var account common.Address
+	var victim QueuedTx
+	found := false
+	for addr, queue := range q.queues {
+		last, ok := queue.tail()
+		if !ok {
+			continue
+		}
+		if addr == sender && tx.Nonce() > last.Tx.Nonce() {
+			continue
+		}
+		if last.Tx.GasPrice().Cmp(tx.GasPrice()) >= 0 {
+			continue
+		}
+		if !found || last.Tx.GasPrice().Cmp(victim.Tx.GasPrice()) < 0 {
+			account = addr
+			victim = last
+			found = true
+		}
+	}
+	return account, victim, found
+}
+
+// expire removes every transaction which has been queued for longer than the
+// configured TTL. Later transactions from the same account are removed too
+// so that no nonce gap is left behind
+func (q *txQueues) expire(now time.Time) []droppedTx {
+	if q.cfg.TTL == 0 {
+		return nil
+	}
+	var dropped []droppedTx
+	reason := fmt.Sprintf("expired after waiting in queue for %v", q.cfg.TTL)
+	for account, queue := range q.queues {
+		expired := false
+		var firstExpired uint64
+		for nonce, tx := range queue.txesByNonce {
+			if now.Sub(tx.Received) > q.cfg.TTL && (!expired || nonce < firstExpired) {
+				expired = true
+				firstExpired = nonce
+			}
+		}
+		if !expired {
+			continue
+		}
+		dropped = append(dropped, q.removeFrom(account, firstExpired, reason)...)
+	}
+	return dropped
+}
+
+// size returns the number of queued transactions from all accounts
+func (q *txQueues) size() int {
+	count := 0
+	for _, queue := range q.queues {
+		count += len(queue.txesByNonce)
+	}
+	return count
+}
+
+// forEach calls f with every queued transaction
+func (q *txQueues) forEach(f func(QueuedTx)) {
+	for _, queue := range q.queues {
+		for _, tx := range queue.txesByNonce {
+			f(tx)
+		}
+	}
+}
+
+func (q *txQueues) removeTx(account common.Address, nonce uint64) {
+	q.queues[account].remove(nonce)
+	q.maybeRemoveAccount(account)
+}
+
+// removeFrom drops the account's transaction with the given nonce and every
+// later one. The transaction at nonce is dropped for reason and the others
+// because they depend on it
+func (q *txQueues) removeFrom(account common.Address, nonce uint64, reason string) []droppedTx {
+	removed := q.queues[account].removeFrom(nonce)
+	q.maybeRemoveAccount(account)
+	dropped := make([]droppedTx, 0, len(removed))
+	for _, tx := range removed {
+		txReason := reason
+		if tx.Tx.Nonce() != nonce {
+			txReason = fmt.Sprintf("removed since earlier transaction with nonce %v was dropped", nonce)
+		}
+		dropped = append(dropped, droppedTx{tx: tx.Tx, reason: txReason})
+	}
+	return dropped
 }
 
 func (q *txQueues) removeTxFromAccountAtIndex(i int) {
 	q.queues[q.accounts[i]].Pop()
 }
 
-func (q *txQueues) maybeRemoveAccountAtIndex(i int) {
-	account := q.accounts[i]
-	if q.queues[account].Empty() {
-		delete(q.queues, account)
-		q.accounts[i] = q.accounts[len(q.accounts)-1]
-		q.accounts = q.accounts[:len(q.accounts)-1]
+// maybeRemoveAccount stops tracking account if it has no queued transactions
+func (q *txQueues) maybeRemoveAccount(account common.Address) {
+	queue, ok := q.queues[account]
+	if !ok || !queue.Empty() {
+		return
+	}
+	delete(q.queues, account)
+	for i := range q.accounts {
+		if q.accounts[i] == account {
+			q.accounts[i] = q.accounts[len(q.accounts)-1]
+			q.accounts = q.accounts[:len(q.accounts)-1]
+			break
+		}
 	}
 }
 
-func (q *txQueues) getRandomTx() (*types.Transaction, int) {
-	index := int(rand.Int31n(int32(len(q.accounts))))
-	nextAccount := q.queues[q.accounts[index]]
-	tx := nextAccount.Peek()
-	return tx, index
+// priceBumped returns whether newPrice exceeds oldPrice by at least bump
+// percent
+func priceBumped(oldPrice, newPrice *big.Int, bump uint64) bool {
+	threshold := new(big.Int).Mul(oldPrice, new(big.Int).SetUint64(100+bump))
+	threshold.Div(threshold, big.NewInt(100))
+	if bump > 0 && threshold.Cmp(oldPrice) == 0 {
+		threshold.Add(threshold, big.NewInt(1))
+	}
+	return newPrice.Cmp(threshold) >= 0
 }
 
 type pendingBatch struct {
@@ -127,6 +396,10 @@ type pendingBatch struct {
 	maxSize     common.StorageSize
 	full        bool
 	signer      types.Signer
+
+	// discardedTxes holds queued transactions which were dropped because
+	// their nonce was already used
+	discardedTxes []*types.Transaction
 }
 
 func newPendingBatch(snap *snapshot.Snapshot, maxSize common.StorageSize, signer types.Signer) *pendingBatch {
@@ -166,28 +439,19 @@ func (p *pendingBatch) getTxCount(account common.Address) uint64 {
 	return count
 }
 
-func (p *pendingBatch) popRandomTx(queuedTxes *txQueues, signer types.Signer) (*types.Transaction, int, bool) {
-	queuedCount := int32(len(queuedTxes.accounts))
-	if queuedCount == 0 {
-		return nil, 0, false
+// popTx removes the next transaction to include in the batch from
+// queuedTxes. Accounts are considered in the order given by policy and
+// transactions with a nonce gap are skipped
+func (p *pendingBatch) popTx(queuedTxes *txQueues, policy OrderingPolicy, signer types.Signer) (*types.Transaction, common.Address, bool) {
+	if len(queuedTxes.accounts) == 0 {
+		return nil, common.Address{}, false
 	}
-	index := int(rand.Int31n(queuedCount))
-	first := true
-	lastIndex := index
-	index--
-	for {
-		index++
-		if index == len(queuedTxes.accounts) {
-			index = 0
-		}
-		if !first && index == lastIndex {
-			return nil, 0, false
-		}
-
-		first = false
-		account := queuedTxes.accounts[index]
-		nextAccount := queuedTxes.queues[account]
-		tx := nextAccount.Peek()
+	candidates := make([]QueuedTx, 0, len(queuedTxes.accounts))
+	for _, account := range queuedTxes.accounts {
+		candidates = append(candidates, queuedTxes.queues[account].peekQueued())
+	}
+	for _, index := range policy.Order(candidates) {
+		tx := candidates[index].Tx
 
 		sender, _ := types.Sender(signer, tx)
 		nextValidNonce := p.getTxCount(sender)
@@ -196,18 +460,20 @@ func (p *pendingBatch) popRandomTx(queuedTxes *txQueues, signer types.Signer) (*
 		}
 		if p.sizeBytes+tx.Size() > p.maxSize {
 			p.full = true
-			return nil, 0, true
+			return nil, common.Address{}, true
 		}
 		queuedTxes.removeTxFromAccountAtIndex(index)
 
 		if tx.Nonce() < nextValidNonce {
 			// Just discard this tx since it is old
-			queuedTxes.maybeRemoveAccountAtIndex(index)
-			return nil, 0, true
+			p.discardedTxes = append(p.discardedTxes, tx)
+			queuedTxes.maybeRemoveAccount(sender)
+			return nil, common.Address{}, true
 		}
 
-		return tx, index, true
+		return tx, sender, true
 	}
+	return nil, common.Address{}, false
 }
 
 func snapWithTx(snap *snapshot.Snapshot, tx *types.Transaction, signer types.Signer) (*snapshot.Snapshot, error) {
@@ -255,3 +521,9 @@ func (p *pendingBatch) checkValidForQueue(tx *types.Transaction) error {
 	}
 	return nil
 }
+
+func (p *pendingBatch) popDiscardedTxes() []*types.Transaction {
+	txes := p.discardedTxes
+	p.discardedTxes = nil
+	return txes
+}
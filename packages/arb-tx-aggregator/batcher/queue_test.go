@@ -0,0 +1,178 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var testSigner = types.NewEIP155Signer(big.NewInt(1))
+
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, common.Address) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func signedTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, gasPrice int64) *types.Transaction {
+	t.Helper()
+	tx := types.NewTransaction(nonce, common.Address{1}, big.NewInt(0), 21000, big.NewInt(gasPrice), nil)
+	signed, err := types.SignTx(tx, testSigner, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func admit(t *testing.T, q *txQueues, tx *types.Transaction) []droppedTx {
+	t.Helper()
+	dropped, err := q.admitTransaction(tx, testSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dropped
+}
+
+func checkQueuedNonces(t *testing.T, q *txQueues, account common.Address, nonces ...uint64) {
+	t.Helper()
+	queue, ok := q.queues[account]
+	if !ok {
+		if len(nonces) > 0 {
+			t.Fatal("account has no queue")
+		}
+		return
+	}
+	if len(queue.txesByNonce) != len(nonces) {
+		t.Fatalf("expected %v queued txes but found %v", len(nonces), len(queue.txesByNonce))
+	}
+	for _, nonce := range nonces {
+		if _, ok := queue.txesByNonce[nonce]; !ok {
+			t.Error("missing tx with nonce", nonce)
+		}
+	}
+	if queue.maxNonce != nonces[len(nonces)-1] {
+		t.Error("max nonce is", queue.maxNonce, "but expected", nonces[len(nonces)-1])
+	}
+}
+
+func TestReplaceByFee(t *testing.T) {
+	key, account := newTestKey(t)
+	q := newTxQueues(QueueConfig{PriceBump: 10})
+	original := signedTx(t, key, 0, 100)
+	admit(t, q, original)
+
+	if _, err := q.admitTransaction(signedTx(t, key, 0, 109), testSigner); err != ErrReplaceUnderpriced {
+		t.Error("accepted underpriced replacement", err)
+	}
+
+	replacement := signedTx(t, key, 0, 110)
+	dropped := admit(t, q, replacement)
+	if len(dropped) != 1 || dropped[0].tx.Hash() != original.Hash() {
+		t.Fatal("original tx wasn't dropped", dropped)
+	}
+	if queued := q.queues[account].Peek(); queued.Hash() != replacement.Hash() {
+		t.Error("replacement isn't queued")
+	}
+	checkQueuedNonces(t, q, account, 0)
+}
+
+func TestAccountQueueLimit(t *testing.T) {
+	key, account := newTestKey(t)
+	q := newTxQueues(QueueConfig{MaxPerAccount: 2})
+	admit(t, q, signedTx(t, key, 0, 1))
+	admit(t, q, signedTx(t, key, 2, 1))
+
+	if _, err := q.admitTransaction(signedTx(t, key, 3, 1), testSigner); err != ErrAccountQueueFull {
+		t.Error("accepted tx past full account queue", err)
+	}
+
+	// A transaction filling the gap replaces the account's last one
+	dropped := admit(t, q, signedTx(t, key, 1, 1))
+	if len(dropped) != 1 || dropped[0].tx.Nonce() != 2 {
+		t.Fatal("last tx wasn't evicted", dropped)
+	}
+	checkQueuedNonces(t, q, account, 0, 1)
+}
+
+func TestQueueLimit(t *testing.T) {
+	cheapKey, cheapAccount := newTestKey(t)
+	key, account := newTestKey(t)
+	q := newTxQueues(QueueConfig{MaxQueued: 2})
+	admit(t, q, signedTx(t, cheapKey, 0, 1))
+	admit(t, q, signedTx(t, cheapKey, 1, 1))
+
+	if _, err := q.admitTransaction(signedTx(t, key, 0, 1), testSigner); err != ErrQueueFull {
+		t.Error("accepted tx which doesn't outbid the queue", err)
+	}
+
+	dropped := admit(t, q, signedTx(t, key, 0, 2))
+	if len(dropped) != 1 || dropped[0].tx.Nonce() != 1 {
+		t.Fatal("cheapest last tx wasn't evicted", dropped)
+	}
+	checkQueuedNonces(t, q, cheapAccount, 0)
+	checkQueuedNonces(t, q, account, 0)
+}
+
+func TestExpireDropsLaterNonces(t *testing.T) {
+	key, account := newTestKey(t)
+	q := newTxQueues(QueueConfig{TTL: time.Hour})
+	for nonce := uint64(0); nonce < 4; nonce++ {
+		admit(t, q, signedTx(t, key, nonce, 1))
+	}
+	now := time.Now()
+	queue := q.queues[account]
+	expired := queue.txesByNonce[1]
+	expired.Received = now.Add(-2 * time.Hour)
+	queue.txesByNonce[1] = expired
+
+	dropped := q.expire(now)
+	if len(dropped) != 3 {
+		t.Fatal("expected 3 dropped txes but got", len(dropped))
+	}
+	for i, d := range dropped {
+		if d.tx.Nonce() != uint64(i+1) {
+			t.Error("dropped unexpected tx", d.tx.Nonce())
+		}
+	}
+	checkQueuedNonces(t, q, account, 0)
+
+	// The account's pending nonce follows the remaining queue
+	admit(t, q, signedTx(t, key, 1, 1))
+	checkQueuedNonces(t, q, account, 0, 1)
+}
+
+func TestExpireRemovesEmptyAccount(t *testing.T) {
+	key, account := newTestKey(t)
+	q := newTxQueues(QueueConfig{TTL: time.Hour})
+	admit(t, q, signedTx(t, key, 0, 1))
+	if dropped := q.expire(time.Now().Add(2 * time.Hour)); len(dropped) != 1 {
+		t.Fatal("tx wasn't expired")
+	}
+	if _, ok := q.queues[account]; ok || len(q.accounts) != 0 {
+		t.Error("account still tracked after its queue emptied")
+	}
+}
@@ -0,0 +1,362 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
+)
+
+const (
+	// batchReceiptTimeout is how long to wait for a batch receipt before
+	// checking whether the L1 transaction was dropped
+	batchReceiptTimeout = 10 * time.Minute
+
+	// maxBatchRetryDelay caps the backoff between retries of a batch
+	maxBatchRetryDelay = 10 * time.Minute
+
+	// maxBatchRetries is how many times a failed batch is retried before its
+	// transactions are marked failed
+	maxBatchRetries = 5
+
+	// batchDropConfirmations is how many blocks must have passed since the
+	// nonce of a batch transaction was used by another transaction before
+	// the batch is considered dropped
+	batchDropConfirmations = 6
+)
+
+var (
+	// batchRetryDelay is how long to wait before the first retry of a
+	// batch. It doubles with each retry after that
+	batchRetryDelay = 10 * time.Second
+
+	// batchDeliveredFetchBlocks is how many L1 blocks of inbox messages are
+	// fetched at once when checking whether a batch was delivered
+	batchDeliveredFetchBlocks uint64 = 1000
+)
+
+var errBatchDropped = errors.New("batch transaction was dropped")
+
+// batchRetryBackoff returns how long to wait before the given retry of a
+// batch, counting from one
+func batchRetryBackoff(retry int) time.Duration {
+	delay := batchRetryDelay
+	for i := 1; i < retry && delay < maxBatchRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxBatchRetryDelay {
+		delay = maxBatchRetryDelay
+	}
+	return delay
+}
+
+func batchData(txes []*types.Transaction) ([]byte, error) {
+	batchTxes := make([]message.AbstractL2Message, 0, len(txes))
+	for _, tx := range txes {
+		batchTxes = append(batchTxes, message.SignedTransaction{Tx: tx})
+	}
+	batchTx, err := message.NewTransactionBatchFromMessages(batchTxes)
+	if err != nil {
+		return nil, err
+	}
+	return message.NewSafeL2Message(batchTx).AsData(), nil
+}
+
+// recover restores the queued transactions and unconfirmed batches saved
+// before the aggregator last stopped. Batches which were delivered to the
+// inbox in the meantime are completed and the rest are left to be confirmed
+// or resent
+func (m *Batcher) recover(ctx context.Context) {
+	queued, err := m.txIndex.Queued()
+	if err != nil {
+		log.Println("Error loading queued transactions", err)
+	}
+	var dropped []*types.Transaction
+	for _, tx := range queued {
+		if err := m.queuedTxes.addTransaction(tx, m.signer); err != nil {
+			dropped = append(dropped, tx)
+		}
+	}
+	m.markFailed(dropped, "dropped when the aggregator restarted")
+
+	batches, err := m.txIndex.PendingBatches()
+	if err != nil {
+		log.Println("Error loading pending batches", err)
+	}
+	for _, batch := range batches {
+		m.nextBatchSeq = batch.Seq + 1
+		delivered, err := m.batchDelivered(ctx, batch)
+		if err != nil {
+			log.Println("Error checking whether batch was delivered", err)
+		}
+		if delivered {
+			if err := m.txIndex.CompleteBatch(batch.Seq); err != nil {
+				log.Println("Error updating tx index", err)
+			}
+			continue
+		}
+		m.pendingSentBatches.PushBack(batch)
+	}
+	if len(queued) > 0 || m.pendingSentBatches.Len() > 0 {
+		log.Println("Recovered", len(queued)-len(dropped), "queued transactions and", m.pendingSentBatches.Len(), "pending batches")
+	}
+}
+
+// waitForBatch returns the successful receipt of the L1 transaction which
+// sent batch. It fails if the transaction reverted or is no longer known
+func (m *Batcher) waitForBatch(ctx context.Context, batch *txindex.Batch) (*types.Receipt, error) {
+	if batch.TxHash == (ethcommon.Hash{}) {
+		return nil, errors.New("batch was never sent")
+	}
+	if m.txManager != nil {
+		if mtx := m.txManager.Lookup(batch.TxHash); mtx != nil {
+			return m.waitForManagedBatch(ctx, mtx)
+		}
+	}
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, batchReceiptTimeout)
+		receipt, err := ethbridge.WaitForReceiptWithResultsSimple(waitCtx, m.client, batch.TxHash)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			if receipt.Status != 1 {
+				return nil, errors.New("batch transaction reverted")
+			}
+			return receipt, nil
+		}
+		_, _, err = m.client.TransactionByHash(ctx, batch.TxHash)
+		if !errors.Is(err, ethereum.NotFound) {
+			// The transaction is still pending or the node couldn't be
+			// reached so keep waiting
+			continue
+		}
+		// The node not knowing the transaction doesn't mean it can't be
+		// mined, so it's only resent once its nonce has been used
+		consumed, err := m.batchNonceConsumed(ctx, batch)
+		if err != nil {
+			log.Println("Error checking batch transaction nonce", err)
+			continue
+		}
+		if consumed {
+			return nil, errBatchDropped
+		}
+		log.Println("Batch transaction", batch.TxHash.Hex(), "is unknown but its nonce hasn't been used yet")
+	}
+}
+
+// batchNonceConsumed returns whether the nonce of the L1 transaction which
+// sent batch has been used by a transaction with enough confirmations. Since
+// there is no receipt for the batch transaction, that transaction can never
+// be mined and the batch can be resent without being posted twice
+func (m *Batcher) batchNonceConsumed(ctx context.Context, batch *txindex.Batch) (bool, error) {
+	if batch.From == (ethcommon.Address{}) {
+		return false, nil
+	}
+	header, err := m.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	if header.Number.Uint64() < batchDropConfirmations {
+		return false, nil
+	}
+	confirmed := new(big.Int).Sub(header.Number, big.NewInt(batchDropConfirmations))
+	nonce, err := m.client.NonceAt(ctx, batch.From, confirmed)
+	if err != nil {
+		return false, err
+	}
+	return nonce > batch.Nonce, nil
+}
+
+// batchTxSender returns the sender and nonce of the L1 transaction which sent
+// a batch. The sender is empty if they couldn't be found
+func (m *Batcher) batchTxSender(ctx context.Context, txHash ethcommon.Hash) (ethcommon.Address, uint64) {
+	tx, _, err := m.client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		log.Println("Error looking up batch transaction", err)
+		return ethcommon.Address{}, 0
+	}
+	from, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		log.Println("Error getting batch transaction sender", err)
+		return ethcommon.Address{}, 0
+	}
+	return from, tx.Nonce()
+}
+
+// waitForManagedBatch waits for a batch sent through the tx manager which
+// resends it with a higher gas price while it's stuck
+func (m *Batcher) waitForManagedBatch(ctx context.Context, mtx *ethbridge.ManagedTx) (*types.Receipt, error) {
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, batchReceiptTimeout)
+		receipt, err := mtx.Wait(waitCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == context.DeadlineExceeded {
+			log.Println("Batch transaction", mtx.Hash().Hex(), "is still", mtx.State())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if receipt.Status != 1 {
+			return nil, errors.New("batch transaction reverted")
+		}
+		return receipt, nil
+	}
+}
+
+// retryBatch handles a batch whose L1 transaction failed. If the batch
+// reached the inbox anyway it's completed, otherwise it's resent after a
+// backoff. A batch which still fails after maxBatchRetries is given up on and
+// its transactions are marked failed
+func (m *Batcher) retryBatch(ctx context.Context, batch *txindex.Batch, reason error) {
+	delivered, err := m.batchDelivered(ctx, batch)
+	if err != nil {
+		log.Println("Error checking whether batch was delivered", err)
+	}
+	if delivered {
+		m.Lock()
+		m.completeFrontBatch()
+		m.Unlock()
+		return
+	}
+
+	m.Lock()
+	m.batchRetries[batch.Seq]++
+	retry := m.batchRetries[batch.Seq]
+	m.Unlock()
+	if retry > maxBatchRetries {
+		log.Println("Giving up on batch", batch.Seq, "after", maxBatchRetries, "retries:", reason)
+		m.markFailed(batch.Txes, fmt.Sprintf("batch couldn't be posted: %v", reason))
+		m.Lock()
+		m.failFrontBatch()
+		m.Unlock()
+		return
+	}
+
+	// Every failed attempt waits before the next one so that a batch which
+	// keeps failing doesn't spin or keep paying for L1 transactions
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(batchRetryBackoff(retry)):
+	}
+
+	log.Println("Resubmitting batch", batch.Seq, "after error:", reason)
+	batchResubmitCounter.Inc(1)
+	data, err := batchData(batch.Txes)
+	if err != nil {
+		log.Println("Error encoding batch", err)
+		return
+	}
+	txHash, err := m.globalInbox.SendL2MessageNoWait(ctx, data)
+	if err != nil {
+		log.Println("Error resubmitting batch", err)
+		return
+	}
+	from, nonce := m.batchTxSender(ctx, txHash.ToEthHash())
+	m.Lock()
+	batch.TxHash = txHash.ToEthHash()
+	batch.From = from
+	batch.Nonce = nonce
+	m.Unlock()
+	if err := m.txIndex.MarkBatched(batch); err != nil {
+		log.Println("Error updating tx index", err)
+	}
+}
+
+// batchDelivered checks whether the inbox has received a message containing
+// batch since it was first sent. The inbox is searched a page of blocks at a
+// time so that a batch which has been pending for long doesn't make one huge
+// log query
+func (m *Batcher) batchDelivered(ctx context.Context, batch *txindex.Batch) (bool, error) {
+	data, err := batchData(batch.Txes)
+	if err != nil {
+		return false, err
+	}
+	header, err := m.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	head := header.Number.Uint64()
+	for pageStart := batch.L1Block; pageStart <= head; pageStart += batchDeliveredFetchBlocks {
+		pageEnd := pageStart + batchDeliveredFetchBlocks - 1
+		if pageEnd > head {
+			pageEnd = head
+		}
+		events, err := m.globalInbox.GetDeliveredEvents(
+			ctx,
+			new(big.Int).SetUint64(pageStart),
+			new(big.Int).SetUint64(pageEnd),
+		)
+		if err != nil {
+			return false, err
+		}
+		for _, ev := range events {
+			if bytes.Equal(ev.Message.Data, data) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// completeFrontBatch removes the oldest pending batch once it's been
+// delivered. It must be called with the lock held
+func (m *Batcher) completeFrontBatch() {
+	batch := m.pendingSentBatches.Front().Value.(*txindex.Batch)
+	batchesPostedCounter.Inc(1)
+	m.lastBatchReceipt = time.Now()
+	if sentAt, ok := m.batchSentAt[batch.Seq]; ok {
+		batchLatencyTimer.UpdateSince(sentAt)
+	}
+	m.removeFrontBatch()
+}
+
+// failFrontBatch removes the oldest pending batch once it's been given up
+// on. It must be called with the lock held
+func (m *Batcher) failFrontBatch() {
+	batchesFailedCounter.Inc(1)
+	m.removeFrontBatch()
+}
+
+// removeFrontBatch must be called with the lock held
+func (m *Batcher) removeFrontBatch() {
+	batch := m.pendingSentBatches.Remove(m.pendingSentBatches.Front()).(*txindex.Batch)
+	delete(m.batchSentAt, batch.Seq)
+	delete(m.batchRetries, batch.Seq)
+	if err := m.txIndex.CompleteBatch(batch.Seq); err != nil {
+		log.Println("Error updating tx index", err)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+)
+
+func TestBatchRetryBackoff(t *testing.T) {
+	expected := []time.Duration{
+		batchRetryDelay,
+		2 * batchRetryDelay,
+		4 * batchRetryDelay,
+	}
+	for i, delay := range expected {
+		if backoff := batchRetryBackoff(i + 1); backoff != delay {
+			t.Errorf("retry %v waited %v but expected %v", i+1, backoff, delay)
+		}
+	}
+	if backoff := batchRetryBackoff(100); backoff != maxBatchRetryDelay {
+		t.Error("backoff wasn't capped", backoff)
+	}
+}
+
+func TestRetryBatchGivesUp(t *testing.T) {
+	defer func(delay time.Duration) {
+		batchRetryDelay = delay
+	}(batchRetryDelay)
+	batchRetryDelay = time.Millisecond
+
+	m, inbox, cleanup := newAdminTestBatcher(t, context.Background())
+	defer cleanup()
+	key, _ := newTestKey(t)
+	batch := &txindex.Batch{Seq: 1, L1Block: 5, Txes: []*types.Transaction{signedTx(t, key, 0, 1)}}
+	if err := m.txIndex.MarkBatched(batch); err != nil {
+		t.Fatal(err)
+	}
+	m.pendingSentBatches.PushBack(batch)
+
+	reverted := errors.New("batch transaction reverted")
+	for i := 0; i < maxBatchRetries; i++ {
+		m.retryBatch(context.Background(), batch, reverted)
+	}
+	if len(inbox.batches) != maxBatchRetries {
+		t.Fatal("batch was resent", len(inbox.batches), "times but expected", maxBatchRetries)
+	}
+	if m.pendingSentBatches.Len() != 1 {
+		t.Fatal("batch was removed before running out of retries")
+	}
+
+	m.retryBatch(context.Background(), batch, reverted)
+	if len(inbox.batches) != maxBatchRetries {
+		t.Error("batch was resent after running out of retries")
+	}
+	if m.pendingSentBatches.Len() != 0 {
+		t.Error("batch wasn't removed after running out of retries")
+	}
+	entry, err := m.txIndex.Get(batch.Txes[0].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || entry.Status != txindex.Failed {
+		t.Error("transaction in abandoned batch wasn't marked failed", entry)
+	}
+	pending, err := m.txIndex.PendingBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Error("abandoned batch is still pending in the tx index")
+	}
+}
+
+func TestBatchDeliveredPagesThroughBlocks(t *testing.T) {
+	defer func(fetchBlocks uint64) {
+		batchDeliveredFetchBlocks = fetchBlocks
+	}(batchDeliveredFetchBlocks)
+	batchDeliveredFetchBlocks = 3
+
+	m, inbox, cleanup := newAdminTestBatcher(t, context.Background())
+	defer cleanup()
+	key, _ := newTestKey(t)
+	batch := &txindex.Batch{Seq: 1, L1Block: 2, Txes: []*types.Transaction{signedTx(t, key, 0, 1)}}
+	data, err := batchData(batch.Txes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The L1 head is at block 10 so every page is searched when the batch
+	// wasn't delivered
+	delivered, err := m.batchDelivered(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered {
+		t.Error("undelivered batch was found")
+	}
+	expected := [][2]uint64{{2, 4}, {5, 7}, {8, 10}}
+	if len(inbox.queries) != len(expected) {
+		t.Fatal("expected queries", expected, "but got", inbox.queries)
+	}
+	for i, query := range expected {
+		if inbox.queries[i] != query {
+			t.Error("expected queries", expected, "but got", inbox.queries)
+		}
+	}
+
+	// The search stops at the page containing the batch
+	inbox.queries = nil
+	inbox.delivered = map[uint64][]byte{6: data}
+	delivered, err = m.batchDelivered(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !delivered {
+		t.Error("delivered batch wasn't found")
+	}
+	if len(inbox.queries) != 2 {
+		t.Error("search didn't stop once the batch was found", inbox.queries)
+	}
+}
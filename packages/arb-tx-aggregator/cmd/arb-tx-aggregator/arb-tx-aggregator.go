@@ -17,17 +17,22 @@
 package main
 
 import (
-	"context"
 	"flag"
+	"fmt"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/rpc"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/rpcpolicy"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/ethclient"
+	errors2 "github.com/pkg/errors"
 
-	utils2 "github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/utils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
@@ -36,10 +41,73 @@ import (
 )
 
 func main() {
+	// Errors are returned from run rather than exiting in it so that its
+	// deferred cleanup, such as shutting down the metrics server, runs
+	if err := run(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 	walletArgs := utils.AddWalletFlags(fs)
-	rpcVars := utils2.AddRPCFlags(fs)
+	configPath := fs.String(
+		"config",
+		"",
+		"path to a YAML config file (settings can also be overridden by "+rpc.EnvPrefix+"_* environment variables)",
+	)
+	certFile := fs.String("cert", "", "path to certificate file (if using ssl)")
+	keyFile := fs.String("privkey", "", "path to private key file (if using ssl)")
 	keepPendingState := fs.Bool("pending", false, "enable pending state tracking")
+	ordering := fs.String(
+		"ordering",
+		batcher.RandomOrdering,
+		"order in which queued transactions are batched: random, fifo or gasprice",
+	)
+	priceBump := fs.Uint64(
+		"priceBump",
+		batcher.DefaultQueueConfig.PriceBump,
+		"minimum gas price increase in percent to replace a queued transaction",
+	)
+	maxQueuedPerAccount := fs.Int(
+		"maxQueuedPerAccount",
+		batcher.DefaultQueueConfig.MaxPerAccount,
+		"maximum number of queued transactions per account (0 for no limit)",
+	)
+	maxQueued := fs.Int(
+		"maxQueued",
+		batcher.DefaultQueueConfig.MaxQueued,
+		"maximum number of queued transactions (0 for no limit)",
+	)
+	queueTTL := fs.Duration(
+		"queueTTL",
+		batcher.DefaultQueueConfig.TTL,
+		"how long a transaction can stay queued before it's dropped (0 for no limit)",
+	)
+	l1ResendInterval := fs.Duration(
+		"l1ResendInterval",
+		utils.DefaultL1Config.ResendInterval,
+		"how long to wait for a batch transaction before resending it with a higher gas price",
+	)
+	l1GasPriceBump := fs.Uint64(
+		"l1GasPriceBump",
+		utils.DefaultL1Config.GasPriceBump,
+		"percentage increase in gas price each time a batch transaction is resent",
+	)
+	maxL1GasPrice := fs.Uint64(
+		"maxL1GasPrice",
+		0,
+		"maximum gas price in gwei for resent batch transactions (0 for no limit)",
+	)
+	archiveMode := fs.Bool("archive", false, "keep all checkpoints to support queries against any historical block")
+	rpcConfigPath := fs.String("rpcConfig", "", "path to a YAML file configuring api keys, rate limits and method access for the rpc servers")
+	upstreams := fs.String(
+		"upstreams",
+		"",
+		"comma separated web3 rpc urls of aggregators to forward transactions to instead of batching them (no L1 key needed)",
+	)
+	metricsAddr := fs.String("metricsAddr", "", "address to serve prometheus metrics on at /metrics (disabled if empty)")
 
 	maxBatchTime := fs.Int64(
 		"maxBatchTime",
@@ -49,14 +117,13 @@ func main() {
 
 	//go http.ListenAndServe("localhost:6060", nil)
 
-	err := fs.Parse(os.Args[1:])
-	if err != nil {
-		log.Fatal(err)
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return err
 	}
 
 	if fs.NArg() != 3 {
-		log.Fatalf(
-			"usage: arb-tx-aggregator [--maxBatchTime=NumSeconds] %v %v",
+		return fmt.Errorf(
+			"usage: arb-tx-aggregator [--config=file.yaml] [--maxBatchTime=NumSeconds] [--upstreams=url1,url2] %v %v",
 			utils.WalletArgsString,
 			utils.RollupArgsString,
 		)
@@ -64,41 +131,104 @@ func main() {
 
 	rollupArgs := utils.ParseRollupCommand(fs, 0)
 
-	auth, err := utils.GetKeystore(rollupArgs.ValidatorFolder, walletArgs, fs)
-	if err != nil {
-		log.Fatal(err)
+	cfg := rpc.DefaultConfig()
+	cfg.Checkpoint.Path = filepath.Join(rollupArgs.ValidatorFolder, "checkpoint_db")
+	if err := utils.LoadConfig(*configPath, rpc.EnvPrefix, cfg); err != nil {
+		return err
+	}
+
+	// Flags given on the command line override the config file
+	var rpcLimitsErr error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cert":
+			cfg.RPC.TLSCert = *certFile
+		case "privkey":
+			cfg.RPC.TLSKey = *keyFile
+		case "metricsAddr":
+			cfg.RPC.MetricsAddr = *metricsAddr
+		case "rpcConfig":
+			cfg.RPC.Limits, rpcLimitsErr = rpcpolicy.LoadConfig(*rpcConfigPath, rpc.EnvPrefix+"_RPC_LIMITS")
+		case "pending":
+			cfg.Batcher.KeepPendingState = *keepPendingState
+		case "ordering":
+			cfg.Batcher.Ordering = *ordering
+		case "priceBump":
+			cfg.Batcher.PriceBump = *priceBump
+		case "maxQueuedPerAccount":
+			cfg.Batcher.MaxQueuedPerAccount = *maxQueuedPerAccount
+		case "maxQueued":
+			cfg.Batcher.MaxQueued = *maxQueued
+		case "queueTTL":
+			cfg.Batcher.QueueTTL = *queueTTL
+		case "maxBatchTime":
+			cfg.Batcher.MaxBatchTime = time.Duration(*maxBatchTime) * time.Second
+		case "l1ResendInterval":
+			cfg.L1.ResendInterval = *l1ResendInterval
+		case "l1GasPriceBump":
+			cfg.L1.GasPriceBump = *l1GasPriceBump
+		case "maxL1GasPrice":
+			cfg.L1.MaxGasPrice = *maxL1GasPrice
+		case "archive":
+			cfg.Checkpoint.Archive = *archiveMode
+		case "upstreams":
+			cfg.Forwarder.Upstreams = nil
+			for _, upstream := range strings.Split(*upstreams, ",") {
+				if upstream = strings.TrimSpace(upstream); upstream != "" {
+					cfg.Forwarder.Upstreams = append(cfg.Forwarder.Upstreams, upstream)
+				}
+			}
+		}
+	})
+	if rpcLimitsErr != nil {
+		return rpcLimitsErr
+	}
+	if err := cfg.Validate(); err != nil {
+		return errors2.Wrap(err, "invalid config")
+	}
+
+	ctx, cancel := utils.SignalContext()
+	defer cancel()
+
+	if cfg.RPC.MetricsAddr != "" {
+		metricsDone := arbmetrics.Launch(ctx, cfg.RPC.MetricsAddr)
+		defer func() {
+			cancel()
+			<-metricsDone
+		}()
 	}
 
 	ethclint, err := ethclient.Dial(rollupArgs.EthURL)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	if err := arbbridge.WaitForBalance(
-		context.Background(),
-		ethbridge.NewEthClient(ethclint),
-		common.Address{},
-		common.NewAddressFromEth(auth.From),
-	); err != nil {
-		log.Fatal(err)
+	// A forwarder doesn't send L1 transactions so it doesn't need a wallet
+	var auth *bind.TransactOpts
+	if !cfg.Forwarding() {
+		auth, err = utils.GetKeystore(rollupArgs.ValidatorFolder, walletArgs, fs)
+		if err != nil {
+			return err
+		}
+
+		if err := arbbridge.WaitForBalance(
+			ctx,
+			ethbridge.NewEthClient(ethclint),
+			common.Address{},
+			common.NewAddressFromEth(auth.From),
+		); err != nil {
+			return err
+		}
 	}
 
 	contractFile := filepath.Join(rollupArgs.ValidatorFolder, "contract.mexe")
-	dbPath := filepath.Join(rollupArgs.ValidatorFolder, "checkpoint_db")
 
-	if err := rpc.LaunchAggregator(
-		context.Background(),
+	return rpc.LaunchAggregator(
+		ctx,
 		ethclint,
 		auth,
 		rollupArgs.Address,
 		contractFile,
-		dbPath,
-		"1235",
-		"8547",
-		rpcVars,
-		time.Duration(*maxBatchTime)*time.Second,
-		*keepPendingState,
-	); err != nil {
-		log.Fatal(err)
-	}
+		cfg,
+	)
 }
@@ -0,0 +1,392 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package forwarder implements an aggregator mode which serves reads from its
+// own TxDB but relays transactions to upstream aggregators instead of posting
+// batches itself, so it doesn't need a funded L1 key
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const (
+	// forwardTimeout bounds each attempt to send a transaction upstream
+	forwardTimeout = 10 * time.Second
+	// queryTimeout bounds requests made to answer queries from clients
+	queryTimeout = 5 * time.Second
+	// upstreamCheckInterval is how often a forwarder which failed over
+	// checks whether a preferred upstream is reachable again
+	upstreamCheckInterval = 30 * time.Second
+)
+
+// Policy is reported as the ordering policy in queue stats since a forwarder
+// doesn't queue transactions
+const Policy = "forward"
+
+var (
+	forwardedCounter = arbmetrics.NewCounter("arb/forwarder/forwarded")
+	failoverCounter  = arbmetrics.NewCounter("arb/forwarder/failovers")
+)
+
+var ErrNoUpstream = errors.New("no upstream aggregator is reachable")
+
+// errCodeLimitExceeded is returned by upstreams which are rate limiting
+// requests
+const errCodeLimitExceeded = -32005
+
+// unavailableErrors are the messages of errors upstreams return when they
+// can't accept any transactions. Aggregators report every error from
+// eth_sendRawTransaction with the same code so they're told apart by message
+var unavailableErrors = []error{
+	batcher.ErrNotRunning,
+	// Returned by upstreams which are forwarders themselves
+	ErrNoUpstream,
+}
+
+type upstream struct {
+	url    string
+	client *rpc.Client
+}
+
+// Forwarder relays transactions to a list of upstream aggregators in order of
+// preference. It fails over to the next upstream when one can't be reached
+// and returns to a preferred upstream once it recovers
+type Forwarder struct {
+	signer    types.Signer
+	db        *txdb.TxDB
+	txIndex   *txindex.Index
+	upstreams []*upstream
+
+	sync.Mutex
+	// current is the index of the upstream transactions are sent to first
+	current int
+
+	newTxFeed event.Feed
+
+	stopped sync.WaitGroup
+}
+
+// New creates a forwarder which relays to the web3 rpc endpoints at urls,
+// in order of preference. It runs until ctx is cancelled
+func New(
+	ctx context.Context,
+	db *txdb.TxDB,
+	txIndex *txindex.Index,
+	rollupAddress common.Address,
+	urls []string,
+) (*Forwarder, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("forwarder needs at least one upstream")
+	}
+	f := &Forwarder{
+		signer:  types.NewEIP155Signer(message.ChainAddressToID(rollupAddress)),
+		db:      db,
+		txIndex: txIndex,
+	}
+	for _, url := range urls {
+		client, err := rpc.DialContext(ctx, url)
+		if err != nil {
+			return nil, errors2.Wrapf(err, "error connecting to upstream %v", url)
+		}
+		f.upstreams = append(f.upstreams, &upstream{url: url, client: client})
+	}
+
+	f.stopped.Add(2)
+	go f.indexIncludedTransactions(ctx)
+	go f.checkUpstreams(ctx)
+	return f, nil
+}
+
+// Wait blocks until the forwarder has stopped after the context passed to
+// New is cancelled
+func (f *Forwarder) Wait() {
+	f.stopped.Wait()
+	for _, up := range f.upstreams {
+		up.client.Close()
+	}
+}
+
+// SendTransaction relays tx to the current upstream, failing over to the
+// others in turn if it can't be reached or can't accept transactions right
+// now. A transaction rejected as invalid by an upstream isn't sent to the
+// others since they'd reject it too
+func (f *Forwarder) SendTransaction(tx *types.Transaction) (common.Hash, error) {
+	if _, err := types.Sender(f.signer, tx); err != nil {
+		log.Println("Error processing transaction", err)
+		return common.Hash{}, err
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	f.Lock()
+	start := f.current
+	f.Unlock()
+
+	var lastErr error
+	for i := range f.upstreams {
+		index := (start + i) % len(f.upstreams)
+		up := f.upstreams[index]
+		ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+		var txHash ethcommon.Hash
+		err := up.client.CallContext(ctx, &txHash, "eth_sendRawTransaction", hexutil.Bytes(data))
+		cancel()
+		if err == nil {
+			if index != start {
+				f.failover(start, index)
+			}
+			return f.forwarded(tx), nil
+		}
+		if !retryable(err) {
+			return common.Hash{}, err
+		}
+		log.Println("Error forwarding transaction to", up.url, err)
+		lastErr = err
+	}
+	return common.Hash{}, errors2.Wrap(ErrNoUpstream, lastErr.Error())
+}
+
+// retryable returns whether err means that the upstream couldn't handle a
+// transaction rather than that the transaction was rejected, in which case
+// another upstream may accept it
+func retryable(err error) bool {
+	rpcErr, ok := err.(rpc.Error)
+	if !ok {
+		// The upstream couldn't be reached or refused the request over http
+		return true
+	}
+	if rpcErr.ErrorCode() == errCodeLimitExceeded {
+		return true
+	}
+	for _, unavailable := range unavailableErrors {
+		if strings.Contains(rpcErr.Error(), unavailable.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Forwarder) forwarded(tx *types.Transaction) common.Hash {
+	forwardedCounter.Inc(1)
+	if err := f.txIndex.MarkForwarded(tx); err != nil {
+		log.Println("Error updating tx index", err)
+	}
+	f.newTxFeed.Send(tx)
+	return common.NewHashFromEth(tx.Hash())
+}
+
+// failover switches from upstream from to upstream to unless another request
+// already switched
+func (f *Forwarder) failover(from int, to int) {
+	f.Lock()
+	defer f.Unlock()
+	if f.current != from {
+		return
+	}
+	log.Println("Failing over from upstream", f.upstreams[from].url, "to", f.upstreams[to].url)
+	failoverCounter.Inc(1)
+	f.current = to
+}
+
+// checkUpstreams periodically returns to the most preferred upstream which
+// is reachable
+func (f *Forwarder) checkUpstreams(ctx context.Context) {
+	defer f.stopped.Done()
+	ticker := time.NewTicker(upstreamCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.returnToPreferred(ctx)
+		}
+	}
+}
+
+// returnToPreferred switches to the first upstream before the current one
+// which is reachable
+func (f *Forwarder) returnToPreferred(ctx context.Context) {
+	f.Lock()
+	current := f.current
+	f.Unlock()
+	for i := 0; i < current; i++ {
+		if f.reachable(ctx, f.upstreams[i]) {
+			f.Lock()
+			if f.current == current {
+				log.Println("Returning to upstream", f.upstreams[i].url)
+				f.current = i
+			}
+			f.Unlock()
+			return
+		}
+	}
+}
+
+func (f *Forwarder) reachable(ctx context.Context, up *upstream) bool {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var blockNum hexutil.Uint64
+	return up.client.CallContext(ctx, &blockNum, "eth_blockNumber") == nil
+}
+
+func (f *Forwarder) currentUpstream() *upstream {
+	f.Lock()
+	defer f.Unlock()
+	return f.upstreams[f.current]
+}
+
+// PendingTransactionCount asks the current upstream for the account's
+// pending nonce since it holds the account's queued transactions. It returns
+// nil if the upstream can't be reached
+func (f *Forwarder) PendingTransactionCount(account common.Address) *uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var count hexutil.Uint64
+	err := f.currentUpstream().client.CallContext(ctx, &count, "eth_getTransactionCount", account.ToEthAddress(), "pending")
+	if err != nil {
+		return nil
+	}
+	res := uint64(count)
+	return &res
+}
+
+// PendingSnapshot returns the latest state since a forwarder has no pending
+// transactions of its own
+func (f *Forwarder) PendingSnapshot() *snapshot.Snapshot {
+	return f.db.LatestSnapshot()
+}
+
+type upstreamStatus struct {
+	Status      string          `json:"status"`
+	BatchTxHash *ethcommon.Hash `json:"batchTxHash"`
+	Error       string          `json:"error"`
+}
+
+// TransactionStatus returns the last known state of a transaction forwarded
+// by this node. Transactions which haven't been included yet are looked up
+// on the upstreams so that batching and failures are reported
+func (f *Forwarder) TransactionStatus(txHash ethcommon.Hash) (*txindex.Entry, error) {
+	entry, err := f.txIndex.Get(txHash)
+	if err != nil || entry == nil {
+		return entry, err
+	}
+	if entry.Status != txindex.Forwarded {
+		return entry, nil
+	}
+
+	f.Lock()
+	start := f.current
+	f.Unlock()
+	for i := range f.upstreams {
+		up := f.upstreams[(start+i)%len(f.upstreams)]
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		var status *upstreamStatus
+		err := up.client.CallContext(ctx, &status, "arb_getTransactionStatus", txHash)
+		cancel()
+		if err != nil || status == nil {
+			continue
+		}
+		switch status.Status {
+		case txindex.Batched.String():
+			if status.BatchTxHash == nil {
+				return entry, nil
+			}
+			if err := f.txIndex.MarkUpstreamBatched(txHash, *status.BatchTxHash); err != nil {
+				return nil, err
+			}
+		case txindex.Failed.String():
+			if err := f.txIndex.MarkFailed([]ethcommon.Hash{txHash}, status.Error); err != nil {
+				return nil, err
+			}
+		default:
+			return entry, nil
+		}
+		return f.txIndex.Get(txHash)
+	}
+	return entry, nil
+}
+
+func (f *Forwarder) QueueStats() batcher.QueueStats {
+	return batcher.QueueStats{
+		Policy:  Policy,
+		Buckets: make(map[string]int),
+	}
+}
+
+// SubscribeNewTransactions registers ch to receive every transaction
+// forwarded upstream
+func (f *Forwarder) SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription {
+	return f.newTxFeed.Subscribe(ch)
+}
+
+// Valid always returns true since a forwarder can recover from any upstream
+// failure without restarting
+func (f *Forwarder) Valid() bool {
+	return true
+}
+
+// LastBatchReceipt returns the zero time since a forwarder doesn't post
+// batches
+func (f *Forwarder) LastBatchReceipt() time.Time {
+	return time.Time{}
+}
+
+// indexIncludedTransactions records the block and position of every
+// forwarded transaction once its result is saved
+func (f *Forwarder) indexIncludedTransactions(ctx context.Context) {
+	defer f.stopped.Done()
+	blocks := make(chan *txdb.BlockEvent, 128)
+	sub := f.db.SubscribeBlockEvents(blocks)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-blocks:
+			blockNum := ev.BlockInfo.BlockNum.Uint64()
+			for _, res := range ev.Results {
+				txHash := res.IncomingRequest.MessageID.ToEthHash()
+				if err := f.txIndex.MarkIncluded(txHash, blockNum, res.TxIndex.Uint64()); err != nil {
+					log.Println("Error updating tx index", err)
+				}
+			}
+		}
+	}
+}
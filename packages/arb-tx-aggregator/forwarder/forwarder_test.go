@@ -0,0 +1,231 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwarder
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+)
+
+var testSigner = types.NewEIP155Signer(big.NewInt(1))
+
+type upstreamError struct {
+	code    int
+	message string
+}
+
+func (e *upstreamError) Error() string {
+	return e.message
+}
+
+func (e *upstreamError) ErrorCode() int {
+	return e.code
+}
+
+// testUpstream is the eth namespace of an upstream aggregator which accepts
+// every transaction unless err is set
+type testUpstream struct {
+	sync.Mutex
+	err      error
+	received []*types.Transaction
+}
+
+func (u *testUpstream) SendRawTransaction(data hexutil.Bytes) (ethcommon.Hash, error) {
+	u.Lock()
+	defer u.Unlock()
+	if u.err != nil {
+		return ethcommon.Hash{}, u.err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return ethcommon.Hash{}, err
+	}
+	u.received = append(u.received, tx)
+	return tx.Hash(), nil
+}
+
+func (u *testUpstream) BlockNumber() hexutil.Uint64 {
+	return 1
+}
+
+func (u *testUpstream) receivedCount() int {
+	u.Lock()
+	defer u.Unlock()
+	return len(u.received)
+}
+
+// newTestForwarder starts an http server for each upstream and returns a
+// forwarder relaying to them in order
+func newTestForwarder(t *testing.T, upstreams ...*testUpstream) (*Forwarder, []*httptest.Server) {
+	t.Helper()
+	f := &Forwarder{
+		signer:  testSigner,
+		txIndex: txindex.New(memorydb.New()),
+	}
+	var servers []*httptest.Server
+	for _, up := range upstreams {
+		server := rpc.NewServer()
+		if err := server.RegisterName("eth", up); err != nil {
+			t.Fatal(err)
+		}
+		httpServer := httptest.NewServer(server)
+		client, err := rpc.Dial(httpServer.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.upstreams = append(f.upstreams, &upstream{url: httpServer.URL, client: client})
+		servers = append(servers, httpServer)
+	}
+	return f, servers
+}
+
+func closeServers(f *Forwarder, servers []*httptest.Server) {
+	for i, server := range servers {
+		f.upstreams[i].client.Close()
+		server.Close()
+	}
+}
+
+func testTx(t *testing.T) *types.Transaction {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction(0, ethcommon.Address{1}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	signed, err := types.SignTx(tx, testSigner, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestFailover(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failover bool
+	}{
+		{"rate limited", &upstreamError{errCodeLimitExceeded, "rate limit exceeded"}, true},
+		{"batcher stopped", &upstreamError{-32000, batcher.ErrNotRunning.Error()}, true},
+		{
+			"upstream forwarder without upstreams",
+			&upstreamError{-32000, errors2.Wrap(ErrNoUpstream, "connection refused").Error()},
+			true,
+		},
+		{"invalid transaction", &upstreamError{-32000, "nonce too low"}, false},
+		{"internal error", &upstreamError{-32603, "internal error"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first := &testUpstream{err: test.err}
+			second := &testUpstream{}
+			f, servers := newTestForwarder(t, first, second)
+			defer closeServers(f, servers)
+
+			tx := testTx(t)
+			txHash, err := f.SendTransaction(tx)
+			if !test.failover {
+				if err == nil || second.receivedCount() != 0 {
+					t.Fatal("rejected transaction was sent to another upstream")
+				}
+				if f.current != 0 {
+					t.Error("failed over after transaction was rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txHash.ToEthHash() != tx.Hash() || second.receivedCount() != 1 {
+				t.Error("transaction wasn't sent to the next upstream")
+			}
+			if f.current != 1 {
+				t.Error("didn't fail over to the next upstream")
+			}
+			entry, err := f.txIndex.Get(tx.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry == nil || entry.Status != txindex.Forwarded {
+				t.Error("forwarded transaction wasn't indexed", entry)
+			}
+		})
+	}
+}
+
+func TestFailoverUnreachable(t *testing.T) {
+	first := &testUpstream{}
+	second := &testUpstream{}
+	f, servers := newTestForwarder(t, first, second)
+	defer closeServers(f, servers)
+
+	servers[0].Close()
+	if _, err := f.SendTransaction(testTx(t)); err != nil {
+		t.Fatal(err)
+	}
+	if f.current != 1 || second.receivedCount() != 1 {
+		t.Error("didn't fail over from unreachable upstream")
+	}
+
+	servers[1].Close()
+	_, err := f.SendTransaction(testTx(t))
+	if errors2.Cause(err) != ErrNoUpstream {
+		t.Error("wrong error with every upstream unreachable", err)
+	}
+}
+
+func TestReturnToPreferred(t *testing.T) {
+	ctx := context.Background()
+	upstreams := []*testUpstream{{}, {}, {}}
+	f, servers := newTestForwarder(t, upstreams...)
+	defer closeServers(f, servers)
+
+	// The most preferred upstream is still down so the forwarder moves to
+	// the second one
+	f.current = 2
+	servers[0].Close()
+	f.returnToPreferred(ctx)
+	if f.current != 1 {
+		t.Fatal("didn't return to reachable upstream", f.current)
+	}
+	f.returnToPreferred(ctx)
+	if f.current != 1 {
+		t.Error("moved to unreachable upstream", f.current)
+	}
+	if _, err := f.SendTransaction(testTx(t)); err != nil {
+		t.Fatal(err)
+	}
+	if upstreams[1].receivedCount() != 1 {
+		t.Error("transaction wasn't sent to the preferred reachable upstream")
+	}
+}
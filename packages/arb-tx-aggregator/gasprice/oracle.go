@@ -0,0 +1,285 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+)
+
+type Config struct {
+	// Blocks is the number of recent blocks used to suggest a gas price
+	Blocks int
+	// Batches is the number of recent batches used to estimate L1 costs
+	Batches int
+	// Percentile of recent transaction gas prices used as the L2 component
+	// of the suggested price
+	Percentile int
+	// HistoryBlocks is the number of blocks available to FeeHistory
+	HistoryBlocks int
+	// MinPrice is the lowest gas price that will ever be suggested
+	MinPrice *big.Int
+}
+
+var DefaultConfig = Config{
+	Blocks:        20,
+	Batches:       20,
+	Percentile:    60,
+	HistoryBlocks: 1024,
+	MinPrice:      big.NewInt(0),
+}
+
+type blockFees struct {
+	number   uint64
+	gasUsed  *big.Int
+	gasLimit *big.Int
+	txCount  uint64
+	// baseFee is the estimated L1 cost per unit of L2 gas when the block
+	// was added
+	baseFee *big.Int
+	// prices holds the gas price paid by each transaction in the block,
+	// sorted in ascending order
+	prices []*big.Int
+}
+
+type batchCost struct {
+	l1Cost  *big.Int
+	txCount uint64
+}
+
+// Oracle suggests gas prices based on the prices paid in recent blocks and
+// on the cost of posting recent batches to L1
+type Oracle struct {
+	cfg Config
+
+	sync.Mutex
+	blocks  []*blockFees
+	batches []batchCost
+}
+
+func NewOracle(cfg Config) *Oracle {
+	return &Oracle{cfg: cfg}
+}
+
+// Follow adds every block saved to db until ctx is cancelled
+func (o *Oracle) Follow(ctx context.Context, db *txdb.TxDB) {
+	blocks := make(chan *txdb.BlockEvent, 128)
+	sub := db.SubscribeBlockEvents(blocks)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-blocks:
+			o.AddBlock(ev.BlockInfo, ev.Results)
+		}
+	}
+}
+
+func (o *Oracle) AddBlock(info *evm.BlockInfo, results []*evm.TxResult) {
+	prices := make([]*big.Int, 0, len(results))
+	for _, res := range results {
+		prices = append(prices, new(big.Int).Set(res.GasPrice))
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+
+	o.Lock()
+	defer o.Unlock()
+	o.blocks = append(o.blocks, &blockFees{
+		number:   info.BlockNum.Uint64(),
+		gasUsed:  new(big.Int).Set(info.BlockStats.GasUsed),
+		gasLimit: new(big.Int).Set(info.GasLimit),
+		txCount:  info.BlockStats.TxCount.Uint64(),
+		baseFee:  o.l1CostPerGas(),
+		prices:   prices,
+	})
+	if len(o.blocks) > o.cfg.HistoryBlocks {
+		o.blocks = o.blocks[len(o.blocks)-o.cfg.HistoryBlocks:]
+	}
+}
+
+// AddBatch records the L1 cost of posting a batch containing txCount
+// transactions
+func (o *Oracle) AddBatch(l1GasUsed uint64, l1GasPrice *big.Int, txCount int) {
+	if txCount == 0 {
+		return
+	}
+	l1Cost := new(big.Int).Mul(new(big.Int).SetUint64(l1GasUsed), l1GasPrice)
+
+	o.Lock()
+	defer o.Unlock()
+	o.batches = append(o.batches, batchCost{l1Cost: l1Cost, txCount: uint64(txCount)})
+	if len(o.batches) > o.cfg.Batches {
+		o.batches = o.batches[len(o.batches)-o.cfg.Batches:]
+	}
+}
+
+// SuggestGasPrice returns a gas price which should be enough to cover the L1
+// cost of including a transaction while matching what recent transactions
+// have paid
+func (o *Oracle) SuggestGasPrice() *big.Int {
+	o.Lock()
+	defer o.Unlock()
+
+	recent := o.blocks
+	if len(recent) > o.cfg.Blocks {
+		recent = recent[len(recent)-o.cfg.Blocks:]
+	}
+	var prices []*big.Int
+	for _, block := range recent {
+		prices = append(prices, block.prices...)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+
+	price := o.l1CostPerGas()
+	if len(prices) > 0 {
+		l2Price := percentile(prices, float64(o.cfg.Percentile))
+		if l2Price.Cmp(price) > 0 {
+			price = l2Price
+		}
+	}
+	if price.Cmp(o.cfg.MinPrice) < 0 {
+		price = new(big.Int).Set(o.cfg.MinPrice)
+	}
+	return price
+}
+
+// l1CostPerGas estimates the L1 cost of each unit of gas used on L2 by
+// spreading the average cost of posting a transaction to L1 over the average
+// gas used by a transaction. It must be called with the lock held
+func (o *Oracle) l1CostPerGas() *big.Int {
+	l1Cost := big.NewInt(0)
+	batchedTxes := uint64(0)
+	for _, batch := range o.batches {
+		l1Cost.Add(l1Cost, batch.l1Cost)
+		batchedTxes += batch.txCount
+	}
+
+	recent := o.blocks
+	if len(recent) > o.cfg.Blocks {
+		recent = recent[len(recent)-o.cfg.Blocks:]
+	}
+	l2Gas := big.NewInt(0)
+	l2Txes := uint64(0)
+	for _, block := range recent {
+		l2Gas.Add(l2Gas, block.gasUsed)
+		l2Txes += block.txCount
+	}
+
+	if batchedTxes == 0 || l2Txes == 0 || l2Gas.Sign() == 0 {
+		return big.NewInt(0)
+	}
+
+	// (l1Cost / batchedTxes) / (l2Gas / l2Txes)
+	num := new(big.Int).Mul(l1Cost, new(big.Int).SetUint64(l2Txes))
+	den := new(big.Int).Mul(l2Gas, new(big.Int).SetUint64(batchedTxes))
+	return num.Div(num, den)
+}
+
+// FeeHistory describes the fees paid in a range of recent blocks
+type FeeHistory struct {
+	OldestBlock uint64
+	// BaseFees has an entry for each block plus one for the next block
+	BaseFees      []*big.Int
+	GasUsedRatios []float64
+	// Rewards has an entry for each block with the gas price paid at each of
+	// the requested percentiles
+	Rewards [][]*big.Int
+}
+
+// FeeHistory returns fee information for up to blockCount blocks ending at
+// newestBlock. Only blocks recently seen by the oracle are available
+func (o *Oracle) FeeHistory(blockCount uint64, newestBlock uint64, percentiles []float64) (*FeeHistory, error) {
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, errors.New("reward percentile out of range")
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return nil, errors.New("reward percentiles must be increasing")
+		}
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	var blocks []*blockFees
+	for _, block := range o.blocks {
+		if block.number > newestBlock {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if uint64(len(blocks)) > blockCount {
+		blocks = blocks[uint64(len(blocks))-blockCount:]
+	}
+
+	history := &FeeHistory{
+		BaseFees:      make([]*big.Int, 0, len(blocks)+1),
+		GasUsedRatios: make([]float64, 0, len(blocks)),
+	}
+	if len(percentiles) > 0 {
+		history.Rewards = make([][]*big.Int, 0, len(blocks))
+	}
+	if len(blocks) == 0 {
+		history.OldestBlock = newestBlock
+		history.BaseFees = append(history.BaseFees, o.l1CostPerGas())
+		return history, nil
+	}
+
+	history.OldestBlock = blocks[0].number
+	for _, block := range blocks {
+		history.BaseFees = append(history.BaseFees, block.baseFee)
+		ratio := 0.0
+		if block.gasLimit.Sign() > 0 {
+			ratio, _ = new(big.Float).Quo(
+				new(big.Float).SetInt(block.gasUsed),
+				new(big.Float).SetInt(block.gasLimit),
+			).Float64()
+		}
+		history.GasUsedRatios = append(history.GasUsedRatios, ratio)
+		if len(percentiles) > 0 {
+			rewards := make([]*big.Int, 0, len(percentiles))
+			for _, p := range percentiles {
+				if len(block.prices) == 0 {
+					rewards = append(rewards, big.NewInt(0))
+				} else {
+					rewards = append(rewards, percentile(block.prices, p))
+				}
+			}
+			history.Rewards = append(history.Rewards, rewards)
+		}
+	}
+	history.BaseFees = append(history.BaseFees, o.l1CostPerGas())
+	return history, nil
+}
+
+// percentile returns the value at the given percentile of a sorted, non-empty
+// list of prices
+func percentile(sorted []*big.Int, p float64) *big.Int {
+	index := int(float64(len(sorted)-1) * p / 100)
+	return new(big.Int).Set(sorted[index])
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gasprice
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+// addBlock adds a block where each transaction used gasPerTx gas and paid
+// the corresponding price
+func addBlock(o *Oracle, number uint64, gasPerTx int64, prices ...int64) {
+	results := make([]*evm.TxResult, 0, len(prices))
+	for _, price := range prices {
+		results = append(results, &evm.TxResult{
+			GasUsed:  big.NewInt(gasPerTx),
+			GasPrice: big.NewInt(price),
+		})
+	}
+	o.AddBlock(&evm.BlockInfo{
+		BlockNum: new(big.Int).SetUint64(number),
+		GasLimit: big.NewInt(gasPerTx * 10),
+		BlockStats: &evm.OutputStatistics{
+			GasUsed: big.NewInt(gasPerTx * int64(len(prices))),
+			TxCount: big.NewInt(int64(len(prices))),
+		},
+	}, results)
+}
+
+func TestSuggestGasPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		setup   func(*Oracle)
+		expects int64
+	}{
+		{
+			name:    "empty",
+			cfg:     DefaultConfig,
+			setup:   func(*Oracle) {},
+			expects: 0,
+		},
+		{
+			name: "min price",
+			cfg: Config{
+				Blocks:        20,
+				Batches:       20,
+				Percentile:    60,
+				HistoryBlocks: 1024,
+				MinPrice:      big.NewInt(7),
+			},
+			setup: func(o *Oracle) {
+				addBlock(o, 1, 100, 1, 2, 3)
+			},
+			expects: 7,
+		},
+		{
+			name: "l2 percentile",
+			cfg:  DefaultConfig,
+			setup: func(o *Oracle) {
+				addBlock(o, 1, 100, 10, 1, 9, 2, 8)
+				addBlock(o, 2, 100, 3, 7, 4, 6, 5)
+			},
+			// The 60th percentile of 1 through 10
+			expects: 6,
+		},
+		{
+			name: "l1 cost",
+			cfg:  DefaultConfig,
+			setup: func(o *Oracle) {
+				addBlock(o, 1, 100, 1, 1, 1, 1, 1)
+				// Each transaction costs 1000 on L1 and uses 100 gas on L2
+				o.AddBatch(500, big.NewInt(10), 5)
+			},
+			expects: 10,
+		},
+		{
+			name: "only recent blocks",
+			cfg: Config{
+				Blocks:        1,
+				Batches:       20,
+				Percentile:    100,
+				HistoryBlocks: 1024,
+				MinPrice:      big.NewInt(0),
+			},
+			setup: func(o *Oracle) {
+				addBlock(o, 1, 100, 50)
+				addBlock(o, 2, 100, 5)
+			},
+			expects: 5,
+		},
+		{
+			name: "empty batch ignored",
+			cfg:  DefaultConfig,
+			setup: func(o *Oracle) {
+				addBlock(o, 1, 100, 1)
+				o.AddBatch(500, big.NewInt(10), 0)
+			},
+			expects: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := NewOracle(test.cfg)
+			test.setup(o)
+			if price := o.SuggestGasPrice(); price.Cmp(big.NewInt(test.expects)) != 0 {
+				t.Errorf("suggested %v but expected %v", price, test.expects)
+			}
+		})
+	}
+}
+
+func TestFeeHistory(t *testing.T) {
+	o := NewOracle(DefaultConfig)
+	addBlock(o, 1, 100, 1, 2, 3, 4)
+	o.AddBatch(400, big.NewInt(1), 4)
+	addBlock(o, 2, 100, 5)
+	addBlock(o, 3, 100)
+
+	if _, err := o.FeeHistory(2, 3, []float64{101}); err == nil {
+		t.Error("accepted percentile out of range")
+	}
+	if _, err := o.FeeHistory(2, 3, []float64{50, 10}); err == nil {
+		t.Error("accepted decreasing percentiles")
+	}
+
+	history, err := o.FeeHistory(2, 2, []float64{0, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.OldestBlock != 1 {
+		t.Error("wrong oldest block", history.OldestBlock)
+	}
+	if len(history.BaseFees) != 3 {
+		t.Fatal("wrong number of base fees", len(history.BaseFees))
+	}
+	// No batches had been seen when block 1 was added
+	if history.BaseFees[0].Sign() != 0 {
+		t.Error("wrong base fee for block 1", history.BaseFees[0])
+	}
+	if history.BaseFees[1].Cmp(big.NewInt(1)) != 0 {
+		t.Error("wrong base fee for block 2", history.BaseFees[1])
+	}
+	if math.Abs(history.GasUsedRatios[0]-0.4) > 1e-9 || math.Abs(history.GasUsedRatios[1]-0.1) > 1e-9 {
+		t.Error("wrong gas used ratios", history.GasUsedRatios)
+	}
+	if history.Rewards[0][0].Cmp(big.NewInt(1)) != 0 || history.Rewards[0][1].Cmp(big.NewInt(4)) != 0 {
+		t.Error("wrong rewards for block 1", history.Rewards[0])
+	}
+
+	// Blocks without transactions report zero rewards
+	history, err = o.FeeHistory(1, 3, []float64{50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.OldestBlock != 3 || history.Rewards[0][0].Sign() != 0 {
+		t.Error("wrong history for empty block", history.OldestBlock, history.Rewards)
+	}
+
+	// Blocks the oracle hasn't seen yet have no history
+	history, err = o.FeeHistory(1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.OldestBlock != 0 || len(history.GasUsedRatios) != 0 || len(history.BaseFees) != 1 {
+		t.Error("wrong history for unknown block", history)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.HistoryBlocks = 2
+	o := NewOracle(cfg)
+	for i := uint64(1); i <= 5; i++ {
+		addBlock(o, i, 100, 1)
+	}
+	history, err := o.FeeHistory(10, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.OldestBlock != 4 || len(history.GasUsedRatios) != 2 {
+		t.Error("history wasn't limited", history.OldestBlock, len(history.GasUsedRatios))
+	}
+}
@@ -8,6 +8,8 @@ require (
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
 	github.com/gorilla/rpc v1.2.0
+	github.com/gorilla/websocket v1.4.1-0.20190629185528-ae1634f6a989
+	github.com/hashicorp/golang-lru v0.5.4
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/offchainlabs/arbitrum/packages/arb-avm-cpp v0.7.1
 	github.com/offchainlabs/arbitrum/packages/arb-checkpointer v0.7.1
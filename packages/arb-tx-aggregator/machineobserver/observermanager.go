@@ -30,91 +30,103 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 )
 
-const defaultMaxReorgDepth = 100
+// DefaultMaxReorgDepth is how many blocks of checkpoints are kept to recover
+// from an L1 reorg
+const DefaultMaxReorgDepth = 100
 
+// RunObserver starts following the chain in the background and returns the
+// database it updates. The returned channel is closed once the observer has
+// stopped using the database after ctx is cancelled
 func RunObserver(
 	ctx context.Context,
 	rollupAddr common.Address,
 	clnt arbbridge.ArbClient,
 	executablePath string,
 	dbPath string,
-) (*txdb.TxDB, error) {
-	cp, err := checkpointing.NewIndexedCheckpointer(
+	archive bool,
+	maxReorgDepth int64,
+) (*txdb.TxDB, <-chan struct{}, error) {
+	newCheckpointer := checkpointing.NewIndexedCheckpointer
+	if archive {
+		// Archive mode reconstructs historical state from old checkpoints
+		// so they must never be cleaned up
+		newCheckpointer = checkpointing.NewIndexedArchiveCheckpointer
+	}
+	cp, err := newCheckpointer(
 		rollupAddr,
 		dbPath,
-		big.NewInt(defaultMaxReorgDepth),
+		big.NewInt(maxReorgDepth),
 		false,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if !cp.Initialized() {
 		if err := cp.Initialize(executablePath); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	initialMachine, err := cp.GetInitialMachine()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	rollupWatcher, err := clnt.NewRollupWatcher(rollupAddr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := rollupWatcher.VerifyArbChain(ctx, initialMachine.Hash()); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	inboxAddr, err := rollupWatcher.InboxAddress(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	_, eventCreated, _, creationTimestamp, err := rollupWatcher.GetCreationInfo(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	db, err := txdb.New(ctx, clnt, cp, cp.GetAggregatorStore(), rollupAddr)
+	var archiveSource *txdb.ArchiveSource
+	if archive {
+		archiveInbox, err := clnt.NewGlobalInboxWatcher(inboxAddr, rollupAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		archiveSource = &txdb.ArchiveSource{Inbox: archiveInbox, Created: eventCreated}
+	}
+
+	db, err := txdb.New(ctx, clnt, cp, cp.GetAggregatorStore(), rollupAddr, archiveSource)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if db.LatestBlockId() == nil {
 		// We're starting from scratch. Process the messages from the partial block
 		inboxWatcher, err := clnt.NewGlobalInboxWatcher(inboxAddr, rollupAddr)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		events, err := inboxWatcher.GetDeliveredEventsInBlock(ctx, eventCreated.BlockId, creationTimestamp)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// filter out events before nextEventId
-		if len(events) > 0 {
-			startIndex := -1
-			for i, ev := range events {
-				if ev.ChainInfo.Cmp(eventCreated) > 0 {
-					startIndex = i
-				}
-			}
-			if startIndex >= 0 {
-				events = events[startIndex:]
-			} else {
-				events = nil
-			}
-		}
+		events = txdb.EventsAfter(events, eventCreated)
 
 		if err := db.AddMessages(ctx, events, eventCreated.BlockId); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 
 		firstRun := true
 
@@ -136,6 +148,7 @@ func RunObserver(
 
 			err = func() error {
 				log.Println("Starting observer after", db.LatestBlockId())
+				db.StartCatchup()
 
 				// If the local chain is significantly behind the L1, catch up
 				// more efficiently. We process `MaxReorgHeight` blocks at a
@@ -158,6 +171,15 @@ func RunObserver(
 						return errors2.Wrap(err, "Manager hit error doing fast catchup")
 					}
 
+					if archive {
+						// Historical state is rebuilt one L1 block at a time
+						// so the catchup has to match it
+						if err := addMessagesPerBlock(runCtx, db, clnt, inboxDeliveredEvents, start, fetchEnd); err != nil {
+							return err
+						}
+						continue
+					}
+
 					endBlock, err := clnt.BlockIdForHeight(ctx, common.NewTimeBlocks(fetchEnd))
 					if err != nil {
 						return errors2.Wrap(err, "error getting end block in fast catchup")
@@ -188,6 +210,17 @@ func RunObserver(
 					if err := db.AddMessages(runCtx, inboxEvents, blockId); err != nil {
 						return errors2.Wrap(err, "error adding messages to db")
 					}
+
+					if !db.IsAtHead() {
+						currentOnChain, err := clnt.CurrentBlockId(runCtx)
+						if err != nil {
+							return errors2.Wrap(err, "error getting current block")
+						}
+						if blockId.Height.Cmp(currentOnChain.Height) >= 0 {
+							db.NowAtHead()
+							log.Println("Now at head")
+						}
+					}
 				}
 				return nil
 			}()
@@ -198,15 +231,40 @@ func RunObserver(
 
 			cancelFunc()
 
+			// Wait for things to settle
 			select {
 			case <-ctx.Done():
 				return
-			default:
-
+			case <-time.After(time.Second):
 			}
-			// Wait for things to settle
-			time.Sleep(time.Second)
 		}
 	}()
-	return db, nil
+	return db, done, nil
+}
+
+// addMessagesPerBlock adds the given events, which were delivered between
+// start and end inclusive, to the db one L1 block at a time
+func addMessagesPerBlock(
+	ctx context.Context,
+	db *txdb.TxDB,
+	clnt arbbridge.ArbClient,
+	events []arbbridge.MessageDeliveredEvent,
+	start *big.Int,
+	end *big.Int,
+) error {
+	for height := new(big.Int).Set(start); height.Cmp(end) <= 0; height = new(big.Int).Add(height, big.NewInt(1)) {
+		var blockEvents []arbbridge.MessageDeliveredEvent
+		for len(events) > 0 && events[0].BlockId.Height.AsInt().Cmp(height) == 0 {
+			blockEvents = append(blockEvents, events[0])
+			events = events[1:]
+		}
+		blockId, err := clnt.BlockIdForHeight(ctx, common.NewTimeBlocks(height))
+		if err != nil {
+			return errors2.Wrap(err, "error getting block in fast catchup")
+		}
+		if err := db.AddMessages(ctx, blockEvents, blockId); err != nil {
+			return errors2.Wrap(err, "error adding messages to db")
+		}
+	}
+	return nil
 }
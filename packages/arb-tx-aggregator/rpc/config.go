@@ -0,0 +1,229 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"net/url"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/machineobserver"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/rpcpolicy"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/utils"
+)
+
+// EnvPrefix is prepended to the names of environment variables which
+// override the aggregator config
+const EnvPrefix = "ARB_AGGREGATOR"
+
+const minAdminTokenLength = 16
+
+// Config is the aggregator's config file. Any of its settings can be
+// overridden from the environment as described by utils.LoadConfig
+type Config struct {
+	RPC        RPCConfig        `yaml:"rpc"`
+	Batcher    BatcherConfig    `yaml:"batcher"`
+	L1         utils.L1Config   `yaml:"l1"`
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+	Forwarder  ForwarderConfig  `yaml:"forwarder"`
+	TxIndex    TxIndexConfig    `yaml:"txIndex"`
+}
+
+type RPCConfig struct {
+	// AggregatorAddr, Web3Addr and Web3WSAddr are the listen addresses of
+	// the rpc servers. A server is disabled if its address is empty
+	AggregatorAddr string `yaml:"aggregatorAddr"`
+	Web3Addr       string `yaml:"web3Addr"`
+	Web3WSAddr     string `yaml:"web3WSAddr"`
+	// TLSCert and TLSKey enable https if both are set
+	TLSCert     string `yaml:"tlsCert"`
+	TLSKey      string `yaml:"tlsKey"`
+	MetricsAddr string `yaml:"metricsAddr"`
+	// AdminAddr serves the admin namespace which controls the batcher. It's
+	// disabled if empty. Requests must include AdminToken as a bearer token
+	AdminAddr  string `yaml:"adminAddr"`
+	AdminToken string `yaml:"adminToken"`
+	// Limits restricts access to the rpc servers. There are no limits if
+	// it's omitted
+	Limits *rpcpolicy.Config `yaml:"limits"`
+	// MaxBatchRequests is the most entries a web3 batch request can have.
+	// Zero means there's no limit
+	MaxBatchRequests int `yaml:"maxBatchRequests"`
+}
+
+type BatcherConfig struct {
+	MaxBatchTime time.Duration `yaml:"maxBatchTime"`
+	// MaxBatchSize is in bytes
+	MaxBatchSize     uint64 `yaml:"maxBatchSize"`
+	KeepPendingState bool   `yaml:"pending"`
+	// Ordering is random, fifo or gasprice
+	Ordering            string        `yaml:"ordering"`
+	PriceBump           uint64        `yaml:"priceBump"`
+	MaxQueuedPerAccount int           `yaml:"maxQueuedPerAccount"`
+	MaxQueued           int           `yaml:"maxQueued"`
+	QueueTTL            time.Duration `yaml:"queueTTL"`
+}
+
+type CheckpointConfig struct {
+	// Path is the checkpoint database. It defaults to checkpoint_db in the
+	// validator folder
+	Path string `yaml:"path"`
+	// Archive keeps all checkpoints to support queries against any
+	// historical block
+	Archive bool `yaml:"archive"`
+	// MaxReorgDepth is how many blocks of checkpoints are kept otherwise
+	MaxReorgDepth int64 `yaml:"maxReorgDepth"`
+}
+
+// TxIndexConfig controls how long transactions which won't change anymore are
+// kept in the transaction index. Zero keeps them forever
+type TxIndexConfig struct {
+	// IncludedRetentionBlocks is how many arbitrum blocks an included
+	// transaction is kept for
+	IncludedRetentionBlocks uint64 `yaml:"includedRetentionBlocks"`
+	// FailedRetention is how long a failed transaction is kept for
+	FailedRetention time.Duration `yaml:"failedRetention"`
+}
+
+// ForwarderConfig enables forwarder mode in which transactions are relayed to
+// upstream aggregators instead of being batched, so no funded L1 key is needed
+type ForwarderConfig struct {
+	// Upstreams are the web3 rpc urls of the upstream aggregators in order of
+	// preference. Forwarder mode is disabled if it's empty
+	Upstreams []string `yaml:"upstreams"`
+}
+
+// Forwarding returns true if the aggregator runs in forwarder mode
+func (c *Config) Forwarding() bool {
+	return len(c.Forwarder.Upstreams) > 0
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		RPC: RPCConfig{
+			AggregatorAddr:   ":1235",
+			Web3Addr:         ":8547",
+			Web3WSAddr:       ":8548",
+			MaxBatchRequests: web3.DefaultMaxBatchRequests,
+		},
+		Batcher: BatcherConfig{
+			MaxBatchTime:        batcher.DefaultConfig.MaxBatchTime,
+			MaxBatchSize:        uint64(batcher.DefaultConfig.MaxBatchSize),
+			Ordering:            batcher.DefaultConfig.Ordering.Name(),
+			PriceBump:           batcher.DefaultQueueConfig.PriceBump,
+			MaxQueuedPerAccount: batcher.DefaultQueueConfig.MaxPerAccount,
+			MaxQueued:           batcher.DefaultQueueConfig.MaxQueued,
+			QueueTTL:            batcher.DefaultQueueConfig.TTL,
+		},
+		L1: utils.DefaultL1Config,
+		Checkpoint: CheckpointConfig{
+			MaxReorgDepth: machineobserver.DefaultMaxReorgDepth,
+		},
+		TxIndex: TxIndexConfig{
+			IncludedRetentionBlocks: txindex.DefaultRetention.IncludedBlocks,
+			FailedRetention:         txindex.DefaultRetention.FailedAge,
+		},
+	}
+}
+
+// Validate returns an error describing the first invalid setting
+func (c *Config) Validate() error {
+	if (c.RPC.TLSCert == "") != (c.RPC.TLSKey == "") {
+		return errors2.New("rpc.tlsCert and rpc.tlsKey must be set together")
+	}
+	if c.RPC.AdminAddr != "" && len(c.RPC.AdminToken) < minAdminTokenLength {
+		return errors2.Errorf("rpc.adminToken must be at least %v characters when the admin server is enabled", minAdminTokenLength)
+	}
+	if c.Forwarding() && c.RPC.AdminAddr != "" {
+		return errors2.New("rpc.adminAddr can't be used in forwarder mode since there's no batcher to control")
+	}
+	for _, upstream := range c.Forwarder.Upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return errors2.Wrapf(err, "invalid forwarder upstream %v", upstream)
+		}
+		switch u.Scheme {
+		case "http", "https", "ws", "wss":
+		default:
+			return errors2.Errorf("forwarder upstream %v must be an http or websocket url", upstream)
+		}
+	}
+	if c.RPC.MaxBatchRequests < 0 {
+		return errors2.New("rpc.maxBatchRequests can't be negative")
+	}
+	if c.RPC.Limits != nil {
+		if err := c.RPC.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Batcher.MaxBatchTime <= 0 {
+		return errors2.New("batcher.maxBatchTime must be positive")
+	}
+	if c.Batcher.MaxBatchSize == 0 {
+		return errors2.New("batcher.maxBatchSize must be positive")
+	}
+	if _, err := batcher.NewOrderingPolicy(c.Batcher.Ordering); err != nil {
+		return errors2.Wrap(err, "invalid batcher.ordering")
+	}
+	if c.Batcher.MaxQueuedPerAccount < 0 || c.Batcher.MaxQueued < 0 || c.Batcher.QueueTTL < 0 {
+		return errors2.New("batcher queue limits can't be negative")
+	}
+	if err := c.L1.Validate(); err != nil {
+		return err
+	}
+	if c.Checkpoint.Path == "" {
+		return errors2.New("checkpoint.path must be set")
+	}
+	if c.Checkpoint.MaxReorgDepth <= 0 {
+		return errors2.New("checkpoint.maxReorgDepth must be positive")
+	}
+	if c.TxIndex.FailedRetention < 0 {
+		return errors2.New("txIndex.failedRetention can't be negative")
+	}
+	return nil
+}
+
+// BatcherConfig converts the batcher section to the batcher's config. The
+// config must have been validated
+func (c *Config) BatcherConfig() batcher.Config {
+	ordering, _ := batcher.NewOrderingPolicy(c.Batcher.Ordering)
+	return batcher.Config{
+		MaxBatchTime:     c.Batcher.MaxBatchTime,
+		MaxBatchSize:     ethcommon.StorageSize(c.Batcher.MaxBatchSize),
+		KeepPendingState: c.Batcher.KeepPendingState,
+		Ordering:         ordering,
+		Queue: batcher.QueueConfig{
+			PriceBump:     c.Batcher.PriceBump,
+			MaxPerAccount: c.Batcher.MaxQueuedPerAccount,
+			MaxQueued:     c.Batcher.MaxQueued,
+			TTL:           c.Batcher.QueueTTL,
+		},
+	}
+}
+
+// TxIndexRetention converts the txIndex section to the index's retention
+func (c *Config) TxIndexRetention() txindex.Retention {
+	return txindex.Retention{
+		IncludedBlocks: c.TxIndex.IncludedRetentionBlocks,
+		FailedAge:      c.TxIndex.FailedRetention,
+	}
+}
@@ -18,78 +18,233 @@ package rpc
 
 import (
 	"context"
+	"log"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/forwarder"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/gasprice"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/machineobserver"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/rpcpolicy"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
 	utils2 "github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/utils"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/web3"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
 )
 
+// LaunchAggregator runs the aggregator until ctx is cancelled or one of its
+// rpc servers fails. The config must have been validated
 func LaunchAggregator(
 	ctx context.Context,
 	client ethutils.EthClient,
 	auth *bind.TransactOpts,
 	rollupAddress common.Address,
 	executable string,
-	dbPath string,
-	aggPort string,
-	web3Port string,
-	flags utils2.RPCFlags,
-	maxBatchTime time.Duration,
-	keepPendingState bool,
+	cfg *Config,
 ) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	arbClient := ethbridge.NewEthClient(client)
-	db, err := machineobserver.RunObserver(ctx, rollupAddress, arbClient, executable, dbPath)
+	db, observerDone, err := machineobserver.RunObserver(
+		ctx,
+		rollupAddress,
+		arbClient,
+		executable,
+		cfg.Checkpoint.Path,
+		cfg.Checkpoint.Archive,
+		cfg.Checkpoint.MaxReorgDepth,
+	)
 	if err != nil {
 		return err
 	}
 
-	authClient := ethbridge.NewEthAuthClient(client, auth)
-	rollupContract, err := arbClient.NewRollupWatcher(rollupAddress)
+	// Every return from here on goes through this so that whatever was
+	// started is shut down in dependency order: stop taking requests, let
+	// the batcher flush, then close the databases once nothing is using them
+	var txIndex *txindex.Index
+	var pruneDone chan struct{}
+	var waitBatcher func()
+	var web3WSServer *ethrpc.Server
+	var servers sync.WaitGroup
+	defer func() {
+		log.Println("Shutting down aggregator")
+		cancel()
+		if web3WSServer != nil {
+			web3WSServer.Stop()
+		}
+		servers.Wait()
+		if waitBatcher != nil {
+			waitBatcher()
+		}
+		if pruneDone != nil {
+			<-pruneDone
+		}
+		if txIndex != nil {
+			if err := txIndex.Close(); err != nil {
+				log.Println("Error closing tx index", err)
+			}
+		}
+		<-observerDone
+		db.Close()
+		log.Println("Aggregator shut down")
+	}()
+
+	txIndex, err = txindex.Open(cfg.Checkpoint.Path + "-txindex")
 	if err != nil {
 		return err
 	}
-	inboxAddress, err := rollupContract.InboxAddress(context.Background())
-	if err != nil {
-		return err
+	pruneDone = make(chan struct{})
+	go func() {
+		defer close(pruneDone)
+		pruneTxIndex(ctx, db, txIndex, cfg.TxIndexRetention())
+	}()
+
+	oracle := gasprice.NewOracle(gasprice.DefaultConfig)
+	go oracle.Follow(ctx, db)
+
+	// In forwarder mode there's no batcher so the admin server and the L1
+	// transaction sender aren't needed
+	var batch batcher.TransactionBatcher
+	var adminServer http.Handler
+	if cfg.Forwarding() {
+		fwd, err := forwarder.New(ctx, db, txIndex, rollupAddress, cfg.Forwarder.Upstreams)
+		if err != nil {
+			return err
+		}
+		log.Println("Forwarding transactions to", cfg.Forwarder.Upstreams)
+		batch = fwd
+		waitBatcher = fwd.Wait
+	} else {
+		b, err := newBatcher(ctx, client, auth, arbClient, rollupAddress, db, txIndex, oracle, cfg)
+		if err != nil {
+			return err
+		}
+		batch = b
+		waitBatcher = b.Wait
+		adminServer, err = web3.GenerateAdminServer(b, cfg.RPC.AdminToken)
+		if err != nil {
+			return err
+		}
 	}
-	globalInbox, err := authClient.NewGlobalInbox(inboxAddress, rollupAddress)
+
+	srv := aggregator.NewServer(client, batch, rollupAddress, db, oracle)
+	var policy *rpcpolicy.Policy
+	if limits := cfg.RPC.Limits; limits != nil {
+		srv.SetLogLimits(limits.MaxLogBlockRange, limits.MaxLogResults)
+		policy = rpcpolicy.NewPolicy(limits)
+	}
+
+	aggServer, err := aggregator.GenerateRPCServer(srv)
 	if err != nil {
 		return err
 	}
 
-	batch := batcher.NewBatcher(ctx, db, rollupAddress, client, globalInbox, maxBatchTime, keepPendingState)
-
-	srv := aggregator.NewServer(client, batch, rollupAddress, db)
-	errChan := make(chan error, 1)
-
-	aggServer, err := aggregator.GenerateRPCServer(srv)
+	web3Server, err := web3.GenerateWeb3Server(ctx, srv, cfg.RPC.MaxBatchRequests)
 	if err != nil {
 		return err
 	}
 
-	web3Server, err := web3.GenerateWeb3Server(srv)
+	web3WSServer, err = web3.GenerateWeb3SubscriptionServer(srv)
 	if err != nil {
 		return err
 	}
 
-	if aggPort != "" {
+	errChan := make(chan error, 4)
+	serve := func(handler http.Handler, addr string, routes map[string]http.Handler) {
+		if addr == "" {
+			return
+		}
+		servers.Add(1)
 		go func() {
-			errChan <- utils2.LaunchRPC(aggServer, aggPort, flags)
+			defer servers.Done()
+			if err := utils2.LaunchRPC(ctx, handler, addr, cfg.RPC.TLSCert, cfg.RPC.TLSKey, routes); err != nil {
+				errChan <- err
+			}
 		}()
 	}
-	if web3Port != "" {
-		go func() {
-			errChan <- utils2.LaunchRPC(web3Server, web3Port, flags)
-		}()
+	launch := func(handler http.Handler, addr string, routes map[string]http.Handler) {
+		if policy != nil {
+			handler = policy.Wrap(handler)
+		}
+		serve(handler, addr, routes)
+	}
+	launch(aggServer, cfg.RPC.AggregatorAddr, nil)
+	launch(web3Server, cfg.RPC.Web3Addr, map[string]http.Handler{
+		"/healthz": aggregator.HealthHandler(srv),
+		"/readyz":  aggregator.ReadyHandler(srv),
+	})
+	if policy != nil {
+		serve(policy.WrapWebsocket(web3WSServer), cfg.RPC.Web3WSAddr, nil)
+	} else {
+		serve(web3WSServer.WebsocketHandler([]string{"*"}), cfg.RPC.Web3WSAddr, nil)
+	}
+	// The admin server has its own authentication so the rpc policy doesn't
+	// apply
+	if adminServer != nil {
+		serve(adminServer, cfg.RPC.AdminAddr, nil)
 	}
 
-	return <-errChan
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// pruneTxIndex removes transactions which are past retention from the index
+// each time a block is added to db
+func pruneTxIndex(ctx context.Context, db *txdb.TxDB, txIndex *txindex.Index, retention txindex.Retention) {
+	blocks := make(chan *txdb.BlockEvent, 128)
+	sub := db.SubscribeBlockEvents(blocks)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-blocks:
+			if _, err := txIndex.PruneAt(retention, ev.BlockInfo.BlockNum.Uint64(), time.Now()); err != nil {
+				log.Println("Error pruning tx index", err)
+			}
+		}
+	}
+}
+
+func newBatcher(
+	ctx context.Context,
+	client ethutils.EthClient,
+	auth *bind.TransactOpts,
+	arbClient arbbridge.ArbClient,
+	rollupAddress common.Address,
+	db *txdb.TxDB,
+	txIndex *txindex.Index,
+	oracle *gasprice.Oracle,
+	cfg *Config,
+) (*batcher.Batcher, error) {
+	authClient := ethbridge.NewEthAuthClient(client, auth)
+	txManager := authClient.EnableTxManager(ctx, cfg.L1.TxManagerConfig())
+	rollupContract, err := arbClient.NewRollupWatcher(rollupAddress)
+	if err != nil {
+		return nil, err
+	}
+	inboxAddress, err := rollupContract.InboxAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	globalInbox, err := authClient.NewGlobalInbox(inboxAddress, rollupAddress)
+	if err != nil {
+		return nil, err
+	}
+	return batcher.NewBatcher(ctx, db, txIndex, oracle, rollupAddress, client, globalInbox, txManager, cfg.BatcherConfig()), nil
 }
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rpcpolicy restricts access to the aggregator's rpc servers with
+// API keys, rate limits and method allow and deny lists
+package rpcpolicy
+
+import (
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/utils"
+)
+
+// RateLimit configures a token bucket. A zero RequestsPerSecond means there
+// is no limit
+type RateLimit struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	// Burst is the number of requests that can be made at once. It defaults
+	// to RequestsPerSecond rounded up
+	Burst int `yaml:"burst"`
+}
+
+type APIKey struct {
+	// RateLimit applies to all requests made with the key
+	RateLimit RateLimit `yaml:"rateLimit"`
+}
+
+type Config struct {
+	// RequireAPIKey rejects requests which don't include one of APIKeys
+	RequireAPIKey bool              `yaml:"requireApiKey"`
+	APIKeys       map[string]APIKey `yaml:"apiKeys"`
+
+	// PerIP applies to each client address
+	PerIP RateLimit `yaml:"perIp"`
+	// TrustProxyHeaders takes the client address from X-Forwarded-For which
+	// should only be enabled behind a trusted proxy
+	TrustProxyHeaders bool `yaml:"trustProxyHeaders"`
+
+	// AllowMethods lists the only methods which can be called if it's
+	// non-empty. DenyMethods lists methods which can never be called
+	AllowMethods []string `yaml:"allowMethods"`
+	DenyMethods  []string `yaml:"denyMethods"`
+
+	// MaxLogBlockRange and MaxLogResults limit log queries. Zero means there
+	// is no limit
+	MaxLogBlockRange uint64 `yaml:"maxLogBlockRange"`
+	MaxLogResults    int    `yaml:"maxLogResults"`
+}
+
+// LoadConfig reads a Config from the YAML file at path, which may also be
+// JSON, and applies overrides from environment variables starting with
+// envPrefix as described by utils.LoadConfig
+func LoadConfig(path string, envPrefix string) (*Config, error) {
+	cfg := new(Config)
+	if err := utils.LoadConfig(path, envPrefix, cfg); err != nil {
+		return nil, errors2.Wrap(err, "error loading rpc config")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the config is consistent
+func (c *Config) Validate() error {
+	if c.RequireAPIKey && len(c.APIKeys) == 0 {
+		return errors2.New("rpc config requires an api key but doesn't list any")
+	}
+	if c.PerIP.RequestsPerSecond < 0 {
+		return errors2.New("rpc config has a negative per ip rate limit")
+	}
+	for key, keyCfg := range c.APIKeys {
+		if key == "" {
+			return errors2.New("rpc config has an empty api key")
+		}
+		if keyCfg.RateLimit.RequestsPerSecond < 0 {
+			return errors2.New("rpc config has a negative rate limit for an api key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpcpolicy
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	expected := &Config{
+		RequireAPIKey: true,
+		APIKeys:       map[string]APIKey{"secret": {RateLimit: RateLimit{RequestsPerSecond: 5, Burst: 10}}},
+		PerIP:         RateLimit{RequestsPerSecond: 2},
+		DenyMethods:   []string{"eth_getLogs"},
+		MaxLogResults: 100,
+	}
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{
+			name: "yaml",
+			contents: `
+requireApiKey: true
+apiKeys:
+  secret:
+    rateLimit:
+      requestsPerSecond: 5
+      burst: 10
+perIp:
+  requestsPerSecond: 2
+denyMethods: [eth_getLogs]
+maxLogResults: 100
+`,
+		},
+		{
+			name: "json",
+			contents: `{
+	"requireApiKey": true,
+	"apiKeys": {"secret": {"rateLimit": {"requestsPerSecond": 5, "burst": 10}}},
+	"perIp": {"requestsPerSecond": 2},
+	"denyMethods": ["eth_getLogs"],
+	"maxLogResults": 100
+}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTempFile(t, test.contents)
+			defer os.Remove(path)
+			cfg, err := LoadConfig(path, "TEST_RPC_LIMITS")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, expected) {
+				t.Errorf("loaded %+v but expected %+v", cfg, expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnvOverride(t *testing.T) {
+	path := writeTempFile(t, "maxLogResults: 100\n")
+	defer os.Remove(path)
+	if err := os.Setenv("TEST_RPC_LIMITS_MAXLOGRESULTS", "5"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("TEST_RPC_LIMITS_MAXLOGRESULTS")
+	cfg, err := LoadConfig(path, "TEST_RPC_LIMITS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxLogResults != 5 {
+		t.Error("environment didn't override file", cfg.MaxLogResults)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, contents := range []string{
+		"maxLogResult: 100\n",
+		"requireApiKey: true\n",
+		"perIp:\n  requestsPerSecond: -1\n",
+	} {
+		path := writeTempFile(t, contents)
+		if _, err := LoadConfig(path, "TEST_RPC_LIMITS"); err == nil {
+			t.Errorf("loaded invalid config %q", contents)
+		}
+		os.Remove(path)
+	}
+}
+
+func writeTempFile(t *testing.T, contents string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "rpc-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpcpolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxRequestSize bounds the request bodies which are read to find the
+// methods being called
+const maxRequestSize = 5 * 1024 * 1024
+
+const (
+	errCodeUnauthorized = -32001
+	errCodeForbidden    = -32002
+	errCodeRateLimited  = -32005
+)
+
+// Policy enforces a Config on requests before they reach an rpc server. A
+// Policy is shared by every server it wraps so limits apply across them
+type Policy struct {
+	cfg      *Config
+	allowed  map[string]bool
+	denied   map[string]bool
+	ipLimits *limiter
+	keys     map[string]*limiter
+}
+
+func NewPolicy(cfg *Config) *Policy {
+	p := &Policy{
+		cfg:      cfg,
+		allowed:  make(map[string]bool),
+		denied:   make(map[string]bool),
+		ipLimits: newLimiter(cfg.PerIP),
+		keys:     make(map[string]*limiter),
+	}
+	for _, method := range cfg.AllowMethods {
+		p.allowed[canonicalMethod(method)] = true
+	}
+	for _, method := range cfg.DenyMethods {
+		p.denied[canonicalMethod(method)] = true
+	}
+	for key, keyCfg := range cfg.APIKeys {
+		p.keys[key] = newLimiter(keyCfg.RateLimit)
+	}
+	return p
+}
+
+// client is who a request is rate limited as
+type client struct {
+	ip        string
+	key       string
+	keyLimits *limiter
+}
+
+// violation describes why a request was rejected
+type violation struct {
+	status  int
+	code    int
+	message string
+}
+
+// Wrap returns a handler which rejects requests that violate the policy and
+// passes the rest to handler
+func (p *Policy) Wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			// Let CORS preflight requests through since they can't carry
+			// credentials
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		c, v := p.authenticate(r)
+		if v != nil {
+			writeError(w, v, nil, false)
+			return
+		}
+
+		var calls []call
+		var batch bool
+		if r.Body != nil && r.Method == http.MethodPost {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+			_ = r.Body.Close()
+			if err != nil {
+				writeError(w, &violation{http.StatusRequestEntityTooLarge, errCodeForbidden, "request too large"}, nil, false)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			calls, batch = parseCalls(body)
+		}
+
+		if v := p.checkCalls(c, calls); v != nil {
+			writeError(w, v, calls, batch)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authenticate identifies the client making r
+func (p *Policy) authenticate(r *http.Request) (*client, *violation) {
+	c := &client{ip: p.clientIP(r), key: apiKey(r)}
+	if c.key != "" {
+		var ok bool
+		c.keyLimits, ok = p.keys[c.key]
+		if !ok {
+			return nil, &violation{http.StatusUnauthorized, errCodeUnauthorized, "invalid api key"}
+		}
+	} else if p.cfg.RequireAPIKey {
+		return nil, &violation{http.StatusUnauthorized, errCodeUnauthorized, "api key required"}
+	}
+	return c, nil
+}
+
+// checkCalls checks that c may make calls, taking one request from its rate
+// limits for each call. A request which doesn't contain any calls counts as
+// one
+func (p *Policy) checkCalls(c *client, calls []call) *violation {
+	for _, call := range calls {
+		if !p.methodAllowed(call.Method) {
+			return &violation{http.StatusForbidden, errCodeForbidden, "method " + call.Method + " is not allowed"}
+		}
+	}
+	n := len(calls)
+	if n == 0 {
+		n = 1
+	}
+	if !p.ipLimits.allow(c.ip, n) {
+		return &violation{http.StatusTooManyRequests, errCodeRateLimited, "rate limit exceeded"}
+	}
+	if c.keyLimits != nil && !c.keyLimits.allow(c.key, n) {
+		return &violation{http.StatusTooManyRequests, errCodeRateLimited, "rate limit exceeded for api key"}
+	}
+	return nil
+}
+
+func (p *Policy) methodAllowed(method string) bool {
+	method = canonicalMethod(method)
+	if p.denied[method] {
+		return false
+	}
+	return len(p.allowed) == 0 || p.allowed[method]
+}
+
+// canonicalMethod returns the name a method is dispatched as. The web3
+// server's codec upper-cases the first letter of the namespace and method so
+// eth_getLogs, Eth_getLogs and eth_GetLogs all call Eth.GetLogs, and they
+// must be allowed or denied together
+func canonicalMethod(method string) string {
+	parts := strings.Split(method, "_")
+	if len(parts) != 2 {
+		return method
+	}
+	return upperFirst(parts[0]) + "." + upperFirst(parts[1])
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+func (p *Policy) clientIP(r *http.Request) string {
+	if p.cfg.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// apiKey returns the key from the X-API-Key header, a bearer token or the
+// apikey query parameter for clients which can't set headers
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("apikey")
+}
+
+type call struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// parseCalls returns the calls in a single or batch JSON-RPC request and
+// whether it was a batch. Malformed requests are left for the rpc server to
+// reject
+func parseCalls(body []byte) ([]call, bool) {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var calls []call
+		if err := json.Unmarshal(trimmed, &calls); err != nil {
+			return nil, true
+		}
+		return calls, true
+	}
+	var c call
+	if err := json.Unmarshal(trimmed, &c); err != nil {
+		return nil, false
+	}
+	return []call{c}, false
+}
+
+// errorResponse is the JSON-RPC response rejecting calls
+func (v *violation) errorResponse(calls []call, batch bool) interface{} {
+	response := func(id json.RawMessage) interface{} {
+		if len(id) == 0 {
+			id = json.RawMessage("null")
+		}
+		return map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error": map[string]interface{}{
+				"code":    v.code,
+				"message": v.message,
+			},
+			"id": id,
+		}
+	}
+	if !batch || len(calls) == 0 {
+		var id json.RawMessage
+		if len(calls) == 1 {
+			id = calls[0].ID
+		}
+		return response(id)
+	}
+	responses := make([]interface{}, 0, len(calls))
+	for _, c := range calls {
+		responses = append(responses, response(c.ID))
+	}
+	return responses
+}
+
+func writeError(w http.ResponseWriter, v *violation, calls []call, batch bool) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(v.status)
+	_ = json.NewEncoder(w).Encode(v.errorResponse(calls, batch))
+}
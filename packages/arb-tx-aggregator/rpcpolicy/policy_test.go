@@ -0,0 +1,361 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpcpolicy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+// slowLimit allows burst requests and then effectively none
+func slowLimit(burst int) RateLimit {
+	return RateLimit{RequestsPerSecond: 0.0001, Burst: burst}
+}
+
+// okHandler records whether it was called
+type okHandler struct {
+	called bool
+}
+
+func (h *okHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.called = true
+	body, _ := ioutil.ReadAll(r.Body)
+	_, _ = w.Write(body)
+}
+
+func rpcRequest(body string, header http.Header) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.RemoteAddr = "10.0.0.1:1234"
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	return r
+}
+
+func TestPolicy(t *testing.T) {
+	const (
+		balance = `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[]}`
+		getLogs = `{"jsonrpc":"2.0","id":2,"method":"eth_getLogs","params":[]}`
+	)
+	keyHeader := func(key string) http.Header {
+		return http.Header{"X-Api-Key": {key}}
+	}
+	tests := []struct {
+		name   string
+		cfg    Config
+		body   string
+		header http.Header
+		status int
+		code   int
+	}{
+		{
+			name:   "no restrictions",
+			body:   balance,
+			status: http.StatusOK,
+		},
+		{
+			name:   "key required",
+			cfg:    Config{RequireAPIKey: true, APIKeys: map[string]APIKey{"secret": {}}},
+			body:   balance,
+			status: http.StatusUnauthorized,
+			code:   errCodeUnauthorized,
+		},
+		{
+			name:   "key in header",
+			cfg:    Config{RequireAPIKey: true, APIKeys: map[string]APIKey{"secret": {}}},
+			body:   balance,
+			header: keyHeader("secret"),
+			status: http.StatusOK,
+		},
+		{
+			name:   "bearer key",
+			cfg:    Config{RequireAPIKey: true, APIKeys: map[string]APIKey{"secret": {}}},
+			body:   balance,
+			header: http.Header{"Authorization": {"Bearer secret"}},
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown key",
+			cfg:    Config{APIKeys: map[string]APIKey{"secret": {}}},
+			body:   balance,
+			header: keyHeader("wrong"),
+			status: http.StatusUnauthorized,
+			code:   errCodeUnauthorized,
+		},
+		{
+			name:   "denied method",
+			cfg:    Config{DenyMethods: []string{"eth_getLogs"}},
+			body:   getLogs,
+			status: http.StatusForbidden,
+			code:   errCodeForbidden,
+		},
+		{
+			name:   "denied method with upper case namespace",
+			cfg:    Config{DenyMethods: []string{"eth_getLogs"}},
+			body:   `{"jsonrpc":"2.0","id":2,"method":"Eth_getLogs"}`,
+			status: http.StatusForbidden,
+			code:   errCodeForbidden,
+		},
+		{
+			name:   "denied method with upper case name",
+			cfg:    Config{DenyMethods: []string{"eth_getLogs"}},
+			body:   `{"jsonrpc":"2.0","id":2,"method":"eth_GetLogs"}`,
+			status: http.StatusForbidden,
+			code:   errCodeForbidden,
+		},
+		{
+			name:   "denied method in batch",
+			cfg:    Config{DenyMethods: []string{"eth_getLogs"}},
+			body:   "[" + balance + "," + getLogs + "]",
+			status: http.StatusForbidden,
+			code:   errCodeForbidden,
+		},
+		{
+			name:   "allowed method",
+			cfg:    Config{AllowMethods: []string{"Eth_getBalance"}},
+			body:   balance,
+			status: http.StatusOK,
+		},
+		{
+			name:   "method not in allow list",
+			cfg:    Config{AllowMethods: []string{"eth_getBalance"}},
+			body:   getLogs,
+			status: http.StatusForbidden,
+			code:   errCodeForbidden,
+		},
+		{
+			name:   "batch over ip limit",
+			cfg:    Config{PerIP: slowLimit(1)},
+			body:   "[" + balance + "," + balance + "]",
+			status: http.StatusTooManyRequests,
+			code:   errCodeRateLimited,
+		},
+		{
+			name:   "batch over key limit",
+			cfg:    Config{APIKeys: map[string]APIKey{"secret": {RateLimit: slowLimit(1)}}},
+			body:   "[" + balance + "," + balance + "]",
+			header: keyHeader("secret"),
+			status: http.StatusTooManyRequests,
+			code:   errCodeRateLimited,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := &okHandler{}
+			rec := httptest.NewRecorder()
+			NewPolicy(&test.cfg).Wrap(next).ServeHTTP(rec, rpcRequest(test.body, test.header))
+			if rec.Code != test.status {
+				t.Fatal("responded with status", rec.Code, "but expected", test.status)
+			}
+			if next.called != (test.status == http.StatusOK) {
+				t.Error("request passed to server:", next.called)
+			}
+			if test.status == http.StatusOK {
+				if rec.Body.String() != test.body {
+					t.Error("server received", rec.Body.String())
+				}
+				return
+			}
+			checkErrorCodes(t, rec.Body.Bytes(), test.code)
+		})
+	}
+}
+
+// checkErrorCodes checks that every response in a single or batch response
+// is an error with code
+func checkErrorCodes(t *testing.T, data []byte, code int) {
+	t.Helper()
+	type response struct {
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	var responses []response
+	if err := json.Unmarshal(data, &responses); err != nil {
+		var single response
+		if err := json.Unmarshal(data, &single); err != nil {
+			t.Fatal("invalid response", string(data))
+		}
+		responses = []response{single}
+	}
+	for _, res := range responses {
+		if res.Error == nil || res.Error.Code != code {
+			t.Error("wrong error in response", string(data))
+		}
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	p := NewPolicy(&Config{
+		PerIP:   slowLimit(2),
+		APIKeys: map[string]APIKey{"a": {RateLimit: slowLimit(3)}, "b": {}},
+	})
+	next := &okHandler{}
+	handler := p.Wrap(next)
+	send := func(ip string, key string) int {
+		r := rpcRequest(`{"method":"eth_blockNumber"}`, http.Header{"X-Api-Key": {key}})
+		r.RemoteAddr = ip + ":1000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Each address has its own bucket
+	for i := 0; i < 2; i++ {
+		if code := send("10.0.0.1", "b"); code != http.StatusOK {
+			t.Fatal("request", i, "rejected with", code)
+		}
+	}
+	if code := send("10.0.0.1", "b"); code != http.StatusTooManyRequests {
+		t.Error("request over ip limit got", code)
+	}
+	if code := send("10.0.0.2", "b"); code != http.StatusOK {
+		t.Error("other address rejected with", code)
+	}
+
+	// A key's limit applies across addresses
+	for i, ip := range []string{"10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		if code := send(ip, "a"); code != http.StatusOK {
+			t.Fatal("request", i, "with key rejected with", code)
+		}
+	}
+	if code := send("10.0.0.6", "a"); code != http.StatusTooManyRequests {
+		t.Error("request over key limit got", code)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(RateLimit{RequestsPerSecond: 2, Burst: 4}, start)
+	if !bucket.take(4, start) {
+		t.Fatal("burst rejected")
+	}
+	if bucket.take(1, start) {
+		t.Error("request allowed from empty bucket")
+	}
+	if !bucket.take(1, start.Add(500*time.Millisecond)) {
+		t.Error("refilled token rejected")
+	}
+	// The bucket never holds more than the burst
+	later := start.Add(time.Hour)
+	if bucket.take(5, later) || !bucket.take(4, later) {
+		t.Error("bucket refilled past its burst")
+	}
+
+	// The burst defaults to the rate rounded up
+	if burst := newTokenBucket(RateLimit{RequestsPerSecond: 2.5}, start).burst; burst != 3 {
+		t.Error("default burst is", burst)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := newLimiter(RateLimit{RequestsPerSecond: 1})
+	l.allow("idle", 1)
+	l.allow("busy", 1)
+	now := time.Now().Add(2 * idleBucketTTL)
+	l.buckets["busy"].last = now
+	l.buckets["busy"].tokens = 0
+	l.sweep(now)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket wasn't discarded")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("recently used bucket was discarded")
+	}
+}
+
+type testService struct{}
+
+func (testService) Echo(s string) string {
+	return s
+}
+
+func (testService) Secret() string {
+	return "secret"
+}
+
+func TestWebsocket(t *testing.T) {
+	server := ethrpc.NewServer()
+	if err := server.RegisterName("test", testService{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	p := NewPolicy(&Config{
+		RequireAPIKey: true,
+		APIKeys:       map[string]APIKey{"secret": {RateLimit: slowLimit(3)}},
+		DenyMethods:   []string{"test_secret"},
+	})
+	httpServer := httptest.NewServer(p.WrapWebsocket(server))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	if _, res, err := websocket.DefaultDialer.Dial(url, nil); err == nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatal("connected without api key", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Api-Key": {"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	call := func(id int, method string, params ...interface{}) []byte {
+		t.Helper()
+		if params == nil {
+			params = []interface{}{}
+		}
+		if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+			t.Fatal(err)
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(data, &res); err != nil || res.ID != id {
+			t.Error("response", string(data), "doesn't have id", id)
+		}
+		return data
+	}
+	echo := func(id int, s string) {
+		t.Helper()
+		var res struct {
+			Result string `json:"result"`
+		}
+		data := call(id, "test_echo", s)
+		if err := json.Unmarshal(data, &res); err != nil || res.Result != s {
+			t.Error("allowed call failed", string(data))
+		}
+	}
+
+	// The handshake and each allowed call take a request from the limit
+	echo(1, "hi")
+	for i, method := range []string{"test_secret", "Test_secret"} {
+		checkErrorCodes(t, call(2+i, method), errCodeForbidden)
+	}
+	echo(4, "again")
+	checkErrorCodes(t, call(5, "test_echo", "limited"), errCodeRateLimited)
+}
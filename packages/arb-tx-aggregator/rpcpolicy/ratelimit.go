@@ -0,0 +1,110 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpcpolicy
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// idleBucketTTL is how long a full bucket is kept before it's discarded
+const idleBucketTTL = 10 * time.Minute
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(limit.RequestsPerSecond)
+	}
+	return &tokenBucket{
+		rate:   limit.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// take removes n tokens if they're available
+func (b *tokenBucket) take(n int, now time.Time) bool {
+	b.refill(now)
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// limiter holds a token bucket for each client
+type limiter struct {
+	sync.Mutex
+	limit     RateLimit
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newLimiter(limit RateLimit) *limiter {
+	return &limiter{
+		limit:     limit,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes n tokens from client's bucket if they're available
+func (l *limiter) allow(client string, n int) bool {
+	if l.limit.RequestsPerSecond <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.lastSweep) > idleBucketTTL {
+		l.sweep(now)
+	}
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = newTokenBucket(l.limit, now)
+		l.buckets[client] = bucket
+	}
+	return bucket.take(n, now)
+}
+
+// sweep discards buckets which have refilled and been idle for a while since
+// they're equivalent to new ones. It must be called with the lock held
+func (l *limiter) sweep(now time.Time) {
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.last) > idleBucketTTL {
+			bucket.refill(now)
+			if bucket.tokens >= bucket.burst {
+				delete(l.buckets, client)
+			}
+		}
+	}
+	l.lastSweep = now
+}
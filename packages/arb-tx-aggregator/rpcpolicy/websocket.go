@@ -0,0 +1,94 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpcpolicy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+const wsBufferSize = 1024
+
+// WrapWebsocket serves server over websocket connections. Once a connection
+// is open its messages never pass through an http handler, so the policy is
+// applied to the handshake and then to every message the client sends. Like
+// the unwrapped server, connections are accepted from any origin
+func (p *Policy) WrapWebsocket(server *ethrpc.Server) http.Handler {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  wsBufferSize,
+		WriteBufferSize: wsBufferSize,
+		CheckOrigin:     func(*http.Request) bool { return true },
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, v := p.authenticate(r)
+		if v == nil {
+			v = p.checkCalls(c, nil)
+		}
+		if v != nil {
+			writeError(w, v, nil, false)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already responded with an error
+			return
+		}
+		conn.SetReadLimit(maxRequestSize)
+		wsConn := &wsConn{policy: p, client: c, conn: conn}
+		server.ServeCodec(ethrpc.NewFuncCodec(conn, wsConn.encode, wsConn.decode), 0)
+	})
+}
+
+// wsConn checks each message read from a websocket connection against the
+// policy before the rpc server sees it
+type wsConn struct {
+	policy *Policy
+	client *client
+	conn   *websocket.Conn
+
+	// writeMu serializes the server's responses with rejections
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) encode(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+// decode reads the next message the policy allows into v. Rejected messages
+// are answered with an error and the connection stays open
+func (c *wsConn) decode(v interface{}) error {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		calls, batch := parseCalls(data)
+		violation := c.policy.checkCalls(c.client, calls)
+		if violation == nil {
+			return json.Unmarshal(data, v)
+		}
+		if err := c.encode(violation.errorResponse(calls, batch)); err != nil {
+			return err
+		}
+	}
+}
@@ -80,9 +80,14 @@ func (s *Snapshot) Height() *common.TimeBlocks {
 	return s.time.BlockNum
 }
 
+// requestID returns the id ArbOS assigns to the message delivered with the
+// given inbox sequence number
+func (s *Snapshot) requestID(inboxSeqNum *big.Int) common.Hash {
+	return hashing.SoliditySHA3(hashing.Uint256(s.chainId), hashing.Uint256(inboxSeqNum))
+}
+
 func (s *Snapshot) Call(msg message.ContractTransaction, sender common.Address) (*evm.TxResult, error) {
-	targetHash := hashing.SoliditySHA3(hashing.Uint256(s.chainId), hashing.Uint256(s.nextInboxSeqNum))
-	return s.TryTx(message.NewSafeL2Message(msg), sender, targetHash)
+	return s.TryTx(message.NewSafeL2Message(msg), sender, s.requestID(s.nextInboxSeqNum))
 }
 
 func (s *Snapshot) TryTx(msg message.Message, sender common.Address, targetHash common.Hash) (*evm.TxResult, error) {
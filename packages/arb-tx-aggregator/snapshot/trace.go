@@ -0,0 +1,148 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// Trace records the AVM level execution of a single message
+type Trace struct {
+	Result *evm.TxResult
+
+	// Block is the block summary ArbOS emitted when closing the block
+	// containing the message. It is nil if ArbOS didn't close the block
+	Block *evm.BlockInfo
+
+	AVMSteps uint64
+	AVMGas   uint64
+	AVMLogs  []value.Value
+	AVMSends []value.Value
+}
+
+// requestInboxMessage rebuilds the inbox message which produced req. ArbOS
+// reports the request id in place of the inbox sequence number, so the
+// original sequence number is recovered by searching the next searchWindow
+// sequence numbers for one with a matching id. Signed transactions are
+// identified by their hash instead, which doesn't depend on the sequence
+// number, so if nothing matches the next sequence number is used and false
+// is returned
+func (s *Snapshot) requestInboxMessage(req evm.IncomingRequest, searchWindow int) (inbox.InboxMessage, bool) {
+	msg := inbox.InboxMessage{
+		Kind:        req.Kind,
+		Sender:      req.Sender,
+		InboxSeqNum: new(big.Int).Set(s.nextInboxSeqNum),
+		Data:        req.Data,
+		ChainTime:   req.ChainTime,
+	}
+	seqNum := new(big.Int).Set(s.nextInboxSeqNum)
+	for i := 0; i < searchWindow; i++ {
+		if s.requestID(seqNum) == req.MessageID {
+			msg.InboxSeqNum = seqNum
+			return msg, true
+		}
+		seqNum = new(big.Int).Add(seqNum, big.NewInt(1))
+	}
+	return msg, false
+}
+
+// ReplayRequest can only be called if the snapshot is uniquely owned
+// It applies the message which produced req to the snapshot without
+// checking the result, which makes it suitable for rebuilding the state part
+// way through a block. The message is delivered with its original inbox
+// sequence number, which is searched for in the next searchWindow sequence
+// numbers, so that its request id matches the original execution
+func (s *Snapshot) ReplayRequest(req evm.IncomingRequest, searchWindow int) error {
+	inboxMsg, found := s.requestInboxMessage(req, searchWindow)
+	mach := s.mach.Clone()
+	_, steps := mach.ExecuteAssertion(100000000, []inbox.InboxMessage{inboxMsg}, 0)
+	if br := mach.IsBlocked(true); steps == 0 && br != nil {
+		return fmt.Errorf("can't replay message since machine is blocked %v", br)
+	}
+	s.mach = mach
+	if found {
+		// Messages identified by their hash don't advance the sequence
+		// number since several of them can come from a single batch
+		s.nextInboxSeqNum = new(big.Int).Add(inboxMsg.InboxSeqNum, big.NewInt(1))
+	}
+	return nil
+}
+
+// TraceRequest re-executes the message which produced req against a copy of
+// the snapshot. The original inbox sequence number is recovered as in
+// ReplayRequest
+func (s *Snapshot) TraceRequest(req evm.IncomingRequest, searchWindow int) (*Trace, error) {
+	inboxMsg, _ := s.requestInboxMessage(req, searchWindow)
+	return s.trace(inboxMsg, req.MessageID)
+}
+
+// TraceMessage executes msg against a copy of the snapshot as the next
+// message in the inbox
+func (s *Snapshot) TraceMessage(msg message.Message, sender common.Address) (*Trace, error) {
+	inboxMsg := message.NewInboxMessage(msg, sender, s.nextInboxSeqNum, s.time)
+	return s.trace(inboxMsg, s.requestID(s.nextInboxSeqNum))
+}
+
+// trace executes inboxMsg, simulating the arrival of the next block so that
+// ArbOS closes out the current one, and returns the trace of the result
+// with the given request id
+func (s *Snapshot) trace(inboxMsg inbox.InboxMessage, requestId common.Hash) (*Trace, error) {
+	mach := s.mach.Clone()
+	nextBlockHeight := new(big.Int).Add(s.time.BlockNum.AsInt(), big.NewInt(1))
+	assertion, steps := mach.ExecuteCallServerAssertion(
+		100000000,
+		[]inbox.InboxMessage{inboxMsg},
+		value.NewIntValue(nextBlockHeight),
+		0,
+	)
+	if br := mach.IsBlocked(true); steps == 0 && br != nil {
+		return nil, fmt.Errorf("can't produce trace since machine is blocked %v", br)
+	}
+
+	trace := &Trace{
+		AVMSteps: steps,
+		AVMGas:   assertion.NumGas,
+		AVMLogs:  assertion.ParseLogs(),
+		AVMSends: assertion.ParseOutMessages(),
+	}
+	for _, avmLog := range trace.AVMLogs {
+		res, err := evm.NewResultFromValue(avmLog)
+		if err != nil {
+			continue
+		}
+		switch res := res.(type) {
+		case *evm.TxResult:
+			if res.IncomingRequest.MessageID == requestId {
+				trace.Result = res
+			}
+		case *evm.BlockInfo:
+			trace.Block = res
+		}
+	}
+	if trace.Result == nil {
+		return nil, errors.New("no result produced by traced message")
+	}
+	return trace, nil
+}
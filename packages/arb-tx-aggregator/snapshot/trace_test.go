@@ -0,0 +1,212 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var testChainId = big.NewInt(42)
+
+// mockMachine stands in for ArbOS by recording the messages it receives and
+// reporting a successful result for each one. Messages are identified the
+// way ArbOS identifies them, by hashing their sequence number unless they're
+// signed transactions
+type mockMachine struct {
+	machine.Machine
+	delivered []inbox.InboxMessage
+	// earlier results are reported before the result of each traced message
+	earlier []value.Value
+}
+
+func (m *mockMachine) Clone() machine.Machine {
+	delivered := make([]inbox.InboxMessage, len(m.delivered))
+	copy(delivered, m.delivered)
+	return &mockMachine{delivered: delivered, earlier: m.earlier}
+}
+
+func (m *mockMachine) IsBlocked(bool) machine.BlockReason {
+	return nil
+}
+
+func (m *mockMachine) ExecuteAssertion(
+	_ uint64,
+	messages []inbox.InboxMessage,
+	_ time.Duration,
+) (*protocol.ExecutionAssertion, uint64) {
+	logs := make([]value.Value, 0, len(messages))
+	for _, msg := range messages {
+		m.delivered = append(m.delivered, msg)
+		logs = append(logs, mockResult(msg).AsValue())
+	}
+	return protocol.NewExecutionAssertionFromValues(common.Hash{}, common.Hash{}, 1, uint64(len(messages)), nil, logs), uint64(len(messages))
+}
+
+func (m *mockMachine) ExecuteCallServerAssertion(
+	maxSteps uint64,
+	messages []inbox.InboxMessage,
+	_ value.Value,
+	maxWallTime time.Duration,
+) (*protocol.ExecutionAssertion, uint64) {
+	assertion, steps := m.ExecuteAssertion(maxSteps, messages, maxWallTime)
+	logs := append(append([]value.Value{}, m.earlier...), assertion.ParseLogs()...)
+	return protocol.NewExecutionAssertionFromValues(common.Hash{}, common.Hash{}, 1, assertion.NumGas, nil, logs), steps
+}
+
+func mockRequestID(msg inbox.InboxMessage) common.Hash {
+	if len(msg.Data) > 0 && msg.Data[0] == message.SignedTransactionType {
+		return hashing.SoliditySHA3(msg.Data)
+	}
+	return hashing.SoliditySHA3(hashing.Uint256(testChainId), hashing.Uint256(msg.InboxSeqNum))
+}
+
+func mockResult(msg inbox.InboxMessage) *evm.TxResult {
+	return &evm.TxResult{
+		IncomingRequest: evm.IncomingRequest{
+			Kind:      msg.Kind,
+			Sender:    msg.Sender,
+			MessageID: mockRequestID(msg),
+			Data:      msg.Data,
+			ChainTime: msg.ChainTime,
+		},
+		ResultCode:    evm.ReturnCode,
+		ReturnData:    msg.Data,
+		GasUsed:       big.NewInt(21000),
+		GasPrice:      big.NewInt(0),
+		CumulativeGas: big.NewInt(21000),
+		TxIndex:       big.NewInt(0),
+		StartLogIndex: big.NewInt(0),
+	}
+}
+
+// deliveredRequest is the request ArbOS reports for a message delivered
+// with the given sequence number
+func deliveredRequest(data []byte, inboxSeqNum int64) evm.IncomingRequest {
+	return mockResult(inbox.InboxMessage{
+		Kind:        message.L2Type,
+		Sender:      common.RandAddress(),
+		InboxSeqNum: big.NewInt(inboxSeqNum),
+		Data:        data,
+		ChainTime:   inbox.NewRandomChainTime(),
+	}).IncomingRequest
+}
+
+func contractTxData() []byte {
+	return message.NewSafeL2Message(message.NewRandomContractTransaction()).AsData()
+}
+
+func signedTxData() []byte {
+	return message.L2Message{Data: append([]byte{message.SignedTransactionType}, common.RandBytes(100)...)}.AsData()
+}
+
+func newTestSnapshot(mach *mockMachine, lastInboxSeq int64) *Snapshot {
+	return NewSnapshot(mach, inbox.NewRandomChainTime(), testChainId, big.NewInt(lastInboxSeq))
+}
+
+func TestReplayRequestUsesOriginalSeqNum(t *testing.T) {
+	snap := newTestSnapshot(&mockMachine{}, 9)
+	requests := []evm.IncomingRequest{
+		deliveredRequest(contractTxData(), 12),
+		deliveredRequest(signedTxData(), 13),
+		deliveredRequest(signedTxData(), 13),
+		deliveredRequest(contractTxData(), 14),
+	}
+	for _, req := range requests {
+		if err := snap.ReplayRequest(req, len(requests)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivered := snap.mach.(*mockMachine).delivered
+	if len(delivered) != len(requests) {
+		t.Fatalf("expected %v messages to be replayed but got %v", len(requests), len(delivered))
+	}
+	for i, msg := range delivered {
+		if id := mockRequestID(msg); id != requests[i].MessageID {
+			t.Errorf("replayed message %v got request id %v instead of %v", i, id, requests[i].MessageID)
+		}
+		if msg.ChainTime.BlockNum.Cmp(requests[i].ChainTime.BlockNum) != 0 {
+			t.Errorf("replayed message %v wasn't delivered at its original time", i)
+		}
+		if msg.Sender != requests[i].Sender {
+			t.Errorf("replayed message %v wasn't sent by its original sender", i)
+		}
+	}
+	if delivered[0].InboxSeqNum.Cmp(big.NewInt(12)) != 0 || delivered[3].InboxSeqNum.Cmp(big.NewInt(14)) != 0 {
+		t.Error("messages weren't replayed with their original sequence numbers")
+	}
+	if snap.nextInboxSeqNum.Cmp(big.NewInt(15)) != 0 {
+		t.Errorf("next sequence number is %v instead of 15", snap.nextInboxSeqNum)
+	}
+}
+
+func TestReplayRequestOutsideWindow(t *testing.T) {
+	snap := newTestSnapshot(&mockMachine{}, 9)
+	if err := snap.ReplayRequest(deliveredRequest(contractTxData(), 20), 5); err != nil {
+		t.Fatal(err)
+	}
+	delivered := snap.mach.(*mockMachine).delivered
+	if delivered[0].InboxSeqNum.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("unmatched request was replayed with sequence number %v instead of 10", delivered[0].InboxSeqNum)
+	}
+	if snap.nextInboxSeqNum.Cmp(big.NewInt(10)) != 0 {
+		t.Error("unmatched request shouldn't advance the sequence number")
+	}
+}
+
+func TestTraceRequest(t *testing.T) {
+	earlier := mockResult(message.NewRandomInboxMessage(message.NewSafeL2Message(message.NewRandomContractTransaction())))
+	mach := &mockMachine{earlier: []value.Value{earlier.AsValue()}}
+	snap := newTestSnapshot(mach, 9)
+
+	req := deliveredRequest(contractTxData(), 11)
+	trace, err := snap.TraceRequest(req, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Result.IncomingRequest.MessageID != req.MessageID {
+		t.Error("trace didn't report the result of the traced request")
+	}
+	if trace.AVMSteps != 1 || len(trace.AVMLogs) != 2 {
+		t.Errorf("unexpected AVM statistics: %v steps and %v logs", trace.AVMSteps, len(trace.AVMLogs))
+	}
+	if len(snap.mach.(*mockMachine).delivered) != 0 || snap.nextInboxSeqNum.Cmp(big.NewInt(10)) != 0 {
+		t.Error("tracing modified the snapshot")
+	}
+}
+
+func TestTraceMessage(t *testing.T) {
+	snap := newTestSnapshot(&mockMachine{}, 9)
+	trace, err := snap.TraceMessage(message.NewSafeL2Message(message.NewRandomContractTransaction()), common.RandAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Result.IncomingRequest.MessageID != snap.requestID(big.NewInt(10)) {
+		t.Error("traced message wasn't delivered as the next message")
+	}
+}
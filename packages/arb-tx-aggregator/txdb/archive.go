@@ -0,0 +1,207 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+// Number of reconstructed historical snapshots kept in archive mode
+var archiveCacheSize = 100
+
+// Number of L1 blocks whose inbox messages are fetched at once when replaying
+// history in archive mode
+var archiveFetchBlocks uint64 = 1000
+
+var errCheckpointTooNew = errors.New("checkpoint includes messages past requested height")
+
+// ArchiveSource is what archive mode needs in order to replay history: the
+// inbox the chain's messages are delivered to and the event which created
+// the chain
+type ArchiveSource struct {
+	Inbox   arbbridge.GlobalInboxWatcher
+	Created arbbridge.ChainInfo
+}
+
+// EventsAfter returns the events which were delivered after the given
+// event. events must be in delivery order
+func EventsAfter(events []arbbridge.MessageDeliveredEvent, after arbbridge.ChainInfo) []arbbridge.MessageDeliveredEvent {
+	for i, ev := range events {
+		if ev.ChainInfo.Cmp(after) > 0 {
+			return events[i:]
+		}
+	}
+	return nil
+}
+
+// archivedState is a machine which has processed every message delivered at
+// or below height
+type archivedState struct {
+	mach         machine.Machine
+	lastInboxSeq *big.Int
+	height       uint64
+	snap         *snapshot.Snapshot
+}
+
+func newArchiveCache() *lru.Cache {
+	cache, err := lru.New(archiveCacheSize)
+	if err != nil {
+		panic(err)
+	}
+	return cache
+}
+
+// archiveSnapshot rebuilds the snapshot at the given time by starting from
+// the closest earlier state available and replaying the inbox messages
+// delivered in each L1 block since then. In archive mode the observer
+// processes L1 blocks one at a time, so replaying each block's messages
+// followed by the block's height reproduces the observer's state exactly
+func (txdb *TxDB) archiveSnapshot(ctx context.Context, time inbox.ChainTime) (*snapshot.Snapshot, error) {
+	height := time.BlockNum.AsInt().Uint64()
+	if entry, ok := txdb.archiveCache.Get(height); ok {
+		snap := entry.(*archivedState).snap.Clone()
+		snap.AdvanceTime(time)
+		return snap, nil
+	}
+
+	start, err := txdb.archiveStartState(ctx, time.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+
+	mach := start.mach.Clone()
+	lastInboxSeq := new(big.Int).Set(start.lastInboxSeq)
+	// Events are fetched a page of blocks at a time so that replaying a long
+	// range doesn't make one huge log query or hold every message in memory
+	createdHeight := txdb.archive.Created.BlockId.Height.AsInt().Uint64()
+	for pageStart := start.height; pageStart <= height; pageStart += archiveFetchBlocks {
+		pageEnd := pageStart + archiveFetchBlocks - 1
+		if pageEnd > height {
+			pageEnd = height
+		}
+		events, err := txdb.archive.Inbox.GetDeliveredEvents(
+			ctx,
+			new(big.Int).SetUint64(pageStart),
+			new(big.Int).SetUint64(pageEnd),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if pageStart == createdHeight {
+			events = EventsAfter(events, txdb.archive.Created)
+		}
+		for blockHeight := pageStart; blockHeight <= pageEnd; blockHeight++ {
+			for len(events) > 0 && events[0].BlockId.Height.AsInt().Uint64() == blockHeight {
+				// TODO: Give ExecuteAssertion the ability to run unbounded until it blocks
+				// The max steps here is a hack since it should just run until it blocks
+				mach.ExecuteAssertion(1000000000000, []inbox.InboxMessage{events[0].Message}, 0)
+				lastInboxSeq = events[0].Message.InboxSeqNum
+				events = events[1:]
+			}
+			nextBlockHeight := new(big.Int).SetUint64(blockHeight + 1)
+			mach.ExecuteCallServerAssertion(1000000000000, nil, value.NewIntValue(nextBlockHeight), 0)
+		}
+	}
+
+	snap := snapshot.NewSnapshot(mach.Clone(), time, message.ChainAddressToID(txdb.chain), lastInboxSeq)
+	txdb.archiveCache.Add(height, &archivedState{
+		mach:         mach,
+		lastInboxSeq: lastInboxSeq,
+		height:       height,
+		snap:         snap,
+	})
+	return snap.Clone(), nil
+}
+
+// archiveStartState finds the most recent state from which the given height
+// can be reached, preferring previously reconstructed snapshots, then
+// checkpoints and finally falling back to the initial machine. The height of
+// the returned state is the first block which must be replayed
+func (txdb *TxDB) archiveStartState(ctx context.Context, height *common.TimeBlocks) (*archivedState, error) {
+	target := height.AsInt().Uint64()
+	var best *archivedState
+	for _, key := range txdb.archiveCache.Keys() {
+		if key.(uint64) > target {
+			continue
+		}
+		entry, ok := txdb.archiveCache.Peek(key)
+		if !ok {
+			continue
+		}
+		state := entry.(*archivedState)
+		if best == nil || state.height > best.height {
+			best = state
+		}
+	}
+	if best != nil {
+		return &archivedState{
+			mach:         best.mach,
+			lastInboxSeq: best.lastInboxSeq,
+			height:       best.height + 1,
+		}, nil
+	}
+
+	var restored *archivedState
+	err := txdb.checkpointer.RestoreStateAtOrBefore(ctx, txdb.timeGetter, height, func(chainObserverBytes []byte, restoreCtx ckptcontext.RestoreContext, blockId *common.BlockId) error {
+		if len(chainObserverBytes) < checkpointDataSize {
+			return errors.New("checkpoint doesn't record its processed height")
+		}
+		var machineHash common.Hash
+		copy(machineHash[:], chainObserverBytes)
+		lastInboxSeq := new(big.Int).SetBytes(chainObserverBytes[32:64])
+
+		// Checkpoints are indexed by the last block ArbOS closed, but the
+		// machine has processed every message up to a possibly later height
+		processedHeight := new(big.Int).SetBytes(chainObserverBytes[64:96])
+		if processedHeight.Cmp(height.AsInt()) > 0 {
+			return errCheckpointTooNew
+		}
+
+		restored = &archivedState{
+			mach:         restoreCtx.GetMachine(machineHash),
+			lastInboxSeq: lastInboxSeq,
+			height:       processedHeight.Uint64() + 1,
+		}
+		return nil
+	})
+	if err == nil {
+		return restored, nil
+	}
+
+	mach, err := txdb.checkpointer.GetInitialMachine()
+	if err != nil {
+		return nil, err
+	}
+	return &archivedState{
+		mach:         mach,
+		lastInboxSeq: big.NewInt(0),
+		height:       txdb.archive.Created.BlockId.Height.AsInt().Uint64(),
+	}, nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/checkpointing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/membridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+func TestArchiveMatchesLiveState(t *testing.T) {
+	ctx := context.Background()
+	dbPath, err := ioutil.TempDir("", "archive-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	chain := membridge.NewChain()
+	clnt := membridge.NewArbClient(chain)
+	owner := common.RandAddress()
+	chain.Fund(owner, big.NewInt(1000000))
+
+	cp, err := checkpointing.NewIndexedArchiveCheckpointer(common.RandAddress(), dbPath, big.NewInt(100), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	if err := cp.Initialize(arbos.Path()); err != nil {
+		t.Fatal(err)
+	}
+	initialMachine, err := cp.GetInitialMachine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authClient := membridge.NewArbAuthClient(chain, owner)
+	factory, err := authClient.NewArbFactory(chain.ArbFactoryAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := valprotocol.ChainParams{
+		StakeRequirement:        big.NewInt(10),
+		GracePeriod:             common.TicksFromBlockNum(common.NewTimeBlocksInt(3)),
+		MaxExecutionSteps:       1000,
+		ArbGasSpeedLimitPerTick: 100,
+	}
+	rollupAddr, _, err := factory.CreateRollup(ctx, initialMachine.Hash(), params, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollupWatcher, err := clnt.NewRollupWatcher(rollupAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, created, _, _, err := rollupWatcher.GetCreationInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalInbox, err := authClient.NewGlobalInbox(chain.GlobalInboxAddress(), rollupAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inboxWatcher, err := clnt.NewGlobalInboxWatcher(chain.GlobalInboxAddress(), rollupAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(ctx, clnt, cp, cp.GetAggregatorStore(), rollupAddr, &ArchiveSource{
+		Inbox:   inboxWatcher,
+		Created: created,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deliver messages in some blocks and none in others, processing each
+	// block as the observer does in archive mode
+	liveHashes := make(map[uint64]common.Hash)
+	createdEvents, err := inboxWatcher.GetDeliveredEventsInBlock(ctx, created.BlockId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddMessages(ctx, EventsAfter(createdEvents, created), created.BlockId); err != nil {
+		t.Fatal(err)
+	}
+	liveHashes[created.BlockId.Height.AsInt().Uint64()] = db.mach.Hash()
+	nextHeight := created.BlockId.Height.AsInt().Uint64() + 1
+	for i := 0; i < 6; i++ {
+		for j := 0; j < i%3; j++ {
+			if err := globalInbox.DepositEthMessage(ctx, common.RandAddress(), big.NewInt(int64(j+1))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		chain.AdvanceBlocks(1)
+		latest, err := clnt.CurrentBlockId(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ; nextHeight <= latest.Height.AsInt().Uint64(); nextHeight++ {
+			blockId, err := clnt.BlockIdForHeight(ctx, common.NewTimeBlocks(new(big.Int).SetUint64(nextHeight)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			events, err := inboxWatcher.GetDeliveredEventsInBlock(ctx, blockId, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AddMessages(ctx, events, blockId); err != nil {
+				t.Fatal(err)
+			}
+			liveHashes[nextHeight] = db.mach.Hash()
+		}
+	}
+
+	// Replaying from the start crosses several pages of events
+	defer func(fetchBlocks uint64) {
+		archiveFetchBlocks = fetchBlocks
+	}(archiveFetchBlocks)
+	archiveFetchBlocks = 2
+	db.archiveCache.Purge()
+	latestTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocks(new(big.Int).SetUint64(nextHeight - 1)),
+		Timestamp: big.NewInt(0),
+	}
+	if _, err := db.archiveSnapshot(ctx, latestTime); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := db.archiveCache.Peek(nextHeight - 1)
+	if !ok {
+		t.Fatal("archived state wasn't cached at height", nextHeight-1)
+	}
+	if entry.(*archivedState).mach.Hash() != liveHashes[nextHeight-1] {
+		t.Error("archived state replayed across pages doesn't match live state")
+	}
+
+	db.archiveCache.Purge()
+	for height, liveHash := range liveHashes {
+		time := inbox.ChainTime{
+			BlockNum:  common.NewTimeBlocks(new(big.Int).SetUint64(height)),
+			Timestamp: big.NewInt(0),
+		}
+		if _, err := db.archiveSnapshot(ctx, time); err != nil {
+			t.Fatal(err)
+		}
+		entry, ok := db.archiveCache.Peek(height)
+		if !ok {
+			t.Fatal("archived state wasn't cached at height", height)
+		}
+		if archivedHash := entry.(*archivedState).mach.Hash(); archivedHash != liveHash {
+			t.Errorf("archived state at height %v is %v but live state was %v", height, archivedHash, liveHash)
+		}
+	}
+}
@@ -21,12 +21,15 @@ import (
 	"errors"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
 	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/checkpointing"
 	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
@@ -36,10 +39,25 @@ import (
 	"log"
 	"math/big"
 	"sync"
+	"time"
 )
 
 var snapshotCacheSize = 10
 
+var (
+	addMessagesTimer         = arbmetrics.NewTimer("arb/txdb/addmessages")
+	assertionStepsHistogram  = arbmetrics.NewHistogram("arb/txdb/assertion/steps")
+	assertionGasHistogram    = arbmetrics.NewHistogram("arb/txdb/assertion/gas")
+	snapshotCacheHitCounter  = arbmetrics.NewCounter("arb/txdb/snapshotcache/hit")
+	snapshotCacheMissCounter = arbmetrics.NewCounter("arb/txdb/snapshotcache/miss")
+)
+
+var errClosed = errors.New("txdb is closed")
+
+// Checkpoints contain the machine hash, the last inbox sequence number
+// processed and the L1 height up to which all messages have been processed
+const checkpointDataSize = 96
+
 type TxDB struct {
 	View
 	mach         machine.Machine
@@ -47,10 +65,26 @@ type TxDB struct {
 	timeGetter   arbbridge.ChainTimeGetter
 	chain        common.Address
 
+	// processMut is held while messages are added so that Close waits for
+	// processing to finish before closing the storage
+	processMut sync.Mutex
+	closed     bool
+
 	callMut            sync.Mutex
 	lastBlockProcessed *common.BlockId
 	lastInboxSeq       *big.Int
 	snapCache          *snapshotCache
+	// syncStart is the height the observer last started catching up from
+	// and atHead is set once it has caught up with L1
+	syncStart *common.TimeBlocks
+	atHead    bool
+
+	// archive and archiveCache are only set when running in archive mode.
+	// archiveCache holds reconstructed historical snapshots
+	archive      *ArchiveSource
+	archiveCache *lru.Cache
+
+	blockFeed event.Feed
 }
 
 func New(
@@ -59,6 +93,7 @@ func New(
 	checkpointer checkpointing.RollupCheckpointer,
 	as *cmachine.AggregatorStore,
 	chain common.Address,
+	archive *ArchiveSource,
 ) (*TxDB, error) {
 	txdb := &TxDB{
 		View:         View{as: as},
@@ -67,6 +102,10 @@ func New(
 		chain:        chain,
 		snapCache:    newSnapshotCache(snapshotCacheSize),
 	}
+	if archive != nil {
+		txdb.archive = archive
+		txdb.archiveCache = newArchiveCache()
+	}
 	if checkpointer.HasCheckpointedState() {
 		if err := txdb.RestoreFromCheckpoint(ctx); err == nil {
 			return txdb, nil
@@ -101,7 +140,7 @@ func (txdb *TxDB) RestoreFromCheckpoint(ctx context.Context) error {
 	if err := txdb.checkpointer.RestoreLatestState(ctx, txdb.timeGetter, func(chainObserverBytes []byte, restoreCtx ckptcontext.RestoreContext, restoreBlockId *common.BlockId) error {
 		var machineHash common.Hash
 		copy(machineHash[:], chainObserverBytes)
-		lastInboxSeq = new(big.Int).SetBytes(chainObserverBytes[32:])
+		lastInboxSeq = new(big.Int).SetBytes(chainObserverBytes[32:64])
 		mach = restoreCtx.GetMachine(machineHash)
 		blockId = restoreBlockId
 		return nil
@@ -142,6 +181,12 @@ type blockData struct {
 }
 
 func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliveredEvent, finishedBlock *common.BlockId) error {
+	txdb.processMut.Lock()
+	defer txdb.processMut.Unlock()
+	if txdb.closed {
+		return errClosed
+	}
+	defer addMessagesTimer.UpdateSince(time.Now())
 	timestamp, err := txdb.timeGetter.TimestampForBlockHash(ctx, finishedBlock.HeaderHash)
 	if err != nil {
 		return err
@@ -151,7 +196,9 @@ func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliv
 	for _, msg := range msgs {
 		// TODO: Give ExecuteAssertion the ability to run unbounded until it blocks
 		// The max steps here is a hack since it should just run until it blocks
-		assertion, _ := txdb.mach.ExecuteAssertion(1000000000000, []inbox.InboxMessage{msg.Message}, 0)
+		assertion, steps := txdb.mach.ExecuteAssertion(1000000000000, []inbox.InboxMessage{msg.Message}, 0)
+		assertionStepsHistogram.Update(int64(steps))
+		assertionGasHistogram.Update(int64(assertion.NumGas))
 		txdb.callMut.Lock()
 		txdb.lastInboxSeq = msg.Message.InboxSeqNum
 		txdb.callMut.Unlock()
@@ -159,7 +206,8 @@ func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliv
 		if err != nil {
 			return err
 		}
-		if err := saveAssertion(txdb.as, processedAssertion); err != nil {
+		blockEvents, err := saveAssertion(txdb.as, processedAssertion)
+		if err != nil {
 			return err
 		}
 		if len(processedAssertion.blocks) > 0 {
@@ -169,6 +217,7 @@ func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliv
 			txdb.callMut.Unlock()
 			lastBlock = &block
 		}
+		txdb.notifyBlocks(blockEvents)
 	}
 
 	nextBlockHeight := new(big.Int).Add(finishedBlock.Height.AsInt(), big.NewInt(1))
@@ -179,7 +228,8 @@ func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliv
 	if err != nil {
 		return err
 	}
-	if err := saveAssertion(txdb.as, processedAssertion); err != nil {
+	blockEvents, err := saveAssertion(txdb.as, processedAssertion)
+	if err != nil {
 		return err
 	}
 	if len(processedAssertion.blocks) > 0 {
@@ -189,6 +239,7 @@ func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliv
 		txdb.callMut.Unlock()
 		lastBlock = &block
 	}
+	txdb.notifyBlocks(blockEvents)
 
 	txdb.callMut.Lock()
 	txdb.lastBlockProcessed = finishedBlock
@@ -204,14 +255,28 @@ func (txdb *TxDB) AddMessages(ctx context.Context, msgs []arbbridge.MessageDeliv
 		ctx := ckptcontext.NewCheckpointContext()
 		ctx.AddMachine(txdb.mach)
 		machHash := txdb.mach.Hash()
-		cpData := make([]byte, 64)
+		cpData := make([]byte, checkpointDataSize)
 		copy(cpData[:], machHash[:])
 		copy(cpData[32:], math.U256Bytes(lastInboxSeq))
+		copy(cpData[64:], math.U256Bytes(finishedBlock.Height.AsInt()))
 		txdb.checkpointer.AsyncSaveCheckpoint(lastBlock.block, cpData, ctx)
 	}
 	return nil
 }
 
+// Close waits for any messages being added to be processed, saves the latest
+// checkpoint and closes the underlying storage. Queries must not be made
+// once the TxDB is closed
+func (txdb *TxDB) Close() {
+	txdb.processMut.Lock()
+	defer txdb.processMut.Unlock()
+	if txdb.closed {
+		return
+	}
+	txdb.closed = true
+	txdb.checkpointer.Close()
+}
+
 type processedAssertion struct {
 	avmLogs   []value.Value
 	blocks    []blockData
@@ -254,19 +319,20 @@ func (txdb *TxDB) processAssertion(ctx context.Context, assertion *protocol.Exec
 func saveAssertion(
 	as *cmachine.AggregatorStore,
 	processed processedAssertion,
-) error {
+) ([]*BlockEvent, error) {
 	for _, avmLog := range processed.avmLogs {
 		if err := as.SaveLog(avmLog); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	for _, avmMessage := range processed.assertion.ParseOutMessages() {
 		if err := as.SaveMessage(avmMessage); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	blockEvents := make([]*BlockEvent, 0, len(processed.blocks))
 	for _, info := range processed.blocks {
 		txCount := info.blockInfo.BlockStats.TxCount.Uint64()
 		startLog := info.blockInfo.FirstAVMLog().Uint64()
@@ -275,11 +341,11 @@ func saveAssertion(
 		for i := uint64(0); i < txCount; i++ {
 			avmLog, err := as.GetLog(startLog + i)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			txRes, err := evm.NewTxResultFromValue(avmLog)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			txResults = append(txResults, txRes)
 		}
@@ -297,16 +363,35 @@ func saveAssertion(
 
 		avmLogIndex := info.blockInfo.ChainStats.AVMLogCount.Uint64() - 1
 		if err := as.SaveBlock(info.block, avmLogIndex, logBloom); err != nil {
-			return err
+			return nil, err
 		}
 
 		for i, txRes := range txResults {
 			if err := as.SaveRequest(txRes.IncomingRequest.MessageID, startLog+uint64(i)); err != nil {
-				return err
+				return nil, err
 			}
 		}
+
+		blockEvents = append(blockEvents, &BlockEvent{
+			Block:     info.block,
+			BlockInfo: info.blockInfo,
+			Bloom:     logBloom,
+			Results:   txResults,
+		})
 	}
-	return nil
+	return blockEvents, nil
+}
+
+func (txdb *TxDB) notifyBlocks(blockEvents []*BlockEvent) {
+	for _, ev := range blockEvents {
+		txdb.blockFeed.Send(ev)
+	}
+}
+
+// SubscribeBlockEvents registers ch to receive a BlockEvent for every block
+// that AddMessages saves to the database
+func (txdb *TxDB) SubscribeBlockEvents(ch chan<- *BlockEvent) event.Subscription {
+	return txdb.blockFeed.Subscribe(ch)
 }
 
 func (txdb *TxDB) GetMessage(index uint64) (value.Value, error) {
@@ -358,10 +443,25 @@ func (txdb *TxDB) LatestSnapshot() *snapshot.Snapshot {
 	return txdb.snapCache.latest()
 }
 
-func (txdb *TxDB) GetSnapshot(time inbox.ChainTime) *snapshot.Snapshot {
+// GetSnapshot returns the snapshot at the given time. Outside of archive mode
+// only recent snapshots are available and nil is returned for older ones
+func (txdb *TxDB) GetSnapshot(ctx context.Context, time inbox.ChainTime) (*snapshot.Snapshot, error) {
 	txdb.callMut.Lock()
-	defer txdb.callMut.Unlock()
-	return txdb.snapCache.getSnapshot(time)
+	snap := txdb.snapCache.getSnapshot(time)
+	lastBlock := txdb.lastBlockProcessed
+	txdb.callMut.Unlock()
+	if snap != nil {
+		snapshotCacheHitCounter.Inc(1)
+	} else {
+		snapshotCacheMissCounter.Inc(1)
+	}
+	if snap != nil || txdb.archiveCache == nil {
+		return snap, nil
+	}
+	if lastBlock == nil || time.BlockNum.Cmp(lastBlock.Height) > 0 {
+		return nil, nil
+	}
+	return txdb.archiveSnapshot(ctx, time)
 }
 
 func (txdb *TxDB) LatestBlockId() *common.BlockId {
@@ -369,3 +469,35 @@ func (txdb *TxDB) LatestBlockId() *common.BlockId {
 	defer txdb.callMut.Unlock()
 	return txdb.lastBlockProcessed
 }
+
+// StartCatchup records that the observer is (re)starting from the latest
+// processed block and isn't at the L1 head
+func (txdb *TxDB) StartCatchup() {
+	txdb.callMut.Lock()
+	defer txdb.callMut.Unlock()
+	txdb.atHead = false
+	txdb.syncStart = nil
+	if txdb.lastBlockProcessed != nil {
+		txdb.syncStart = txdb.lastBlockProcessed.Height.Clone()
+	}
+}
+
+func (txdb *TxDB) NowAtHead() {
+	txdb.callMut.Lock()
+	defer txdb.callMut.Unlock()
+	txdb.atHead = true
+}
+
+func (txdb *TxDB) IsAtHead() bool {
+	txdb.callMut.Lock()
+	defer txdb.callMut.Unlock()
+	return txdb.atHead
+}
+
+// SyncStart returns the height the observer last started catching up from
+// or nil if it hasn't started
+func (txdb *TxDB) SyncStart() *common.TimeBlocks {
+	txdb.callMut.Lock()
+	defer txdb.callMut.Unlock()
+	return txdb.syncStart
+}
@@ -29,6 +29,10 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 )
 
+// ErrTooManyLogs is returned when a log query matches more logs than the
+// caller allowed
+var ErrTooManyLogs = errors.New("log query matched too many logs")
+
 type View struct {
 	as *cmachine.AggregatorStore
 }
@@ -68,12 +72,16 @@ func (txdb *View) LatestBlockId() (*common.BlockId, error) {
 	return txdb.as.LatestBlock()
 }
 
+// FindLogs returns the logs matching the query. If maxResults is non-zero it
+// stops scanning and returns ErrTooManyLogs once more than maxResults logs
+// have matched
 func (txdb *View) FindLogs(
 	ctx context.Context,
 	fromHeight *uint64,
 	toHeight *uint64,
 	address []common.Address,
 	topics [][]common.Hash,
+	maxResults int,
 ) ([]evm.FullLog, error) {
 	latestBlock, err := txdb.LatestBlockId()
 	if err != nil {
@@ -84,15 +92,13 @@ func (txdb *View) FindLogs(
 	if fromHeight != nil && *fromHeight > 0 {
 		startHeight = *fromHeight
 	}
-	if toHeight != nil {
-		altEndHeight := *toHeight + 1
-		if endHeight > altEndHeight {
-			endHeight = altEndHeight
-		}
+	if toHeight != nil && endHeight > *toHeight {
+		endHeight = *toHeight
 	}
 
+	// The range is inclusive on both ends
 	logs := make([]evm.FullLog, 0)
-	if startHeight >= endHeight {
+	if startHeight > endHeight {
 		return logs, nil
 	}
 
@@ -131,27 +137,64 @@ func (txdb *View) FindLogs(
 				return nil, err
 			}
 
-			logIndex := uint64(0)
-			for _, evmLog := range res.EVMLogs {
-				if evmLog.MatchesQuery(address, topics) {
-					logs = append(logs, evm.FullLog{
-						Log:     evmLog,
-						TxIndex: j,
-						TxHash:  res.IncomingRequest.MessageID,
-						Index:   logIndex,
-						Block: &common.BlockId{
-							Height:     common.NewTimeBlocks(new(big.Int).SetUint64(i)),
-							HeaderHash: blockInfo.Hash,
-						},
-					})
-				}
-				logIndex++
+			block := &common.BlockId{
+				Height:     common.NewTimeBlocks(new(big.Int).SetUint64(i)),
+				HeaderHash: blockInfo.Hash,
+			}
+			logs = appendMatchingLogs(logs, res, j, block, address, topics)
+			if maxResults > 0 && len(logs) > maxResults {
+				return nil, ErrTooManyLogs
 			}
 		}
 	}
 	return logs, nil
 }
 
+func appendMatchingLogs(
+	logs []evm.FullLog,
+	res *evm.TxResult,
+	txIndex uint64,
+	block *common.BlockId,
+	address []common.Address,
+	topics [][]common.Hash,
+) []evm.FullLog {
+	logIndex := uint64(0)
+	for _, evmLog := range res.EVMLogs {
+		if evmLog.MatchesQuery(address, topics) {
+			logs = append(logs, evm.FullLog{
+				Log:     evmLog,
+				TxIndex: txIndex,
+				TxHash:  res.IncomingRequest.MessageID,
+				Index:   logIndex,
+				Block:   block,
+			})
+		}
+		logIndex++
+	}
+	return logs
+}
+
+// BlockEvent describes a block which has just been added to the database
+type BlockEvent struct {
+	Block     *common.BlockId
+	BlockInfo *evm.BlockInfo
+	Bloom     types.Bloom
+	Results   []*evm.TxResult
+}
+
+// FindLogs returns the logs in the block matching the given query, using the
+// block bloom filter to skip blocks which can't contain a match
+func (b *BlockEvent) FindLogs(address []common.Address, topics [][]common.Hash) []evm.FullLog {
+	logs := make([]evm.FullLog, 0)
+	if !maybeMatchesLogQuery(b.Bloom, address, topics) {
+		return logs
+	}
+	for i, res := range b.Results {
+		logs = appendMatchingLogs(logs, res, uint64(i), b.Block, address, topics)
+	}
+	return logs
+}
+
 func maybeMatchesLogQuery(logFilter types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
 	if len(addresses) > 0 {
 		match := false
@@ -0,0 +1,487 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txindex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/rlp"
+	errors2 "github.com/pkg/errors"
+)
+
+type Status uint8
+
+const (
+	// Queued transactions are waiting in the batcher
+	Queued Status = iota
+	// Batched transactions were sent to the inbox in an L1 transaction which
+	// hasn't been processed yet
+	Batched
+	// Included transactions have a result in an arbitrum block
+	Included
+	// Failed transactions were dropped before being included
+	Failed
+	// Forwarded transactions were relayed to an upstream aggregator which
+	// hasn't reported them as batched yet
+	Forwarded
+)
+
+func (s Status) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case Batched:
+		return "batched"
+	case Included:
+		return "included"
+	case Failed:
+		return "failed"
+	case Forwarded:
+		return "forwarded"
+	default:
+		return fmt.Sprintf("Status(%d)", uint8(s))
+	}
+}
+
+// Entry records the last known state of a transaction sent to the aggregator
+type Entry struct {
+	Status Status
+	Tx     *types.Transaction
+
+	// BatchTxHash is the L1 transaction which delivered the batch containing
+	// the transaction. It is set once the transaction is batched
+	BatchTxHash common.Hash
+
+	// BlockNum and TxIndex are set once the transaction is included
+	BlockNum uint64
+	TxIndex  uint64
+
+	// FailReason explains why a failed transaction was dropped
+	FailReason string
+}
+
+// Retention is how long transactions which won't change anymore are kept in
+// the index. Zero keeps them forever
+type Retention struct {
+	// IncludedBlocks is how many arbitrum blocks an included transaction is
+	// kept for
+	IncludedBlocks uint64
+	// FailedAge is how long a failed transaction is kept for
+	FailedAge time.Duration
+}
+
+var DefaultRetention = Retention{
+	IncludedBlocks: 100000,
+	FailedAge:      7 * 24 * time.Hour,
+}
+
+var entryPrefix = []byte("tx")
+
+func entryKey(txHash common.Hash) []byte {
+	return append(append([]byte{}, entryPrefix...), txHash.Bytes()...)
+}
+
+// Index is a persistent index of transactions sent to the aggregator keyed by
+// transaction hash. It also holds the batches which haven't been confirmed so
+// that they survive restarts
+type Index struct {
+	// mu serializes updates to entries so that a status is never overwritten
+	// by a concurrent update which read an older one
+	mu sync.Mutex
+	db ethdb.KeyValueStore
+}
+
+func New(db ethdb.KeyValueStore) *Index {
+	return &Index{db: db}
+}
+
+// Open opens or creates an index stored in a leveldb database at path
+func Open(path string) (*Index, error) {
+	db, err := leveldb.New(path, 16, 16, "txindex")
+	if err != nil {
+		return nil, errors2.Wrap(err, "error opening tx index")
+	}
+	return New(db), nil
+}
+
+func (i *Index) Close() error {
+	return i.db.Close()
+}
+
+// Get returns the entry for the given transaction or nil if the transaction
+// isn't in the index
+func (i *Index) Get(txHash common.Hash) (*Entry, error) {
+	key := entryKey(txHash)
+	found, err := i.db.Has(key)
+	if err != nil || !found {
+		return nil, err
+	}
+	data, err := i.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	entry := new(Entry)
+	if err := rlp.DecodeBytes(data, entry); err != nil {
+		return nil, errors2.Wrap(err, "error decoding tx index entry")
+	}
+	return entry, nil
+}
+
+func (i *Index) put(batch ethdb.KeyValueWriter, entry *Entry) error {
+	data, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		return err
+	}
+	return batch.Put(entryKey(entry.Tx.Hash()), data)
+}
+
+// update applies f to the existing entries for the given transactions and
+// writes the results atomically. Transactions not in the index are skipped
+func (i *Index) update(txHashes []common.Hash, f func(*Entry)) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.db.NewBatch()
+	for _, txHash := range txHashes {
+		entry, err := i.Get(txHash)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		before := *entry
+		f(entry)
+		if err := i.put(batch, entry); err != nil {
+			return err
+		}
+		if err := addPruneKeys(batch, &before, entry); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// MarkQueued adds a newly accepted transaction to the index. It does nothing
+// if the transaction has already moved further along, which can happen when
+// it's batched before this is called
+func (i *Index) MarkQueued(tx *types.Transaction) error {
+	return i.add(&Entry{Status: Queued, Tx: tx})
+}
+
+// MarkForwarded adds a transaction relayed to an upstream aggregator to the
+// index. Like MarkQueued it never moves an existing transaction backwards
+func (i *Index) MarkForwarded(tx *types.Transaction) error {
+	return i.add(&Entry{Status: Forwarded, Tx: tx})
+}
+
+// add writes a new entry unless the transaction is already in the index.
+// Failed transactions may be resubmitted so they are overwritten
+func (i *Index) add(entry *Entry) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	existing, err := i.Get(entry.Tx.Hash())
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Status != Failed {
+		return nil
+	}
+	return i.put(i.db, entry)
+}
+
+// MarkUpstreamBatched records that an upstream aggregator batched a
+// forwarded transaction in the given L1 transaction
+func (i *Index) MarkUpstreamBatched(txHash common.Hash, batchTxHash common.Hash) error {
+	return i.update([]common.Hash{txHash}, func(entry *Entry) {
+		if entry.Status == Included {
+			return
+		}
+		entry.Status = Batched
+		entry.BatchTxHash = batchTxHash
+	})
+}
+
+// Batch is a batch of transactions sent to the inbox which hasn't been
+// confirmed yet
+type Batch struct {
+	// Seq orders batches by when they were created
+	Seq uint64
+	// TxHash is the latest L1 transaction sending the batch. It is empty if
+	// the batch couldn't be sent
+	TxHash common.Hash
+	// L1Block is the L1 block number when the batch was first sent. Checks
+	// for whether the batch was delivered start from it
+	L1Block uint64
+	Txes    []*types.Transaction
+	// From and Nonce identify the L1 transaction sending the batch so that
+	// it can be told whether that transaction can still be mined. From is
+	// empty if they aren't known
+	From  common.Address
+	Nonce uint64
+}
+
+var batchPrefix = []byte("batch")
+
+func batchKey(seq uint64) []byte {
+	key := make([]byte, len(batchPrefix)+8)
+	copy(key, batchPrefix)
+	binary.BigEndian.PutUint64(key[len(batchPrefix):], seq)
+	return key
+}
+
+// MarkBatched records a batch sent to the inbox, or resent in a new L1
+// transaction, along with the batched status of each of its transactions
+func (i *Index) MarkBatched(batch *Batch) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	data, err := rlp.EncodeToBytes(batch)
+	if err != nil {
+		return err
+	}
+	dbBatch := i.db.NewBatch()
+	if err := dbBatch.Put(batchKey(batch.Seq), data); err != nil {
+		return err
+	}
+	for _, tx := range batch.Txes {
+		existing, err := i.Get(tx.Hash())
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Status == Included {
+			// The batch was resent after the transaction already executed
+			continue
+		}
+		entry := &Entry{Status: Batched, Tx: tx, BatchTxHash: batch.TxHash}
+		if err := i.put(dbBatch, entry); err != nil {
+			return err
+		}
+	}
+	return dbBatch.Write()
+}
+
+// CompleteBatch removes a batch once it has been delivered to the inbox
+func (i *Index) CompleteBatch(seq uint64) error {
+	return i.db.Delete(batchKey(seq))
+}
+
+// PendingBatches returns every batch which hasn't been completed ordered by
+// sequence number
+func (i *Index) PendingBatches() ([]*Batch, error) {
+	it := i.db.NewIterator(batchPrefix, nil)
+	defer it.Release()
+	var batches []*Batch
+	for it.Next() {
+		batch := new(Batch)
+		if err := rlp.DecodeBytes(it.Value(), batch); err != nil {
+			return nil, errors2.Wrap(err, "error decoding batch")
+		}
+		batches = append(batches, batch)
+	}
+	return batches, it.Error()
+}
+
+// MarkIncluded records the arbitrum block containing the result of a
+// transaction. It does nothing for transactions that aren't in the index
+func (i *Index) MarkIncluded(txHash common.Hash, blockNum uint64, txIndex uint64) error {
+	return i.update([]common.Hash{txHash}, func(entry *Entry) {
+		entry.Status = Included
+		entry.BlockNum = blockNum
+		entry.TxIndex = txIndex
+		entry.FailReason = ""
+	})
+}
+
+// MarkFailed records that the given transactions were dropped
+func (i *Index) MarkFailed(txHashes []common.Hash, reason string) error {
+	return i.update(txHashes, func(entry *Entry) {
+		if entry.Status == Included {
+			return
+		}
+		entry.Status = Failed
+		entry.FailReason = reason
+	})
+}
+
+// Queued returns every transaction which was accepted by the aggregator but
+// hasn't been batched or dropped
+func (i *Index) Queued() ([]*types.Transaction, error) {
+	it := i.db.NewIterator(entryPrefix, nil)
+	defer it.Release()
+	var queued []*types.Transaction
+	for it.Next() {
+		entry := new(Entry)
+		if err := rlp.DecodeBytes(it.Value(), entry); err != nil {
+			return nil, errors2.Wrap(err, "error decoding tx index entry")
+		}
+		if entry.Status == Queued {
+			queued = append(queued, entry.Tx)
+		}
+	}
+	return queued, it.Error()
+}
+
+// Entries which won't change anymore are pruned in order using keys sorted by
+// the block an entry was included in or the time it failed. Since the sorted
+// keys aren't removed when an entry changes, pruning checks that each one
+// still describes its entry
+var (
+	includedPrefix = []byte("pruneIncluded")
+	failedPrefix   = []byte("pruneFailed")
+	// failTimePrefix keys the time each failed transaction failed
+	failTimePrefix = []byte("failTime")
+)
+
+func pruneKey(prefix []byte, n uint64, txHash common.Hash) []byte {
+	key := make([]byte, len(prefix)+8+common.HashLength)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], n)
+	copy(key[len(prefix)+8:], txHash.Bytes())
+	return key
+}
+
+func parsePruneKey(prefix []byte, key []byte) (uint64, common.Hash) {
+	n := binary.BigEndian.Uint64(key[len(prefix):])
+	return n, common.BytesToHash(key[len(prefix)+8:])
+}
+
+func failTimeKey(txHash common.Hash) []byte {
+	return append(append([]byte{}, failTimePrefix...), txHash.Bytes()...)
+}
+
+// addPruneKeys records when an entry which was just updated from before was
+// included or failed
+func addPruneKeys(batch ethdb.KeyValueWriter, before *Entry, entry *Entry) error {
+	txHash := entry.Tx.Hash()
+	switch {
+	case entry.Status == Included && (before.Status != Included || before.BlockNum != entry.BlockNum):
+		return batch.Put(pruneKey(includedPrefix, entry.BlockNum, txHash), []byte{})
+	case entry.Status == Failed && before.Status != Failed:
+		failTime := make([]byte, 8)
+		now := uint64(time.Now().Unix())
+		binary.BigEndian.PutUint64(failTime, now)
+		if err := batch.Put(failTimeKey(txHash), failTime); err != nil {
+			return err
+		}
+		return batch.Put(pruneKey(failedPrefix, now, txHash), []byte{})
+	default:
+		return nil
+	}
+}
+
+// Prune removes transactions included in blocks before includedBefore and
+// transactions which failed before failedBefore. It returns the number of
+// transactions removed
+func (i *Index) Prune(includedBefore uint64, failedBefore time.Time) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	batch := i.db.NewBatch()
+	included, err := i.prunePrefix(batch, includedPrefix, includedBefore, func(blockNum uint64, txHash common.Hash, entry *Entry) (bool, error) {
+		return entry.Status == Included && entry.BlockNum == blockNum, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	failedCutoff := uint64(0)
+	if unix := failedBefore.Unix(); unix > 0 {
+		failedCutoff = uint64(unix)
+	}
+	failed, err := i.prunePrefix(batch, failedPrefix, failedCutoff, func(failedAt uint64, txHash common.Hash, entry *Entry) (bool, error) {
+		key := failTimeKey(txHash)
+		found, err := i.db.Has(key)
+		if err != nil || !found {
+			return false, err
+		}
+		data, err := i.db.Get(key)
+		if err != nil {
+			return false, err
+		}
+		if len(data) != 8 || binary.BigEndian.Uint64(data) != failedAt {
+			// The transaction failed again later so a newer key covers it
+			return false, nil
+		}
+		if err := batch.Delete(key); err != nil {
+			return false, err
+		}
+		return entry.Status == Failed, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return included + failed, batch.Write()
+}
+
+// PruneAt prunes the transactions which are past retention as of the given
+// arbitrum block and time
+func (i *Index) PruneAt(retention Retention, blockNum uint64, now time.Time) (int, error) {
+	var includedBefore uint64
+	if retention.IncludedBlocks > 0 && blockNum > retention.IncludedBlocks {
+		includedBefore = blockNum - retention.IncludedBlocks
+	}
+	var failedBefore time.Time
+	if retention.FailedAge > 0 {
+		failedBefore = now.Add(-retention.FailedAge)
+	}
+	return i.Prune(includedBefore, failedBefore)
+}
+
+// prunePrefix deletes the prune keys with the given prefix which are below
+// cutoff, along with the entries they describe if shouldPrune says they still
+// apply
+func (i *Index) prunePrefix(
+	batch ethdb.Batch,
+	prefix []byte,
+	cutoff uint64,
+	shouldPrune func(uint64, common.Hash, *Entry) (bool, error),
+) (int, error) {
+	it := i.db.NewIterator(prefix, nil)
+	defer it.Release()
+	pruned := 0
+	for it.Next() {
+		n, txHash := parsePruneKey(prefix, it.Key())
+		if n >= cutoff {
+			break
+		}
+		if err := batch.Delete(common.CopyBytes(it.Key())); err != nil {
+			return 0, err
+		}
+		entry, err := i.Get(txHash)
+		if err != nil {
+			return 0, err
+		}
+		if entry == nil {
+			continue
+		}
+		prune, err := shouldPrune(n, txHash, entry)
+		if err != nil {
+			return 0, err
+		}
+		if prune {
+			if err := batch.Delete(entryKey(txHash)); err != nil {
+				return 0, err
+			}
+			pruned++
+		}
+	}
+	return pruned, it.Error()
+}
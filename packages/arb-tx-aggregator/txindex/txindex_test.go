@@ -0,0 +1,231 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txindex
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+func testTx(nonce uint64) *types.Transaction {
+	return types.NewTransaction(nonce, common.Address{1}, big.NewInt(0), 21000, big.NewInt(1), nil)
+}
+
+func checkStatus(t *testing.T, index *Index, tx *types.Transaction, status Status) {
+	t.Helper()
+	entry, err := index.Get(tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Fatal("tx missing from index")
+	}
+	if entry.Status != status {
+		t.Errorf("tx has status %v but expected %v", entry.Status, status)
+	}
+}
+
+func TestStatusNeverMovesBackwards(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance func(*Index, *types.Transaction) error
+		status  Status
+	}{
+		{
+			name: "batched",
+			advance: func(index *Index, tx *types.Transaction) error {
+				return index.MarkBatched(&Batch{Seq: 1, Txes: []*types.Transaction{tx}})
+			},
+			status: Batched,
+		},
+		{
+			name: "included",
+			advance: func(index *Index, tx *types.Transaction) error {
+				return index.MarkIncluded(tx.Hash(), 5, 0)
+			},
+			status: Included,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, mark := range []func(*Index, *types.Transaction) error{
+				(*Index).MarkQueued,
+				(*Index).MarkForwarded,
+			} {
+				index := New(memorydb.New())
+				tx := testTx(0)
+				if err := mark(index, tx); err != nil {
+					t.Fatal(err)
+				}
+				if err := test.advance(index, tx); err != nil {
+					t.Fatal(err)
+				}
+				// A late initial update must not undo the progress
+				if err := mark(index, tx); err != nil {
+					t.Fatal(err)
+				}
+				checkStatus(t, index, tx, test.status)
+			}
+		})
+	}
+}
+
+func TestResentBatchKeepsIncluded(t *testing.T) {
+	index := New(memorydb.New())
+	included := testTx(0)
+	pending := testTx(1)
+	batch := &Batch{Seq: 1, Txes: []*types.Transaction{included, pending}}
+	if err := index.MarkBatched(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.MarkIncluded(included.Hash(), 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	batch.TxHash = common.Hash{2}
+	if err := index.MarkBatched(batch); err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, index, included, Included)
+	checkStatus(t, index, pending, Batched)
+}
+
+func TestFailedTransactionCanBeRequeued(t *testing.T) {
+	index := New(memorydb.New())
+	tx := testTx(0)
+	if err := index.MarkQueued(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.MarkFailed([]common.Hash{tx.Hash()}, "dropped"); err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, index, tx, Failed)
+	if err := index.MarkQueued(tx); err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, index, tx, Queued)
+}
+
+func TestPrune(t *testing.T) {
+	index := New(memorydb.New())
+	var txes []*types.Transaction
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		tx := testTx(nonce)
+		if err := index.MarkQueued(tx); err != nil {
+			t.Fatal(err)
+		}
+		txes = append(txes, tx)
+	}
+	old, recent, reincluded, failed, requeued := txes[0], txes[1], txes[2], txes[3], txes[4]
+	for _, inclusion := range []struct {
+		tx       *types.Transaction
+		blockNum uint64
+	}{{old, 5}, {recent, 10}, {reincluded, 5}, {reincluded, 20}} {
+		if err := index.MarkIncluded(inclusion.tx.Hash(), inclusion.blockNum, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.MarkFailed([]common.Hash{failed.Hash(), requeued.Hash()}, "dropped"); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.MarkQueued(requeued); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := index.Prune(10, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Error("pruned", pruned, "transactions but expected 1")
+	}
+	if entry, err := index.Get(old.Hash()); err != nil || entry != nil {
+		t.Error("old included transaction wasn't pruned", entry, err)
+	}
+	checkStatus(t, index, recent, Included)
+	checkStatus(t, index, reincluded, Included)
+	checkStatus(t, index, failed, Failed)
+
+	pruned, err = index.Prune(0, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Error("pruned", pruned, "transactions but expected 1")
+	}
+	if entry, err := index.Get(failed.Hash()); err != nil || entry != nil {
+		t.Error("failed transaction wasn't pruned", entry, err)
+	}
+	checkStatus(t, index, requeued, Queued)
+}
+
+func TestQueuedReportsCorruptEntries(t *testing.T) {
+	db := memorydb.New()
+	index := New(db)
+	if err := index.MarkQueued(testTx(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(entryKey(common.Hash{1}), []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.Queued(); err == nil {
+		t.Error("corrupt entry was skipped")
+	}
+}
+
+func TestPendingBatchesRoundTrip(t *testing.T) {
+	index := New(memorydb.New())
+	batches := []*Batch{
+		{Seq: 2, TxHash: common.Hash{2}, L1Block: 20, Txes: []*types.Transaction{testTx(1)}, From: common.Address{3}, Nonce: 7},
+		{Seq: 1, L1Block: 10, Txes: []*types.Transaction{testTx(0)}},
+	}
+	for _, batch := range batches {
+		if err := index.MarkBatched(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.CompleteBatch(3); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := index.PendingBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Seq != 1 || pending[1].Seq != 2 {
+		t.Fatal("batches weren't returned in order", pending)
+	}
+	sent := pending[1]
+	if sent.TxHash != batches[0].TxHash || sent.L1Block != 20 || sent.From != batches[0].From || sent.Nonce != 7 {
+		t.Error("batch wasn't restored", sent)
+	}
+
+	if err := index.CompleteBatch(1); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = index.PendingBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Seq != 2 {
+		t.Error("completed batch still pending", pending)
+	}
+}
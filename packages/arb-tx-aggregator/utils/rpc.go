@@ -17,35 +17,39 @@
 package utils
 
 import (
-	"flag"
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
-type RPCFlags struct {
-	certFile *string
-	keyFile  *string
-}
-
-func AddRPCFlags(fs *flag.FlagSet) RPCFlags {
-	certFile := fs.String("cert", "", "path to certificate file (if using ssl)")
-	privkeyFile := fs.String("privkey", "", "path to private key file (if using ssl)")
-
-	return RPCFlags{
-		certFile: certFile,
-		keyFile:  privkeyFile,
-	}
-}
+// rpcShutdownTimeout is how long in-flight requests are given to finish when
+// an rpc server is shut down
+const rpcShutdownTimeout = 10 * time.Second
 
-func LaunchRPC(handler http.Handler, port string, flags RPCFlags) error {
+// LaunchRPC serves handler on addr until ctx is cancelled, at which point the
+// server stops accepting connections and waits for in-flight requests. Any
+// extra routes are served alongside handler, keyed by path. The server uses
+// https if certFile and keyFile are both set
+func LaunchRPC(
+	ctx context.Context,
+	handler http.Handler,
+	addr string,
+	certFile string,
+	keyFile string,
+	routes map[string]http.Handler,
+) error {
 	r := mux.NewRouter()
 	r.Handle("/", handler).Methods("GET", "POST", "OPTIONS")
+	for path, routeHandler := range routes {
+		r.Handle(path, routeHandler).Methods("GET", "HEAD")
+	}
 
 	headersOk := handlers.AllowedHeaders(
-		[]string{"X-Requested-With", "Content-Type", "Authorization"},
+		[]string{"X-Requested-With", "Content-Type", "Authorization", "X-API-Key"},
 	)
 	originsOk := handlers.AllowedOrigins([]string{"*"})
 	methodsOk := handlers.AllowedMethods(
@@ -53,20 +57,29 @@ func LaunchRPC(handler http.Handler, port string, flags RPCFlags) error {
 	)
 	h := handlers.CORS(headersOk, originsOk, methodsOk)(r)
 
-	if flags.certFile != nil && flags.keyFile != nil && *flags.certFile != "" && *flags.keyFile != "" {
-		log.Println("Launching rpc server over https with cert", *flags.certFile, "and key", *flags.keyFile)
-		return http.ListenAndServeTLS(
-			":"+port,
-			*flags.certFile,
-			*flags.keyFile,
-			h,
-		)
+	srv := &http.Server{Addr: addr, Handler: h}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), rpcShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("Error shutting down rpc server on", addr, err)
+		}
+	}()
+
+	var err error
+	if certFile != "" && keyFile != "" {
+		log.Println("Launching rpc server on", addr, "over https with cert", certFile, "and key", keyFile)
+		err = srv.ListenAndServeTLS(certFile, keyFile)
 	} else {
-		log.Println("Launching rpc server over http")
-		return http.ListenAndServe(
-			":"+port,
-			h,
-		)
+		log.Println("Launching rpc server on", addr, "over http")
+		err = srv.ListenAndServe()
 	}
-
+	if err != http.ErrServerClosed {
+		return err
+	}
+	<-shutdownDone
+	return nil
 }
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
+)
+
+// Admin implements the admin namespace which lets an operator inspect and
+// control the batcher of a running aggregator. It must only be served behind
+// AdminAuth
+type Admin struct {
+	batch *batcher.Batcher
+}
+
+func NewAdmin(batch *batcher.Batcher) *Admin {
+	return &Admin{batch: batch}
+}
+
+type QueuedTransactionResult struct {
+	Hash     common.Hash    `json:"hash"`
+	Nonce    hexutil.Uint64 `json:"nonce"`
+	GasPrice *hexutil.Big   `json:"gasPrice"`
+	Received time.Time      `json:"received"`
+}
+
+// QueuedTransactions lists the queued transactions of each account in nonce
+// order
+func (a *Admin) QueuedTransactions(_ *http.Request, _ *EmptyArgs, reply *map[common.Address][]QueuedTransactionResult) error {
+	res := make(map[common.Address][]QueuedTransactionResult)
+	for account, txes := range a.batch.QueuedTransactions() {
+		accountTxes := make([]QueuedTransactionResult, 0, len(txes))
+		for _, tx := range txes {
+			accountTxes = append(accountTxes, QueuedTransactionResult{
+				Hash:     tx.Tx.Hash(),
+				Nonce:    hexutil.Uint64(tx.Tx.Nonce()),
+				GasPrice: (*hexutil.Big)(tx.Tx.GasPrice()),
+				Received: tx.Received,
+			})
+		}
+		res[account] = accountTxes
+	}
+	*reply = res
+	return nil
+}
+
+// DropTransaction removes a transaction from the queue along with its
+// account's later queued transactions and returns the hashes of every removed
+// transaction. It fails if the transaction isn't queued
+func (a *Admin) DropTransaction(_ *http.Request, args *DropTransactionArgs, reply *[]common.Hash) error {
+	dropped, err := a.batch.DropTransaction(args.TxHash)
+	if err != nil {
+		return err
+	}
+	*reply = dropped
+	return nil
+}
+
+// FlushBatch sends the pending batch immediately and returns the number of
+// transactions it contained
+func (a *Admin) FlushBatch(_ *http.Request, _ *EmptyArgs, reply *hexutil.Uint64) error {
+	*reply = hexutil.Uint64(a.batch.FlushBatch())
+	return nil
+}
+
+// PauseBatching stops new batches from being sent until ResumeBatching is
+// called
+func (a *Admin) PauseBatching(_ *http.Request, _ *EmptyArgs, reply *bool) error {
+	a.batch.SetPaused(true)
+	*reply = true
+	return nil
+}
+
+func (a *Admin) ResumeBatching(_ *http.Request, _ *EmptyArgs, reply *bool) error {
+	a.batch.SetPaused(false)
+	*reply = true
+	return nil
+}
+
+type BatcherStatusResult struct {
+	Paused       bool   `json:"paused"`
+	MaxBatchTime string `json:"maxBatchTime"`
+	// PendingTransactions is the number of transactions in the batch which
+	// hasn't been sent yet
+	PendingTransactions hexutil.Uint64 `json:"pendingTransactions"`
+}
+
+func (a *Admin) BatcherStatus(_ *http.Request, _ *EmptyArgs, reply *BatcherStatusResult) error {
+	*reply = BatcherStatusResult{
+		Paused:              a.batch.Paused(),
+		MaxBatchTime:        a.batch.MaxBatchTime().String(),
+		PendingTransactions: hexutil.Uint64(len(a.batch.PendingBatchTransactions())),
+	}
+	return nil
+}
+
+// SetMaxBatchTime changes how long a batch which isn't full waits before
+// it's sent. It returns the previous value
+func (a *Admin) SetMaxBatchTime(_ *http.Request, args *SetMaxBatchTimeArgs, reply *string) error {
+	prev := a.batch.MaxBatchTime()
+	if err := a.batch.SetMaxBatchTime(args.MaxBatchTime); err != nil {
+		return err
+	}
+	*reply = prev.String()
+	return nil
+}
+
+type SentBatchResult struct {
+	Seq          hexutil.Uint64 `json:"seq"`
+	TxHash       *common.Hash   `json:"txHash"`
+	L1Block      hexutil.Uint64 `json:"l1Block"`
+	SentAt       *time.Time     `json:"sentAt"`
+	Transactions []common.Hash  `json:"transactions"`
+}
+
+// PendingSentBatches lists the batches which were sent to L1 but haven't
+// been confirmed along with the L1 transaction which last sent them
+func (a *Admin) PendingSentBatches(_ *http.Request, _ *EmptyArgs, reply *[]SentBatchResult) error {
+	batches := a.batch.PendingSentBatches()
+	res := make([]SentBatchResult, 0, len(batches))
+	for _, batch := range batches {
+		item := SentBatchResult{
+			Seq:          hexutil.Uint64(batch.Seq),
+			L1Block:      hexutil.Uint64(batch.L1Block),
+			Transactions: make([]common.Hash, 0, len(batch.Txes)),
+		}
+		if batch.TxHash != (common.Hash{}) {
+			txHash := batch.TxHash
+			item.TxHash = &txHash
+		}
+		if !batch.SentAt.IsZero() {
+			sentAt := batch.SentAt
+			item.SentAt = &sentAt
+		}
+		for _, tx := range batch.Txes {
+			item.Transactions = append(item.Transactions, tx.Hash())
+		}
+		res = append(res, item)
+	}
+	*reply = res
+	return nil
+}
+
+// AdminAuth rejects requests which don't carry token
+func AdminAuth(handler http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		given := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("Authorization"); given == "" && strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
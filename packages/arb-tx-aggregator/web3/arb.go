@@ -0,0 +1,95 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
+)
+
+// Arb implements the arb namespace which exposes aggregator specific
+// information
+type Arb struct {
+	srv *aggregator.Server
+}
+
+func NewArb(srv *aggregator.Server) *Arb {
+	return &Arb{srv: srv}
+}
+
+type TransactionStatusResult struct {
+	Status           string          `json:"status"`
+	BatchTxHash      *common.Hash    `json:"batchTxHash"`
+	BlockNumber      *hexutil.Uint64 `json:"blockNumber"`
+	TransactionIndex *hexutil.Uint64 `json:"transactionIndex"`
+	Error            string          `json:"error,omitempty"`
+}
+
+// GetTransactionStatus reports whether a transaction sent to this aggregator
+// is queued, batched, included or failed. It returns null for transactions
+// which weren't sent through this aggregator
+func (a *Arb) GetTransactionStatus(_ *http.Request, args *GetTransactionReceiptArgs, reply **TransactionStatusResult) error {
+	entry, err := a.srv.GetTransactionStatus(common.BytesToHash(*args.Data))
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		*reply = nil
+		return nil
+	}
+	res := &TransactionStatusResult{
+		Status: entry.Status.String(),
+		Error:  entry.FailReason,
+	}
+	if entry.BatchTxHash != (common.Hash{}) {
+		batchTxHash := entry.BatchTxHash
+		res.BatchTxHash = &batchTxHash
+	}
+	if entry.Status == txindex.Included {
+		blockNum := hexutil.Uint64(entry.BlockNum)
+		txIndex := hexutil.Uint64(entry.TxIndex)
+		res.BlockNumber = &blockNum
+		res.TransactionIndex = &txIndex
+	}
+	*reply = res
+	return nil
+}
+
+type QueueStatsResult struct {
+	Policy   string         `json:"policy"`
+	Accounts hexutil.Uint64 `json:"accounts"`
+	Queued   hexutil.Uint64 `json:"queued"`
+	Buckets  map[string]int `json:"buckets"`
+}
+
+// QueueStats reports the ordering policy used by the batcher and the number
+// of transactions waiting to be batched, grouped by the policy's buckets
+func (a *Arb) QueueStats(_ *http.Request, _ *EmptyArgs, reply *QueueStatsResult) error {
+	stats := a.srv.QueueStats()
+	*reply = QueueStatsResult{
+		Policy:   stats.Policy,
+		Accounts: hexutil.Uint64(stats.Accounts),
+		Queued:   hexutil.Uint64(stats.Queued),
+		Buckets:  stats.Buckets,
+	}
+	return nil
+}
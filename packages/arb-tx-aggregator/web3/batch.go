@@ -0,0 +1,158 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/rpc/v2/json2"
+)
+
+// BatchHandler adds support for JSON-RPC batch requests to a handler which
+// only understands single requests. Each entry of a batch is dispatched to
+// the wrapped handler separately and the responses are collected, in order,
+// into a single array.
+type BatchHandler struct {
+	handler     http.Handler
+	maxRequests int
+}
+
+// DefaultMaxBatchRequests is the default limit on the number of entries in a
+// batch request
+const DefaultMaxBatchRequests = 100
+
+// NewBatchHandler wraps handler so that it accepts batches of at most
+// maxRequests entries. Batches of any size are accepted if maxRequests is
+// zero
+func NewBatchHandler(handler http.Handler, maxRequests int) *BatchHandler {
+	return &BatchHandler{handler: handler, maxRequests: maxRequests}
+}
+
+func (h *BatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.Body == nil {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		writeBatchError(w, &json2.Error{Code: json2.E_PARSE, Message: err.Error()})
+		return
+	}
+
+	if !isBatch(body) {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	var requests []json.RawMessage
+	if err := json.Unmarshal(body, &requests); err != nil {
+		writeBatchError(w, &json2.Error{Code: json2.E_PARSE, Message: err.Error()})
+		return
+	}
+	if len(requests) == 0 {
+		writeBatchError(w, &json2.Error{Code: json2.E_INVALID_REQ, Message: "empty batch"})
+		return
+	}
+	if h.maxRequests > 0 && len(requests) > h.maxRequests {
+		writeBatchError(w, &json2.Error{
+			Code:    json2.E_INVALID_REQ,
+			Message: fmt.Sprintf("batch of %v requests exceeds the limit of %v", len(requests), h.maxRequests),
+		})
+		return
+	}
+
+	responses := make([]json.RawMessage, 0, len(requests))
+	for _, request := range requests {
+		entryReq := r.Clone(r.Context())
+		entryReq.Body = ioutil.NopCloser(bytes.NewReader(request))
+		entryReq.ContentLength = int64(len(request))
+
+		entryWriter := newBatchEntryWriter()
+		h.handler.ServeHTTP(entryWriter, entryReq)
+
+		// Notifications don't produce a response
+		response := bytes.TrimSpace(entryWriter.body.Bytes())
+		if len(response) == 0 {
+			continue
+		}
+		if !json.Valid(response) {
+			// The handler failed before reaching the codec and wrote a plain
+			// text error so wrap it in a JSON-RPC error
+			response, err = json.Marshal(&serverResponse{
+				Version: Version,
+				Error:   &json2.Error{Code: json2.E_SERVER, Message: string(response)},
+				Id:      &null,
+			})
+			if err != nil {
+				continue
+			}
+		}
+		responses = append(responses, response)
+	}
+
+	if len(responses) == 0 {
+		// A batch made up entirely of notifications has no response
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func isBatch(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+func writeBatchError(w http.ResponseWriter, jsonErr *json2.Error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(&serverResponse{
+		Version: Version,
+		Error:   jsonErr,
+		Id:      &null,
+	})
+}
+
+// batchEntryWriter captures the response to a single entry in a batch
+type batchEntryWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newBatchEntryWriter() *batchEntryWriter {
+	return &batchEntryWriter{header: make(http.Header)}
+}
+
+func (w *batchEntryWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchEntryWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *batchEntryWriter) WriteHeader(int) {
+	// The status of an individual entry is reported in its JSON-RPC response
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/rpc/v2"
+	"github.com/gorilla/rpc/v2/json2"
+)
+
+// BatchTestArgs and BatchTestService are exported since the rpc server only
+// registers exported types
+type BatchTestArgs struct {
+	Value string
+}
+
+func (n *BatchTestArgs) UnmarshalJSON(buf []byte) error {
+	return unmarshalJSONArray(buf, []interface{}{&n.Value})
+}
+
+type BatchTestService struct{}
+
+func (BatchTestService) Echo(_ *http.Request, args *BatchTestArgs, reply *string) error {
+	*reply = args.Value
+	return nil
+}
+
+func (BatchTestService) Fail(_ *http.Request, args *BatchTestArgs, _ *string) error {
+	return errors.New(args.Value)
+}
+
+type batchTestResponse struct {
+	Result string       `json:"result"`
+	Error  *json2.Error `json:"error"`
+	Id     *int         `json:"id"`
+}
+
+func newBatchTestHandler(t *testing.T, maxRequests int) http.Handler {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewUpCodec(), "application/json")
+	if err := s.RegisterService(BatchTestService{}, "Test"); err != nil {
+		t.Fatal(err)
+	}
+	return NewBatchHandler(s, maxRequests)
+}
+
+func postBatch(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func decodeBatch(t *testing.T, w *httptest.ResponseRecorder) []batchTestResponse {
+	t.Helper()
+	var responses []batchTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("couldn't decode batch response %q: %v", w.Body.String(), err)
+	}
+	return responses
+}
+
+func decodeBatchError(t *testing.T, w *httptest.ResponseRecorder) *json2.Error {
+	t.Helper()
+	var response batchTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("couldn't decode error response %q: %v", w.Body.String(), err)
+	}
+	if response.Error == nil {
+		t.Fatalf("expected an error but got %q", w.Body.String())
+	}
+	return response.Error
+}
+
+func echoRequest(id int, value string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"test_echo","params":["%v"],"id":%v}`, value, id)
+}
+
+func TestBatchResponseOrder(t *testing.T) {
+	handler := newBatchTestHandler(t, 0)
+	values := []string{"a", "b", "c", "d", "e"}
+	requests := make([]string, 0, len(values))
+	for i, value := range values {
+		requests = append(requests, echoRequest(i, value))
+	}
+	responses := decodeBatch(t, postBatch(handler, "["+strings.Join(requests, ",")+"]"))
+	if len(responses) != len(values) {
+		t.Fatalf("got %v responses instead of %v", len(responses), len(values))
+	}
+	for i, response := range responses {
+		if response.Id == nil || *response.Id != i {
+			t.Errorf("response %v has the wrong id", i)
+		}
+		if response.Result != values[i] {
+			t.Errorf("response %v has result %q instead of %q", i, response.Result, values[i])
+		}
+	}
+}
+
+func TestBatchNotifications(t *testing.T) {
+	handler := newBatchTestHandler(t, 0)
+	notification := `{"jsonrpc":"2.0","method":"test_echo","params":["n"]}`
+	responses := decodeBatch(t, postBatch(handler, "["+notification+","+echoRequest(1, "a")+","+notification+"]"))
+	if len(responses) != 1 || *responses[0].Id != 1 {
+		t.Fatalf("expected only a response to the request but got %v", responses)
+	}
+
+	w := postBatch(handler, "["+notification+","+notification+"]")
+	if w.Body.Len() != 0 {
+		t.Errorf("batch of notifications got response %q", w.Body.String())
+	}
+}
+
+func TestBatchEntryErrors(t *testing.T) {
+	handler := newBatchTestHandler(t, 0)
+	body := "[" + strings.Join([]string{
+		echoRequest(0, "a"),
+		`{"jsonrpc":"2.0","method":"test_fail","params":["broken"],"id":1}`,
+		`{"jsonrpc":"2.0","method":"test_missing","params":[],"id":2}`,
+		echoRequest(3, "b"),
+	}, ",") + "]"
+	responses := decodeBatch(t, postBatch(handler, body))
+	if len(responses) != 4 {
+		t.Fatalf("got %v responses instead of 4", len(responses))
+	}
+	if responses[0].Error != nil || responses[3].Error != nil {
+		t.Error("failed entries affected the rest of the batch")
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != json2.E_SERVER || responses[1].Error.Message != "broken" {
+		t.Errorf("unexpected error for failed call %v", responses[1].Error)
+	}
+	if responses[2].Error == nil {
+		t.Error("unknown method didn't return an error")
+	}
+}
+
+func TestBatchPlainTextError(t *testing.T) {
+	handler := NewBatchHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}), 0)
+	responses := decodeBatch(t, postBatch(handler, "["+echoRequest(0, "a")+"]"))
+	if len(responses) != 1 || responses[0].Error == nil {
+		t.Fatal("plain text error wasn't returned as a JSON-RPC error")
+	}
+	if responses[0].Error.Code != json2.E_SERVER || !strings.Contains(responses[0].Error.Message, "rate limited") {
+		t.Errorf("unexpected error %v", responses[0].Error)
+	}
+}
+
+func TestEmptyBatch(t *testing.T) {
+	jsonErr := decodeBatchError(t, postBatch(newBatchTestHandler(t, 0), "[]"))
+	if jsonErr.Code != json2.E_INVALID_REQ {
+		t.Errorf("empty batch returned error code %v", jsonErr.Code)
+	}
+}
+
+func TestMalformedBatch(t *testing.T) {
+	jsonErr := decodeBatchError(t, postBatch(newBatchTestHandler(t, 0), "["+echoRequest(0, "a")+","))
+	if jsonErr.Code != json2.E_PARSE {
+		t.Errorf("malformed batch returned error code %v", jsonErr.Code)
+	}
+}
+
+func TestBatchLimit(t *testing.T) {
+	handler := newBatchTestHandler(t, 2)
+	responses := decodeBatch(t, postBatch(handler, "["+echoRequest(0, "a")+","+echoRequest(1, "b")+"]"))
+	if len(responses) != 2 {
+		t.Errorf("batch at the limit got %v responses", len(responses))
+	}
+
+	jsonErr := decodeBatchError(t, postBatch(handler, "["+echoRequest(0, "a")+","+echoRequest(1, "b")+","+echoRequest(2, "c")+"]"))
+	if jsonErr.Code != json2.E_INVALID_REQ {
+		t.Errorf("oversized batch returned error code %v", jsonErr.Code)
+	}
+}
+
+func TestSingleRequestPassesThrough(t *testing.T) {
+	handler := newBatchTestHandler(t, 1)
+	var response batchTestResponse
+	w := postBatch(handler, echoRequest(7, "single"))
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "single" || *response.Id != 7 {
+		t.Errorf("unexpected response %q", w.Body.String())
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/rpc/v2/json2"
 
@@ -102,6 +103,7 @@ func (c *Codec) NewRequest(r *http.Request) rpc.CodecRequest {
 
 // newCodecRequest returns a new CodecRequest.
 func newCodecRequest(r *http.Request, encoder rpc.Encoder, errorMapper func(error) error) rpc.CodecRequest {
+	start := time.Now()
 	// Decode the request body and check if RPC method is valid.
 	req := new(serverRequest)
 	err := json.NewDecoder(r.Body).Decode(req)
@@ -121,7 +123,7 @@ func newCodecRequest(r *http.Request, encoder rpc.Encoder, errorMapper func(erro
 	}
 
 	r.Body.Close()
-	return &CodecRequest{request: req, err: err, encoder: encoder, errorMapper: errorMapper}
+	return &CodecRequest{request: req, err: err, encoder: encoder, errorMapper: errorMapper, start: start}
 }
 
 // CodecRequest decodes and encodes a single request.
@@ -130,6 +132,10 @@ type CodecRequest struct {
 	err         error
 	encoder     rpc.Encoder
 	errorMapper func(error) error
+	start       time.Time
+	// dispatched is set once the server has found a registered service
+	// method for the request
+	dispatched bool
 }
 
 // Method returns the RPC method for the current request.
@@ -173,9 +179,13 @@ func init() {
 	ignoredMethods["eth_gasPrice"] = true
 	ignoredMethods["eth_getLogs"] = true
 	ignoredMethods["eth_chainId"] = true
+	ignoredMethods["eth_getFilterChanges"] = true
+	ignoredMethods["eth_syncing"] = true
 }
 
 func (c *CodecRequest) ReadRequest(args interface{}) error {
+	// The server only reads the request after it resolves the method
+	c.dispatched = true
 	if c.err == nil && c.request.Params != nil {
 		if _, ok := ignoredMethods[c.request.Method]; !ok {
 			raw, _ := c.request.Params.MarshalJSON()
@@ -236,6 +246,7 @@ func (c CodecRequest) tryToMapIfNotAnErrorAlready(err error) error {
 }
 
 func (c *CodecRequest) writeServerResponse(w http.ResponseWriter, res *serverResponse) {
+	recordRequest(metricMethod(c.request.Method, c.dispatched), c.start, res.Error != nil)
 	// Id is null for notifications and they don't have a response, unless we couldn't even parse the JSON, in that
 	// case we can't know whether it was intended to be a notification
 	if c.request.Id != nil || isParseErrorResponse(res) {
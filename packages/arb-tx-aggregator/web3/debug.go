@@ -0,0 +1,231 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// traceBackend is the part of the aggregator which tracing needs
+type traceBackend interface {
+	snapshotSource
+	GetRequestResult(requestId arbcommon.Hash) (value.Value, error)
+	GetBlockResults(height uint64) ([]*evm.TxResult, error)
+	BlockInfo(height uint64) (*machine.BlockInfo, error)
+	AdjustGas(msg message.ContractTransaction) message.ContractTransaction
+}
+
+// Debug implements the debug namespace which re-executes transactions and
+// calls to provide more detail about their execution than is available from
+// their receipts
+type Debug struct {
+	srv traceBackend
+}
+
+func NewDebug(eth *Server) *Debug {
+	return &Debug{srv: eth.srv}
+}
+
+// TraceTransaction re-executes an already included transaction on top of the
+// state at the end of the previous block plus all transactions which preceded
+// it in its own block. Each message is replayed with the inbox sequence
+// number it was originally delivered with so that request ids and state
+// match the original execution. The trace only has the outermost call frame
+// since ArbOS doesn't report nested calls
+func (d *Debug) TraceTransaction(r *http.Request, args *TraceTransactionArgs, reply **TraceResult) error {
+	var requestId arbcommon.Hash
+	copy(requestId[:], args.TxHash)
+	val, err := d.srv.GetRequestResult(requestId)
+	if err != nil {
+		return errors2.Wrap(err, "transaction not found")
+	}
+	res, err := evm.NewTxResultFromValue(val)
+	if err != nil {
+		return err
+	}
+
+	height := res.IncomingRequest.ChainTime.BlockNum.AsInt().Uint64()
+	if height == 0 {
+		return errors.New("can't trace transaction in genesis block")
+	}
+	snap, err := d.srv.GetSnapshot(r.Context(), height-1)
+	if err != nil {
+		return err
+	}
+	if snap == nil {
+		return errors.New("state before transaction is not available")
+	}
+	snap = snap.Clone()
+	snap.AdvanceTime(res.IncomingRequest.ChainTime)
+
+	blockResults, err := d.srv.GetBlockResults(height)
+	if err != nil {
+		return err
+	}
+	// Every message delivered in the block produces at least one result so
+	// the number of results bounds how far apart their sequence numbers are
+	searchWindow := len(blockResults)
+	for _, prev := range blockResults {
+		if prev.TxIndex.Cmp(res.TxIndex) >= 0 {
+			break
+		}
+		if err := snap.ReplayRequest(prev.IncomingRequest, searchWindow); err != nil {
+			return errors2.Wrap(err, "failed to replay preceding transaction")
+		}
+	}
+
+	trace, err := snap.TraceRequest(res.IncomingRequest, searchWindow)
+	if err != nil {
+		return err
+	}
+	msg, err := nestedMessage(res.IncomingRequest)
+	if err != nil {
+		return err
+	}
+
+	var blockHash arbcommon.Hash
+	blockInfo, err := d.srv.BlockInfo(height)
+	if err != nil {
+		return err
+	}
+	if blockInfo != nil {
+		blockHash = blockInfo.Hash
+	}
+	*reply = newTraceResult(msg, res.IncomingRequest.Sender, trace, blockHash)
+	return nil
+}
+
+// TraceCall executes a call against the state at the given block and
+// returns a trace of its execution. Like TraceTransaction it only has the
+// outermost call frame
+func (d *Debug) TraceCall(r *http.Request, args *CallArgs, reply **TraceResult) error {
+	snap, err := snapshotAt(r.Context(), d.srv, args.BlockNum)
+	if err != nil {
+		return err
+	}
+	from, callMsg := buildCallMsg(args.CallArgs)
+	callMsg = d.srv.AdjustGas(callMsg)
+	msg := message.NewSafeL2Message(callMsg)
+	trace, err := snap.TraceMessage(msg, from)
+	if err != nil {
+		return err
+	}
+	*reply = newTraceResult(msg, from, trace, arbcommon.Hash{})
+	return nil
+}
+
+func nestedMessage(req evm.IncomingRequest) (message.Message, error) {
+	return message.NestedMessage(inbox.InboxMessage{Kind: req.Kind, Data: req.Data})
+}
+
+// newTraceResult builds the trace of a message. ArbOS only reports the outcome
+// of the outermost call, so that's the only frame and it holds every log.
+// Gas and value are those of the message itself
+func newTraceResult(msg message.Message, sender arbcommon.Address, trace *snapshot.Trace, blockHash arbcommon.Hash) *TraceResult {
+	res := trace.Result
+	frame := &TraceResult{
+		Type:     "CALL",
+		From:     sender.ToEthAddress(),
+		Value:    (*hexutil.Big)(big.NewInt(0)),
+		GasUsed:  (*hexutil.Big)(res.GasUsed),
+		Output:   res.ReturnData,
+		Logs:     make([]*types.Log, 0),
+		AVMSteps: hexutil.Uint64(trace.AVMSteps),
+		AVMGas:   hexutil.Uint64(trace.AVMGas),
+	}
+
+	if l2, ok := msg.(message.L2Message); ok {
+		if abstract, err := l2.AbstractMessage(); err == nil {
+			frame.setCallInfo(abstract)
+		}
+	}
+
+	switch res.ResultCode {
+	case evm.ReturnCode:
+	case evm.RevertCode:
+		frame.Error = "execution reverted"
+		if reason, err := abi.UnpackRevert(res.ReturnData); err == nil {
+			frame.RevertReason = reason
+		}
+	case evm.CongestionCode:
+		frame.Error = "congestion"
+	case evm.InsufficientGasFundsCode:
+		frame.Error = "insufficient funds for gas"
+	case evm.InsufficientTxFundsCode:
+		frame.Error = "insufficient funds for transfer"
+	case evm.BadSequenceCode:
+		frame.Error = "invalid nonce"
+	case evm.InvalidMessageFormatCode:
+		frame.Error = "invalid message format"
+	default:
+		frame.Error = "unknown error"
+	}
+
+	if frame.Type == "CREATE" && res.ResultCode == evm.ReturnCode && len(res.ReturnData) >= 32 {
+		var created common.Address
+		copy(created[:], res.ReturnData[12:32])
+		frame.To = &created
+	}
+	frame.Logs = append(frame.Logs, res.ToEthReceipt(blockHash).Logs...)
+	return frame
+}
+
+func (t *TraceResult) setCallInfo(msg message.AbstractL2Message) {
+	switch msg := msg.(type) {
+	case message.EthConvertable:
+		tx := msg.AsEthTx()
+		t.To = tx.To()
+		t.Value = (*hexutil.Big)(tx.Value())
+		t.Gas = (*hexutil.Big)(new(big.Int).SetUint64(tx.Gas()))
+		t.Input = tx.Data()
+	case message.ContractTransaction:
+		t.setDestination(msg.DestAddress)
+		t.Value = (*hexutil.Big)(msg.Payment)
+		t.Gas = (*hexutil.Big)(msg.MaxGas)
+		t.Input = msg.Data
+	case message.Call:
+		t.setDestination(msg.DestAddress)
+		t.Gas = (*hexutil.Big)(msg.MaxGas)
+		t.Input = msg.Data
+	}
+	if t.To == nil {
+		t.Type = "CREATE"
+	}
+}
+
+func (t *TraceResult) setDestination(dest arbcommon.Address) {
+	if dest != (arbcommon.Address{}) {
+		to := dest.ToEthAddress()
+		t.To = &to
+	}
+}
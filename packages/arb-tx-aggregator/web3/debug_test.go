@@ -0,0 +1,311 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var traceChainId = big.NewInt(42)
+
+// traceMachine stands in for ArbOS by answering every message with the
+// result built by respond. It records the messages delivered to it and its
+// clones so tests can check how state was rebuilt
+type traceMachine struct {
+	machine.Machine
+	respond   func(msg inbox.InboxMessage) *evm.TxResult
+	delivered *[]inbox.InboxMessage
+}
+
+func newTraceMachine(respond func(msg inbox.InboxMessage) *evm.TxResult) *traceMachine {
+	return &traceMachine{respond: respond, delivered: new([]inbox.InboxMessage)}
+}
+
+func (m *traceMachine) Clone() machine.Machine {
+	return m
+}
+
+func (m *traceMachine) IsBlocked(bool) machine.BlockReason {
+	return nil
+}
+
+func (m *traceMachine) ExecuteAssertion(
+	_ uint64,
+	messages []inbox.InboxMessage,
+	_ time.Duration,
+) (*protocol.ExecutionAssertion, uint64) {
+	logs := make([]value.Value, 0, len(messages))
+	for _, msg := range messages {
+		*m.delivered = append(*m.delivered, msg)
+		logs = append(logs, m.respond(msg).AsValue())
+	}
+	return protocol.NewExecutionAssertionFromValues(common.Hash{}, common.Hash{}, 1, 10, nil, logs), 10
+}
+
+func (m *traceMachine) ExecuteCallServerAssertion(
+	maxSteps uint64,
+	messages []inbox.InboxMessage,
+	_ value.Value,
+	maxWallTime time.Duration,
+) (*protocol.ExecutionAssertion, uint64) {
+	return m.ExecuteAssertion(maxSteps, messages, maxWallTime)
+}
+
+func traceRequestID(inboxSeqNum *big.Int) common.Hash {
+	return hashing.SoliditySHA3(hashing.Uint256(traceChainId), hashing.Uint256(inboxSeqNum))
+}
+
+func traceResult(msg inbox.InboxMessage, code evm.ResultType, returnData []byte, logs []evm.Log) *evm.TxResult {
+	return &evm.TxResult{
+		IncomingRequest: evm.IncomingRequest{
+			Kind:      msg.Kind,
+			Sender:    msg.Sender,
+			MessageID: traceRequestID(msg.InboxSeqNum),
+			Data:      msg.Data,
+			ChainTime: msg.ChainTime,
+		},
+		ResultCode:    code,
+		ReturnData:    returnData,
+		EVMLogs:       logs,
+		GasUsed:       big.NewInt(30000),
+		GasPrice:      big.NewInt(0),
+		CumulativeGas: big.NewInt(30000),
+		TxIndex:       big.NewInt(0),
+		StartLogIndex: big.NewInt(0),
+	}
+}
+
+// traceServer serves a single snapshot and block of results
+type traceServer struct {
+	snap    *snapshot.Snapshot
+	height  uint64
+	results []*evm.TxResult
+}
+
+func (s *traceServer) GetSnapshot(_ context.Context, blockHeight uint64) (*snapshot.Snapshot, error) {
+	if blockHeight != s.height-1 {
+		return nil, nil
+	}
+	return s.snap, nil
+}
+
+func (s *traceServer) LatestSnapshot() *snapshot.Snapshot {
+	return s.snap
+}
+
+func (s *traceServer) PendingSnapshot() *snapshot.Snapshot {
+	return s.snap
+}
+
+func (s *traceServer) GetRequestResult(requestId common.Hash) (value.Value, error) {
+	for _, res := range s.results {
+		if res.IncomingRequest.MessageID == requestId {
+			return res.AsValue(), nil
+		}
+	}
+	return nil, errors.New("request not found")
+}
+
+func (s *traceServer) GetBlockResults(height uint64) ([]*evm.TxResult, error) {
+	if height != s.height {
+		return nil, nil
+	}
+	return s.results, nil
+}
+
+func (s *traceServer) BlockInfo(uint64) (*machine.BlockInfo, error) {
+	return nil, nil
+}
+
+func (s *traceServer) AdjustGas(msg message.ContractTransaction) message.ContractTransaction {
+	return msg
+}
+
+func revertData(t *testing.T, reason string) []byte {
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := abi.Arguments{{Type: stringType}}.Pack(reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(hexutil.MustDecode("0x08c379a0"), encoded...)
+}
+
+func traceCall(t *testing.T, mach *traceMachine, to common.Address) *TraceResult {
+	t.Helper()
+	snap := snapshot.NewSnapshot(mach, inbox.NewRandomChainTime(), traceChainId, big.NewInt(0))
+	debug := &Debug{srv: &traceServer{snap: snap}}
+	ethTo := to.ToEthAddress()
+	gas := hexutil.Uint64(100000)
+	latest := ethrpc.LatestBlockNumber
+	args := &CallArgs{CallArgs: &CallTxArgs{To: &ethTo, Gas: &gas}, BlockNum: &latest}
+	var reply *TraceResult
+	if err := debug.TraceCall(httptest.NewRequest("POST", "/", nil), args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestTraceCallRevertReason(t *testing.T) {
+	data := revertData(t, "not enough funds")
+	mach := newTraceMachine(func(msg inbox.InboxMessage) *evm.TxResult {
+		return traceResult(msg, evm.RevertCode, data, nil)
+	})
+	to := common.RandAddress()
+	trace := traceCall(t, mach, to)
+	if trace.Error != "execution reverted" {
+		t.Errorf("unexpected error %q", trace.Error)
+	}
+	if trace.RevertReason != "not enough funds" {
+		t.Errorf("unexpected revert reason %q", trace.RevertReason)
+	}
+	if trace.Type != "CALL" || trace.To == nil || *trace.To != to.ToEthAddress() {
+		t.Error("trace doesn't describe the call")
+	}
+	if trace.GasUsed.ToInt().Cmp(big.NewInt(30000)) != 0 || trace.Gas.ToInt().Cmp(big.NewInt(100000)) != 0 {
+		t.Errorf("unexpected gas %v used of %v", trace.GasUsed, trace.Gas)
+	}
+}
+
+func TestTraceCallUndecodableRevert(t *testing.T) {
+	mach := newTraceMachine(func(msg inbox.InboxMessage) *evm.TxResult {
+		return traceResult(msg, evm.RevertCode, []byte{1, 2, 3}, nil)
+	})
+	trace := traceCall(t, mach, common.RandAddress())
+	if trace.Error != "execution reverted" || trace.RevertReason != "" {
+		t.Errorf("unexpected error %q with reason %q", trace.Error, trace.RevertReason)
+	}
+}
+
+func TestTraceCallLogs(t *testing.T) {
+	to := common.RandAddress()
+	token := common.RandAddress()
+	oracle := common.RandAddress()
+	logs := []evm.Log{
+		{Address: to, Topics: []common.Hash{common.RandHash()}},
+		{Address: token, Topics: []common.Hash{common.RandHash()}},
+		{Address: oracle, Topics: []common.Hash{common.RandHash()}},
+		{Address: to, Topics: []common.Hash{common.RandHash()}},
+	}
+	mach := newTraceMachine(func(msg inbox.InboxMessage) *evm.TxResult {
+		return traceResult(msg, evm.ReturnCode, nil, logs)
+	})
+	trace := traceCall(t, mach, to)
+	if trace.Error != "" {
+		t.Fatal("unexpected error", trace.Error)
+	}
+	// Nested calls aren't reported so every log belongs to the outer frame
+	// in the order it was emitted
+	if len(trace.Logs) != len(logs) {
+		t.Fatalf("trace has %v logs instead of %v", len(trace.Logs), len(logs))
+	}
+	for i, l := range trace.Logs {
+		if l.Address != logs[i].Address.ToEthAddress() {
+			t.Errorf("log %v was emitted by %v instead of %v", i, l.Address.Hex(), logs[i].Address)
+		}
+	}
+}
+
+func TestTraceTransaction(t *testing.T) {
+	const height = 20
+	reason := "slippage"
+	mach := newTraceMachine(func(msg inbox.InboxMessage) *evm.TxResult {
+		return traceResult(msg, evm.RevertCode, revertData(t, reason), nil)
+	})
+
+	// The block's messages were delivered with sequence numbers 12, 13 and
+	// 15 while the snapshot's next sequence number is 11
+	chainTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(height),
+		Timestamp: big.NewInt(1000),
+	}
+	results := make([]*evm.TxResult, 0)
+	for i, seqNum := range []int64{12, 13, 15} {
+		msg := message.NewInboxMessage(
+			message.NewSafeL2Message(message.NewRandomContractTransaction()),
+			common.RandAddress(),
+			big.NewInt(seqNum),
+			chainTime,
+		)
+		res := traceResult(msg, evm.ReturnCode, nil, nil)
+		res.TxIndex = big.NewInt(int64(i))
+		results = append(results, res)
+	}
+	snapTime := inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(height - 1),
+		Timestamp: big.NewInt(900),
+	}
+	snap := snapshot.NewSnapshot(mach, snapTime, traceChainId, big.NewInt(10))
+	debug := &Debug{srv: &traceServer{snap: snap, height: height, results: results}}
+
+	target := results[2].IncomingRequest
+	args := &TraceTransactionArgs{TxHash: target.MessageID.Bytes()}
+	var reply *TraceResult
+	if err := debug.TraceTransaction(httptest.NewRequest("POST", "/", nil), args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.RevertReason != reason {
+		t.Errorf("unexpected revert reason %q", reply.RevertReason)
+	}
+	if reply.From != target.Sender.ToEthAddress() {
+		t.Error("trace isn't from the transaction's sender")
+	}
+
+	delivered := *mach.delivered
+	if len(delivered) != len(results) {
+		t.Fatalf("expected %v messages to be executed but got %v", len(results), len(delivered))
+	}
+	for i, msg := range delivered {
+		if traceRequestID(msg.InboxSeqNum) != results[i].IncomingRequest.MessageID {
+			t.Errorf("message %v was executed with sequence number %v", i, msg.InboxSeqNum)
+		}
+		if msg.ChainTime.BlockNum.AsInt().Uint64() != height {
+			t.Errorf("message %v was executed at the wrong time", i)
+		}
+	}
+}
+
+func TestTraceTransactionNotFound(t *testing.T) {
+	snap := snapshot.NewSnapshot(newTraceMachine(nil), inbox.NewRandomChainTime(), traceChainId, big.NewInt(0))
+	debug := &Debug{srv: &traceServer{snap: snap, height: 1}}
+	args := &TraceTransactionArgs{TxHash: common.RandHash().Bytes()}
+	var reply *TraceResult
+	if err := debug.TraceTransaction(httptest.NewRequest("POST", "/", nil), args, &reply); err == nil {
+		t.Error("tracing an unknown transaction should fail")
+	}
+}
@@ -18,17 +18,23 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txindex"
 	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
 )
 
 type Server struct {
-	srv *aggregator.Server
+	srv     *aggregator.Server
+	filters *filterManager
 }
 
 func NewServer(
+	ctx context.Context,
 	srv *aggregator.Server,
 ) *Server {
-	return &Server{srv: srv}
+	return &Server{
+		srv:     srv,
+		filters: newFilterManager(ctx, srv),
+	}
 }
 
 func (s *Server) ChainId(_ *http.Request, _ *EmptyArgs, reply *string) error {
@@ -42,6 +48,31 @@ func (s *Server) BlockNumber(_ *http.Request, _ *BlockNumberArgs, reply *string)
 	return nil
 }
 
+// Syncing returns false once the aggregator has caught up with L1 and
+// otherwise reports its progress
+func (s *Server) Syncing(r *http.Request, _ *EmptyArgs, reply *interface{}) error {
+	*reply = syncingResult(s.srv.HealthStatus(r.Context()))
+	return nil
+}
+
+func syncingResult(status *aggregator.HealthStatus) interface{} {
+	if status.AtHead {
+		return false
+	}
+	res := &SyncingResult{
+		StartingBlock: hexutil.Uint64(status.LatestBlock),
+		CurrentBlock:  hexutil.Uint64(status.LatestBlock),
+		HighestBlock:  hexutil.Uint64(status.LatestBlock),
+	}
+	if status.SyncStart != nil {
+		res.StartingBlock = hexutil.Uint64(*status.SyncStart)
+	}
+	if status.L1Head != nil && *status.L1Head > status.LatestBlock {
+		res.HighestBlock = hexutil.Uint64(*status.L1Head)
+	}
+	return res
+}
+
 func (s *Server) GetBalance(r *http.Request, args *AccountInfoArgs, reply *string) error {
 	snap, err := s.getSnapshot(r.Context(), args.BlockNum)
 	if err != nil {
@@ -104,8 +135,12 @@ func (s *Server) GetStorageAt(r *http.Request, args *GetStorageAtArgs, reply *st
 }
 
 func (s *Server) blockNum(block *rpc.BlockNumber) (uint64, error) {
+	return blockHeight(s.srv, block)
+}
+
+func blockHeight(src logSource, block *rpc.BlockNumber) (uint64, error) {
 	if *block == rpc.LatestBlockNumber {
-		return s.srv.GetBlockCount(), nil
+		return src.GetBlockCount(), nil
 	} else if *block >= 0 {
 		return uint64(*block), nil
 	} else {
@@ -247,6 +282,13 @@ func (s *Server) Call(r *http.Request, args *CallArgs, reply *string) error {
 
 func (s *Server) EstimateGas(r *http.Request, args *CallTxArgs, reply *string) error {
 	blockNum := rpc.PendingBlockNumber
+	if args.GasPrice == nil && args.From != nil {
+		// Estimate using the price the sender will likely pay so that the
+		// sender's ability to pay for gas is taken into account
+		estimateArgs := *args
+		estimateArgs.GasPrice = (*hexutil.Big)(s.srv.SuggestGasPrice())
+		args = &estimateArgs
+	}
 	res, err := s.executeCall(r.Context(), args, &blockNum)
 	if err != nil {
 		return err
@@ -256,7 +298,42 @@ func (s *Server) EstimateGas(r *http.Request, args *CallTxArgs, reply *string) e
 }
 
 func (s *Server) GasPrice(_ *http.Request, _ *EmptyArgs, reply *string) error {
-	*reply = "0x" + big.NewInt(0).Text(16)
+	*reply = hexutil.EncodeBig(s.srv.SuggestGasPrice())
+	return nil
+}
+
+func (s *Server) FeeHistory(_ *http.Request, args *FeeHistoryArgs, reply **FeeHistoryResult) error {
+	newestBlock := args.NewestBlock
+	if newestBlock == rpc.PendingBlockNumber {
+		newestBlock = rpc.LatestBlockNumber
+	}
+	newest, err := s.blockNum(&newestBlock)
+	if err != nil {
+		return err
+	}
+	history, err := s.srv.FeeHistory(uint64(args.BlockCount), newest, args.RewardPercentiles)
+	if err != nil {
+		return err
+	}
+	res := &FeeHistoryResult{
+		OldestBlock:   hexutil.Uint64(history.OldestBlock),
+		BaseFeePerGas: make([]*hexutil.Big, 0, len(history.BaseFees)),
+		GasUsedRatio:  history.GasUsedRatios,
+	}
+	for _, baseFee := range history.BaseFees {
+		res.BaseFeePerGas = append(res.BaseFeePerGas, (*hexutil.Big)(baseFee))
+	}
+	if history.Rewards != nil {
+		res.Reward = make([][]*hexutil.Big, 0, len(history.Rewards))
+		for _, blockRewards := range history.Rewards {
+			rewards := make([]*hexutil.Big, 0, len(blockRewards))
+			for _, reward := range blockRewards {
+				rewards = append(rewards, (*hexutil.Big)(reward))
+			}
+			res.Reward = append(res.Reward, rewards)
+		}
+	}
+	*reply = res
 	return nil
 }
 
@@ -276,15 +353,11 @@ func (s *Server) SendRawTransaction(_ *http.Request, args *SendTransactionArgs,
 func (s *Server) GetTransactionReceipt(r *http.Request, args *GetTransactionReceiptArgs, reply **GetTransactionReceiptResult) error {
 	var requestId arbcommon.Hash
 	copy(requestId[:], *args.Data)
-	val, err := s.srv.GetRequestResult(requestId)
-	if val == nil || err != nil {
+	result, _, err := s.getTxResult(requestId)
+	if result == nil || err != nil {
 		*reply = nil
 		return nil
 	}
-	result, err := evm.NewTxResultFromValue(val)
-	if err != nil {
-		return err
-	}
 
 	blockInfo, err := s.srv.BlockInfo(result.IncomingRequest.ChainTime.BlockNum.AsInt().Uint64())
 	if err != nil {
@@ -320,43 +393,95 @@ func (s *Server) makeTransactionResult(res *evm.TxResult) (*TransactionResult, e
 	if err != nil {
 		return nil, err
 	}
-	vVal, rVal, sVal := tx.RawSignatureValues()
 	txIndex := res.TxIndex.Uint64()
 	blockNum := hexutil.EncodeBig(res.IncomingRequest.ChainTime.BlockNum.AsInt())
 	blockHash := blockInfo.Hash.ToEthHash()
+	result := newTransactionResult(tx, res.IncomingRequest.Sender.ToEthAddress())
+	result.BlockHash = &blockHash
+	result.BlockNumber = &blockNum
+	result.TransactionIndex = &txIndex
+	return result, nil
+}
+
+// makePendingTransactionResult describes a transaction which has been
+// accepted by the aggregator but isn't yet in a block
+func (s *Server) makePendingTransactionResult(tx *types.Transaction) (*TransactionResult, error) {
+	signer := types.NewEIP155Signer(message.ChainAddressToID(arbcommon.NewAddressFromEth(s.srv.GetChainAddress())))
+	sender, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	return newTransactionResult(tx, sender), nil
+}
+
+func newTransactionResult(tx *types.Transaction, sender common.Address) *TransactionResult {
+	vVal, rVal, sVal := tx.RawSignatureValues()
 	var to *string
 	if tx.To() != nil {
 		toStr := tx.To().Hex()
 		to = &toStr
 	}
 	return &TransactionResult{
-		BlockHash:        &blockHash,
-		BlockNumber:      &blockNum,
-		From:             res.IncomingRequest.Sender.ToEthAddress().Hex(),
-		Gas:              hexutil.EncodeUint64(tx.Gas()),
-		GasPrice:         hexutil.EncodeBig(tx.GasPrice()),
-		Hash:             tx.Hash(),
-		Input:            hexutil.Encode(tx.Data()),
-		Nonce:            hexutil.EncodeUint64(tx.Nonce()),
-		To:               to,
-		TransactionIndex: &txIndex,
-		Value:            hexutil.EncodeBig(tx.Value()),
-		V:                hexutil.EncodeBig(vVal),
-		R:                hexutil.EncodeBig(rVal),
-		S:                hexutil.EncodeBig(sVal),
-	}, nil
+		From:     sender.Hex(),
+		Gas:      hexutil.EncodeUint64(tx.Gas()),
+		GasPrice: hexutil.EncodeBig(tx.GasPrice()),
+		Hash:     tx.Hash(),
+		Input:    hexutil.Encode(tx.Data()),
+		Nonce:    hexutil.EncodeUint64(tx.Nonce()),
+		To:       to,
+		Value:    hexutil.EncodeBig(tx.Value()),
+		V:        hexutil.EncodeBig(vVal),
+		R:        hexutil.EncodeBig(rVal),
+		S:        hexutil.EncodeBig(sVal),
+	}
+}
+
+// getTxResult looks up the result of a transaction, falling back to the
+// position recorded in the transaction index if the request isn't found
+func (s *Server) getTxResult(requestId arbcommon.Hash) (*evm.TxResult, *txindex.Entry, error) {
+	val, err := s.srv.GetRequestResult(requestId)
+	if err == nil && val != nil {
+		res, err := evm.NewTxResultFromValue(val)
+		return res, nil, err
+	}
+	entry, err := s.srv.GetTransactionStatus(requestId.ToEthHash())
+	if err != nil || entry == nil || entry.Status != txindex.Included {
+		return nil, entry, err
+	}
+	results, err := s.srv.GetBlockResults(entry.BlockNum)
+	if err != nil {
+		return nil, entry, err
+	}
+	for _, res := range results {
+		if res.TxIndex.Uint64() == entry.TxIndex {
+			return res, entry, nil
+		}
+	}
+	return nil, entry, nil
 }
 
 func (s *Server) GetTransactionByHash(_ *http.Request, args *GetTransactionReceiptArgs, reply **TransactionResult) error {
 	var requestId arbcommon.Hash
 	copy(requestId[:], *args.Data)
-	val, err := s.srv.GetRequestResult(requestId)
+	res, entry, err := s.getTxResult(requestId)
 	if err != nil {
 		return err
 	}
-	res, err := evm.NewTxResultFromValue(val)
-	if err != nil {
-		return err
+	if res == nil {
+		if entry == nil {
+			*reply = nil
+			return nil
+		}
+		txRes, err := s.makePendingTransactionResult(entry.Tx)
+		if err != nil {
+			return err
+		}
+		if entry.Status == txindex.Failed {
+			reason := entry.FailReason
+			txRes.DropReason = &reason
+		}
+		*reply = txRes
+		return nil
 	}
 	txRes, err := s.makeTransactionResult(res)
 	if err != nil {
@@ -367,46 +492,56 @@ func (s *Server) GetTransactionByHash(_ *http.Request, args *GetTransactionRecei
 }
 
 func (s *Server) GetLogs(r *http.Request, args *GetLogsArgs, reply *[]LogResult) error {
+	logs, err := findLogs(r.Context(), s.srv, args)
+	if err != nil {
+		return err
+	}
+	*reply = logs
+	return nil
+}
+
+// logSource is the part of the aggregator which answers log queries
+type logSource interface {
+	GetBlockCount() uint64
+	FindLogs(ctx context.Context, fromHeight, toHeight *uint64, addresses []common.Address, topics [][]common.Hash) ([]evm.FullLog, error)
+}
+
+func findLogs(ctx context.Context, src logSource, args *GetLogsArgs) ([]LogResult, error) {
 	var fromHeight *uint64
 	if args.FromBlock != nil {
-		from, err := s.blockNum(args.FromBlock)
+		from, err := blockHeight(src, args.FromBlock)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fromHeight = &from
 	}
 
 	var toHeight *uint64
 	if args.ToBlock != nil {
-		to, err := s.blockNum(args.ToBlock)
+		to, err := blockHeight(src, args.ToBlock)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		toHeight = &to
 	}
 
-	addresses := make([]common.Address, 0, 1)
-	if args.Address != nil {
-		addresses = args.Address.addresses
-	}
-
-	topicGroups := make([][]common.Hash, 0, len(args.Topics))
-	for _, topic := range args.Topics {
-		topicGroups = append(topicGroups, topic.topics)
-	}
-
-	logs, err := s.srv.FindLogs(r.Context(), fromHeight, toHeight, addresses, topicGroups)
+	addresses, topicGroups := args.ethLogQuery()
+	logs, err := src.FindLogs(ctx, fromHeight, toHeight, addresses, topicGroups)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	*reply = make([]LogResult, 0, len(logs))
+	return makeLogResults(logs), nil
+}
+
+func makeLogResults(logs []evm.FullLog) []LogResult {
+	results := make([]LogResult, 0, len(logs))
 	for _, evmLog := range logs {
 		logIndex := hexutil.EncodeUint64(evmLog.Index)
 		txIndex := hexutil.EncodeUint64(evmLog.TxIndex)
 		txHash := evmLog.TxHash.ToEthHash()
 		blockHash := evmLog.Block.HeaderHash.ToEthHash()
 		blockNum := hexutil.EncodeBig(evmLog.Block.Height.AsInt())
-		*reply = append(*reply, LogResult{
+		results = append(results, LogResult{
 			Removed:          false,
 			LogIndex:         &logIndex,
 			TransactionIndex: &txIndex,
@@ -418,19 +553,31 @@ func (s *Server) GetLogs(r *http.Request, args *GetLogsArgs, reply *[]LogResult)
 			Topics:           arbcommon.NewEthHashesFromHashes(evmLog.Topics),
 		})
 	}
-	return nil
+	return results
 }
 
 func (s *Server) getSnapshot(ctx context.Context, blockNum *rpc.BlockNumber) (*snapshot.Snapshot, error) {
+	return snapshotAt(ctx, s.srv, blockNum)
+}
+
+// snapshotSource is the part of the aggregator which provides the state at
+// each block
+type snapshotSource interface {
+	GetSnapshot(ctx context.Context, blockHeight uint64) (*snapshot.Snapshot, error)
+	LatestSnapshot() *snapshot.Snapshot
+	PendingSnapshot() *snapshot.Snapshot
+}
+
+func snapshotAt(ctx context.Context, src snapshotSource, blockNum *rpc.BlockNumber) (*snapshot.Snapshot, error) {
 	if blockNum == nil || *blockNum == rpc.PendingBlockNumber {
-		return s.srv.PendingSnapshot(), nil
+		return src.PendingSnapshot(), nil
 	}
 
 	if *blockNum == rpc.LatestBlockNumber {
-		return s.srv.LatestSnapshot(), nil
+		return src.LatestSnapshot(), nil
 	}
 
-	snap, err := s.srv.GetSnapshot(ctx, uint64(*blockNum))
+	snap, err := src.GetSnapshot(ctx, uint64(*blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+)
+
+func TestSyncingResult(t *testing.T) {
+	height := func(h uint64) *uint64 {
+		return &h
+	}
+	tests := []struct {
+		name     string
+		status   aggregator.HealthStatus
+		expected string
+	}{
+		{
+			name:     "at head",
+			status:   aggregator.HealthStatus{L1Head: height(20), LatestBlock: 20, AtHead: true},
+			expected: `false`,
+		},
+		{
+			name:     "catching up",
+			status:   aggregator.HealthStatus{L1Head: height(30), LatestBlock: 20, SyncStart: height(10)},
+			expected: `{"startingBlock":"0xa","currentBlock":"0x14","highestBlock":"0x1e"}`,
+		},
+		{
+			name:     "L1 unreachable",
+			status:   aggregator.HealthStatus{LatestBlock: 20, SyncStart: height(10)},
+			expected: `{"startingBlock":"0xa","currentBlock":"0x14","highestBlock":"0x14"}`,
+		},
+		{
+			name:     "not started",
+			status:   aggregator.HealthStatus{L1Head: height(15), LatestBlock: 20},
+			expected: `{"startingBlock":"0x14","currentBlock":"0x14","highestBlock":"0x14"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(syncingResult(&test.status))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("eth_syncing returned %s but expected %s", data, test.expected)
+			}
+		})
+	}
+}
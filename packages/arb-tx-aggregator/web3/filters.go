@@ -0,0 +1,353 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// Filters which haven't been polled within filterTimeout are uninstalled
+const filterTimeout = 5 * time.Minute
+
+// maxFilterTxHashes is the most transaction hashes a pending transaction
+// filter holds between polls. Older hashes are dropped once it's reached
+const maxFilterTxHashes = 4096
+
+// maxFilters is the most filters which can be installed at once. Since each
+// pending transaction filter may hold maxFilterTxHashes hashes, this bounds
+// the memory used by filters
+const maxFilters = 1024
+
+var errFilterNotFound = errors.New("filter not found")
+
+var errTooManyFilters = errors.New("too many filters installed")
+
+type filterType int
+
+const (
+	logFilter filterType = iota
+	blockFilter
+	pendingTxFilter
+)
+
+type filter struct {
+	typ      filterType
+	lastPoll time.Time
+
+	// nextHeight is the first block which hasn't been returned by a call to
+	// eth_getFilterChanges for log and block filters
+	nextHeight uint64
+
+	// criteria and toHeight are only set for log filters
+	criteria *GetLogsArgs
+	toHeight *uint64
+
+	// txHashes accumulates new transactions for pending transaction filters
+	txHashes []common.Hash
+}
+
+// filterBackend is the part of the aggregator which filters are answered from
+type filterBackend interface {
+	logSource
+	BlockInfo(height uint64) (*machine.BlockInfo, error)
+	MaxLogBlockRange() uint64
+	SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription
+}
+
+type filterManager struct {
+	srv        filterBackend
+	maxFilters int
+
+	sync.Mutex
+	filters map[rpc.ID]*filter
+}
+
+func newFilterManager(ctx context.Context, srv filterBackend) *filterManager {
+	fm := &filterManager{
+		srv:        srv,
+		maxFilters: maxFilters,
+		filters:    make(map[rpc.ID]*filter),
+	}
+
+	go func() {
+		txes := make(chan *types.Transaction, subscriptionBufferSize)
+		sub := srv.SubscribeNewTransactions(txes)
+		defer sub.Unsubscribe()
+
+		ticker := time.NewTicker(filterTimeout / 5)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case tx := <-txes:
+				fm.addPendingTx(tx.Hash())
+			case <-ticker.C:
+				fm.expire(time.Now())
+			}
+		}
+	}()
+
+	return fm
+}
+
+// addPendingTx records a new transaction in every pending transaction filter
+func (fm *filterManager) addPendingTx(txHash common.Hash) {
+	fm.Lock()
+	defer fm.Unlock()
+	for _, f := range fm.filters {
+		if f.typ == pendingTxFilter {
+			if len(f.txHashes) >= maxFilterTxHashes {
+				f.txHashes = f.txHashes[1:]
+			}
+			f.txHashes = append(f.txHashes, txHash)
+		}
+	}
+}
+
+// expire uninstalls filters which haven't been polled within filterTimeout
+// of now
+func (fm *filterManager) expire(now time.Time) {
+	fm.Lock()
+	defer fm.Unlock()
+	for id, f := range fm.filters {
+		if now.Sub(f.lastPoll) > filterTimeout {
+			delete(fm.filters, id)
+		}
+	}
+}
+
+func (fm *filterManager) install(f *filter) (rpc.ID, error) {
+	fm.Lock()
+	defer fm.Unlock()
+	if len(fm.filters) >= fm.maxFilters {
+		return "", errTooManyFilters
+	}
+	f.lastPoll = time.Now()
+	id := rpc.NewID()
+	fm.filters[id] = f
+	return id, nil
+}
+
+func (fm *filterManager) newLogFilter(args *GetLogsArgs) (rpc.ID, error) {
+	f := &filter{
+		typ:        logFilter,
+		nextHeight: fm.srv.GetBlockCount() + 1,
+		criteria:   args,
+	}
+	if args.FromBlock != nil {
+		from, err := blockHeight(fm.srv, args.FromBlock)
+		if err != nil {
+			return "", err
+		}
+		if from > f.nextHeight {
+			f.nextHeight = from
+		}
+	}
+	if args.ToBlock != nil {
+		to, err := blockHeight(fm.srv, args.ToBlock)
+		if err != nil {
+			return "", err
+		}
+		f.toHeight = &to
+	}
+	return fm.install(f)
+}
+
+func (fm *filterManager) newBlockFilter() (rpc.ID, error) {
+	return fm.install(&filter{
+		typ:        blockFilter,
+		nextHeight: fm.srv.GetBlockCount() + 1,
+	})
+}
+
+func (fm *filterManager) newPendingTxFilter() (rpc.ID, error) {
+	return fm.install(&filter{typ: pendingTxFilter})
+}
+
+func (fm *filterManager) uninstall(id rpc.ID) bool {
+	fm.Lock()
+	defer fm.Unlock()
+	_, found := fm.filters[id]
+	delete(fm.filters, id)
+	return found
+}
+
+func (fm *filterManager) getFilter(id rpc.ID) (*filter, error) {
+	fm.Lock()
+	defer fm.Unlock()
+	f, ok := fm.filters[id]
+	if !ok {
+		return nil, errFilterNotFound
+	}
+	f.lastPoll = time.Now()
+	return f, nil
+}
+
+// logs returns every log matching the criteria of the given log filter
+// without affecting the results of eth_getFilterChanges
+func (fm *filterManager) logs(ctx context.Context, id rpc.ID) ([]LogResult, error) {
+	f, err := fm.getFilter(id)
+	if err != nil {
+		return nil, err
+	}
+	if f.typ != logFilter {
+		return nil, errors.New("filter is not a log filter")
+	}
+	return findLogs(ctx, fm.srv, f.criteria)
+}
+
+// changes returns the new results for the given filter since it was last
+// polled. The cursor is only advanced once the results have been found so
+// that a failed query can be retried
+func (fm *filterManager) changes(ctx context.Context, id rpc.ID) (interface{}, error) {
+	fm.Lock()
+	f, ok := fm.filters[id]
+	if !ok {
+		fm.Unlock()
+		return nil, errFilterNotFound
+	}
+	f.lastPoll = time.Now()
+	if f.typ == pendingTxFilter {
+		hashes := f.txHashes
+		f.txHashes = nil
+		fm.Unlock()
+		if hashes == nil {
+			hashes = make([]common.Hash, 0)
+		}
+		return hashes, nil
+	}
+	startHeight := f.nextHeight
+	latest := fm.srv.GetBlockCount()
+	fm.Unlock()
+
+	// Release the lock while querying since lookups may take a while
+	results, nextHeight, err := fm.findChanges(ctx, f, startHeight, latest)
+	if err != nil {
+		return nil, err
+	}
+
+	fm.Lock()
+	defer fm.Unlock()
+	// Another poll may have returned these results already
+	if f.nextHeight == startHeight {
+		f.nextHeight = nextHeight
+	}
+	return results, nil
+}
+
+// findChanges returns the results for the filter from startHeight up to
+// latest along with the height to resume from. Log filters which have
+// fallen further behind than the log query range limit catch up over
+// several polls
+func (fm *filterManager) findChanges(ctx context.Context, f *filter, startHeight, latest uint64) (interface{}, uint64, error) {
+	if f.typ == blockFilter {
+		hashes := make([]common.Hash, 0)
+		for height := startHeight; height <= latest; height++ {
+			info, err := fm.srv.BlockInfo(height)
+			if err != nil {
+				return nil, 0, err
+			}
+			if info == nil {
+				// No arbitrum block at this height
+				continue
+			}
+			hashes = append(hashes, info.Hash.ToEthHash())
+		}
+		return hashes, latest + 1, nil
+	}
+
+	endHeight := latest
+	if f.toHeight != nil && *f.toHeight < endHeight {
+		endHeight = *f.toHeight
+	}
+	if startHeight > endHeight {
+		return make([]LogResult, 0), latest + 1, nil
+	}
+	nextHeight := latest + 1
+	if maxRange := fm.srv.MaxLogBlockRange(); maxRange > 0 && endHeight-startHeight+1 > maxRange {
+		endHeight = startHeight + maxRange - 1
+		nextHeight = endHeight + 1
+	}
+	addresses, topics := f.criteria.ethLogQuery()
+	logs, err := fm.srv.FindLogs(ctx, &startHeight, &endHeight, addresses, topics)
+	if err != nil {
+		return nil, 0, err
+	}
+	return makeLogResults(logs), nextHeight, nil
+}
+
+func (s *Server) NewFilter(_ *http.Request, args *GetLogsArgs, reply *string) error {
+	id, err := s.filters.newLogFilter(args)
+	if err != nil {
+		return err
+	}
+	*reply = string(id)
+	return nil
+}
+
+func (s *Server) NewBlockFilter(_ *http.Request, _ *EmptyArgs, reply *string) error {
+	id, err := s.filters.newBlockFilter()
+	if err != nil {
+		return err
+	}
+	*reply = string(id)
+	return nil
+}
+
+func (s *Server) NewPendingTransactionFilter(_ *http.Request, _ *EmptyArgs, reply *string) error {
+	id, err := s.filters.newPendingTxFilter()
+	if err != nil {
+		return err
+	}
+	*reply = string(id)
+	return nil
+}
+
+func (s *Server) GetFilterChanges(r *http.Request, args *FilterIDArgs, reply *interface{}) error {
+	changes, err := s.filters.changes(r.Context(), args.ID)
+	if err != nil {
+		return err
+	}
+	*reply = changes
+	return nil
+}
+
+func (s *Server) GetFilterLogs(r *http.Request, args *FilterIDArgs, reply *[]LogResult) error {
+	logs, err := s.filters.logs(r.Context(), args.ID)
+	if err != nil {
+		return err
+	}
+	*reply = logs
+	return nil
+}
+
+func (s *Server) UninstallFilter(_ *http.Request, args *FilterIDArgs, reply *bool) error {
+	*reply = s.filters.uninstall(args.ID)
+	return nil
+}
@@ -0,0 +1,392 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// filterTestBackend serves one log from each of the given contracts at every
+// block up to height
+type filterTestBackend struct {
+	height    uint64
+	maxRange  uint64
+	contracts []ethcommon.Address
+	// blocks without an entry have no arbitrum block
+	blocks map[uint64]*machine.BlockInfo
+	err    error
+}
+
+func (b *filterTestBackend) GetBlockCount() uint64 {
+	return b.height
+}
+
+func (b *filterTestBackend) MaxLogBlockRange() uint64 {
+	return b.maxRange
+}
+
+func (b *filterTestBackend) BlockInfo(height uint64) (*machine.BlockInfo, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.blocks[height], nil
+}
+
+func (b *filterTestBackend) FindLogs(
+	_ context.Context,
+	fromHeight, toHeight *uint64,
+	addresses []ethcommon.Address,
+	_ [][]ethcommon.Hash,
+) ([]evm.FullLog, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	from := uint64(0)
+	if fromHeight != nil {
+		from = *fromHeight
+	}
+	to := b.height
+	if toHeight != nil && *toHeight < to {
+		to = *toHeight
+	}
+	logs := make([]evm.FullLog, 0)
+	for height := from; height <= to; height++ {
+		for _, contract := range b.contracts {
+			if len(addresses) > 0 && addresses[0] != contract {
+				continue
+			}
+			logs = append(logs, evm.FullLog{
+				Log: evm.Log{Address: common.NewAddressFromEth(contract)},
+				Block: &common.BlockId{
+					Height:     common.NewTimeBlocksInt(int64(height)),
+					HeaderHash: common.RandHash(),
+				},
+			})
+		}
+	}
+	return logs, nil
+}
+
+func (b *filterTestBackend) SubscribeNewTransactions(chan<- *types.Transaction) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// newTestFilterManager returns a filter manager which doesn't listen for
+// new transactions or expire filters on its own
+func newTestFilterManager(backend *filterTestBackend) *filterManager {
+	return &filterManager{
+		srv:        backend,
+		maxFilters: maxFilters,
+		filters:    make(map[rpc.ID]*filter),
+	}
+}
+
+func blockNumArg(height int64) *rpc.BlockNumber {
+	block := rpc.BlockNumber(height)
+	return &block
+}
+
+func logHeights(t *testing.T, changes interface{}) []uint64 {
+	t.Helper()
+	logs, ok := changes.([]LogResult)
+	if !ok {
+		t.Fatalf("expected logs but got %T", changes)
+	}
+	heights := make([]uint64, 0, len(logs))
+	for _, result := range logs {
+		height, err := hexutil.DecodeUint64(*result.BlockNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heights = append(heights, height)
+	}
+	return heights
+}
+
+func checkHeights(t *testing.T, heights []uint64, expected ...uint64) {
+	t.Helper()
+	if len(heights) != len(expected) {
+		t.Fatalf("got logs from blocks %v instead of %v", heights, expected)
+	}
+	for i := range heights {
+		if heights[i] != expected[i] {
+			t.Fatalf("got logs from blocks %v instead of %v", heights, expected)
+		}
+	}
+}
+
+func pollLogs(t *testing.T, fm *filterManager, id rpc.ID) []uint64 {
+	t.Helper()
+	changes, err := fm.changes(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logHeights(t, changes)
+}
+
+func TestLogFilterChangesAdvance(t *testing.T) {
+	backend := &filterTestBackend{height: 5, contracts: []ethcommon.Address{common.RandAddress().ToEthAddress()}}
+	fm := newTestFilterManager(backend)
+	id, err := fm.newLogFilter(&GetLogsArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logs from before the filter was installed aren't returned
+	checkHeights(t, pollLogs(t, fm, id))
+
+	backend.height = 7
+	checkHeights(t, pollLogs(t, fm, id), 6, 7)
+	checkHeights(t, pollLogs(t, fm, id))
+
+	backend.height = 8
+	checkHeights(t, pollLogs(t, fm, id), 8)
+}
+
+func TestLogFilterChangesRetryAfterFailure(t *testing.T) {
+	backend := &filterTestBackend{height: 5, contracts: []ethcommon.Address{common.RandAddress().ToEthAddress()}}
+	fm := newTestFilterManager(backend)
+	id, err := fm.newLogFilter(&GetLogsArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.height = 7
+	backend.err = errors.New("lookup failed")
+	if _, err := fm.changes(context.Background(), id); err == nil {
+		t.Fatal("failed lookup didn't return an error")
+	}
+
+	// The failed poll didn't advance the cursor so nothing was lost
+	backend.err = nil
+	checkHeights(t, pollLogs(t, fm, id), 6, 7)
+}
+
+func TestLogFilterChangesRangeLimit(t *testing.T) {
+	backend := &filterTestBackend{maxRange: 2, contracts: []ethcommon.Address{common.RandAddress().ToEthAddress()}}
+	fm := newTestFilterManager(backend)
+	id, err := fm.newLogFilter(&GetLogsArgs{FromBlock: blockNumArg(1), ToBlock: blockNumArg(6)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.height = 10
+	checkHeights(t, pollLogs(t, fm, id), 1, 2)
+	checkHeights(t, pollLogs(t, fm, id), 3, 4)
+	checkHeights(t, pollLogs(t, fm, id), 5, 6)
+	checkHeights(t, pollLogs(t, fm, id))
+}
+
+func TestBlockFilterChanges(t *testing.T) {
+	backend := &filterTestBackend{height: 2, blocks: make(map[uint64]*machine.BlockInfo)}
+	fm := newTestFilterManager(backend)
+	id, err := fm.newBlockFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.height = 5
+	backend.blocks[3] = &machine.BlockInfo{Hash: common.RandHash()}
+	backend.blocks[5] = &machine.BlockInfo{Hash: common.RandHash()}
+	changes, err := fm.changes(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := changes.([]ethcommon.Hash)
+	if len(hashes) != 2 || hashes[0] != backend.blocks[3].Hash.ToEthHash() || hashes[1] != backend.blocks[5].Hash.ToEthHash() {
+		t.Errorf("unexpected block hashes %v", hashes)
+	}
+
+	changes, err = fm.changes(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.([]ethcommon.Hash)) != 0 {
+		t.Error("block hashes were returned twice")
+	}
+}
+
+func TestPendingTxFilterChanges(t *testing.T) {
+	fm := newTestFilterManager(&filterTestBackend{})
+	id, err := fm.newPendingTxFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockID, err := fm.newBlockFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var txHashes []ethcommon.Hash
+	for i := 0; i < maxFilterTxHashes+2; i++ {
+		txHash := common.RandHash().ToEthHash()
+		txHashes = append(txHashes, txHash)
+		fm.addPendingTx(txHash)
+	}
+	if fm.filters[blockID].txHashes != nil {
+		t.Error("block filter received pending transactions")
+	}
+
+	changes, err := fm.changes(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := changes.([]ethcommon.Hash)
+	if len(hashes) != maxFilterTxHashes || hashes[0] != txHashes[2] || hashes[len(hashes)-1] != txHashes[len(txHashes)-1] {
+		t.Error("filter didn't keep the latest transactions")
+	}
+
+	changes, err = fm.changes(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes := changes.([]ethcommon.Hash); hashes == nil || len(hashes) != 0 {
+		t.Error("expected an empty list of transactions")
+	}
+}
+
+func TestFilterExpiry(t *testing.T) {
+	fm := newTestFilterManager(&filterTestBackend{})
+	stale, err := fm.newBlockFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	polled, err := fm.newPendingTxFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	fm.filters[stale].lastPoll = now.Add(-filterTimeout - time.Second)
+	fm.filters[polled].lastPoll = now.Add(-filterTimeout + time.Second)
+	fm.expire(now)
+
+	if _, err := fm.changes(context.Background(), stale); err != errFilterNotFound {
+		t.Error("stale filter wasn't uninstalled")
+	}
+	if _, err := fm.changes(context.Background(), polled); err != nil {
+		t.Error("recently polled filter was uninstalled")
+	}
+
+	// Polling resets the timeout
+	fm.expire(now.Add(filterTimeout / 2))
+	if _, err := fm.getFilter(polled); err != nil {
+		t.Error("filter expired after being polled")
+	}
+}
+
+func TestUninstallFilter(t *testing.T) {
+	fm := newTestFilterManager(&filterTestBackend{})
+	id, err := fm.newLogFilter(&GetLogsArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fm.uninstall(id) {
+		t.Error("installed filter wasn't found")
+	}
+	if fm.uninstall(id) {
+		t.Error("filter was uninstalled twice")
+	}
+	if _, err := fm.changes(context.Background(), id); err != errFilterNotFound {
+		t.Error("uninstalled filter was polled")
+	}
+	if _, err := fm.logs(context.Background(), id); err != errFilterNotFound {
+		t.Error("uninstalled filter returned logs")
+	}
+}
+
+func TestFilterLogs(t *testing.T) {
+	contract := common.RandAddress().ToEthAddress()
+	backend := &filterTestBackend{
+		height:    4,
+		contracts: []ethcommon.Address{contract, common.RandAddress().ToEthAddress()},
+	}
+	fm := newTestFilterManager(backend)
+	args := &GetLogsArgs{
+		FromBlock: blockNumArg(2),
+		ToBlock:   blockNumArg(int64(rpc.LatestBlockNumber)),
+		Address:   &AddressGroup{addresses: []ethcommon.Address{contract}},
+	}
+	id, err := fm.newLogFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := fm.logs(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(t, logHeights(t, logs), 2, 3, 4)
+	for _, result := range logs {
+		if result.Address != common.NewAddressFromEth(contract).Hex() {
+			t.Errorf("got log from %v which doesn't match the filter", result.Address)
+		}
+	}
+
+	// eth_getFilterLogs returns every matching log each time
+	backend.height = 5
+	pollLogs(t, fm, id)
+	logs, err = fm.logs(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(t, logHeights(t, logs), 2, 3, 4, 5)
+
+	blockID, err := fm.newBlockFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fm.logs(context.Background(), blockID); err == nil {
+		t.Error("block filter returned logs")
+	}
+}
+
+func TestFilterCap(t *testing.T) {
+	fm := newTestFilterManager(&filterTestBackend{})
+	fm.maxFilters = 2
+	first, err := fm.newBlockFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fm.newPendingTxFilter(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fm.newLogFilter(&GetLogsArgs{}); err != errTooManyFilters {
+		t.Fatal("installed more filters than the limit")
+	}
+
+	fm.uninstall(first)
+	if _, err := fm.newLogFilter(&GetLogsArgs{}); err != nil {
+		t.Error("couldn't install a filter after uninstalling one", err)
+	}
+}
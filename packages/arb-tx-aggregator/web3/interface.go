@@ -9,6 +9,9 @@ import (
 	ethrpc "github.com/ethereum/go-ethereum/rpc"
 	errors2 "github.com/pkg/errors"
 	"math/big"
+	"time"
+
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
 )
 
 type BlockNumberArgs struct{}
@@ -170,6 +173,9 @@ type TransactionResult struct {
 	V                string       `json:"v"`
 	R                string       `json:"r"`
 	S                string       `json:"s"`
+	// DropReason is set for transactions which were dropped by the aggregator
+	// before being included
+	DropReason *string `json:"dropReason,omitempty"`
 }
 
 type AddressGroup struct {
@@ -216,6 +222,91 @@ type GetLogsArgs struct {
 	BlockHash *common.Hash        `json:"blockHash"`
 }
 
+func (n *GetLogsArgs) ethLogQuery() ([]common.Address, [][]common.Hash) {
+	addresses := make([]common.Address, 0, 1)
+	if n.Address != nil {
+		addresses = n.Address.addresses
+	}
+	topics := make([][]common.Hash, 0, len(n.Topics))
+	for _, topic := range n.Topics {
+		topics = append(topics, topic.topics)
+	}
+	return addresses, topics
+}
+
+func (n *GetLogsArgs) logQuery() ([]arbcommon.Address, [][]arbcommon.Hash) {
+	var addresses []arbcommon.Address
+	if n.Address != nil {
+		addresses = arbcommon.AddressArrayFromEth(n.Address.addresses)
+	}
+	topics := make([][]arbcommon.Hash, 0, len(n.Topics))
+	for _, topic := range n.Topics {
+		topics = append(topics, arbcommon.HashArrayFromEth(topic.topics))
+	}
+	return addresses, topics
+}
+
+type FeeHistoryArgs struct {
+	BlockCount        hexutil.Uint64
+	NewestBlock       ethrpc.BlockNumber
+	RewardPercentiles []float64
+}
+
+func (n *FeeHistoryArgs) UnmarshalJSON(buf []byte) error {
+	// The reward percentiles are optional
+	var fields []json.RawMessage
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return errors2.Wrap(err, "error parsing fee history args")
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("wrong number of fields in FeeHistoryArgs: %d", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &n.BlockCount); err != nil {
+		// Accept a plain integer block count as well as a quantity
+		var count uint64
+		if err := json.Unmarshal(fields[0], &count); err != nil {
+			return errors2.Wrap(err, "error parsing fee history block count")
+		}
+		n.BlockCount = hexutil.Uint64(count)
+	}
+	if err := json.Unmarshal(fields[1], &n.NewestBlock); err != nil {
+		return errors2.Wrap(err, "error parsing fee history newest block")
+	}
+	if len(fields) == 3 {
+		if err := json.Unmarshal(fields[2], &n.RewardPercentiles); err != nil {
+			return errors2.Wrap(err, "error parsing fee history reward percentiles")
+		}
+	}
+	return nil
+}
+
+type FeeHistoryResult struct {
+	OldestBlock   hexutil.Uint64   `json:"oldestBlock"`
+	BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio  []float64        `json:"gasUsedRatio"`
+	Reward        [][]*hexutil.Big `json:"reward,omitempty"`
+}
+
+// SyncingResult is the progress reported by eth_syncing while the aggregator
+// is catching up with L1
+type SyncingResult struct {
+	StartingBlock hexutil.Uint64 `json:"startingBlock"`
+	CurrentBlock  hexutil.Uint64 `json:"currentBlock"`
+	HighestBlock  hexutil.Uint64 `json:"highestBlock"`
+}
+
+type FilterIDArgs struct {
+	ID ethrpc.ID
+}
+
+func (n *FilterIDArgs) UnmarshalJSON(buf []byte) error {
+	err := unmarshalJSONArray(buf, []interface{}{&n.ID})
+	if err != nil {
+		return errors2.Wrap(err, "error parsing filter id args")
+	}
+	return nil
+}
+
 type LogResult struct {
 	Removed          bool          `json:"removed"`
 	LogIndex         *string       `json:"logIndex"`
@@ -238,3 +329,72 @@ func unmarshalJSONArray(buf []byte, fields []interface{}) error {
 	}
 	return nil
 }
+
+type TraceTransactionArgs struct {
+	TxHash hexutil.Bytes
+}
+
+func (n *TraceTransactionArgs) UnmarshalJSON(buf []byte) error {
+	// Tracer options may be passed as a second parameter but aren't supported
+	var fields []json.RawMessage
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return errors2.Wrap(err, "error parsing trace transaction args")
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("wrong number of fields in TraceTransactionArgs: %d", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &n.TxHash); err != nil {
+		return errors2.Wrap(err, "error parsing trace transaction args")
+	}
+	return nil
+}
+
+// TraceResult describes the outermost call frame in the execution of a
+// transaction along with AVM level statistics about its execution. ArbOS
+// doesn't report the calls made during execution, so nested frames aren't
+// available and Logs holds every log emitted by the transaction
+type TraceResult struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to"`
+	Value        *hexutil.Big    `json:"value"`
+	Gas          *hexutil.Big    `json:"gas"`
+	GasUsed      *hexutil.Big    `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Logs         []*types.Log    `json:"logs"`
+	AVMSteps     hexutil.Uint64  `json:"avmSteps"`
+	AVMGas       hexutil.Uint64  `json:"avmGas"`
+}
+
+type DropTransactionArgs struct {
+	TxHash common.Hash
+}
+
+func (n *DropTransactionArgs) UnmarshalJSON(buf []byte) error {
+	err := unmarshalJSONArray(buf, []interface{}{&n.TxHash})
+	if err != nil {
+		return errors2.Wrap(err, "error parsing drop transaction args")
+	}
+	return nil
+}
+
+// SetMaxBatchTimeArgs takes a duration string such as "30s"
+type SetMaxBatchTimeArgs struct {
+	MaxBatchTime time.Duration
+}
+
+func (n *SetMaxBatchTimeArgs) UnmarshalJSON(buf []byte) error {
+	var str string
+	if err := unmarshalJSONArray(buf, []interface{}{&str}); err != nil {
+		return errors2.Wrap(err, "error parsing max batch time args")
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return errors2.Wrap(err, "error parsing max batch time args")
+	}
+	n.MaxBatchTime = d
+	return nil
+}
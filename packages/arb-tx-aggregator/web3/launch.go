@@ -17,20 +17,33 @@
 package web3
 
 import (
+	"context"
+	"net/http"
+
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
 	"github.com/gorilla/rpc/v2"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 )
 
-func GenerateWeb3Server(server *aggregator.Server) (*rpc.Server, error) {
+// GenerateWeb3Server creates a server for the web3 api. Batch requests can
+// have at most maxBatchRequests entries, or any number if it's zero
+func GenerateWeb3Server(ctx context.Context, server *aggregator.Server, maxBatchRequests int) (http.Handler, error) {
 	s := rpc.NewServer()
 	// Register our own Codec
 	s.RegisterCodec(NewUpCodec(), "application/json")
 	s.RegisterCodec(NewUpCodec(), "application/json;charset=UTF-8")
 
-	err := s.RegisterService(NewServer(server), "Eth")
+	ethServer := NewServer(ctx, server)
+	err := s.RegisterService(ethServer, "Eth")
+	if err != nil {
+		panic(err)
+	}
+
+	err = s.RegisterService(NewDebug(ethServer), "Debug")
 	if err != nil {
 		panic(err)
 	}
@@ -41,11 +54,39 @@ func GenerateWeb3Server(server *aggregator.Server) (*rpc.Server, error) {
 		panic(err)
 	}
 
+	err = s.RegisterService(NewArb(server), "Arb")
+	if err != nil {
+		panic(err)
+	}
+
 	web3 := &Web3{}
 	err = s.RegisterService(web3, "Web3")
 	if err != nil {
 		panic(err)
 	}
 
+	return NewBatchHandler(s, maxBatchRequests), nil
+}
+
+// GenerateWeb3SubscriptionServer creates a server handling eth_subscribe and
+// eth_unsubscribe requests. It must be served over a websocket connection.
+func GenerateWeb3SubscriptionServer(server *aggregator.Server) (*ethrpc.Server, error) {
+	s := ethrpc.NewServer()
+	if err := s.RegisterName("eth", NewPubSub(server)); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
+
+// GenerateAdminServer creates a server for the admin namespace. Every
+// request must include token as a bearer token or in the X-Admin-Token
+// header
+func GenerateAdminServer(batch *batcher.Batcher, token string) (http.Handler, error) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewUpCodec(), "application/json")
+	s.RegisterCodec(NewUpCodec(), "application/json;charset=UTF-8")
+	if err := s.RegisterService(NewAdmin(batch), "Admin"); err != nil {
+		return nil, err
+	}
+	return AdminAuth(s, token), nil
+}
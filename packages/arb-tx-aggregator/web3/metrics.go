@@ -0,0 +1,55 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
+)
+
+const otherMethod = "other"
+
+// metricMethod returns the name under which metrics for method are recorded.
+// Method names come from untrusted requests so only methods which were
+// dispatched to a registered service get their own metrics
+func metricMethod(method string, dispatched bool) string {
+	if !dispatched {
+		return otherMethod
+	}
+	// The service and method lookup ignores the case of the first letter so
+	// normalize it to keep a single metric per method
+	parts := strings.Split(method, "_")
+	for i, part := range parts {
+		r, n := utf8.DecodeRuneInString(part)
+		parts[i] = string(unicode.ToLower(r)) + part[n:]
+	}
+	return strings.Join(parts, "_")
+}
+
+// recordRequest updates the latency and error count of method for a request
+// which started at start
+func recordRequest(method string, start time.Time, failed bool) {
+	name := "arb/rpc/" + method
+	arbmetrics.NewTimer(name + "/latency").UpdateSince(start)
+	if failed {
+		arbmetrics.NewCounter(name + "/errors").Inc(1)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/rpc/v2"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
+)
+
+func TestRecordRequest(t *testing.T) {
+	arbmetrics.Enable()
+	start := time.Now().Add(-time.Millisecond)
+	recordRequest("eth_metricsTest", start, false)
+	recordRequest("eth_metricsTest", start, true)
+
+	timer := arbmetrics.NewTimer("arb/rpc/eth_metricsTest/latency")
+	if count := timer.Count(); count != 2 {
+		t.Error("latency recorded for", count, "requests")
+	}
+	if timer.Min() < int64(time.Millisecond) {
+		t.Error("latency is shorter than the request", timer.Min())
+	}
+	if errs := arbmetrics.NewCounter("arb/rpc/eth_metricsTest/errors").Count(); errs != 1 {
+		t.Error("recorded", errs, "errors")
+	}
+}
+
+func TestMetricMethod(t *testing.T) {
+	if name := metricMethod("eth_getBalance", false); name != otherMethod {
+		t.Error("method which wasn't dispatched recorded as", name)
+	}
+	for _, method := range []string{"eth_getBalance", "Eth_getBalance", "eth_GetBalance"} {
+		if name := metricMethod(method, true); name != "eth_getBalance" {
+			t.Errorf("method %q recorded as %v", method, name)
+		}
+	}
+}
+
+func TestMetricsOnlyForRegisteredMethods(t *testing.T) {
+	arbmetrics.Enable()
+	s := rpc.NewServer()
+	s.RegisterCodec(NewUpCodec(), "application/json")
+	if err := s.RegisterService(BatchTestService{}, "Metrics"); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"metrics_echo", "Metrics_Echo", "metrics_madeUp", "made_up"} {
+		postBatch(s, `{"jsonrpc":"2.0","method":"`+method+`","params":["a"],"id":1}`)
+	}
+
+	if count := arbmetrics.NewTimer("arb/rpc/metrics_echo/latency").Count(); count != 2 {
+		t.Error("recorded", count, "requests for registered method")
+	}
+	for _, method := range []string{"Metrics_Echo", "metrics_madeUp", "made_up"} {
+		if arbmetrics.Registry.Get("arb/rpc/"+method+"/latency") != nil {
+			t.Errorf("method %v got its own metric", method)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"log"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const subscriptionBufferSize = 128
+
+// pubSubBackend is the part of the aggregator which subscriptions are fed from
+type pubSubBackend interface {
+	GetBlockHeaderByHash(ctx context.Context, hash arbcommon.Hash) (*types.Header, error)
+	SubscribeBlockEvents(ch chan<- *txdb.BlockEvent) event.Subscription
+	SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription
+}
+
+// PubSub implements eth_subscribe over the websocket transport
+type PubSub struct {
+	srv pubSubBackend
+}
+
+func NewPubSub(srv *aggregator.Server) *PubSub {
+	return &PubSub{srv: srv}
+}
+
+// NewHeads sends a notification containing the block header each time a new
+// block is added to the chain
+func (p *PubSub) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+	blocks, sub := p.subscribeBlocks()
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev, ok := <-blocks:
+				if !ok {
+					return
+				}
+				// The request context is cancelled once the subscription is
+				// created so it can't be used for lookups here
+				header, err := p.srv.GetBlockHeaderByHash(context.Background(), ev.Block.HeaderHash)
+				if err != nil {
+					log.Println("Error getting header for new block", err)
+					continue
+				}
+				if err := notifier.Notify(rpcSub.ID, header); err != nil {
+					return
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// Logs sends a notification for each log included in a new block which
+// matches the given filter criteria
+func (p *PubSub) Logs(ctx context.Context, args *GetLogsArgs) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	var addresses []arbcommon.Address
+	var topics [][]arbcommon.Hash
+	if args != nil {
+		addresses, topics = args.logQuery()
+	}
+	rpcSub := notifier.CreateSubscription()
+	blocks, sub := p.subscribeBlocks()
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev, ok := <-blocks:
+				if !ok {
+					return
+				}
+				for _, evmLog := range ev.FindLogs(addresses, topics) {
+					if err := notifier.Notify(rpcSub.ID, evmLog.ToEVMLog()); err != nil {
+						return
+					}
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// NewPendingTransactions sends a notification containing the hash of each
+// transaction accepted by the aggregator
+func (p *PubSub) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+	txes, sub := p.subscribeTransactions()
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case tx, ok := <-txes:
+				if !ok {
+					return
+				}
+				if err := notifier.Notify(rpcSub.ID, tx.Hash()); err != nil {
+					return
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// subscribeBlocks takes each new block off the shared feed as soon as it is
+// sent and queues it for a single subscriber. A subscriber which falls
+// subscriptionBufferSize blocks behind is dropped rather than allowed to
+// block the feed, in which case the returned channel is closed
+func (p *PubSub) subscribeBlocks() (<-chan *txdb.BlockEvent, event.Subscription) {
+	in := make(chan *txdb.BlockEvent, subscriptionBufferSize)
+	sub := p.srv.SubscribeBlockEvents(in)
+	out := make(chan *txdb.BlockEvent, subscriptionBufferSize)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case ev := <-in:
+				select {
+				case out <- ev:
+				default:
+					log.Println("Dropping lagging block subscriber")
+					sub.Unsubscribe()
+					return
+				}
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return out, sub
+}
+
+// subscribeTransactions is the same as subscribeBlocks for transactions
+// accepted by the aggregator
+func (p *PubSub) subscribeTransactions() (<-chan *types.Transaction, event.Subscription) {
+	in := make(chan *types.Transaction, subscriptionBufferSize)
+	sub := p.srv.SubscribeNewTransactions(in)
+	out := make(chan *types.Transaction, subscriptionBufferSize)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case tx := <-in:
+				select {
+				case out <- tx:
+				default:
+					log.Println("Dropping lagging pending transaction subscriber")
+					sub.Unsubscribe()
+					return
+				}
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return out, sub
+}
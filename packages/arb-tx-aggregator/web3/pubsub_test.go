@@ -0,0 +1,279 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const notificationTimeout = 5 * time.Second
+
+// pubSubTestBackend feeds subscriptions from feeds which tests send on
+// directly
+type pubSubTestBackend struct {
+	blocks  event.Feed
+	txes    event.Feed
+	headers map[common.Hash]*types.Header
+}
+
+func newPubSubTestBackend() *pubSubTestBackend {
+	return &pubSubTestBackend{headers: make(map[common.Hash]*types.Header)}
+}
+
+func (b *pubSubTestBackend) GetBlockHeaderByHash(_ context.Context, hash common.Hash) (*types.Header, error) {
+	header, ok := b.headers[hash]
+	if !ok {
+		return nil, errors.New("header not found")
+	}
+	return header, nil
+}
+
+func (b *pubSubTestBackend) SubscribeBlockEvents(ch chan<- *txdb.BlockEvent) event.Subscription {
+	return b.blocks.Subscribe(ch)
+}
+
+func (b *pubSubTestBackend) SubscribeNewTransactions(ch chan<- *types.Transaction) event.Subscription {
+	return b.txes.Subscribe(ch)
+}
+
+// newPubSubClient returns a client connected to a server which only serves
+// subscriptions fed by backend along with a function which shuts both down
+func newPubSubClient(t *testing.T, backend *pubSubTestBackend) (*ethrpc.Client, func()) {
+	t.Helper()
+	server := ethrpc.NewServer()
+	if err := server.RegisterName("eth", &PubSub{srv: backend}); err != nil {
+		t.Fatal(err)
+	}
+	client := ethrpc.DialInProc(server)
+	return client, func() {
+		client.Close()
+		server.Stop()
+	}
+}
+
+// newBlockEvent returns an event for a block at the given height containing
+// a single transaction which emitted logs
+func newBlockEvent(height int64, logs ...evm.Log) *txdb.BlockEvent {
+	ethLogs := make([]*types.Log, 0, len(logs))
+	for _, evmLog := range logs {
+		ethLogs = append(ethLogs, &types.Log{
+			Address: evmLog.Address.ToEthAddress(),
+			Topics:  common.NewEthHashesFromHashes(evmLog.Topics),
+		})
+	}
+	return &txdb.BlockEvent{
+		Block: &common.BlockId{
+			Height:     common.NewTimeBlocksInt(height),
+			HeaderHash: common.RandHash(),
+		},
+		Bloom: types.BytesToBloom(types.LogsBloom(ethLogs).Bytes()),
+		Results: []*evm.TxResult{{
+			IncomingRequest: evm.IncomingRequest{MessageID: common.RandHash()},
+			EVMLogs:         logs,
+		}},
+	}
+}
+
+func (b *pubSubTestBackend) sendBlock(t *testing.T, ev *txdb.BlockEvent) {
+	t.Helper()
+	if b.blocks.Send(ev) == 0 {
+		t.Fatal("block wasn't sent to any subscribers")
+	}
+}
+
+func TestNewHeadsSubscription(t *testing.T) {
+	backend := newPubSubTestBackend()
+	client, closeClient := newPubSubClient(t, backend)
+	defer closeClient()
+	headers := make(chan *types.Header)
+	sub, err := client.EthSubscribe(context.Background(), headers, "newHeads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	missing := newBlockEvent(1)
+	found := newBlockEvent(2)
+	header := &types.Header{Number: big.NewInt(2), Difficulty: big.NewInt(0)}
+	backend.headers[found.Block.HeaderHash] = header
+
+	// Blocks whose header can't be found are skipped
+	backend.sendBlock(t, missing)
+	backend.sendBlock(t, found)
+	select {
+	case received := <-headers:
+		if received.Hash() != header.Hash() {
+			t.Errorf("received header for block %v instead of 2", received.Number)
+		}
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(notificationTimeout):
+		t.Fatal("didn't receive new head")
+	}
+}
+
+func receiveLog(t *testing.T, logs <-chan types.Log, sub *ethrpc.ClientSubscription) types.Log {
+	t.Helper()
+	select {
+	case evmLog := <-logs:
+		return evmLog
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(notificationTimeout):
+		t.Fatal("didn't receive log")
+	}
+	return types.Log{}
+}
+
+func TestLogsSubscription(t *testing.T) {
+	backend := newPubSubTestBackend()
+	client, closeClient := newPubSubClient(t, backend)
+	defer closeClient()
+
+	contract := common.RandAddress()
+	otherContract := common.RandAddress()
+	topic := common.RandHash()
+	otherTopic := common.RandHash()
+
+	filtered := make(chan types.Log)
+	criteria := map[string]interface{}{
+		"address": contract.ToEthAddress(),
+		"topics":  []interface{}{topic.ToEthHash()},
+	}
+	filteredSub, err := client.EthSubscribe(context.Background(), filtered, "logs", criteria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filteredSub.Unsubscribe()
+
+	all := make(chan types.Log, 10)
+	allSub, err := client.EthSubscribe(context.Background(), all, "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer allSub.Unsubscribe()
+
+	// Only the first log of the first block matches the criteria and the
+	// second block can be skipped using its bloom filter
+	backend.sendBlock(t, newBlockEvent(
+		1,
+		evm.Log{Address: contract, Topics: []common.Hash{topic}},
+		evm.Log{Address: otherContract, Topics: []common.Hash{topic}},
+		evm.Log{Address: contract, Topics: []common.Hash{otherTopic}},
+	))
+	backend.sendBlock(t, newBlockEvent(2, evm.Log{Address: otherContract, Topics: []common.Hash{otherTopic}}))
+	backend.sendBlock(t, newBlockEvent(3, evm.Log{Address: contract, Topics: []common.Hash{topic, otherTopic}}))
+
+	for _, expected := range []uint64{1, 3} {
+		evmLog := receiveLog(t, filtered, filteredSub)
+		if evmLog.Address != contract.ToEthAddress() || evmLog.Topics[0] != topic.ToEthHash() {
+			t.Error("received log which doesn't match the criteria")
+		}
+		if evmLog.BlockNumber != expected {
+			t.Errorf("received log from block %v instead of %v", evmLog.BlockNumber, expected)
+		}
+	}
+
+	for i, expected := range []struct {
+		block uint64
+		index uint
+	}{{1, 0}, {1, 1}, {1, 2}, {2, 0}, {3, 0}} {
+		evmLog := receiveLog(t, all, allSub)
+		if evmLog.BlockNumber != expected.block || evmLog.Index != expected.index {
+			t.Errorf("log %v was log %v of block %v instead of log %v of block %v",
+				i, evmLog.Index, evmLog.BlockNumber, expected.index, expected.block)
+		}
+	}
+}
+
+func TestNewPendingTransactionsSubscription(t *testing.T) {
+	backend := newPubSubTestBackend()
+	client, closeClient := newPubSubClient(t, backend)
+	defer closeClient()
+	hashes := make(chan ethcommon.Hash)
+	sub, err := client.EthSubscribe(context.Background(), hashes, "newPendingTransactions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	txes := make([]*types.Transaction, 0, 3)
+	for i := 0; i < 3; i++ {
+		tx := types.NewTransaction(uint64(i), common.RandAddress().ToEthAddress(), big.NewInt(0), 21000, big.NewInt(0), nil)
+		txes = append(txes, tx)
+		if backend.txes.Send(tx) == 0 {
+			t.Fatal("transaction wasn't sent to any subscribers")
+		}
+	}
+	for i, tx := range txes {
+		select {
+		case hash := <-hashes:
+			if hash != tx.Hash() {
+				t.Errorf("notification %v was for the wrong transaction", i)
+			}
+		case err := <-sub.Err():
+			t.Fatal(err)
+		case <-time.After(notificationTimeout):
+			t.Fatal("didn't receive pending transaction")
+		}
+	}
+}
+
+func TestLaggingSubscriberDropped(t *testing.T) {
+	backend := newPubSubTestBackend()
+	p := &PubSub{srv: backend}
+	blocks, sub := p.subscribeBlocks()
+
+	// The subscriber never reads so once its queue fills the next block
+	// drops it instead of blocking the feed
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		backend.sendBlock(t, newBlockEvent(int64(i)))
+	}
+	select {
+	case <-sub.Err():
+	case <-time.After(notificationTimeout):
+		t.Fatal("lagging subscriber wasn't dropped")
+	}
+	if backend.blocks.Send(newBlockEvent(subscriptionBufferSize+1)) != 0 {
+		t.Error("dropped subscriber is still subscribed to the feed")
+	}
+
+	// Blocks queued before it was dropped are still delivered
+	received := 0
+	for ev := range blocks {
+		if ev.Block.Height.AsInt().Int64() != int64(received) {
+			t.Errorf("received block %v out of order", ev.Block.Height)
+		}
+		received++
+	}
+	if received != subscriptionBufferSize {
+		t.Errorf("received %v blocks instead of %v", received, subscriptionBufferSize)
+	}
+}
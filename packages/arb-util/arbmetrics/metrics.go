@@ -0,0 +1,199 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package arbmetrics holds the metrics exported by the aggregator and the
+// validator and serves them in the Prometheus text format
+package arbmetrics
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+)
+
+// Registry contains every metric created through this package
+var Registry = metrics.NewRegistry()
+
+// Enable turns on geth's metrics, which are otherwise no-ops. It must be
+// called before any metric is used
+func Enable() {
+	metrics.Enabled = true
+}
+
+// Metrics are declared at package level, before the command line has been
+// parsed and so before Enable can be called. They're therefore looked up in
+// Registry the first time they're used rather than when they're declared
+
+type Counter struct {
+	name    string
+	once    sync.Once
+	counter metrics.Counter
+}
+
+func NewCounter(name string) *Counter {
+	return &Counter{name: name}
+}
+
+func (c *Counter) get() metrics.Counter {
+	c.once.Do(func() {
+		c.counter = metrics.GetOrRegisterCounter(c.name, Registry)
+	})
+	return c.counter
+}
+
+func (c *Counter) Inc(n int64) {
+	c.get().Inc(n)
+}
+
+func (c *Counter) Count() int64 {
+	return c.get().Count()
+}
+
+type Gauge struct {
+	name  string
+	once  sync.Once
+	gauge metrics.Gauge
+}
+
+func NewGauge(name string) *Gauge {
+	return &Gauge{name: name}
+}
+
+func (g *Gauge) get() metrics.Gauge {
+	g.once.Do(func() {
+		g.gauge = metrics.GetOrRegisterGauge(g.name, Registry)
+	})
+	return g.gauge
+}
+
+func (g *Gauge) Update(v int64) {
+	g.get().Update(v)
+}
+
+func (g *Gauge) Value() int64 {
+	return g.get().Value()
+}
+
+type Timer struct {
+	name  string
+	once  sync.Once
+	timer metrics.Timer
+}
+
+func NewTimer(name string) *Timer {
+	return &Timer{name: name}
+}
+
+func (t *Timer) get() metrics.Timer {
+	t.once.Do(func() {
+		t.timer = metrics.GetOrRegisterTimer(t.name, Registry)
+	})
+	return t.timer
+}
+
+func (t *Timer) Update(d time.Duration) {
+	t.get().Update(d)
+}
+
+func (t *Timer) UpdateSince(start time.Time) {
+	t.get().UpdateSince(start)
+}
+
+func (t *Timer) Count() int64 {
+	return t.get().Count()
+}
+
+func (t *Timer) Min() int64 {
+	return t.get().Min()
+}
+
+// Histogram samples the recent distribution of its values
+type Histogram struct {
+	name      string
+	once      sync.Once
+	histogram metrics.Histogram
+}
+
+func NewHistogram(name string) *Histogram {
+	return &Histogram{name: name}
+}
+
+func (h *Histogram) get() metrics.Histogram {
+	h.once.Do(func() {
+		h.histogram = metrics.GetOrRegisterHistogram(h.name, Registry, metrics.NewExpDecaySample(1028, 0.015))
+	})
+	return h.histogram
+}
+
+func (h *Histogram) Update(v int64) {
+	h.get().Update(v)
+}
+
+func (h *Histogram) Count() int64 {
+	return h.get().Count()
+}
+
+// Handler serves the contents of Registry in the Prometheus text format
+func Handler() http.Handler {
+	return prometheus.Handler(Registry)
+}
+
+// shutdownTimeout is how long in-flight scrapes are given to finish when the
+// metrics server is shut down
+const shutdownTimeout = 5 * time.Second
+
+// ListenAndServe serves the metrics endpoint at /metrics on addr until ctx is
+// cancelled, at which point the server is shut down
+func ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("Error shutting down metrics server on", addr, err)
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-shutdownDone
+	return nil
+}
+
+// Launch enables metrics and runs ListenAndServe in the background, logging
+// if it fails. The returned channel is closed once the server has stopped
+func Launch(ctx context.Context, addr string) <-chan struct{} {
+	Enable()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := ListenAndServe(ctx, addr); err != nil {
+			log.Println("Metrics server stopped:", err)
+		}
+	}()
+	return done
+}
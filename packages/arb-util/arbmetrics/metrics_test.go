@@ -0,0 +1,90 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arbmetrics
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsAreShared(t *testing.T) {
+	Enable()
+	counter := NewCounter("arbmetrics/test/shared")
+	counter.Inc(2)
+	if count := NewCounter("arbmetrics/test/shared").Count(); count != 2 {
+		t.Error("counter with same name has count", count)
+	}
+
+	timer := NewTimer("arbmetrics/test/timer")
+	timer.Update(time.Millisecond)
+	if count := NewTimer("arbmetrics/test/timer").Count(); count != 1 {
+		t.Error("timer with same name has count", count)
+	}
+
+	// Metrics aren't no-ops since they've been enabled
+	gauge := NewGauge("arbmetrics/test/gauge")
+	gauge.Update(7)
+	if value := gauge.Value(); value != 7 {
+		t.Error("gauge has value", value)
+	}
+
+	histogram := NewHistogram("arbmetrics/test/histogram")
+	histogram.Update(3)
+	histogram.Update(5)
+	if count := histogram.Count(); count != 2 {
+		t.Error("histogram has count", count)
+	}
+}
+
+func TestHandlerServesPrometheus(t *testing.T) {
+	Enable()
+	NewCounter("arbmetrics/test/served").Inc(3)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != 200 {
+		t.Fatal("metrics request failed with status", rec.Code)
+	}
+	if !strings.Contains(string(body), "arbmetrics_test_served 3") {
+		t.Error("counter missing from metrics output:", string(body))
+	}
+}
+
+func TestListenAndServeShutsDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ListenAndServe(ctx, "127.0.0.1:0")
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("metrics server didn't shut down cleanly", err)
+		}
+	case <-time.After(shutdownTimeout * 2):
+		t.Fatal("metrics server didn't stop after its context was cancelled")
+	}
+}
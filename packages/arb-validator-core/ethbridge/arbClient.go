@@ -186,13 +186,28 @@ func (c *EthArbClient) TimestampForBlockHash(ctx context.Context, hash common.Ha
 
 type TransactAuth struct {
 	sync.Mutex
-	auth *bind.TransactOpts
+	auth      *bind.TransactOpts
+	txManager *TxManager
+}
+
+// nonce returns the nonce to send the next transaction with or nil to let
+// the node choose
+func (t *TransactAuth) nonce(ctx context.Context) *big.Int {
+	if t.txManager == nil {
+		return t.auth.Nonce
+	}
+	nonce, err := t.txManager.NextNonce(ctx)
+	if err != nil {
+		log.Println("Error getting nonce", err)
+		return t.auth.Nonce
+	}
+	return new(big.Int).SetUint64(nonce)
 }
 
 func (t *TransactAuth) getAuth(ctx context.Context) *bind.TransactOpts {
 	return &bind.TransactOpts{
 		From:     t.auth.From,
-		Nonce:    t.auth.Nonce,
+		Nonce:    t.nonce(ctx),
 		Signer:   t.auth.Signer,
 		Value:    t.auth.Value,
 		GasPrice: t.auth.GasPrice,
@@ -213,6 +228,15 @@ func NewEthAuthClient(client ethutils.EthClient, auth *bind.TransactOpts) *EthAr
 	}
 }
 
+// EnableTxManager sends every later transaction through a TxManager which
+// resends stuck transactions with higher gas prices until ctx is cancelled
+func (c *EthArbAuthClient) EnableTxManager(ctx context.Context, cfg TxManagerConfig) *TxManager {
+	c.auth.Lock()
+	defer c.auth.Unlock()
+	c.auth.txManager = NewTxManager(ctx, c.client, c.auth.auth, cfg)
+	return c.auth.txManager
+}
+
 func (c *EthArbAuthClient) Address() common.Address {
 	return common.NewAddressFromEth(c.auth.auth.From)
 }
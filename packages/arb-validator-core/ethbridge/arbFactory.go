@@ -84,7 +84,7 @@ func (con *arbFactory) CreateRollup(
 	if err != nil {
 		return common.Address{}, nil, errors2.Wrap(err, "Failed to call to ChainFactory.CreateChain")
 	}
-	receipt, err := WaitForReceiptWithResults(ctx, con.client, con.auth.auth.From, tx, "CreateChain")
+	receipt, err := con.auth.waitForReceipt(ctx, con.client, tx, "CreateChain")
 	if err != nil {
 		return common.Address{}, nil, err
 	}
@@ -49,6 +49,7 @@ func (vm *arbRollup) PlaceStake(ctx context.Context, stakeAmount *big.Int, proof
 	defer vm.auth.Unlock()
 	call := &bind.TransactOpts{
 		From:    vm.auth.auth.From,
+		Nonce:   vm.auth.nonce(ctx),
 		Signer:  vm.auth.auth.Signer,
 		Context: ctx,
 	}
@@ -331,7 +332,7 @@ func (vm *arbRollup) StartChallenge(
 }
 
 func (vm *arbRollup) waitForReceipt(ctx context.Context, tx *types.Transaction, methodName string) ([]arbbridge.Event, error) {
-	receipt, err := WaitForReceiptWithResults(ctx, vm.client, vm.auth.auth.From, tx, methodName)
+	receipt, err := vm.auth.waitForReceipt(ctx, vm.client, tx, methodName)
 	if err != nil {
 		return nil, err
 	}
@@ -70,11 +70,24 @@ func getLogChainInfo(log types.Log) arbbridge.ChainInfo {
 	}
 }
 
-func waitForReceipt(ctx context.Context, client ethutils.EthClient, from ethcommon.Address, tx *types.Transaction, methodName string) error {
-	_, err := WaitForReceiptWithResults(ctx, client, from, tx, methodName)
+func waitForReceipt(ctx context.Context, client ethutils.EthClient, auth *TransactAuth, tx *types.Transaction, methodName string) error {
+	_, err := auth.waitForReceipt(ctx, client, tx, methodName)
 	return err
 }
 
+// waitForReceipt waits for tx to be mined. If a TxManager is in use, the
+// transaction is resent with a higher gas price while it's stuck
+func (t *TransactAuth) waitForReceipt(ctx context.Context, client ethutils.EthClient, tx *types.Transaction, methodName string) (*types.Receipt, error) {
+	if t.txManager == nil {
+		return WaitForReceiptWithResults(ctx, client, t.auth.From, tx, methodName)
+	}
+	receipt, err := t.txManager.Track(tx).Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return checkReceipt(ctx, client, t.auth.From, tx, receipt, methodName)
+}
+
 func WaitForReceiptWithResultsSimple(ctx context.Context, client ethutils.EthClient, txHash ethcommon.Hash) (*types.Receipt, error) {
 	for {
 		select {
@@ -102,6 +115,11 @@ func WaitForReceiptWithResults(ctx context.Context, client ethutils.EthClient, f
 	if err != nil {
 		return nil, err
 	}
+	return checkReceipt(ctx, client, from, tx, receipt, methodName)
+}
+
+// checkReceipt returns an error including the revert reason if tx failed
+func checkReceipt(ctx context.Context, client ethutils.EthClient, from ethcommon.Address, tx *types.Transaction, receipt *types.Receipt, methodName string) (*types.Receipt, error) {
 	if receipt.Status != 1 {
 		data, err := receipt.MarshalJSON()
 		if err != nil {
@@ -79,7 +79,7 @@ func (c *challenge) TimeoutChallenge(ctx context.Context) error {
 }
 
 func (c *challenge) waitForReceipt(ctx context.Context, tx *types.Transaction, methodName string) error {
-	return waitForReceipt(ctx, c.client, c.auth.auth.From, tx, methodName)
+	return waitForReceipt(ctx, c.client, c.auth, tx, methodName)
 }
 
 type challengeWatcher struct {
@@ -82,7 +82,7 @@ func (con *challengeFactory) CreateChallenge(
 		return common.Address{}, errors2.Wrap(err, "Failed to call to challengeFactory.CreateChallenge")
 	}
 
-	receipt, err := WaitForReceiptWithResults(ctx, con.client, con.auth.auth.From, tx, "CreateChallenge")
+	receipt, err := con.auth.waitForReceipt(ctx, con.client, tx, "CreateChallenge")
 	if err != nil {
 		return common.Address{}, err
 	}
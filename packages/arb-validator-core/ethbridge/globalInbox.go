@@ -52,7 +52,10 @@ func (con *globalInbox) SendL2Message(ctx context.Context, data []byte) (arbbrid
 		con.rollupAddress,
 		data,
 	)
-	receipt, err := WaitForReceiptWithResults(ctx, con.client, con.auth.auth.From, tx, "SendL2MessageFromOrigin")
+	if err != nil {
+		return arbbridge.MessageDeliveredEvent{}, err
+	}
+	receipt, err := con.auth.waitForReceipt(ctx, con.client, tx, "SendL2MessageFromOrigin")
 	if err != nil {
 		return arbbridge.MessageDeliveredEvent{}, err
 	}
@@ -81,6 +84,9 @@ func (con *globalInbox) SendL2MessageNoWait(ctx context.Context, data []byte) (c
 	if err != nil {
 		return common.Hash{}, err
 	}
+	if con.auth.txManager != nil {
+		con.auth.txManager.Track(tx)
+	}
 	return common.NewHashFromEth(tx.Hash()), nil
 }
 
@@ -156,5 +162,5 @@ func (con *globalInbox) DepositERC721Message(
 }
 
 func (con *globalInbox) waitForReceipt(ctx context.Context, tx *types.Transaction, methodName string) error {
-	return waitForReceipt(ctx, con.client, con.auth.auth.From, tx, methodName)
+	return waitForReceipt(ctx, con.client, con.auth, tx, methodName)
 }
@@ -58,7 +58,7 @@ func (con *IERC20) Approve(ctx context.Context, spender common.Address, amount *
 }
 
 func (con *IERC20) waitForReceipt(ctx context.Context, tx *types.Transaction, methodName string) error {
-	return waitForReceipt(ctx, con.client, con.auth.auth.From, tx, methodName)
+	return waitForReceipt(ctx, con.client, con.auth, tx, methodName)
 }
 
 type IERC20Watcher struct {
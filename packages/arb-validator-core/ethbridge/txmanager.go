@@ -0,0 +1,369 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
+)
+
+var (
+	ErrTxReplaced = errors.New("transaction nonce was used by another transaction")
+)
+
+const (
+	txPollInterval = time.Second
+
+	// finishedTxRetention is how long a transaction which is no longer
+	// pending can still be looked up
+	finishedTxRetention = time.Hour
+)
+
+type TxManagerConfig struct {
+	// ResendInterval is how long to wait for a transaction to be mined
+	// before resending it with a higher gas price
+	ResendInterval time.Duration
+	// GasPriceBump is the percentage by which the gas price is raised each
+	// time a transaction is resent
+	GasPriceBump uint64
+	// MaxGasPrice caps the gas price of resent transactions. A nil value
+	// means there is no cap
+	MaxGasPrice *big.Int
+}
+
+var DefaultTxManagerConfig = TxManagerConfig{
+	ResendInterval: 2 * time.Minute,
+	GasPriceBump:   20,
+	MaxGasPrice:    nil,
+}
+
+type TxState uint8
+
+const (
+	// TxPending transactions haven't been mined yet
+	TxPending TxState = iota
+	// TxDropped transactions are no longer known by the node and are being
+	// rebroadcast
+	TxDropped
+	// TxMined transactions were mined successfully
+	TxMined
+	// TxReverted transactions were mined but reverted
+	TxReverted
+	// TxReplaced transactions had their nonce used by a transaction which
+	// wasn't sent by the manager
+	TxReplaced
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxPending:
+		return "pending"
+	case TxDropped:
+		return "dropped"
+	case TxMined:
+		return "mined"
+	case TxReverted:
+		return "reverted"
+	case TxReplaced:
+		return "replaced"
+	default:
+		return fmt.Sprintf("TxState(%d)", uint8(s))
+	}
+}
+
+// ManagedTx is an L1 transaction along with every version of it that has
+// been broadcast with a higher gas price
+type ManagedTx struct {
+	sync.Mutex
+	txes       []*types.Transaction
+	sentAt     time.Time
+	state      TxState
+	receipt    *types.Receipt
+	finishedAt time.Time
+	done       chan struct{}
+}
+
+func (t *ManagedTx) Nonce() uint64 {
+	t.Lock()
+	defer t.Unlock()
+	return t.txes[0].Nonce()
+}
+
+// Hash returns the hash of the most recently broadcast version of the
+// transaction
+func (t *ManagedTx) Hash() ethcommon.Hash {
+	t.Lock()
+	defer t.Unlock()
+	return t.txes[len(t.txes)-1].Hash()
+}
+
+func (t *ManagedTx) State() TxState {
+	t.Lock()
+	defer t.Unlock()
+	return t.state
+}
+
+// Wait blocks until the transaction is mined or replaced. It returns the
+// receipt of whichever version was mined, even if it reverted
+func (t *ManagedTx) Wait(ctx context.Context) (*types.Receipt, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.done:
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.state == TxReplaced {
+		return nil, ErrTxReplaced
+	}
+	return t.receipt, nil
+}
+
+func (t *ManagedTx) finish(state TxState, receipt *types.Receipt) {
+	t.Lock()
+	defer t.Unlock()
+	t.state = state
+	t.receipt = receipt
+	t.finishedAt = time.Now()
+	close(t.done)
+}
+
+func (t *ManagedTx) setState(state TxState) {
+	t.Lock()
+	defer t.Unlock()
+	t.state = state
+}
+
+// TxManager tracks the nonces of the transactions sent from an account and
+// rebroadcasts transactions which are stuck with escalating gas prices.
+// Transactions are monitored until they finish or the context the manager
+// was created with is cancelled
+type TxManager struct {
+	ctx    context.Context
+	client ethutils.EthClient
+	from   ethcommon.Address
+	signer bind.SignerFn
+	cfg    TxManagerConfig
+
+	sync.Mutex
+	nextNonce *uint64
+	txes      map[ethcommon.Hash]*ManagedTx
+}
+
+func NewTxManager(ctx context.Context, client ethutils.EthClient, auth *bind.TransactOpts, cfg TxManagerConfig) *TxManager {
+	return &TxManager{
+		ctx:    ctx,
+		client: client,
+		from:   auth.From,
+		signer: auth.Signer,
+		cfg:    cfg,
+		txes:   make(map[ethcommon.Hash]*ManagedTx),
+	}
+}
+
+// NextNonce returns the nonce to use for the next transaction. It is ahead
+// of the node's pending nonce if the node has forgotten about transactions
+// that are still being tracked
+func (m *TxManager) NextNonce(ctx context.Context) (uint64, error) {
+	pending, err := m.client.PendingNonceAt(ctx, m.from)
+	if err != nil {
+		return 0, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.nextNonce != nil && *m.nextNonce > pending {
+		return *m.nextNonce, nil
+	}
+	return pending, nil
+}
+
+// Track starts monitoring a transaction which has just been sent until it's
+// mined or replaced. Monitoring isn't tied to the caller's context so that a
+// transaction sent while handling a request is still finished after the
+// request ends
+func (m *TxManager) Track(tx *types.Transaction) *ManagedTx {
+	mtx := &ManagedTx{
+		txes:   []*types.Transaction{tx},
+		sentAt: time.Now(),
+		state:  TxPending,
+		done:   make(chan struct{}),
+	}
+	m.Lock()
+	next := tx.Nonce() + 1
+	if m.nextNonce == nil || *m.nextNonce < next {
+		m.nextNonce = &next
+	}
+	m.pruneFinished()
+	m.txes[tx.Hash()] = mtx
+	m.Unlock()
+
+	go m.monitor(m.ctx, mtx)
+	return mtx
+}
+
+// Lookup returns the tracked transaction which has a version with the given
+// hash or nil if there isn't one
+func (m *TxManager) Lookup(txHash ethcommon.Hash) *ManagedTx {
+	m.Lock()
+	defer m.Unlock()
+	return m.txes[txHash]
+}
+
+// pruneFinished forgets transactions which finished a while ago. It must be
+// called with the lock held
+func (m *TxManager) pruneFinished() {
+	for txHash, mtx := range m.txes {
+		mtx.Lock()
+		finished := !mtx.finishedAt.IsZero() && time.Since(mtx.finishedAt) > finishedTxRetention
+		mtx.Unlock()
+		if finished {
+			delete(m.txes, txHash)
+		}
+	}
+}
+
+func (m *TxManager) monitor(ctx context.Context, mtx *ManagedTx) {
+	ticker := time.NewTicker(txPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.checkTx(ctx, mtx) {
+				return
+			}
+		}
+	}
+}
+
+// checkTx updates the state of mtx and resends it if necessary. It returns
+// true once the transaction is no longer pending
+func (m *TxManager) checkTx(ctx context.Context, mtx *ManagedTx) bool {
+	mtx.Lock()
+	txes := append([]*types.Transaction{}, mtx.txes...)
+	sentAt := mtx.sentAt
+	mtx.Unlock()
+
+	for _, tx := range txes {
+		receipt, err := m.client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil || receipt == nil {
+			continue
+		}
+		if receipt.Status == 1 {
+			mtx.finish(TxMined, receipt)
+		} else {
+			mtx.finish(TxReverted, receipt)
+		}
+		return true
+	}
+
+	latest := txes[len(txes)-1]
+	// Receipts are checked before the nonce so that a version which was just
+	// mined isn't mistaken for a replacement
+	confirmedNonce, err := m.client.NonceAt(ctx, m.from, nil)
+	if err != nil {
+		return false
+	}
+	if confirmedNonce > latest.Nonce() {
+		for _, tx := range txes {
+			if receipt, err := m.client.TransactionReceipt(ctx, tx.Hash()); err == nil && receipt != nil {
+				return false
+			}
+		}
+		log.Println("Transaction with nonce", latest.Nonce(), "was replaced")
+		mtx.finish(TxReplaced, nil)
+		return true
+	}
+
+	if _, _, err := m.client.TransactionByHash(ctx, latest.Hash()); errors.Is(err, ethereum.NotFound) {
+		mtx.setState(TxDropped)
+		if err := m.client.SendTransaction(ctx, latest); err != nil {
+			log.Println("Error rebroadcasting dropped transaction", latest.Hash().Hex(), err)
+			return false
+		}
+		mtx.setState(TxPending)
+	}
+
+	if time.Since(sentAt) >= m.cfg.ResendInterval {
+		m.resend(ctx, mtx, latest)
+	}
+	return false
+}
+
+// resend broadcasts a copy of latest with a higher gas price
+func (m *TxManager) resend(ctx context.Context, mtx *ManagedTx, latest *types.Transaction) {
+	gasPrice := m.bumpedGasPrice(latest.GasPrice())
+	if gasPrice.Cmp(latest.GasPrice()) <= 0 {
+		// Already at the maximum gas price so just keep waiting
+		mtx.Lock()
+		mtx.sentAt = time.Now()
+		mtx.Unlock()
+		return
+	}
+
+	var rawTx *types.Transaction
+	if latest.To() == nil {
+		rawTx = types.NewContractCreation(latest.Nonce(), latest.Value(), latest.Gas(), gasPrice, latest.Data())
+	} else {
+		rawTx = types.NewTransaction(latest.Nonce(), *latest.To(), latest.Value(), latest.Gas(), gasPrice, latest.Data())
+	}
+	// Sign the same way as the contract bindings
+	tx, err := m.signer(types.HomesteadSigner{}, m.from, rawTx)
+	if err != nil {
+		log.Println("Error signing resent transaction", err)
+		return
+	}
+	if err := m.client.SendTransaction(ctx, tx); err != nil {
+		log.Println("Error resending transaction", latest.Hash().Hex(), err)
+		return
+	}
+	log.Println("Resent transaction", latest.Hash().Hex(), "as", tx.Hash().Hex(), "with gas price", gasPrice)
+
+	mtx.Lock()
+	mtx.txes = append(mtx.txes, tx)
+	mtx.sentAt = time.Now()
+	mtx.Unlock()
+
+	m.Lock()
+	m.txes[tx.Hash()] = mtx
+	m.Unlock()
+}
+
+func (m *TxManager) bumpedGasPrice(gasPrice *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(100+m.cfg.GasPriceBump))
+	bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(gasPrice) <= 0 {
+		bumped.Add(gasPrice, big.NewInt(1))
+	}
+	if m.cfg.MaxGasPrice != nil && bumped.Cmp(m.cfg.MaxGasPrice) > 0 {
+		bumped.Set(m.cfg.MaxGasPrice)
+	}
+	return bumped
+}
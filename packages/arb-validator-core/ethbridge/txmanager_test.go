@@ -0,0 +1,252 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethbridge
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethutils"
+)
+
+// txManagerClient is the subset of an L1 node used by the TxManager. Calls to
+// any other method panic
+type txManagerClient struct {
+	ethutils.EthClient
+
+	sync.Mutex
+	confirmedNonce uint64
+	// mempool holds the transactions the node knows about
+	mempool  map[ethcommon.Hash]*types.Transaction
+	receipts map[ethcommon.Hash]*types.Receipt
+	sent     []*types.Transaction
+}
+
+func newTxManagerClient() *txManagerClient {
+	return &txManagerClient{
+		mempool:  make(map[ethcommon.Hash]*types.Transaction),
+		receipts: make(map[ethcommon.Hash]*types.Receipt),
+	}
+}
+
+func (c *txManagerClient) PendingNonceAt(ctx context.Context, account ethcommon.Address) (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.confirmedNonce, nil
+}
+
+func (c *txManagerClient) NonceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.confirmedNonce, nil
+}
+
+func (c *txManagerClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.Lock()
+	defer c.Unlock()
+	c.mempool[tx.Hash()] = tx
+	c.sent = append(c.sent, tx)
+	return nil
+}
+
+func (c *txManagerClient) TransactionByHash(ctx context.Context, txHash ethcommon.Hash) (*types.Transaction, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	tx, ok := c.mempool[txHash]
+	if !ok {
+		return nil, false, ethereum.NotFound
+	}
+	return tx, true, nil
+}
+
+func (c *txManagerClient) TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error) {
+	c.Lock()
+	defer c.Unlock()
+	receipt, ok := c.receipts[txHash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+// mine includes tx in a block with the given status
+func (c *txManagerClient) mine(tx *types.Transaction, status uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.receipts[tx.Hash()] = &types.Receipt{Status: status, TxHash: tx.Hash()}
+	c.confirmedNonce = tx.Nonce() + 1
+}
+
+func (c *txManagerClient) drop(txHash ethcommon.Hash) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.mempool, txHash)
+}
+
+func (c *txManagerClient) sentTxes() []*types.Transaction {
+	c.Lock()
+	defer c.Unlock()
+	return append([]*types.Transaction(nil), c.sent...)
+}
+
+func newTestTxManager(t *testing.T, ctx context.Context, cfg TxManagerConfig) (*TxManager, *txManagerClient, *bind.TransactOpts) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := bind.NewKeyedTransactor(key)
+	client := newTxManagerClient()
+	return NewTxManager(ctx, client, auth, cfg), client, auth
+}
+
+func sendTestTx(t *testing.T, client *txManagerClient, auth *bind.TransactOpts, nonce uint64, gasPrice int64) *types.Transaction {
+	t.Helper()
+	rawTx := types.NewTransaction(nonce, ethcommon.Address{1}, big.NewInt(0), 21000, big.NewInt(gasPrice), nil)
+	tx, err := auth.Signer(types.HomesteadSigner{}, auth.From, rawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestTxManagerEscalatesGasPrice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, client, auth := newTestTxManager(t, ctx, TxManagerConfig{
+		ResendInterval: 0,
+		GasPriceBump:   50,
+		MaxGasPrice:    big.NewInt(200),
+	})
+	original := sendTestTx(t, client, auth, 0, 100)
+	mtx := &ManagedTx{txes: []*types.Transaction{original}, state: TxPending, done: make(chan struct{})}
+
+	expectedPrices := []int64{150, 200, 200}
+	for _, price := range expectedPrices {
+		if m.checkTx(ctx, mtx) {
+			t.Fatal("pending transaction finished")
+		}
+		mtx.Lock()
+		latest := mtx.txes[len(mtx.txes)-1]
+		mtx.Unlock()
+		if latest.GasPrice().Cmp(big.NewInt(price)) != 0 {
+			t.Error("gas price is", latest.GasPrice(), "but expected", price)
+		}
+		if latest.Nonce() != original.Nonce() {
+			t.Error("resent transaction has different nonce")
+		}
+	}
+	// The capped price isn't sent twice
+	if sent := len(client.sentTxes()); sent != 3 {
+		t.Error("expected 3 transactions sent but got", sent)
+	}
+	if m.Lookup(mtx.Hash()) != mtx {
+		t.Error("resent version isn't tracked")
+	}
+
+	// A receipt for an earlier version finishes the transaction
+	client.mine(original, 1)
+	if !m.checkTx(ctx, mtx) {
+		t.Fatal("mined transaction still pending")
+	}
+	receipt, err := mtx.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.TxHash != original.Hash() || mtx.State() != TxMined {
+		t.Error("wrong result for mined transaction", receipt.TxHash.Hex(), mtx.State())
+	}
+}
+
+func TestTxManagerDetectsReplacement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, client, auth := newTestTxManager(t, ctx, TxManagerConfig{ResendInterval: time.Hour, GasPriceBump: 10})
+	tx := sendTestTx(t, client, auth, 0, 100)
+	mtx := &ManagedTx{txes: []*types.Transaction{tx}, sentAt: time.Now(), state: TxPending, done: make(chan struct{})}
+
+	other := sendTestTx(t, client, auth, 0, 500)
+	client.mine(other, 1)
+	if !m.checkTx(ctx, mtx) {
+		t.Fatal("replaced transaction still pending")
+	}
+	if _, err := mtx.Wait(ctx); err != ErrTxReplaced {
+		t.Error("wrong error for replaced transaction", err)
+	}
+	if mtx.State() != TxReplaced {
+		t.Error("wrong state", mtx.State())
+	}
+}
+
+func TestTxManagerRebroadcastsDropped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, client, auth := newTestTxManager(t, ctx, TxManagerConfig{ResendInterval: time.Hour, GasPriceBump: 10})
+	tx := sendTestTx(t, client, auth, 0, 100)
+	mtx := &ManagedTx{txes: []*types.Transaction{tx}, sentAt: time.Now(), state: TxPending, done: make(chan struct{})}
+
+	client.drop(tx.Hash())
+	if m.checkTx(ctx, mtx) {
+		t.Fatal("dropped transaction finished")
+	}
+	sent := client.sentTxes()
+	if len(sent) != 2 || sent[1].Hash() != tx.Hash() {
+		t.Fatal("dropped transaction wasn't rebroadcast")
+	}
+	if mtx.State() != TxPending {
+		t.Error("rebroadcast transaction isn't pending", mtx.State())
+	}
+}
+
+func TestTxManagerOutlivesCallerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, client, auth := newTestTxManager(t, ctx, TxManagerConfig{ResendInterval: time.Hour, GasPriceBump: 10})
+	tx := sendTestTx(t, client, auth, 0, 100)
+	mtx := m.Track(tx)
+
+	nonce, err := m.NextNonce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 1 {
+		t.Error("next nonce doesn't account for tracked transaction", nonce)
+	}
+
+	client.mine(tx, 0)
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*txPollInterval)
+	defer waitCancel()
+	receipt, err := mtx.Wait(waitCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != 0 || mtx.State() != TxReverted {
+		t.Error("reverted transaction has wrong result", mtx.State())
+	}
+}
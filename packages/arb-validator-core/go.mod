@@ -9,6 +9,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.2.2
 )
 
 replace github.com/offchainlabs/arbitrum/packages/arb-util => ../arb-util
@@ -0,0 +1,231 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+var errERC20 = errors.New("ERC-20 tokens aren't supported by membridge")
+
+// ArbClient reads from a Chain
+type ArbClient struct {
+	chain *Chain
+}
+
+func NewArbClient(chain *Chain) *ArbClient {
+	return &ArbClient{chain: chain}
+}
+
+func (c *ArbClient) CurrentBlockId(ctx context.Context) (*common.BlockId, error) {
+	return c.chain.currentBlockId(), nil
+}
+
+func (c *ArbClient) BlockIdForHeight(ctx context.Context, height *common.TimeBlocks) (*common.BlockId, error) {
+	return c.chain.blockIdForHeight(height)
+}
+
+func (c *ArbClient) TimestampForBlockHash(ctx context.Context, hash common.Hash) (*big.Int, error) {
+	return c.chain.timestampForBlockHash(hash)
+}
+
+func (c *ArbClient) SubscribeBlockHeaders(
+	ctx context.Context,
+	startBlockId *common.BlockId,
+) (<-chan arbbridge.MaybeBlockId, error) {
+	timestamp, err := c.chain.timestampForBlockHash(startBlockId.HeaderHash)
+	if err != nil {
+		return nil, err
+	}
+	blockIdChan := make(chan arbbridge.MaybeBlockId)
+	first := &arbbridge.MaybeBlockId{BlockId: startBlockId, Timestamp: timestamp}
+	if err := c.chain.subscribeBlockHeadersAfter(ctx, startBlockId, first, blockIdChan); err != nil {
+		return nil, err
+	}
+	return blockIdChan, nil
+}
+
+func (c *ArbClient) SubscribeBlockHeadersAfter(
+	ctx context.Context,
+	prevBlockId *common.BlockId,
+) (<-chan arbbridge.MaybeBlockId, error) {
+	blockIdChan := make(chan arbbridge.MaybeBlockId)
+	if err := c.chain.subscribeBlockHeadersAfter(ctx, prevBlockId, nil, blockIdChan); err != nil {
+		return nil, err
+	}
+	return blockIdChan, nil
+}
+
+func (c *ArbClient) NewArbFactoryWatcher(address common.Address) (arbbridge.ArbFactoryWatcher, error) {
+	if address != c.chain.factoryAddress {
+		return nil, fmt.Errorf("no ArbFactory at %v", address)
+	}
+	return &arbFactoryWatcher{chain: c.chain}, nil
+}
+
+func (c *ArbClient) NewRollupWatcher(address common.Address) (arbbridge.ArbRollupWatcher, error) {
+	return &arbRollupWatcher{chain: c.chain, rollupAddress: address}, nil
+}
+
+func (c *ArbClient) NewGlobalInboxWatcher(
+	address common.Address,
+	rollupAddress common.Address,
+) (arbbridge.GlobalInboxWatcher, error) {
+	if address != c.chain.inboxAddress {
+		return nil, fmt.Errorf("no GlobalInbox at %v", address)
+	}
+	return &globalInboxWatcher{chain: c.chain, address: address, rollupAddress: rollupAddress}, nil
+}
+
+func (c *ArbClient) NewExecutionChallengeWatcher(address common.Address) (arbbridge.ExecutionChallengeWatcher, error) {
+	return &challengeWatcher{chain: c.chain, address: address}, nil
+}
+
+func (c *ArbClient) NewInboxTopChallengeWatcher(address common.Address) (arbbridge.InboxTopChallengeWatcher, error) {
+	return &challengeWatcher{chain: c.chain, address: address}, nil
+}
+
+func (c *ArbClient) NewIERC20Watcher(address common.Address) (arbbridge.IERC20Watcher, error) {
+	return nil, errERC20
+}
+
+func (c *ArbClient) GetBalance(ctx context.Context, account common.Address) (*big.Int, error) {
+	return c.chain.latestState().balance(account), nil
+}
+
+// ArbAuthClient sends transactions to a Chain from a single address
+type ArbAuthClient struct {
+	*ArbClient
+	address common.Address
+}
+
+func NewArbAuthClient(chain *Chain, address common.Address) *ArbAuthClient {
+	return &ArbAuthClient{ArbClient: NewArbClient(chain), address: address}
+}
+
+func (c *ArbAuthClient) Address() common.Address {
+	return c.address
+}
+
+func (c *ArbAuthClient) NewArbFactory(address common.Address) (arbbridge.ArbFactory, error) {
+	watcher, err := c.NewArbFactoryWatcher(address)
+	if err != nil {
+		return nil, err
+	}
+	return &arbFactory{arbFactoryWatcher: watcher.(*arbFactoryWatcher), from: c.address}, nil
+}
+
+func (c *ArbAuthClient) NewRollup(address common.Address) (arbbridge.ArbRollup, error) {
+	return &arbRollup{
+		arbRollupWatcher: &arbRollupWatcher{chain: c.chain, rollupAddress: address},
+		from:             c.address,
+	}, nil
+}
+
+func (c *ArbAuthClient) NewGlobalInbox(address common.Address, rollupAddress common.Address) (arbbridge.GlobalInbox, error) {
+	watcher, err := c.NewGlobalInboxWatcher(address, rollupAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &globalInbox{globalInboxWatcher: watcher.(*globalInboxWatcher), from: c.address}, nil
+}
+
+// NewChallengeFactory isn't supported since challenges can only be created by
+// a rollup starting them
+func (c *ArbAuthClient) NewChallengeFactory(address common.Address) (arbbridge.ChallengeFactory, error) {
+	return nil, errors.New("challenges can only be created through a rollup")
+}
+
+func (c *ArbAuthClient) newChallenge(address common.Address) *challenge {
+	return &challenge{
+		challengeWatcher: &challengeWatcher{chain: c.chain, address: address},
+		from:             c.address,
+	}
+}
+
+func (c *ArbAuthClient) NewExecutionChallenge(address common.Address) (arbbridge.ExecutionChallenge, error) {
+	return &executionChallenge{challenge: c.newChallenge(address)}, nil
+}
+
+func (c *ArbAuthClient) NewInboxTopChallenge(address common.Address) (arbbridge.InboxTopChallenge, error) {
+	return &inboxTopChallenge{challenge: c.newChallenge(address)}, nil
+}
+
+func (c *ArbAuthClient) NewIERC20(address common.Address) (arbbridge.IERC20, error) {
+	return nil, errERC20
+}
+
+type arbFactoryWatcher struct {
+	chain *Chain
+}
+
+func (f *arbFactoryWatcher) GlobalInboxAddress() (common.Address, error) {
+	return f.chain.inboxAddress, nil
+}
+
+func (f *arbFactoryWatcher) ChallengeFactoryAddress() (common.Address, error) {
+	return f.chain.challengeFactoryAddress, nil
+}
+
+type arbFactory struct {
+	*arbFactoryWatcher
+	from common.Address
+}
+
+func (f *arbFactory) CreateRollup(
+	ctx context.Context,
+	vmState common.Hash,
+	params valprotocol.ChainParams,
+	owner common.Address,
+) (common.Address, *common.BlockId, error) {
+	if params.StakeToken != (common.Address{}) {
+		return common.Address{}, nil, errERC20
+	}
+	var rollupAddress common.Address
+	t, err := f.chain.transact(f.from, func(st *state, t *tx) error {
+		rollupAddress = st.newContractAddress()
+		st.rollups[rollupAddress] = newRollupState(t, rollupAddress, vmState, params, owner)
+
+		data := make([]byte, 0, 6*32)
+		data = append(data, hashing.Uint256(params.GracePeriod.Val)...)
+		data = append(data, hashing.Uint256(new(big.Int).SetUint64(params.ArbGasSpeedLimitPerTick))...)
+		data = append(data, hashing.Uint256(new(big.Int).SetUint64(params.MaxExecutionSteps))...)
+		data = append(data, hashing.Uint256(params.StakeRequirement)...)
+		data = append(data, addressToBytes32(params.StakeToken)...)
+		data = append(data, addressToBytes32(owner)...)
+		st.deliverMessage(t, rollupAddress, initializationMsg, rollupAddress, data)
+		return nil
+	})
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return rollupAddress, t.blockId, nil
+}
+
+var (
+	_ arbbridge.ArbAuthClient = &ArbAuthClient{}
+	_ arbbridge.ArbRollup     = &arbRollup{}
+	_ arbbridge.GlobalInbox   = &globalInbox{}
+)
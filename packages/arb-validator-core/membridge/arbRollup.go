@@ -0,0 +1,294 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+var errNoRollup = errors.New("chain does not exist")
+
+type arbRollupWatcher struct {
+	chain         *Chain
+	rollupAddress common.Address
+}
+
+func (vm *arbRollupWatcher) rollup() (*rollupState, error) {
+	rollup, ok := vm.chain.latestState().rollups[vm.rollupAddress]
+	if !ok {
+		return nil, errNoRollup
+	}
+	return rollup, nil
+}
+
+func eventsFromLogs(logs []logEntry) []arbbridge.Event {
+	events := make([]arbbridge.Event, 0, len(logs))
+	for _, l := range logs {
+		events = append(events, l.event)
+	}
+	return events
+}
+
+func (vm *arbRollupWatcher) GetEvents(
+	ctx context.Context,
+	blockId *common.BlockId,
+	timestamp *big.Int,
+) ([]arbbridge.Event, error) {
+	logs, err := vm.chain.logsInBlock(blockId, vm.rollupAddress)
+	if err != nil {
+		return nil, err
+	}
+	return eventsFromLogs(logs), nil
+}
+
+func (vm *arbRollupWatcher) GetAllEvents(
+	ctx context.Context,
+	fromBlock *big.Int,
+	toBlock *big.Int,
+) ([]arbbridge.Event, error) {
+	return eventsFromLogs(vm.chain.logsInRange(fromBlock, toBlock, vm.rollupAddress)), nil
+}
+
+func (vm *arbRollupWatcher) GetParams(ctx context.Context) (valprotocol.ChainParams, error) {
+	rollup, err := vm.rollup()
+	if err != nil {
+		return valprotocol.ChainParams{}, err
+	}
+	return rollup.params, nil
+}
+
+func (vm *arbRollupWatcher) InboxAddress(ctx context.Context) (common.Address, error) {
+	if _, err := vm.rollup(); err != nil {
+		return common.Address{}, err
+	}
+	return vm.chain.inboxAddress, nil
+}
+
+func (vm *arbRollupWatcher) GetCreationInfo(
+	ctx context.Context,
+) (common.Hash, arbbridge.ChainInfo, common.Hash, *big.Int, error) {
+	rollup, err := vm.rollup()
+	if err != nil {
+		return common.Hash{}, arbbridge.ChainInfo{}, common.Hash{}, nil, err
+	}
+	return rollup.creationTxHash, rollup.creationInfo, rollup.vmState, rollup.creationTimestamp, nil
+}
+
+func (vm *arbRollupWatcher) GetVersion(ctx context.Context) (string, error) {
+	if _, err := vm.rollup(); err != nil {
+		return "", err
+	}
+	return rollupVersion, nil
+}
+
+func (vm *arbRollupWatcher) IsStaked(address common.Address) (bool, error) {
+	rollup, err := vm.rollup()
+	if err != nil {
+		return false, err
+	}
+	_, ok := rollup.stakers[address]
+	return ok, nil
+}
+
+func (vm *arbRollupWatcher) VerifyArbChain(ctx context.Context, machHash common.Hash) error {
+	_, _, initialVMHash, _, err := vm.GetCreationInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if machHash != initialVMHash {
+		return fmt.Errorf("ArbChain was initialized with VM with hash %v, but local validator has VM with hash %v", initialVMHash, machHash)
+	}
+	return nil
+}
+
+type arbRollup struct {
+	*arbRollupWatcher
+	from common.Address
+}
+
+// transact applies a call to the rollup and returns the events that the
+// rollup emitted
+func (vm *arbRollup) transact(apply func(rollup *rollupState, st *state, t *tx) error) ([]arbbridge.Event, error) {
+	t, err := vm.chain.transact(vm.from, func(st *state, t *tx) error {
+		rollup, ok := st.rollups[vm.rollupAddress]
+		if !ok {
+			return errNoRollup
+		}
+		return apply(rollup, st, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.events(vm.rollupAddress), nil
+}
+
+func (vm *arbRollup) PlaceStake(
+	ctx context.Context,
+	stakeAmount *big.Int,
+	proof1 []common.Hash,
+	proof2 []common.Hash,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.placeStake(st, t, stakeAmount, proof1, proof2)
+	})
+}
+
+func (vm *arbRollup) RecoverStakeConfirmed(ctx context.Context, proof []common.Hash) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.recoverStakeConfirmed(t, t.sender, proof)
+	})
+}
+
+func (vm *arbRollup) RecoverStakeOld(
+	ctx context.Context,
+	staker common.Address,
+	proof []common.Hash,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.recoverStakeOld(t, staker, proof)
+	})
+}
+
+func (vm *arbRollup) RecoverStakeMooted(
+	ctx context.Context,
+	nodeHash common.Hash,
+	staker common.Address,
+	latestConfirmedProof []common.Hash,
+	stakerProof []common.Hash,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.recoverStakeMooted(t, staker, nodeHash, latestConfirmedProof, stakerProof)
+	})
+}
+
+func (vm *arbRollup) RecoverStakePassedDeadline(
+	ctx context.Context,
+	stakerAddress common.Address,
+	deadlineTicks *big.Int,
+	disputableNodeHashVal common.Hash,
+	childType uint64,
+	vmProtoStateHash common.Hash,
+	proof []common.Hash,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.recoverStakePassedDeadline(
+			t,
+			stakerAddress,
+			deadlineTicks,
+			disputableNodeHashVal,
+			childType,
+			vmProtoStateHash,
+			proof,
+		)
+	})
+}
+
+func (vm *arbRollup) MoveStake(
+	ctx context.Context,
+	proof1 []common.Hash,
+	proof2 []common.Hash,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.moveStake(t, proof1, proof2)
+	})
+}
+
+func (vm *arbRollup) PruneLeaves(ctx context.Context, opps []valprotocol.PruneParams) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.pruneLeaves(t, opps)
+	})
+}
+
+func (vm *arbRollup) MakeAssertion(
+	ctx context.Context,
+	prevPrevLeafHash common.Hash,
+	prevDataHash common.Hash,
+	prevDeadline common.TimeTicks,
+	prevChildType valprotocol.ChildType,
+	beforeState *valprotocol.VMProtoData,
+	assertionParams *valprotocol.AssertionParams,
+	assertion *valprotocol.ExecutionAssertionStub,
+	stakerProof []common.Hash,
+	validBlock *common.BlockId,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.makeAssertion(
+			st,
+			t,
+			prevPrevLeafHash,
+			prevDataHash,
+			prevDeadline,
+			prevChildType,
+			beforeState,
+			assertionParams,
+			assertion,
+			stakerProof,
+			validBlock,
+		)
+	})
+}
+
+func (vm *arbRollup) Confirm(ctx context.Context, opp *valprotocol.ConfirmOpportunity) ([]arbbridge.Event, error) {
+	proof := opp.PrepareProof()
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.confirm(t, proof, opp.StakerAddresses)
+	})
+}
+
+func (vm *arbRollup) StartChallenge(
+	ctx context.Context,
+	asserterAddress common.Address,
+	challengerAddress common.Address,
+	prevNode common.Hash,
+	disputableDeadline *big.Int,
+	asserterPosition valprotocol.ChildType,
+	challengerPosition valprotocol.ChildType,
+	asserterVMProtoHash common.Hash,
+	challengerVMProtoHash common.Hash,
+	asserterProof []common.Hash,
+	challengerProof []common.Hash,
+	asserterNodeHash common.Hash,
+	challengerDataHash common.Hash,
+	challengerPeriodTicks common.TimeTicks,
+) ([]arbbridge.Event, error) {
+	return vm.transact(func(rollup *rollupState, st *state, t *tx) error {
+		return rollup.startChallenge(
+			st,
+			t,
+			asserterAddress,
+			challengerAddress,
+			prevNode,
+			disputableDeadline,
+			asserterPosition,
+			challengerPosition,
+			asserterVMProtoHash,
+			challengerVMProtoHash,
+			asserterProof,
+			challengerProof,
+			asserterNodeHash,
+			challengerDataHash,
+			challengerPeriodTicks,
+		)
+	})
+}
@@ -0,0 +1,677 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package membridge implements arbbridge on top of an in-memory model of the
+// Arbitrum contracts so that protocol tests don't need an Ethereum backend
+package membridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+const (
+	genesisTimestamp = 1600000000
+	blockTime        = 15
+)
+
+var reorgError = errors.New("reorg occured")
+
+// OneStepExecutor stands in for the contract which executes one step proofs.
+// It returns the assertion that the proof demonstrates
+type OneStepExecutor func(
+	assertion *valprotocol.ExecutionAssertionStub,
+	proof []byte,
+	msg *inbox.InboxMessage,
+) (*valprotocol.ExecutionAssertionStub, error)
+
+// TrustingExecutor accepts every proof as demonstrating the submitted
+// assertion
+func TrustingExecutor(
+	assertion *valprotocol.ExecutionAssertionStub,
+	_ []byte,
+	_ *inbox.InboxMessage,
+) (*valprotocol.ExecutionAssertionStub, error) {
+	return assertion, nil
+}
+
+type logEntry struct {
+	address common.Address
+	// chain is the rollup that a message was delivered to
+	chain common.Address
+	event arbbridge.Event
+}
+
+type block struct {
+	id        *common.BlockId
+	parent    common.Hash
+	timestamp *big.Int
+	logs      []logEntry
+	// state is the contract state after the block was applied
+	state *state
+}
+
+// tx is the transaction currently being applied
+type tx struct {
+	chain     *Chain
+	sender    common.Address
+	hash      common.Hash
+	blockId   *common.BlockId
+	timestamp *big.Int
+	// logIndex is the number of logs emitted earlier in the block
+	logIndex int
+	logs     []logEntry
+}
+
+func (t *tx) ticks() common.TimeTicks {
+	return common.TicksFromBlockNum(t.blockId.Height)
+}
+
+// blockHash mirrors the blockhash opcode, which only sees the 256 blocks
+// before the current one
+func (t *tx) blockHash(height *big.Int) common.Hash {
+	current := t.blockId.Height.AsInt()
+	if height.Cmp(current) >= 0 || new(big.Int).Sub(current, height).Cmp(big.NewInt(256)) > 0 {
+		return common.Hash{}
+	}
+	b, err := t.chain.blockAt(height)
+	if err != nil {
+		return common.Hash{}
+	}
+	return b.id.HeaderHash
+}
+
+func (t *tx) chainInfo() arbbridge.ChainInfo {
+	return arbbridge.ChainInfo{BlockId: t.blockId, LogIndex: uint(t.logIndex + len(t.logs))}
+}
+
+func (t *tx) emit(address common.Address, event arbbridge.Event) {
+	t.logs = append(t.logs, logEntry{address: address, event: event})
+}
+
+func (t *tx) events(address common.Address) []arbbridge.Event {
+	events := make([]arbbridge.Event, 0)
+	for _, l := range t.logs {
+		if l.address == address {
+			events = append(events, l.event)
+		}
+	}
+	return events
+}
+
+func revert(reason string) error {
+	return fmt.Errorf("execution reverted: %v", reason)
+}
+
+type txResult struct {
+	t   *tx
+	err error
+}
+
+type pendingTx struct {
+	sender common.Address
+	apply  func(st *state, t *tx) error
+	done   chan txResult
+}
+
+// Chain is a simulated L1 chain which runs the Arbitrum contracts in memory.
+// By default transactions are applied as soon as they're sent, each in a new
+// block. With automining disabled they wait until the next block is mined
+type Chain struct {
+	mu       sync.Mutex
+	blocks   []*block
+	fork     uint64
+	newBlock chan struct{}
+	executor OneStepExecutor
+	automine bool
+	pending  []*pendingTx
+	// subscriptions holds the height of the last header delivered by each
+	// open header subscription
+	subscriptions map[*headerSubscription]bool
+	// activity is closed and replaced whenever a transaction is sent or a
+	// header is delivered
+	activity chan struct{}
+
+	factoryAddress          common.Address
+	challengeFactoryAddress common.Address
+	inboxAddress            common.Address
+}
+
+func NewChain() *Chain {
+	st := newState()
+	c := &Chain{
+		newBlock:                make(chan struct{}),
+		activity:                make(chan struct{}),
+		subscriptions:           make(map[*headerSubscription]bool),
+		executor:                TrustingExecutor,
+		automine:                true,
+		factoryAddress:          st.newContractAddress(),
+		challengeFactoryAddress: st.newContractAddress(),
+		inboxAddress:            st.newContractAddress(),
+	}
+	height := big.NewInt(0)
+	c.blocks = []*block{{
+		id: &common.BlockId{
+			Height:     common.NewTimeBlocks(height),
+			HeaderHash: c.blockHash(common.Hash{}, height),
+		},
+		timestamp: big.NewInt(genesisTimestamp),
+		state:     st,
+	}}
+	return c
+}
+
+// SetOneStepExecutor replaces the executor used to check execution one step
+// proofs, which defaults to TrustingExecutor
+func (c *Chain) SetOneStepExecutor(executor OneStepExecutor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.executor = executor
+}
+
+// SetAutomine controls whether every transaction is mined in its own block
+// as soon as it's sent. When disabled, transactions block until AdvanceBlocks
+// mines them, which lets the caller decide when L1 time moves forward
+func (c *Chain) SetAutomine(automine bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.automine = automine
+	if automine && len(c.pending) > 0 {
+		c.mineBlock()
+	}
+}
+
+// PendingTransactions returns the number of transactions waiting to be mined
+func (c *Chain) PendingTransactions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// WaitSettled blocks until every header subscriber has received the head and
+// nothing has been sent to or delivered by the chain for quiet. With
+// automining disabled this lets a caller mine the next block only once the
+// chain's users have stopped reacting to the previous one
+func (c *Chain) WaitSettled(ctx context.Context, quiet time.Duration) error {
+	for {
+		c.mu.Lock()
+		delivered := true
+		head := c.head().id.Height.AsInt()
+		for sub := range c.subscriptions {
+			if sub.height.Cmp(head) < 0 {
+				delivered = false
+			}
+		}
+		activity := c.activity
+		c.mu.Unlock()
+
+		if !delivered {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-activity:
+			}
+			continue
+		}
+		timer := time.NewTimer(quiet)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-activity:
+			timer.Stop()
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// touch records that the chain was used. It must be called with the lock held
+func (c *Chain) touch() {
+	close(c.activity)
+	c.activity = make(chan struct{})
+}
+
+// headerSubscription tracks how far a header subscription has got
+type headerSubscription struct {
+	height *big.Int
+}
+
+// delivered records that sub handed the header at height to its subscriber
+func (c *Chain) delivered(sub *headerSubscription, height *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub.height = height
+	c.touch()
+}
+
+func (c *Chain) ArbFactoryAddress() common.Address {
+	return c.factoryAddress
+}
+
+func (c *Chain) GlobalInboxAddress() common.Address {
+	return c.inboxAddress
+}
+
+// Fund mines a block which credits account with amount. Pending
+// transactions aren't included in it
+func (c *Chain) Fund(account common.Address, amount *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.newBlockBuilder()
+	_, _ = b.apply(account, func(st *state, t *tx) error {
+		st.balances[account] = new(big.Int).Add(st.balance(account), amount)
+		return nil
+	})
+	b.mine()
+}
+
+// AdvanceBlocks mines count blocks. The first block includes any pending
+// transactions
+func (c *Chain) AdvanceBlocks(count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < count; i++ {
+		c.mineBlock()
+	}
+}
+
+// Reorg drops the latest depth blocks along with their transactions. Blocks
+// mined afterwards get new hashes, so subscribers see the reorg once the
+// replacement chain passes their last block
+func (c *Chain) Reorg(depth int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if depth < 1 || depth >= len(c.blocks) {
+		return fmt.Errorf("can't reorg %v blocks with %v blocks after genesis", depth, len(c.blocks)-1)
+	}
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+	c.fork++
+	c.notify()
+	return nil
+}
+
+func (c *Chain) head() *block {
+	return c.blocks[len(c.blocks)-1]
+}
+
+func (c *Chain) blockHash(parent common.Hash, height *big.Int) common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Bytes32(parent),
+		hashing.Uint256(height),
+		hashing.Uint64(c.fork),
+	)
+}
+
+func (c *Chain) nextBlockId() *common.BlockId {
+	head := c.head()
+	height := new(big.Int).Add(head.id.Height.AsInt(), big.NewInt(1))
+	return &common.BlockId{
+		Height:     common.NewTimeBlocks(height),
+		HeaderHash: c.blockHash(head.id.HeaderHash, height),
+	}
+}
+
+func (c *Chain) nextTimestamp() *big.Int {
+	return new(big.Int).Add(c.head().timestamp, big.NewInt(blockTime))
+}
+
+// blockBuilder applies transactions on top of the head until the block is
+// mined
+type blockBuilder struct {
+	chain     *Chain
+	id        *common.BlockId
+	timestamp *big.Int
+	txCount   uint64
+	logs      []logEntry
+	state     *state
+}
+
+func (c *Chain) newBlockBuilder() *blockBuilder {
+	return &blockBuilder{
+		chain:     c,
+		id:        c.nextBlockId(),
+		timestamp: c.nextTimestamp(),
+		state:     c.head().state,
+	}
+}
+
+// apply runs a transaction against a copy of the block's state which is kept
+// only if the transaction succeeds
+func (b *blockBuilder) apply(sender common.Address, apply func(st *state, t *tx) error) (*tx, error) {
+	t := &tx{
+		chain:     b.chain,
+		sender:    sender,
+		hash:      hashing.SoliditySHA3(hashing.Bytes32(b.id.HeaderHash), hashing.Uint64(b.txCount)),
+		blockId:   b.id,
+		timestamp: b.timestamp,
+		logIndex:  len(b.logs),
+	}
+	st := b.state.clone()
+	if err := apply(st, t); err != nil {
+		return nil, err
+	}
+	b.txCount++
+	b.logs = append(b.logs, t.logs...)
+	b.state = st
+	return t, nil
+}
+
+func (b *blockBuilder) mine() {
+	c := b.chain
+	c.blocks = append(c.blocks, &block{
+		id:        b.id,
+		parent:    c.head().id.HeaderHash,
+		timestamp: b.timestamp,
+		logs:      b.logs,
+		state:     b.state,
+	})
+	c.notify()
+}
+
+// mineBlock mines a block containing every pending transaction. Transactions
+// are ordered by sender, and by arrival for each sender, so that the block
+// doesn't depend on how the senders' goroutines were scheduled
+func (c *Chain) mineBlock() {
+	pending := c.pending
+	c.pending = nil
+	sort.SliceStable(pending, func(i, j int) bool {
+		return bytes.Compare(pending[i].sender[:], pending[j].sender[:]) < 0
+	})
+	b := c.newBlockBuilder()
+	results := make([]txResult, 0, len(pending))
+	for _, p := range pending {
+		t, err := b.apply(p.sender, p.apply)
+		results = append(results, txResult{t: t, err: err})
+	}
+	b.mine()
+	for i, p := range pending {
+		p.done <- results[i]
+	}
+}
+
+func (c *Chain) notify() {
+	close(c.newBlock)
+	c.newBlock = make(chan struct{})
+}
+
+// transact applies a transaction on top of the latest state. With automining
+// a successful transaction is mined in a new block and a failed one is
+// dropped without mining a block. Otherwise it waits to be mined
+func (c *Chain) transact(sender common.Address, apply func(st *state, t *tx) error) (*tx, error) {
+	c.mu.Lock()
+	if !c.automine {
+		p := &pendingTx{sender: sender, apply: apply, done: make(chan txResult, 1)}
+		c.pending = append(c.pending, p)
+		c.touch()
+		c.mu.Unlock()
+		res := <-p.done
+		return res.t, res.err
+	}
+	defer c.mu.Unlock()
+	b := c.newBlockBuilder()
+	t, err := b.apply(sender, apply)
+	if err != nil {
+		return nil, err
+	}
+	b.mine()
+	return t, nil
+}
+
+func (c *Chain) latestState() *state {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.head().state
+}
+
+func (c *Chain) blockAt(height *big.Int) (*block, error) {
+	if !height.IsInt64() || height.Sign() < 0 || height.Int64() >= int64(len(c.blocks)) {
+		return nil, fmt.Errorf("block %v not found", height)
+	}
+	return c.blocks[height.Int64()], nil
+}
+
+func (c *Chain) canonicalBlock(blockId *common.BlockId) (*block, error) {
+	b, err := c.blockAt(blockId.Height.AsInt())
+	if err != nil {
+		return nil, err
+	}
+	if b.id.HeaderHash != blockId.HeaderHash {
+		return nil, fmt.Errorf("block %v isn't part of the chain", blockId)
+	}
+	return b, nil
+}
+
+// logsInBlock returns the logs emitted by address in the given block
+func (c *Chain) logsInBlock(blockId *common.BlockId, address common.Address) ([]logEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.canonicalBlock(blockId)
+	if err != nil {
+		return nil, err
+	}
+	return filterLogs(b.logs, address), nil
+}
+
+// logsInRange returns the logs emitted by address between the given heights
+// inclusive, with the latest block used if toBlock is nil
+func (c *Chain) logsInRange(fromBlock, toBlock *big.Int, address common.Address) []logEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	logs := make([]logEntry, 0)
+	for _, b := range c.blocks {
+		height := b.id.Height.AsInt()
+		if fromBlock != nil && height.Cmp(fromBlock) < 0 {
+			continue
+		}
+		if toBlock != nil && height.Cmp(toBlock) > 0 {
+			break
+		}
+		logs = append(logs, filterLogs(b.logs, address)...)
+	}
+	return logs
+}
+
+func filterLogs(logs []logEntry, address common.Address) []logEntry {
+	filtered := make([]logEntry, 0)
+	for _, l := range logs {
+		if l.address == address {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
+
+func (c *Chain) currentBlockId() *common.BlockId {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.head().id
+}
+
+func (c *Chain) blockIdForHeight(height *common.TimeBlocks) (*common.BlockId, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.blockAt(height.AsInt())
+	if err != nil {
+		return nil, err
+	}
+	return b.id, nil
+}
+
+func (c *Chain) timestampForBlockHash(hash common.Hash) (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range c.blocks {
+		if b.id.HeaderHash == hash {
+			return b.timestamp, nil
+		}
+	}
+	return nil, fmt.Errorf("block %v not found", hash)
+}
+
+// subscribeBlockHeadersAfter sends each header after prevBlockId on
+// blockIdChan, starting with first if it's set. blockIdChan should be
+// unbuffered so that WaitSettled knows when its subscriber has received a
+// header
+func (c *Chain) subscribeBlockHeadersAfter(
+	ctx context.Context,
+	prevBlockId *common.BlockId,
+	first *arbbridge.MaybeBlockId,
+	blockIdChan chan<- arbbridge.MaybeBlockId,
+) error {
+	prevBlockIdCheck, err := c.blockIdForHeight(prevBlockId.Height)
+	if err != nil {
+		return err
+	}
+	if !prevBlockId.Equals(prevBlockIdCheck) {
+		return fmt.Errorf("can't subscribe to headers, block hash %v doesn't match expected value %v", prevBlockIdCheck, prevBlockId)
+	}
+
+	sub := &headerSubscription{height: prevBlockId.Height.AsInt()}
+	if first != nil {
+		sub.height = new(big.Int).Sub(sub.height, big.NewInt(1))
+	}
+	c.mu.Lock()
+	c.subscriptions[sub] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer close(blockIdChan)
+		defer func() {
+			c.mu.Lock()
+			delete(c.subscriptions, sub)
+			c.mu.Unlock()
+		}()
+		if first != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case blockIdChan <- *first:
+			}
+			c.delivered(sub, prevBlockId.Height.AsInt())
+		}
+		for {
+			c.mu.Lock()
+			next, err := c.blockAt(new(big.Int).Add(prevBlockId.Height.AsInt(), big.NewInt(1)))
+			newBlock := c.newBlock
+			c.mu.Unlock()
+
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-newBlock:
+				}
+				continue
+			}
+
+			maybeBlockId := arbbridge.MaybeBlockId{BlockId: next.id, Timestamp: next.timestamp}
+			if next.parent != prevBlockId.HeaderHash {
+				maybeBlockId = arbbridge.MaybeBlockId{Err: reorgError}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case blockIdChan <- maybeBlockId:
+			}
+			if maybeBlockId.Err != nil {
+				return
+			}
+			c.delivered(sub, next.id.Height.AsInt())
+			prevBlockId = next.id
+		}
+	}()
+	return nil
+}
+
+// state is the storage of every contract on the chain
+type state struct {
+	contractCount uint64
+	balances      map[common.Address]*big.Int
+	rollups       map[common.Address]*rollupState
+	inboxes       map[common.Address]*inboxState
+	challenges    map[common.Address]*challengeState
+}
+
+func newState() *state {
+	return &state{
+		balances:   make(map[common.Address]*big.Int),
+		rollups:    make(map[common.Address]*rollupState),
+		inboxes:    make(map[common.Address]*inboxState),
+		challenges: make(map[common.Address]*challengeState),
+	}
+}
+
+func (st *state) clone() *state {
+	ret := &state{
+		contractCount: st.contractCount,
+		balances:      make(map[common.Address]*big.Int, len(st.balances)),
+		rollups:       make(map[common.Address]*rollupState, len(st.rollups)),
+		inboxes:       make(map[common.Address]*inboxState, len(st.inboxes)),
+		challenges:    make(map[common.Address]*challengeState, len(st.challenges)),
+	}
+	for addr, balance := range st.balances {
+		ret.balances[addr] = balance
+	}
+	for addr, rollup := range st.rollups {
+		ret.rollups[addr] = rollup.clone()
+	}
+	for addr, in := range st.inboxes {
+		ret.inboxes[addr] = in.clone()
+	}
+	for addr, chal := range st.challenges {
+		ret.challenges[addr] = chal.clone()
+	}
+	return ret
+}
+
+func (st *state) newContractAddress() common.Address {
+	addr := ethcrypto.CreateAddress(ethcommon.Address{}, st.contractCount)
+	st.contractCount++
+	return common.NewAddressFromEth(addr)
+}
+
+func (st *state) balance(account common.Address) *big.Int {
+	balance, ok := st.balances[account]
+	if !ok {
+		return big.NewInt(0)
+	}
+	return balance
+}
+
+func (st *state) transfer(from, to common.Address, amount *big.Int) error {
+	if st.balance(from).Cmp(amount) < 0 {
+		return errors.New("insufficient funds for transfer")
+	}
+	st.balances[from] = new(big.Int).Sub(st.balance(from), amount)
+	st.balances[to] = new(big.Int).Add(st.balance(to), amount)
+	return nil
+}
@@ -0,0 +1,498 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+var errNoChallenge = errors.New("no contract code at given address")
+
+// challengeState models the storage of a bisection challenge contract
+type challengeState struct {
+	rollup         common.Address
+	challengeType  valprotocol.ChildType
+	asserter       common.Address
+	challenger     common.Address
+	periodTicks    *big.Int
+	deadlineTicks  *big.Int
+	asserterTurn   bool
+	challengeState common.Hash
+}
+
+func (c *challengeState) clone() *challengeState {
+	ret := *c
+	return &ret
+}
+
+func (c *challengeState) updateDeadline(t *tx) {
+	c.deadlineTicks = new(big.Int).Add(t.ticks().Val, c.periodTicks)
+}
+
+func (c *challengeState) deadline() common.TimeTicks {
+	return common.TimeTicks{Val: new(big.Int).Set(c.deadlineTicks)}
+}
+
+func (c *challengeState) asserterAction(t *tx) error {
+	if !c.asserterTurn {
+		return revert("BIS_STATE")
+	}
+	if t.ticks().Val.Cmp(c.deadlineTicks) > 0 {
+		return revert("BIS_DEADLINE")
+	}
+	if t.sender != c.asserter {
+		return revert("BIS_SENDER")
+	}
+	return nil
+}
+
+func (c *challengeState) challengerAction(t *tx) error {
+	if c.asserterTurn {
+		return revert("CON_STATE")
+	}
+	if t.ticks().Val.Cmp(c.deadlineTicks) > 0 {
+		return revert("CON_DEADLINE")
+	}
+	if t.sender != c.challenger {
+		return revert("CON_SENDER")
+	}
+	return nil
+}
+
+func (st *state) createChallenge(
+	t *tx,
+	rollup common.Address,
+	asserter common.Address,
+	challenger common.Address,
+	periodTicks common.TimeTicks,
+	challengeHash common.Hash,
+	challengeType valprotocol.ChildType,
+) (common.Address, error) {
+	if challengeType != valprotocol.InvalidInboxTopChildType &&
+		challengeType != valprotocol.InvalidExecutionChildType {
+		return common.Address{}, revert("INVALID_TYPE")
+	}
+	address := st.newContractAddress()
+	c := &challengeState{
+		rollup:         rollup,
+		challengeType:  challengeType,
+		asserter:       asserter,
+		challenger:     challenger,
+		periodTicks:    periodTicks.Val,
+		asserterTurn:   true,
+		challengeState: challengeHash,
+	}
+	c.updateDeadline(t)
+	st.challenges[address] = c
+	t.emit(address, arbbridge.InitiateChallengeEvent{
+		ChainInfo: t.chainInfo(),
+		Deadline:  c.deadline(),
+	})
+	return address, nil
+}
+
+func (st *state) challenge(address common.Address, challengeType valprotocol.ChildType) (*challengeState, error) {
+	c, ok := st.challenges[address]
+	if !ok || c.challengeType != challengeType {
+		return nil, errNoChallenge
+	}
+	return c, nil
+}
+
+func (st *state) resolveChallenge(t *tx, address common.Address, winner, loser common.Address) error {
+	c := st.challenges[address]
+	rollup, ok := st.rollups[c.rollup]
+	if !ok {
+		return errNoChallenge
+	}
+	if err := rollup.resolveChallenge(t, address, winner, loser); err != nil {
+		return err
+	}
+	delete(st.challenges, address)
+	return nil
+}
+
+func (st *state) timeoutChallenge(t *tx, address common.Address) error {
+	c, ok := st.challenges[address]
+	if !ok {
+		return errNoChallenge
+	}
+	if t.ticks().Val.Cmp(c.deadlineTicks) <= 0 {
+		return revert("Deadline hasn't expired")
+	}
+	if c.asserterTurn {
+		t.emit(address, arbbridge.AsserterTimeoutEvent{ChainInfo: t.chainInfo()})
+		return st.resolveChallenge(t, address, c.challenger, c.asserter)
+	}
+	t.emit(address, arbbridge.ChallengerTimeoutEvent{ChainInfo: t.chainInfo()})
+	return st.resolveChallenge(t, address, c.asserter, c.challenger)
+}
+
+func (st *state) asserterWin(t *tx, address common.Address) error {
+	t.emit(address, arbbridge.OneStepProofEvent{ChainInfo: t.chainInfo()})
+	c := st.challenges[address]
+	return st.resolveChallenge(t, address, c.asserter, c.challenger)
+}
+
+func (st *state) chooseSegment(
+	t *tx,
+	address common.Address,
+	challengeType valprotocol.ChildType,
+	segmentToChallenge uint16,
+	segments []common.Hash,
+) error {
+	c, err := st.challenge(address, challengeType)
+	if err != nil {
+		return err
+	}
+	if err := c.challengerAction(t); err != nil {
+		return err
+	}
+	if int(segmentToChallenge) >= len(segments) {
+		return revert("CON_PROOF")
+	}
+	if merkleRoot(segments) != c.challengeState {
+		return revert("CON_PREV")
+	}
+	c.challengeState = segments[segmentToChallenge]
+	c.asserterTurn = true
+	c.updateDeadline(t)
+	t.emit(address, arbbridge.ContinueChallengeEvent{
+		ChainInfo:    t.chainInfo(),
+		SegmentIndex: big.NewInt(int64(segmentToChallenge)),
+		Deadline:     c.deadline(),
+	})
+	return nil
+}
+
+// commitToSegments records the asserter's bisection and hands the turn to
+// the challenger
+func (c *challengeState) commitToSegments(t *tx, segments []common.Hash) {
+	c.challengeState = merkleRoot(segments)
+	c.asserterTurn = false
+	c.updateDeadline(t)
+}
+
+func (st *state) bisectAssertion(
+	t *tx,
+	address common.Address,
+	assertions []*valprotocol.ExecutionAssertionStub,
+	totalSteps uint64,
+) error {
+	c, err := st.challenge(address, valprotocol.InvalidExecutionChildType)
+	if err != nil {
+		return err
+	}
+	if err := c.asserterAction(t); err != nil {
+		return err
+	}
+	bisectionCount := uint64(len(assertions))
+	if bisectionCount == 0 {
+		return revert("BIS_INPLEN")
+	}
+
+	// The contract receives the hashes at each boundary between assertions,
+	// taken from the end of the assertion before it like ethbridge does
+	machineHashes := []common.Hash{assertions[0].BeforeMachineHash}
+	inboxHashes := []common.Hash{assertions[0].BeforeInboxHash}
+	messageAccs := []common.Hash{assertions[0].FirstMessageHash}
+	logAccs := []common.Hash{assertions[0].FirstLogHash}
+	for _, assertion := range assertions {
+		machineHashes = append(machineHashes, assertion.AfterMachineHash)
+		inboxHashes = append(inboxHashes, assertion.AfterInboxHash)
+		messageAccs = append(messageAccs, assertion.LastMessageHash)
+		logAccs = append(logAccs, assertion.LastLogHash)
+	}
+	assertionHash := func(numSteps, from, to, numGas, messageCount, logCount uint64) common.Hash {
+		return valprotocol.ExecutionDataHash(numSteps, &valprotocol.ExecutionAssertionStub{
+			NumGas:            numGas,
+			BeforeMachineHash: machineHashes[from],
+			AfterMachineHash:  machineHashes[to],
+			BeforeInboxHash:   inboxHashes[from],
+			AfterInboxHash:    inboxHashes[to],
+			FirstMessageHash:  messageAccs[from],
+			LastMessageHash:   messageAccs[to],
+			MessageCount:      messageCount,
+			FirstLogHash:      logAccs[from],
+			LastLogHash:       logAccs[to],
+			LogCount:          logCount,
+		})
+	}
+
+	var totalGas, totalMessageCount, totalLogCount uint64
+	for _, assertion := range assertions {
+		totalGas += assertion.NumGas
+		totalMessageCount += assertion.MessageCount
+		totalLogCount += assertion.LogCount
+	}
+	if assertionHash(totalSteps, 0, bisectionCount, totalGas, totalMessageCount, totalLogCount) != c.challengeState {
+		return revert("BIS_PREV")
+	}
+
+	hashes := make([]common.Hash, 0, bisectionCount)
+	for i, assertion := range assertions {
+		segment := uint64(i)
+		hashes = append(hashes, assertionHash(
+			valprotocol.CalculateBisectionStepCount(segment, bisectionCount, totalSteps),
+			segment,
+			segment+1,
+			assertion.NumGas,
+			assertion.MessageCount,
+			assertion.LogCount,
+		))
+	}
+
+	c.commitToSegments(t, hashes)
+	t.emit(address, arbbridge.ExecutionBisectionEvent{
+		ChainInfo:       t.chainInfo(),
+		AssertionHashes: hashes,
+		Deadline:        c.deadline(),
+	})
+	return nil
+}
+
+func (st *state) executionOneStepProof(
+	t *tx,
+	address common.Address,
+	assertion *valprotocol.ExecutionAssertionStub,
+	proof []byte,
+	msg *inbox.InboxMessage,
+) error {
+	c, err := st.challenge(address, valprotocol.InvalidExecutionChildType)
+	if err != nil {
+		return err
+	}
+	if err := c.asserterAction(t); err != nil {
+		return err
+	}
+	proven, err := t.chain.executor(assertion, proof, msg)
+	if err != nil {
+		return revert(err.Error())
+	}
+	// A single step produces at most one message and one log, so the
+	// contract infers the counts from whether the accumulators changed
+	var messageCount, logCount uint64
+	if proven.FirstMessageHash != proven.LastMessageHash {
+		messageCount = 1
+	}
+	if proven.FirstLogHash != proven.LastLogHash {
+		logCount = 1
+	}
+	stepAssertion := &valprotocol.ExecutionAssertionStub{
+		NumGas:            proven.NumGas,
+		BeforeMachineHash: proven.BeforeMachineHash,
+		AfterMachineHash:  proven.AfterMachineHash,
+		BeforeInboxHash:   proven.BeforeInboxHash,
+		AfterInboxHash:    proven.AfterInboxHash,
+		FirstMessageHash:  proven.FirstMessageHash,
+		LastMessageHash:   proven.LastMessageHash,
+		MessageCount:      messageCount,
+		FirstLogHash:      proven.FirstLogHash,
+		LastLogHash:       proven.LastLogHash,
+		LogCount:          logCount,
+	}
+	if valprotocol.ExecutionDataHash(1, stepAssertion) != c.challengeState {
+		return revert("BIS_PREV")
+	}
+	return st.asserterWin(t, address)
+}
+
+func (st *state) bisectInboxTop(t *tx, address common.Address, chainHashes []common.Hash, chainLength *big.Int) error {
+	c, err := st.challenge(address, valprotocol.InvalidInboxTopChildType)
+	if err != nil {
+		return err
+	}
+	if err := c.asserterAction(t); err != nil {
+		return err
+	}
+	if len(chainHashes) < 2 {
+		return revert("BIS_INPLEN")
+	}
+	bisectionCount := uint64(len(chainHashes) - 1)
+	if valprotocol.InboxTopChallengeDataHash(chainHashes[0], chainHashes[bisectionCount], chainLength) != c.challengeState {
+		return revert("BIS_PREV")
+	}
+	if chainLength.Cmp(big.NewInt(1)) <= 0 {
+		return revert("bisection too short")
+	}
+	c.commitToSegments(t, inboxTopSegments(chainHashes, chainLength.Uint64()))
+	t.emit(address, arbbridge.InboxTopBisectionEvent{
+		ChainInfo:   t.chainInfo(),
+		ChainHashes: chainHashes,
+		TotalLength: chainLength,
+		Deadline:    c.deadline(),
+	})
+	return nil
+}
+
+func inboxTopSegments(chainHashes []common.Hash, chainLength uint64) []common.Hash {
+	bisectionCount := uint64(len(chainHashes) - 1)
+	hashes := make([]common.Hash, 0, bisectionCount)
+	for i := uint64(0); i < bisectionCount; i++ {
+		stepCount := valprotocol.CalculateBisectionStepCount(i, bisectionCount, chainLength)
+		hashes = append(hashes, valprotocol.InboxTopChallengeDataHash(
+			chainHashes[i],
+			chainHashes[i+1],
+			new(big.Int).SetUint64(stepCount),
+		))
+	}
+	return hashes
+}
+
+func (st *state) inboxTopOneStepProof(t *tx, address common.Address, lowerHash common.Hash, value common.Hash) error {
+	c, err := st.challenge(address, valprotocol.InvalidInboxTopChildType)
+	if err != nil {
+		return err
+	}
+	if err := c.asserterAction(t); err != nil {
+		return err
+	}
+	upperHash := hashing.SoliditySHA3(hashing.Bytes32(lowerHash), hashing.Bytes32(value))
+	if valprotocol.InboxTopChallengeDataHash(lowerHash, upperHash, big.NewInt(1)) != c.challengeState {
+		return revert("BIS_PREV")
+	}
+	return st.asserterWin(t, address)
+}
+
+type challengeWatcher struct {
+	chain   *Chain
+	address common.Address
+}
+
+func (c *challengeWatcher) GetEvents(
+	ctx context.Context,
+	blockId *common.BlockId,
+	timestamp *big.Int,
+) ([]arbbridge.Event, error) {
+	logs, err := c.chain.logsInBlock(blockId, c.address)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]arbbridge.Event, 0, len(logs))
+	for _, l := range logs {
+		events = append(events, l.event)
+	}
+	return events, nil
+}
+
+type challenge struct {
+	*challengeWatcher
+	from common.Address
+}
+
+func (c *challenge) transact(apply func(st *state, t *tx) error) error {
+	_, err := c.chain.transact(c.from, apply)
+	return err
+}
+
+func (c *challenge) TimeoutChallenge(ctx context.Context) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.timeoutChallenge(t, c.address)
+	})
+}
+
+type executionChallenge struct {
+	*challenge
+}
+
+func (c *executionChallenge) BisectAssertion(
+	ctx context.Context,
+	assertions []*valprotocol.ExecutionAssertionStub,
+	totalSteps uint64,
+) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.bisectAssertion(t, c.address, assertions, totalSteps)
+	})
+}
+
+func (c *executionChallenge) OneStepProof(
+	ctx context.Context,
+	assertion *valprotocol.ExecutionAssertionStub,
+	proof []byte,
+) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.executionOneStepProof(t, c.address, assertion, proof, nil)
+	})
+}
+
+func (c *executionChallenge) OneStepProofWithMessage(
+	ctx context.Context,
+	assertion *valprotocol.ExecutionAssertionStub,
+	proof []byte,
+	msg inbox.InboxMessage,
+) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.executionOneStepProof(t, c.address, assertion, proof, &msg)
+	})
+}
+
+func (c *executionChallenge) ChooseSegment(
+	ctx context.Context,
+	assertionToChallenge uint16,
+	assertionHashes []common.Hash,
+) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.chooseSegment(t, c.address, valprotocol.InvalidExecutionChildType, assertionToChallenge, assertionHashes)
+	})
+}
+
+type inboxTopChallenge struct {
+	*challenge
+}
+
+func (c *inboxTopChallenge) Bisect(
+	ctx context.Context,
+	chainHashes []common.Hash,
+	chainLength *big.Int,
+) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.bisectInboxTop(t, c.address, chainHashes, chainLength)
+	})
+}
+
+func (c *inboxTopChallenge) OneStepProof(
+	ctx context.Context,
+	lowerHashA common.Hash,
+	value common.Hash,
+) error {
+	return c.transact(func(st *state, t *tx) error {
+		return st.inboxTopOneStepProof(t, c.address, lowerHashA, value)
+	})
+}
+
+func (c *inboxTopChallenge) ChooseSegment(
+	ctx context.Context,
+	assertionToChallenge uint16,
+	chainHashes []common.Hash,
+	chainLength uint64,
+) error {
+	if len(chainHashes) < 2 {
+		return revert("CON_PROOF")
+	}
+	segments := inboxTopSegments(chainHashes, chainLength)
+	return c.transact(func(st *state, t *tx) error {
+		return st.chooseSegment(t, c.address, valprotocol.InvalidInboxTopChildType, assertionToChallenge, segments)
+	})
+}
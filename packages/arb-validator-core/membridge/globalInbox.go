@@ -0,0 +1,231 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+const (
+	ethTransferMsg    inbox.Type = 0
+	l2Msg             inbox.Type = 3
+	initializationMsg inbox.Type = 4
+)
+
+var errTokenDeposit = errors.New("token deposits aren't supported by membridge")
+
+// inboxState is the inbox of a single chain in the global inbox
+type inboxState struct {
+	value common.Hash
+	count *big.Int
+}
+
+func (in *inboxState) clone() *inboxState {
+	ret := *in
+	return &ret
+}
+
+func (in *inboxState) snapshot() (common.Hash, *big.Int) {
+	return in.value, in.count
+}
+
+func (st *state) inbox(chain common.Address) *inboxState {
+	in, ok := st.inboxes[chain]
+	if !ok {
+		return &inboxState{count: big.NewInt(0)}
+	}
+	return in
+}
+
+func (st *state) deliverMessage(
+	t *tx,
+	chain common.Address,
+	kind inbox.Type,
+	sender common.Address,
+	data []byte,
+) arbbridge.MessageDeliveredEvent {
+	in := st.inbox(chain).clone()
+	msg := inbox.InboxMessage{
+		Kind:        kind,
+		Sender:      sender,
+		InboxSeqNum: new(big.Int).Add(in.count, big.NewInt(1)),
+		Data:        data,
+		ChainTime: inbox.ChainTime{
+			BlockNum:  t.blockId.Height,
+			Timestamp: t.timestamp,
+		},
+	}
+	in.value = hashing.SoliditySHA3(hashing.Bytes32(in.value), hashing.Bytes32(msg.CommitmentHash()))
+	in.count = msg.InboxSeqNum
+	st.inboxes[chain] = in
+
+	ev := arbbridge.MessageDeliveredEvent{
+		ChainInfo: t.chainInfo(),
+		Message:   msg,
+	}
+	t.logs = append(t.logs, logEntry{address: t.chain.inboxAddress, chain: chain, event: ev})
+	return ev
+}
+
+func addressToUint256(address common.Address) []byte {
+	ret := make([]byte, 32)
+	copy(ret[12:], address[:])
+	return ret
+}
+
+func addressToBytes32(address common.Address) []byte {
+	ret := make([]byte, 32)
+	copy(ret, address[:])
+	return ret
+}
+
+type globalInboxWatcher struct {
+	chain         *Chain
+	address       common.Address
+	rollupAddress common.Address
+}
+
+func (gi *globalInboxWatcher) messages(logs []logEntry) []arbbridge.MessageDeliveredEvent {
+	events := make([]arbbridge.MessageDeliveredEvent, 0, len(logs))
+	for _, l := range logs {
+		if l.chain == gi.rollupAddress {
+			events = append(events, l.event.(arbbridge.MessageDeliveredEvent))
+		}
+	}
+	return events
+}
+
+func (gi *globalInboxWatcher) GetEvents(
+	ctx context.Context,
+	blockId *common.BlockId,
+	timestamp *big.Int,
+) ([]arbbridge.Event, error) {
+	deliveredEvents, err := gi.GetDeliveredEventsInBlock(ctx, blockId, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]arbbridge.Event, 0, len(deliveredEvents))
+	for _, ev := range deliveredEvents {
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (gi *globalInboxWatcher) GetDeliveredEvents(
+	ctx context.Context,
+	fromBlock *big.Int,
+	toBlock *big.Int,
+) ([]arbbridge.MessageDeliveredEvent, error) {
+	return gi.messages(gi.chain.logsInRange(fromBlock, toBlock, gi.address)), nil
+}
+
+func (gi *globalInboxWatcher) GetDeliveredEventsInBlock(
+	ctx context.Context,
+	blockId *common.BlockId,
+	timestamp *big.Int,
+) ([]arbbridge.MessageDeliveredEvent, error) {
+	logs, err := gi.chain.logsInBlock(blockId, gi.address)
+	if err != nil {
+		return nil, err
+	}
+	return gi.messages(logs), nil
+}
+
+// GetERC20Balance always returns zero since withdrawals aren't delivered
+func (gi *globalInboxWatcher) GetERC20Balance(
+	ctx context.Context,
+	user common.Address,
+	tokenContract common.Address,
+) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
+
+// GetEthBalance always returns zero since withdrawals aren't delivered
+func (gi *globalInboxWatcher) GetEthBalance(
+	ctx context.Context,
+	user common.Address,
+) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
+
+type globalInbox struct {
+	*globalInboxWatcher
+	from common.Address
+}
+
+func (gi *globalInbox) sendL2Message(data []byte) (*tx, arbbridge.MessageDeliveredEvent, error) {
+	var ev arbbridge.MessageDeliveredEvent
+	t, err := gi.chain.transact(gi.from, func(st *state, t *tx) error {
+		ev = st.deliverMessage(t, gi.rollupAddress, l2Msg, t.sender, data)
+		return nil
+	})
+	return t, ev, err
+}
+
+func (gi *globalInbox) SendL2Message(ctx context.Context, data []byte) (arbbridge.MessageDeliveredEvent, error) {
+	_, ev, err := gi.sendL2Message(data)
+	return ev, err
+}
+
+func (gi *globalInbox) SendL2MessageNoWait(ctx context.Context, data []byte) (common.Hash, error) {
+	t, _, err := gi.sendL2Message(data)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return t.hash, nil
+}
+
+func (gi *globalInbox) DepositEthMessage(
+	ctx context.Context,
+	destination common.Address,
+	value *big.Int,
+) error {
+	_, err := gi.chain.transact(gi.from, func(st *state, t *tx) error {
+		if err := st.transfer(t.sender, gi.address, value); err != nil {
+			return err
+		}
+		data := append(addressToUint256(destination), hashing.Uint256(value)...)
+		st.deliverMessage(t, gi.rollupAddress, ethTransferMsg, t.sender, data)
+		return nil
+	})
+	return err
+}
+
+func (gi *globalInbox) DepositERC20Message(
+	ctx context.Context,
+	tokenAddress common.Address,
+	destination common.Address,
+	value *big.Int,
+) error {
+	return errTokenDeposit
+}
+
+func (gi *globalInbox) DepositERC721Message(
+	ctx context.Context,
+	tokenAddress common.Address,
+	destination common.Address,
+	value *big.Int,
+) error {
+	return errTokenDeposit
+}
@@ -0,0 +1,497 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+var stakeRequirement = big.NewInt(10)
+
+type testChain struct {
+	chain         *Chain
+	params        valprotocol.ChainParams
+	vmState       common.Hash
+	rollupAddress common.Address
+	asserter      arbbridge.ArbRollup
+	challenger    arbbridge.ArbRollup
+	asserterAddr  common.Address
+	challengeAddr common.Address
+}
+
+func newTestChain(t *testing.T) *testChain {
+	chain := NewChain()
+	tc := &testChain{
+		chain: chain,
+		params: valprotocol.ChainParams{
+			StakeRequirement:        stakeRequirement,
+			GracePeriod:             common.TicksFromBlockNum(common.NewTimeBlocksInt(3)),
+			MaxExecutionSteps:       1000,
+			ArbGasSpeedLimitPerTick: 100,
+		},
+		vmState:       common.RandHash(),
+		asserterAddr:  common.RandAddress(),
+		challengeAddr: common.RandAddress(),
+	}
+	ctx := context.Background()
+	factory, err := NewArbAuthClient(chain, common.RandAddress()).NewArbFactory(chain.ArbFactoryAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.rollupAddress, _, err = factory.CreateRollup(ctx, tc.vmState, tc.params, common.RandAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []common.Address{tc.asserterAddr, tc.challengeAddr} {
+		chain.Fund(addr, big.NewInt(100))
+	}
+	tc.asserter, err = NewArbAuthClient(chain, tc.asserterAddr).NewRollup(tc.rollupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.challenger, err = NewArbAuthClient(chain, tc.challengeAddr).NewRollup(tc.rollupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tc
+}
+
+func (tc *testChain) initialProto() *valprotocol.VMProtoData {
+	return valprotocol.NewVMProtoData(tc.vmState, common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0))
+}
+
+func (tc *testChain) initialNode() common.Hash {
+	return childNodeHash(common.Hash{}, big.NewInt(0), common.Hash{}, big.NewInt(0), tc.initialProto().Hash())
+}
+
+// nodeInnerHash is the proof element leading from a node to its child
+func nodeInnerHash(vmProtoHash common.Hash, deadline common.TimeTicks, dataHash common.Hash, childType valprotocol.ChildType) common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Bytes32(vmProtoHash),
+		hashing.TimeTicks(deadline),
+		hashing.Bytes32(dataHash),
+		hashing.Uint256(big.NewInt(int64(childType))),
+	)
+}
+
+type assertion struct {
+	params   *valprotocol.AssertionParams
+	stub     *valprotocol.ExecutionAssertionStub
+	deadline common.TimeTicks
+	event    arbbridge.AssertedEvent
+}
+
+func (a *assertion) validDataHash() common.Hash {
+	return validDataHash(big.NewInt(0), a.stub.LastMessageHash, a.stub.LastLogHash)
+}
+
+func (a *assertion) validProto(tc *testChain) *valprotocol.VMProtoData {
+	return valprotocol.NewDisputableNode(a.params, a.stub, common.Hash{}, nil).ValidAfterVMProtoData(tc.initialProto())
+}
+
+func (a *assertion) challengeDataHash() common.Hash {
+	return valprotocol.ExecutionDataHash(a.params.NumSteps, a.stub)
+}
+
+func (a *assertion) challengePeriod(tc *testChain) common.TimeTicks {
+	return tc.params.GracePeriod.Add(a.stub.CheckTime(tc.params))
+}
+
+func (tc *testChain) stakeAndAssert(t *testing.T) *assertion {
+	ctx := context.Background()
+	if _, err := tc.asserter.PlaceStake(ctx, stakeRequirement, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	a := &assertion{
+		params: &valprotocol.AssertionParams{NumSteps: 10, ImportedMessageCount: big.NewInt(0)},
+		stub: &valprotocol.ExecutionAssertionStub{
+			NumGas:            1000,
+			BeforeMachineHash: tc.vmState,
+			AfterMachineHash:  common.RandHash(),
+			LastLogHash:       common.RandHash(),
+		},
+	}
+	validBlock := tc.chain.currentBlockId()
+	events, err := tc.asserter.MakeAssertion(
+		ctx,
+		common.Hash{},
+		common.Hash{},
+		common.TimeTicks{Val: big.NewInt(0)},
+		0,
+		tc.initialProto(),
+		a.params,
+		a.stub,
+		nil,
+		validBlock,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected assertion and stake move events but got %v", events)
+	}
+	var ok bool
+	a.event, ok = events[0].(arbbridge.AssertedEvent)
+	if !ok {
+		t.Fatalf("expected AssertedEvent but got %T", events[0])
+	}
+	if a.event.MaxInboxCount.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("expected the initialization message in the inbox but count was %v", a.event.MaxInboxCount)
+	}
+	a.deadline = valprotocol.CalculateNodeDeadline(
+		a.stub,
+		tc.params,
+		common.TimeTicks{Val: big.NewInt(0)},
+		common.TicksFromBlockNum(a.event.BlockId.Height),
+	)
+	validNode := hashing.SoliditySHA3(
+		hashing.Bytes32(tc.initialNode()),
+		hashing.Bytes32(nodeInnerHash(a.validProto(tc).Hash(), a.deadline, a.validDataHash(), valprotocol.ValidChildType)),
+	)
+	moved, ok := events[1].(arbbridge.StakeMovedEvent)
+	if !ok || moved.Location != validNode {
+		t.Fatalf("expected stake to move to %v but got %v", validNode, events[1])
+	}
+	return a
+}
+
+func TestCreateRollup(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	client := NewArbClient(tc.chain)
+	watcher, err := client.NewRollupWatcher(tc.rollupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.VerifyArbChain(ctx, tc.vmState); err != nil {
+		t.Error(err)
+	}
+	if err := watcher.VerifyArbChain(ctx, common.RandHash()); err == nil {
+		t.Error("expected VerifyArbChain to fail with the wrong machine")
+	}
+	params, err := watcher.GetParams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !params.Equals(tc.params) {
+		t.Error("wrong params")
+	}
+
+	inboxAddress, err := watcher.InboxAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inboxWatcher, err := client.NewGlobalInboxWatcher(inboxAddress, tc.rollupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := inboxWatcher.GetDeliveredEvents(ctx, big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 1 || delivered[0].Message.Kind != initializationMsg {
+		t.Fatalf("expected initialization message but got %v", delivered)
+	}
+
+	inbox, err := NewArbAuthClient(tc.chain, tc.asserterAddr).NewGlobalInbox(inboxAddress, tc.rollupAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := inbox.SendL2Message(ctx, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Message.InboxSeqNum.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("expected second message but got %v", ev.Message.InboxSeqNum)
+	}
+	inBlock, err := inboxWatcher.GetDeliveredEventsInBlock(ctx, ev.BlockId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inBlock) != 1 || !inBlock[0].Message.Equals(ev.Message) {
+		t.Errorf("expected the sent message but got %v", inBlock)
+	}
+}
+
+func TestFailedTransaction(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	before := tc.chain.currentBlockId()
+	if _, err := tc.asserter.PlaceStake(ctx, big.NewInt(1), nil, nil); err == nil {
+		t.Fatal("expected stake with the wrong amount to fail")
+	}
+	if !tc.chain.currentBlockId().Equals(before) {
+		t.Error("failed transaction was mined")
+	}
+	if staked, _ := tc.asserter.IsStaked(tc.asserterAddr); staked {
+		t.Error("failed transaction changed state")
+	}
+}
+
+func TestAssertAndConfirm(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	a := tc.stakeAndAssert(t)
+
+	opp := &valprotocol.ConfirmOpportunity{
+		Nodes: []valprotocol.ConfirmNodeOpportunity{
+			valprotocol.ConfirmValidOpportunity{
+				ConfirmNodeOpportunityCore: &valprotocol.ConfirmNodeOpportunityCore{
+					Branch:           valprotocol.ValidChildType,
+					DeadlineTicks:    a.deadline,
+					PrevVMProtoState: tc.initialProto(),
+					VMProtoState:     a.validProto(tc),
+				},
+				LogsAcc: a.stub.LastLogHash,
+			},
+		},
+		CurrentLatestConfirmed: tc.initialNode(),
+		StakerAddresses:        []common.Address{tc.asserterAddr},
+		StakerProofs:           [][]common.Hash{nil},
+	}
+	if _, err := tc.asserter.Confirm(ctx, opp); err == nil {
+		t.Fatal("expected confirmation before the deadline to fail")
+	}
+
+	tc.chain.AdvanceBlocks(int(new(big.Int).Div(a.deadline.Val, big.NewInt(common.TicksPerBlock)).Int64()))
+	events, err := tc.asserter.Confirm(ctx, opp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected confirmation events but got %v", events)
+	}
+	if _, ok := events[0].(arbbridge.ConfirmedEvent); !ok {
+		t.Errorf("expected ConfirmedEvent but got %T", events[0])
+	}
+	confirmedAssertion, ok := events[1].(arbbridge.ConfirmedAssertionEvent)
+	if !ok || len(confirmedAssertion.LogsAccHash) != 1 || confirmedAssertion.LogsAccHash[0] != a.stub.LastLogHash {
+		t.Errorf("expected ConfirmedAssertionEvent with the assertion's logs but got %v", events[1])
+	}
+
+	if _, err := tc.asserter.RecoverStakeConfirmed(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if staked, _ := tc.asserter.IsStaked(tc.asserterAddr); staked {
+		t.Error("asserter still staked after recovering stake")
+	}
+}
+
+func TestChallengeTimeout(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	a := tc.stakeAndAssert(t)
+
+	invalidInner := nodeInnerHash(
+		tc.initialProto().Hash(),
+		a.deadline,
+		challengeDataHash(a.challengeDataHash(), a.challengePeriod(tc).Val),
+		valprotocol.InvalidExecutionChildType,
+	)
+	if _, err := tc.challenger.PlaceStake(ctx, stakeRequirement, []common.Hash{invalidInner}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := tc.challenger.StartChallenge(
+		ctx,
+		tc.asserterAddr,
+		tc.challengeAddr,
+		tc.initialNode(),
+		a.deadline.Val,
+		valprotocol.ValidChildType,
+		valprotocol.InvalidExecutionChildType,
+		a.validProto(tc).Hash(),
+		tc.initialProto().Hash(),
+		nil,
+		nil,
+		a.validDataHash(),
+		a.challengeDataHash(),
+		a.challengePeriod(tc),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, ok := events[0].(arbbridge.ChallengeStartedEvent)
+	if len(events) != 1 || !ok {
+		t.Fatalf("expected ChallengeStartedEvent but got %v", events)
+	}
+
+	challengeWatcher, err := NewArbClient(tc.chain).NewExecutionChallengeWatcher(started.ChallengeContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengeEvents, err := challengeWatcher.GetEvents(ctx, started.BlockId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(challengeEvents) != 1 {
+		t.Fatalf("expected challenge to be initiated but got %v", challengeEvents)
+	}
+	if _, ok := challengeEvents[0].(arbbridge.InitiateChallengeEvent); !ok {
+		t.Fatalf("expected InitiateChallengeEvent but got %T", challengeEvents[0])
+	}
+
+	challenge, err := NewArbAuthClient(tc.chain, tc.challengeAddr).NewExecutionChallenge(started.ChallengeContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := challenge.TimeoutChallenge(ctx); err == nil {
+		t.Fatal("expected timeout before the deadline to fail")
+	}
+	periodBlocks := new(big.Int).Div(a.challengePeriod(tc).Val, big.NewInt(common.TicksPerBlock)).Int64()
+	tc.chain.AdvanceBlocks(int(periodBlocks) + 1)
+	if err := challenge.TimeoutChallenge(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rollupEvents, err := tc.challenger.GetAllEvents(ctx, big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed, ok := rollupEvents[len(rollupEvents)-1].(arbbridge.ChallengeCompletedEvent)
+	if !ok {
+		t.Fatalf("expected ChallengeCompletedEvent but got %T", rollupEvents[len(rollupEvents)-1])
+	}
+	if completed.Winner != tc.challengeAddr || completed.Loser != tc.asserterAddr {
+		t.Error("expected challenger to win after the asserter timed out")
+	}
+	if staked, _ := tc.asserter.IsStaked(tc.asserterAddr); staked {
+		t.Error("losing asserter is still staked")
+	}
+}
+
+func TestReorg(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tc := newTestChain(t)
+	client := NewArbClient(tc.chain)
+
+	start := tc.chain.currentBlockId()
+	headers, err := client.SubscribeBlockHeaders(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.asserter.PlaceStake(ctx, stakeRequirement, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	tc.chain.AdvanceBlocks(1)
+	for i := int64(0); i < 3; i++ {
+		maybeBlockId := <-headers
+		if maybeBlockId.Err != nil {
+			t.Fatal(maybeBlockId.Err)
+		}
+		height := new(big.Int).Add(start.Height.AsInt(), big.NewInt(i))
+		if maybeBlockId.BlockId.Height.AsInt().Cmp(height) != 0 {
+			t.Fatalf("expected block %v but got %v", height, maybeBlockId.BlockId)
+		}
+	}
+
+	if err := tc.chain.Reorg(2); err != nil {
+		t.Fatal(err)
+	}
+	if staked, _ := tc.asserter.IsStaked(tc.asserterAddr); staked {
+		t.Error("stake survived the reorg")
+	}
+	tc.chain.AdvanceBlocks(3)
+	if maybeBlockId := <-headers; maybeBlockId.Err == nil {
+		t.Fatalf("expected reorg error but got %v", maybeBlockId.BlockId)
+	}
+	if _, err := client.SubscribeBlockHeadersAfter(ctx, start); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestManualMining(t *testing.T) {
+	ctx := context.Background()
+	tc := newTestChain(t)
+	tc.chain.SetAutomine(false)
+
+	type result struct {
+		events []arbbridge.Event
+		err    error
+	}
+	results := make(chan result, 2)
+	for _, rollup := range []arbbridge.ArbRollup{tc.asserter, tc.challenger} {
+		rollup := rollup
+		go func() {
+			events, err := rollup.PlaceStake(ctx, stakeRequirement, nil, nil)
+			results <- result{events: events, err: err}
+		}()
+	}
+	for tc.chain.PendingTransactions() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	start := tc.chain.currentBlockId()
+	tc.chain.AdvanceBlocks(1)
+
+	blockId := tc.chain.currentBlockId()
+	if blockId.Height.AsInt().Cmp(new(big.Int).Add(start.Height.AsInt(), big.NewInt(1))) != 0 {
+		t.Fatalf("expected a single block to be mined but head is %v", blockId)
+	}
+	for i := 0; i < 2; i++ {
+		res := <-results
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if len(res.events) != 1 || !res.events[0].GetChainInfo().BlockId.Equals(blockId) {
+			t.Errorf("expected stake to be created in %v but got %v", blockId, res.events)
+		}
+	}
+	events, err := tc.asserter.GetEvents(ctx, blockId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].GetChainInfo().LogIndex != 0 || events[1].GetChainInfo().LogIndex != 1 {
+		t.Errorf("expected both stakes in block %v but got %v", blockId, events)
+	}
+}
+
+func TestWaitSettled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tc := newTestChain(t)
+	client := NewArbClient(tc.chain)
+	headers, err := client.SubscribeBlockHeadersAfter(ctx, tc.chain.currentBlockId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.chain.WaitSettled(ctx, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain isn't settled until the subscriber receives the new head
+	tc.chain.AdvanceBlocks(1)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	if err := tc.chain.WaitSettled(waitCtx, time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatal("chain settled before the head was received", err)
+	}
+	if maybeBlockId := <-headers; maybeBlockId.Err != nil {
+		t.Fatal(maybeBlockId.Err)
+	}
+	if err := tc.chain.WaitSettled(ctx, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
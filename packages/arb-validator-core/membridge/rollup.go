@@ -0,0 +1,664 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+const rollupVersion = "0.7.0"
+
+var (
+	machineHaltHash  = common.Hash{}
+	machineErrorHash = common.Hash{31: 1}
+)
+
+type staker struct {
+	location     common.Hash
+	creationTime *common.TimeBlocks
+	inChallenge  bool
+}
+
+// rollupState models the storage of an ArbRollup contract
+type rollupState struct {
+	address common.Address
+	params  valprotocol.ChainParams
+	owner   common.Address
+	vmState common.Hash
+
+	creationTxHash    common.Hash
+	creationInfo      arbbridge.ChainInfo
+	creationTimestamp *big.Int
+
+	latestConfirmed common.Hash
+	leaves          map[common.Hash]bool
+	stakers         map[common.Address]staker
+	challenges      map[common.Address]bool
+	withdrawnStakes map[common.Address]*big.Int
+}
+
+func newRollupState(
+	t *tx,
+	address common.Address,
+	vmState common.Hash,
+	params valprotocol.ChainParams,
+	owner common.Address,
+) *rollupState {
+	zero := big.NewInt(0)
+	initialNode := childNodeHash(
+		common.Hash{},
+		zero,
+		common.Hash{},
+		zero,
+		protoStateHash(vmState, common.Hash{}, zero, zero, zero),
+	)
+	return &rollupState{
+		address:           address,
+		params:            params,
+		owner:             owner,
+		vmState:           vmState,
+		creationTxHash:    t.hash,
+		creationInfo:      t.chainInfo(),
+		creationTimestamp: t.timestamp,
+		latestConfirmed:   initialNode,
+		leaves:            map[common.Hash]bool{initialNode: true},
+		stakers:           make(map[common.Address]staker),
+		challenges:        make(map[common.Address]bool),
+		withdrawnStakes:   make(map[common.Address]*big.Int),
+	}
+}
+
+func (r *rollupState) clone() *rollupState {
+	ret := *r
+	ret.leaves = make(map[common.Hash]bool, len(r.leaves))
+	for leaf := range r.leaves {
+		ret.leaves[leaf] = true
+	}
+	ret.stakers = make(map[common.Address]staker, len(r.stakers))
+	for addr, s := range r.stakers {
+		ret.stakers[addr] = s
+	}
+	ret.challenges = make(map[common.Address]bool, len(r.challenges))
+	for addr := range r.challenges {
+		ret.challenges[addr] = true
+	}
+	ret.withdrawnStakes = make(map[common.Address]*big.Int, len(r.withdrawnStakes))
+	for addr, amount := range r.withdrawnStakes {
+		ret.withdrawnStakes[addr] = amount
+	}
+	return &ret
+}
+
+func (r *rollupState) getValidStaker(address common.Address) (staker, error) {
+	s, ok := r.stakers[address]
+	if !ok {
+		return staker{}, revert("INV_STAKER")
+	}
+	return s, nil
+}
+
+func (r *rollupState) createStake(st *state, t *tx, location common.Hash, amount *big.Int) error {
+	if amount.Cmp(r.params.StakeRequirement) != 0 {
+		return revert("STK_AMT")
+	}
+	if err := st.transfer(t.sender, r.address, amount); err != nil {
+		return err
+	}
+	if _, ok := r.stakers[t.sender]; ok {
+		return revert("ALRDY_STAKED")
+	}
+	r.stakers[t.sender] = staker{location: location, creationTime: t.blockId.Height}
+	t.emit(r.address, arbbridge.StakeCreatedEvent{
+		ChainInfo: t.chainInfo(),
+		Staker:    t.sender,
+		NodeHash:  location,
+	})
+	return nil
+}
+
+func (r *rollupState) updateStakerLocation(t *tx, address common.Address, location common.Hash) {
+	s := r.stakers[address]
+	s.location = location
+	r.stakers[address] = s
+	t.emit(r.address, arbbridge.StakeMovedEvent{
+		ChainInfo: t.chainInfo(),
+		Staker:    address,
+		Location:  location,
+	})
+}
+
+func (r *rollupState) refundStaker(t *tx, address common.Address) {
+	delete(r.stakers, address)
+	r.addWithdrawnStake(address, r.params.StakeRequirement)
+	t.emit(r.address, arbbridge.StakeRefundedEvent{
+		ChainInfo: t.chainInfo(),
+		Staker:    address,
+	})
+}
+
+func (r *rollupState) addWithdrawnStake(address common.Address, amount *big.Int) {
+	withdrawn, ok := r.withdrawnStakes[address]
+	if !ok {
+		withdrawn = big.NewInt(0)
+	}
+	r.withdrawnStakes[address] = new(big.Int).Add(withdrawn, amount)
+}
+
+func (r *rollupState) placeStake(st *state, t *tx, amount *big.Int, proof1, proof2 []common.Hash) error {
+	location := calculateLeafFromPath(r.latestConfirmed, proof1)
+	leaf := calculateLeafFromPath(location, proof2)
+	if !r.leaves[leaf] {
+		return revert("PLACE_LEAF")
+	}
+	return r.createStake(st, t, location, amount)
+}
+
+func (r *rollupState) moveStake(t *tx, proof1, proof2 []common.Hash) error {
+	s, err := r.getValidStaker(t.sender)
+	if err != nil {
+		return err
+	}
+	newLocation := calculateLeafFromPath(s.location, proof1)
+	leaf := calculateLeafFromPath(newLocation, proof2)
+	if !r.leaves[leaf] {
+		return revert("MOVE_LEAF")
+	}
+	r.updateStakerLocation(t, t.sender, newLocation)
+	return nil
+}
+
+// Like the contract, the stake recovery methods check proofs against the
+// sender's location rather than the recovered staker's
+
+func (r *rollupState) recoverStakeConfirmed(t *tx, address common.Address, proof []common.Hash) error {
+	s, err := r.getValidStaker(t.sender)
+	if err != nil {
+		return err
+	}
+	if calculateLeafFromPath(s.location, proof) != r.latestConfirmed {
+		return revert("RECOV_PATH_PROOF")
+	}
+	r.refundStaker(t, address)
+	return nil
+}
+
+func (r *rollupState) recoverStakeOld(t *tx, address common.Address, proof []common.Hash) error {
+	if len(proof) == 0 {
+		return revert("RECVOLD_LENGTH")
+	}
+	return r.recoverStakeConfirmed(t, address, proof)
+}
+
+func (r *rollupState) recoverStakeMooted(
+	t *tx,
+	address common.Address,
+	node common.Hash,
+	latestConfirmedProof []common.Hash,
+	stakerProof []common.Hash,
+) error {
+	s, err := r.getValidStaker(t.sender)
+	if err != nil {
+		return err
+	}
+	if len(latestConfirmedProof) == 0 || len(stakerProof) == 0 ||
+		latestConfirmedProof[0] == stakerProof[0] ||
+		calculateLeafFromPath(node, latestConfirmedProof) != r.latestConfirmed ||
+		calculateLeafFromPath(node, stakerProof) != s.location {
+		return revert("RECOV_CONFLICT_PROOF")
+	}
+	r.refundStaker(t, address)
+	return nil
+}
+
+func (r *rollupState) recoverStakePassedDeadline(
+	t *tx,
+	address common.Address,
+	deadlineTicks *big.Int,
+	disputableNodeHashVal common.Hash,
+	childType uint64,
+	vmProtoStateHash common.Hash,
+	proof []common.Hash,
+) error {
+	s, err := r.getValidStaker(t.sender)
+	if err != nil {
+		return err
+	}
+	nextNode := childNodeHash(
+		s.location,
+		deadlineTicks,
+		disputableNodeHashVal,
+		new(big.Int).SetUint64(childType),
+		vmProtoStateHash,
+	)
+	if !r.leaves[calculateLeafFromPath(nextNode, proof)] {
+		return revert("RECOV_DEADLINE_LEAF")
+	}
+	// The contract compares the block number against the deadline converted
+	// to ticks a second time
+	if t.blockId.Height.AsInt().Cmp(blocksToTicks(deadlineTicks)) < 0 {
+		return revert("RECOV_DEADLINE_TIME")
+	}
+	r.refundStaker(t, address)
+	return nil
+}
+
+func (r *rollupState) pruneLeaves(t *tx, params []valprotocol.PruneParams) error {
+	for _, p := range params {
+		if len(p.LeafProof) == 0 || len(p.AncProof) == 0 {
+			return revert("PRUNE_PROOFLEN")
+		}
+		if calculateLeafFromPath(p.AncestorHash, p.AncProof) != r.latestConfirmed ||
+			p.LeafProof[0] == p.AncProof[0] {
+			return revert("PRUNE_CONFLICT")
+		}
+		leaf := calculateLeafFromPath(p.AncestorHash, p.LeafProof)
+		if r.leaves[leaf] {
+			delete(r.leaves, leaf)
+			t.emit(r.address, arbbridge.PrunedEvent{
+				ChainInfo: t.chainInfo(),
+				Leaf:      leaf,
+			})
+		}
+	}
+	return nil
+}
+
+func (r *rollupState) makeAssertion(
+	st *state,
+	t *tx,
+	prevPrevLeafHash common.Hash,
+	prevDataHash common.Hash,
+	prevDeadline common.TimeTicks,
+	prevChildType valprotocol.ChildType,
+	beforeState *valprotocol.VMProtoData,
+	params *valprotocol.AssertionParams,
+	stub *valprotocol.ExecutionAssertionStub,
+	stakerProof []common.Hash,
+	validBlock *common.BlockId,
+) error {
+	if t.blockHash(validBlock.Height.AsInt()) != validBlock.HeaderHash {
+		return revert("invalid known block")
+	}
+
+	// The contract only receives the fields of the assertion which it can't
+	// derive itself
+	assertion := &valprotocol.ExecutionAssertionStub{
+		NumGas:            stub.NumGas,
+		BeforeMachineHash: beforeState.MachineHash,
+		AfterMachineHash:  stub.AfterMachineHash,
+		BeforeInboxHash:   stub.BeforeInboxHash,
+		AfterInboxHash:    stub.AfterInboxHash,
+		LastMessageHash:   stub.LastMessageHash,
+		MessageCount:      stub.MessageCount,
+		LastLogHash:       stub.LastLogHash,
+		LogCount:          stub.LogCount,
+	}
+	inboxValue, inboxCount := st.inbox(r.address).snapshot()
+
+	vmProtoHashBefore := protoStateHash(
+		assertion.BeforeMachineHash,
+		assertion.BeforeInboxHash,
+		beforeState.InboxCount,
+		beforeState.MessageCount,
+		beforeState.LogCount,
+	)
+	prevLeaf := childNodeHash(
+		prevPrevLeafHash,
+		prevDeadline.Val,
+		prevDataHash,
+		new(big.Int).SetUint64(uint64(prevChildType)),
+		vmProtoHashBefore,
+	)
+	if !r.leaves[prevLeaf] {
+		return revert("MAKE_LEAF")
+	}
+	if assertion.BeforeMachineHash == machineErrorHash || assertion.BeforeMachineHash == machineHaltHash {
+		return revert("MAKE_RUN")
+	}
+	if params.NumSteps > r.params.MaxExecutionSteps {
+		return revert("MAKE_STEP")
+	}
+	if beforeState.InboxCount.Cmp(inboxCount) > 0 {
+		return revert("SafeMath: subtraction overflow")
+	}
+	if params.ImportedMessageCount.Cmp(new(big.Int).Sub(inboxCount, beforeState.InboxCount)) > 0 {
+		return revert("MAKE_MESSAGE_CNT")
+	}
+
+	checkTimeTicks := new(big.Int).SetUint64(assertion.NumGas / r.params.ArbGasSpeedLimitPerTick)
+	deadlineTicks := new(big.Int).Add(t.ticks().Val, r.params.GracePeriod.Val)
+	if deadlineTicks.Cmp(prevDeadline.Val) < 0 {
+		deadlineTicks = new(big.Int).Set(prevDeadline.Val)
+	}
+	deadlineTicks = deadlineTicks.Add(deadlineTicks, checkTimeTicks)
+
+	afterInboxCount := new(big.Int).Add(beforeState.InboxCount, params.ImportedMessageCount)
+	invalidInboxLeaf := childNodeHash(
+		prevLeaf,
+		deadlineTicks,
+		challengeDataHash(
+			valprotocol.InboxTopChallengeDataHash(
+				assertion.AfterInboxHash,
+				inboxValue,
+				new(big.Int).Sub(inboxCount, afterInboxCount),
+			),
+			new(big.Int).Add(r.params.GracePeriod.Val, blocksToTicks(big.NewInt(1))),
+		),
+		big.NewInt(int64(valprotocol.InvalidInboxTopChildType)),
+		vmProtoHashBefore,
+	)
+	invalidExecLeaf := childNodeHash(
+		prevLeaf,
+		deadlineTicks,
+		challengeDataHash(
+			valprotocol.ExecutionDataHash(params.NumSteps, assertion),
+			new(big.Int).Add(r.params.GracePeriod.Val, checkTimeTicks),
+		),
+		big.NewInt(int64(valprotocol.InvalidExecutionChildType)),
+		vmProtoHashBefore,
+	)
+	validLeaf := childNodeHash(
+		prevLeaf,
+		deadlineTicks,
+		validDataHash(beforeState.MessageCount, assertion.LastMessageHash, assertion.LastLogHash),
+		big.NewInt(int64(valprotocol.ValidChildType)),
+		protoStateHash(
+			assertion.AfterMachineHash,
+			assertion.AfterInboxHash,
+			afterInboxCount,
+			new(big.Int).Add(beforeState.MessageCount, new(big.Int).SetUint64(assertion.MessageCount)),
+			new(big.Int).Add(beforeState.LogCount, new(big.Int).SetUint64(assertion.LogCount)),
+		),
+	)
+	r.leaves[invalidInboxLeaf] = true
+	r.leaves[invalidExecLeaf] = true
+	r.leaves[validLeaf] = true
+	delete(r.leaves, prevLeaf)
+
+	t.emit(r.address, arbbridge.AssertedEvent{
+		ChainInfo:    t.chainInfo(),
+		PrevLeafHash: prevLeaf,
+		AssertionParams: &valprotocol.AssertionParams{
+			NumSteps:             params.NumSteps,
+			ImportedMessageCount: params.ImportedMessageCount,
+		},
+		MaxInboxTop:      inboxValue,
+		MaxInboxCount:    inboxCount,
+		NumGas:           assertion.NumGas,
+		AfterMachineHash: assertion.AfterMachineHash,
+		AfterInboxHash:   assertion.AfterInboxHash,
+		LastMessageHash:  assertion.LastMessageHash,
+		MessageCount:     assertion.MessageCount,
+		LastLogHash:      assertion.LastLogHash,
+		LogCount:         assertion.LogCount,
+	})
+
+	s, err := r.getValidStaker(t.sender)
+	if err != nil {
+		return err
+	}
+	if calculateLeafFromPath(s.location, stakerProof) != prevLeaf {
+		return revert("MAKE_STAKER_PROOF")
+	}
+	r.updateStakerLocation(t, t.sender, validLeaf)
+	return nil
+}
+
+func (r *rollupState) confirm(t *tx, proof valprotocol.ConfirmProof, stakerAddresses []common.Address) error {
+	nodeCount := len(proof.BranchesNums)
+	validNodeCount := len(proof.MessageCounts)
+	if nodeCount == 0 ||
+		validNodeCount > nodeCount ||
+		len(proof.VMProtoStateHashes) != validNodeCount ||
+		len(proof.LogsAcc) != validNodeCount ||
+		len(proof.DeadlineTicks) != nodeCount ||
+		len(proof.ChallengeNodeData) != nodeCount-validNodeCount {
+		return revert("CONF_INP")
+	}
+	lastDeadline := proof.DeadlineTicks[nodeCount-1]
+	if t.ticks().Val.Cmp(lastDeadline) < 0 {
+		return revert("CONF_TIME")
+	}
+
+	nodeHash := r.latestConfirmed
+	vmProtoStateHash := proof.InitalProtoStateHash
+	beforeSendCount := new(big.Int).Set(proof.BeforeSendCount)
+	messages := proof.Messages
+	validNum := 0
+	invalidNum := 0
+	validType := big.NewInt(int64(valprotocol.ValidChildType))
+	for i, branch := range proof.BranchesNums {
+		var nodeDataHash common.Hash
+		if branch.Cmp(validType) == 0 {
+			if validNum >= validNodeCount {
+				return revert("CONF_INP")
+			}
+			sendCount := proof.MessageCounts[validNum]
+			var lastMsgHash common.Hash
+			var err error
+			lastMsgHash, messages, err = generateLastMessageHash(messages, sendCount.Uint64())
+			if err != nil {
+				return err
+			}
+			nodeDataHash = validDataHash(beforeSendCount, lastMsgHash, common.Hash(proof.LogsAcc[validNum]))
+			vmProtoStateHash = common.Hash(proof.VMProtoStateHashes[validNum])
+			beforeSendCount = beforeSendCount.Add(beforeSendCount, sendCount)
+			validNum++
+		} else {
+			if invalidNum >= len(proof.ChallengeNodeData) {
+				return revert("CONF_INP")
+			}
+			nodeDataHash = common.Hash(proof.ChallengeNodeData[invalidNum])
+			invalidNum++
+		}
+		nodeHash = childNodeHash(nodeHash, proof.DeadlineTicks[i], nodeDataHash, branch, vmProtoStateHash)
+	}
+
+	activeCount, err := r.checkAlignedStakers(
+		nodeHash,
+		lastDeadline,
+		stakerAddresses,
+		proof.CombinedProofs,
+		proof.StakerProofOffsets,
+	)
+	if err != nil {
+		return err
+	}
+	if activeCount == 0 {
+		return revert("CONF_HAS_STAKER")
+	}
+
+	r.latestConfirmed = nodeHash
+	t.emit(r.address, arbbridge.ConfirmedEvent{
+		ChainInfo: t.chainInfo(),
+		NodeHash:  nodeHash,
+	})
+	// Outgoing messages aren't delivered to L1 since nothing here can
+	// receive them
+	if validNodeCount > 0 {
+		logsAcc := make([]common.Hash, 0, validNodeCount)
+		for _, acc := range proof.LogsAcc {
+			logsAcc = append(logsAcc, common.Hash(acc))
+		}
+		t.emit(r.address, arbbridge.ConfirmedAssertionEvent{
+			ChainInfo:   t.chainInfo(),
+			LogsAccHash: logsAcc,
+		})
+	}
+	return nil
+}
+
+func (r *rollupState) checkAlignedStakers(
+	node common.Hash,
+	deadlineTicks *big.Int,
+	stakerAddresses []common.Address,
+	stakerProofs [][32]byte,
+	stakerProofOffsets []*big.Int,
+) (int, error) {
+	if len(stakerAddresses) != len(r.stakers) {
+		return 0, revert("CHCK_COUNT")
+	}
+	if len(stakerAddresses)+1 != len(stakerProofOffsets) {
+		return 0, revert("CHCK_OFFSETS")
+	}
+	prevStaker := common.Address{}
+	activeCount := 0
+	for i, address := range stakerAddresses {
+		if bytes.Compare(address[:], prevStaker[:]) <= 0 {
+			return 0, revert("CHCK_ORDER")
+		}
+		s, err := r.getValidStaker(address)
+		if err != nil {
+			return 0, err
+		}
+		if common.TicksFromBlockNum(s.creationTime).Val.Cmp(deadlineTicks) < 0 {
+			start := stakerProofOffsets[i].Int64()
+			end := stakerProofOffsets[i+1].Int64()
+			if start < 0 || start > end || end > int64(len(stakerProofs)) {
+				return 0, revert("CHCK_STAKER_PROOF")
+			}
+			proof := make([]common.Hash, 0, end-start)
+			for _, h := range stakerProofs[start:end] {
+				proof = append(proof, common.Hash(h))
+			}
+			if calculateLeafFromPath(node, proof) != s.location {
+				return 0, revert("CHCK_STAKER_PROOF")
+			}
+			activeCount++
+		}
+		prevStaker = address
+	}
+	return activeCount, nil
+}
+
+func (r *rollupState) startChallenge(
+	st *state,
+	t *tx,
+	asserterAddress common.Address,
+	challengerAddress common.Address,
+	prevNode common.Hash,
+	deadlineTicks *big.Int,
+	asserterPosition valprotocol.ChildType,
+	challengerPosition valprotocol.ChildType,
+	asserterVMProtoHash common.Hash,
+	challengerVMProtoHash common.Hash,
+	asserterProof []common.Hash,
+	challengerProof []common.Hash,
+	asserterNodeHash common.Hash,
+	challengerDataHash common.Hash,
+	challengerPeriodTicks common.TimeTicks,
+) error {
+	asserter, err := r.getValidStaker(asserterAddress)
+	if err != nil {
+		return err
+	}
+	challenger, err := r.getValidStaker(challengerAddress)
+	if err != nil {
+		return err
+	}
+	if common.TicksFromBlockNum(asserter.creationTime).Val.Cmp(deadlineTicks) >= 0 {
+		return revert("STK1_DEADLINE")
+	}
+	if common.TicksFromBlockNum(challenger.creationTime).Val.Cmp(deadlineTicks) >= 0 {
+		return revert("STK2_DEADLINE")
+	}
+	if asserter.inChallenge {
+		return revert("STK1_IN_CHAL")
+	}
+	if challenger.inChallenge {
+		return revert("STK2_IN_CHAL")
+	}
+	if asserterPosition <= challengerPosition {
+		return revert("TYPE_ORDER")
+	}
+	asserterNode := childNodeHash(
+		prevNode,
+		deadlineTicks,
+		asserterNodeHash,
+		big.NewInt(int64(asserterPosition)),
+		asserterVMProtoHash,
+	)
+	if calculateLeafFromPath(asserterNode, asserterProof) != asserter.location {
+		return revert("ASSERT_PROOF")
+	}
+	challengerNode := childNodeHash(
+		prevNode,
+		deadlineTicks,
+		challengeDataHash(challengerDataHash, challengerPeriodTicks.Val),
+		big.NewInt(int64(challengerPosition)),
+		challengerVMProtoHash,
+	)
+	if calculateLeafFromPath(challengerNode, challengerProof) != challenger.location {
+		return revert("CHAL_PROOF")
+	}
+
+	asserter.inChallenge = true
+	challenger.inChallenge = true
+	r.stakers[asserterAddress] = asserter
+	r.stakers[challengerAddress] = challenger
+
+	challengeAddress, err := st.createChallenge(
+		t,
+		r.address,
+		asserterAddress,
+		challengerAddress,
+		challengerPeriodTicks,
+		challengerDataHash,
+		challengerPosition,
+	)
+	if err != nil {
+		return err
+	}
+	r.challenges[challengeAddress] = true
+	t.emit(r.address, arbbridge.ChallengeStartedEvent{
+		ChainInfo:         t.chainInfo(),
+		Asserter:          asserterAddress,
+		Challenger:        challengerAddress,
+		ChallengeType:     challengerPosition,
+		ChallengeContract: challengeAddress,
+	})
+	return nil
+}
+
+func (r *rollupState) resolveChallenge(t *tx, challenge common.Address, winner, loser common.Address) error {
+	if !r.challenges[challenge] {
+		return revert("RES_CHAL_SENDER")
+	}
+	delete(r.challenges, challenge)
+
+	winningStaker, err := r.getValidStaker(winner)
+	if err != nil {
+		return err
+	}
+	r.addWithdrawnStake(winner, new(big.Int).Div(r.params.StakeRequirement, big.NewInt(2)))
+	winningStaker.inChallenge = false
+	r.stakers[winner] = winningStaker
+	delete(r.stakers, loser)
+
+	t.emit(r.address, arbbridge.ChallengeCompletedEvent{
+		ChainInfo:         t.chainInfo(),
+		Winner:            winner,
+		Loser:             loser,
+		ChallengeContract: challenge,
+	})
+	return nil
+}
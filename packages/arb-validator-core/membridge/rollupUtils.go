@@ -0,0 +1,121 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package membridge
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// The helpers in this file mirror RollupUtils.sol
+
+func protoStateHash(
+	machineHash common.Hash,
+	inboxTop common.Hash,
+	inboxCount *big.Int,
+	messageCount *big.Int,
+	logCount *big.Int,
+) common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Bytes32(machineHash),
+		hashing.Bytes32(inboxTop),
+		hashing.Uint256(inboxCount),
+		hashing.Uint256(messageCount),
+		hashing.Uint256(logCount),
+	)
+}
+
+func validDataHash(beforeSendCount *big.Int, messagesAcc common.Hash, logsAcc common.Hash) common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Uint256(beforeSendCount),
+		hashing.Bytes32(messagesAcc),
+		hashing.Bytes32(logsAcc),
+	)
+}
+
+func challengeDataHash(challenge common.Hash, challengePeriod *big.Int) common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Bytes32(challenge),
+		hashing.Uint256(challengePeriod),
+	)
+}
+
+func childNodeHash(
+	prevNodeHash common.Hash,
+	deadlineTicks *big.Int,
+	nodeDataHash common.Hash,
+	childType *big.Int,
+	vmProtoStateHash common.Hash,
+) common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Bytes32(prevNodeHash),
+		hashing.Bytes32(hashing.SoliditySHA3(
+			hashing.Bytes32(vmProtoStateHash),
+			hashing.Uint256(deadlineTicks),
+			hashing.Bytes32(nodeDataHash),
+			hashing.Uint256(childType),
+		)),
+	)
+}
+
+func calculateLeafFromPath(from common.Hash, proof []common.Hash) common.Hash {
+	node := from
+	for _, p := range proof {
+		node = hashing.SoliditySHA3(hashing.Bytes32(node), hashing.Bytes32(p))
+	}
+	return node
+}
+
+// generateLastMessageHash hashes count serialized values from messages,
+// returning the accumulated hash and the unread remainder
+func generateLastMessageHash(messages []byte, count uint64) (common.Hash, []byte, error) {
+	rd := bytes.NewReader(messages)
+	hashVal := common.Hash{}
+	for i := uint64(0); i < count; i++ {
+		val, err := value.UnmarshalValue(rd)
+		if err != nil {
+			return common.Hash{}, nil, revert("invalid message")
+		}
+		hashVal = hashing.SoliditySHA3(hashing.Bytes32(hashVal), hashing.Bytes32(val.Hash()))
+	}
+	return hashVal, messages[len(messages)-rd.Len():], nil
+}
+
+func blocksToTicks(blocks *big.Int) *big.Int {
+	return common.TicksFromBlockNum(common.NewTimeBlocks(blocks)).Val
+}
+
+// merkleRoot mirrors MerkleLib.generateRoot
+func merkleRoot(hashes []common.Hash) common.Hash {
+	layer := hashes
+	for len(layer) > 1 {
+		next := make([]common.Hash, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 < len(layer) {
+				next = append(next, hashing.SoliditySHA3(hashing.Bytes32(layer[i]), hashing.Bytes32(layer[i+1])))
+			} else {
+				next = append(next, layer[i])
+			}
+		}
+		layer = next
+	}
+	return layer[0]
+}
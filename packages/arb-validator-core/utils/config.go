@@ -0,0 +1,195 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+	errors2 "github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// LoadConfig fills cfg, which must be a pointer to a struct holding the
+// default settings, from the YAML file at path and then from environment
+// variables. Unknown keys in the file are an error. If path is empty only the
+// environment is read.
+//
+// Each setting can be overridden by an environment variable named envPrefix
+// followed by the upper case path of its yaml keys joined by underscores. For
+// example with the prefix ARB_AGGREGATOR the key web3Addr in the rpc section
+// is overridden by ARB_AGGREGATOR_RPC_WEB3ADDR. Lists are comma separated
+func LoadConfig(path string, envPrefix string, cfg interface{}) error {
+	val := reflect.ValueOf(cfg)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return errors2.New("config must be a pointer to a struct")
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors2.Wrap(err, "error reading config file")
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return errors2.Wrapf(err, "error parsing config file %v", path)
+		}
+	}
+	return applyEnvOverrides(val.Elem(), envPrefix)
+}
+
+func applyEnvOverrides(val reflect.Value, prefix string) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		fieldVal := val.Field(i)
+
+		if fieldVal.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(fieldVal, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if fieldVal.Kind() == reflect.Ptr && fieldVal.Type().Elem().Kind() == reflect.Struct {
+			// Optional sections can only be enabled from the config file
+			if fieldVal.IsNil() {
+				continue
+			}
+			if err := applyEnvOverrides(fieldVal.Elem(), name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		envVal, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(fieldVal, envVal); err != nil {
+			return errors2.Wrapf(err, "invalid value for %v", name)
+		}
+	}
+	return nil
+}
+
+func setFromString(val reflect.Value, str string) error {
+	if val.Type() == durationType {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return err
+		}
+		val.SetInt(int64(d))
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		val.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(str, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetFloat(f)
+	case reflect.Slice:
+		if val.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("can't set %v from the environment", val.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(str, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		val.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("can't set %v from the environment", val.Type())
+	}
+	return nil
+}
+
+// L1Config configures how transactions are sent to the L1 chain
+type L1Config struct {
+	ResendInterval time.Duration `yaml:"resendInterval"`
+	GasPriceBump   uint64        `yaml:"gasPriceBump"`
+	// MaxGasPrice is in gwei. Zero means there is no limit
+	MaxGasPrice uint64 `yaml:"maxGasPrice"`
+}
+
+var DefaultL1Config = L1Config{
+	ResendInterval: ethbridge.DefaultTxManagerConfig.ResendInterval,
+	GasPriceBump:   ethbridge.DefaultTxManagerConfig.GasPriceBump,
+}
+
+func (c L1Config) Validate() error {
+	if c.ResendInterval <= 0 {
+		return errors2.New("l1.resendInterval must be positive")
+	}
+	return nil
+}
+
+func (c L1Config) TxManagerConfig() ethbridge.TxManagerConfig {
+	cfg := ethbridge.TxManagerConfig{
+		ResendInterval: c.ResendInterval,
+		GasPriceBump:   c.GasPriceBump,
+	}
+	if c.MaxGasPrice > 0 {
+		cfg.MaxGasPrice = new(big.Int).Mul(
+			new(big.Int).SetUint64(c.MaxGasPrice),
+			big.NewInt(params.GWei),
+		)
+	}
+	return cfg
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSection struct {
+	Addr    string        `yaml:"addr"`
+	Timeout time.Duration `yaml:"timeout"`
+	Hosts   []string      `yaml:"hosts"`
+}
+
+type testConfig struct {
+	Name     string       `yaml:"name"`
+	Enabled  bool         `yaml:"enabled"`
+	Count    int          `yaml:"count"`
+	Limit    uint64       `yaml:"limit"`
+	Rate     float64      `yaml:"rate"`
+	Section  testSection  `yaml:"section"`
+	Optional *testSection `yaml:"optional"`
+	Ignored  string       `yaml:"-"`
+	NoTag    string
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func setEnv(t *testing.T, env map[string]string) func() {
+	t.Helper()
+	for name, value := range env {
+		if err := os.Setenv(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for name := range env {
+			_ = os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+name: file
+count: 3
+section:
+  addr: ":1234"
+  timeout: 5s
+optional:
+  hosts: [a, b]
+`)
+	defer os.Remove(path)
+
+	cfg := &testConfig{Name: "default", Limit: 7}
+	if err := LoadConfig(path, "TEST_CONFIG_FILE", cfg); err != nil {
+		t.Fatal(err)
+	}
+	expected := &testConfig{
+		Name:     "file",
+		Count:    3,
+		Limit:    7,
+		Section:  testSection{Addr: ":1234", Timeout: 5 * time.Second},
+		Optional: &testSection{Hosts: []string{"a", "b"}},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("loaded %+v but expected %+v", cfg, expected)
+	}
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	for _, contents := range []string{
+		"nmae: typo\n",
+		"section:\n  adr: typo\n",
+		"count: notanumber\n",
+	} {
+		path := writeConfigFile(t, contents)
+		if err := LoadConfig(path, "TEST_CONFIG_STRICT", &testConfig{}); err == nil {
+			t.Errorf("loaded invalid config %q", contents)
+		}
+		os.Remove(path)
+	}
+
+	if err := LoadConfig("/nonexistent/config.yaml", "TEST_CONFIG_STRICT", &testConfig{}); err == nil {
+		t.Error("loaded missing config file")
+	}
+	if err := LoadConfig("", "TEST_CONFIG_STRICT", testConfig{}); err == nil {
+		t.Error("loaded config into a struct which isn't a pointer")
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, "name: file\nsection:\n  addr: \":1\"\n")
+	defer os.Remove(path)
+	defer setEnv(t, map[string]string{
+		"TEST_CONFIG_ENV_NAME":            "env",
+		"TEST_CONFIG_ENV_ENABLED":         "true",
+		"TEST_CONFIG_ENV_COUNT":           "-4",
+		"TEST_CONFIG_ENV_LIMIT":           "9",
+		"TEST_CONFIG_ENV_RATE":            "1.5",
+		"TEST_CONFIG_ENV_SECTION_ADDR":    ":2",
+		"TEST_CONFIG_ENV_SECTION_TIMEOUT": "1m",
+		"TEST_CONFIG_ENV_SECTION_HOSTS":   "x, y,,z",
+		"TEST_CONFIG_ENV_OPTIONAL_ADDR":   ":3",
+		"TEST_CONFIG_ENV_IGNORED":         "set",
+		"TEST_CONFIG_ENV_NOTAG":           "untagged",
+	})()
+
+	cfg := &testConfig{}
+	if err := LoadConfig(path, "TEST_CONFIG_ENV", cfg); err != nil {
+		t.Fatal(err)
+	}
+	expected := &testConfig{
+		Name:    "env",
+		Enabled: true,
+		Count:   -4,
+		Limit:   9,
+		Rate:    1.5,
+		Section: testSection{
+			Addr:    ":2",
+			Timeout: time.Minute,
+			Hosts:   []string{"x", "y", "z"},
+		},
+		NoTag: "untagged",
+	}
+	// Optional sections which aren't in the file can't be enabled from the
+	// environment and ignored fields are never set
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("loaded %+v but expected %+v", cfg, expected)
+	}
+
+	// An optional section from the file can be overridden
+	cfg = &testConfig{Optional: &testSection{Addr: ":0"}}
+	if err := LoadConfig("", "TEST_CONFIG_ENV", cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Optional.Addr != ":3" {
+		t.Error("optional section wasn't overridden", cfg.Optional.Addr)
+	}
+}
+
+func TestLoadConfigInvalidEnv(t *testing.T) {
+	for name, value := range map[string]string{
+		"TEST_CONFIG_BAD_ENABLED":         "maybe",
+		"TEST_CONFIG_BAD_COUNT":           "1.5",
+		"TEST_CONFIG_BAD_LIMIT":           "-1",
+		"TEST_CONFIG_BAD_SECTION_TIMEOUT": "10",
+	} {
+		cleanup := setEnv(t, map[string]string{name: value})
+		if err := LoadConfig("", "TEST_CONFIG_BAD", &testConfig{}); err == nil {
+			t.Errorf("accepted %v=%v", name, value)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,117 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package chainlistener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	errors2 "github.com/pkg/errors"
+)
+
+// Alert describes an invalid node which is close to being confirmed
+type Alert struct {
+	Node ethcommon.Hash `json:"node"`
+	Prev ethcommon.Hash `json:"prev"`
+	// ValidNode is the sibling of Node which this validator computed
+	ValidNode ethcommon.Hash `json:"validNode"`
+	// Reason says what's wrong with the assertion
+	Reason string `json:"reason"`
+	// BlocksLeft is how many blocks remain until the node's deadline. It's
+	// negative once the deadline has passed
+	BlocksLeft int64  `json:"blocksLeft"`
+	Stakers    uint64 `json:"stakers"`
+	// Confirmed is set if the invalid node was confirmed
+	Confirmed bool `json:"confirmed"`
+}
+
+// Alerter is notified by a WatchtowerListener about invalid nodes
+type Alerter interface {
+	Alert(ctx context.Context, alert Alert)
+}
+
+// InvalidNodeAlerter is an Alerter which also wants to know about invalid
+// nodes as soon as they're found, long before they near their deadline. The
+// alert passed to InvalidNodeFound is never Confirmed
+type InvalidNodeAlerter interface {
+	Alerter
+	InvalidNodeFound(ctx context.Context, alert Alert)
+}
+
+// LogAlerter writes alerts to the log
+type LogAlerter struct{}
+
+func (LogAlerter) Alert(_ context.Context, alert Alert) {
+	if alert.Confirmed {
+		log.Println("ALERT: invalid node", alert.Node.Hex(), "was confirmed")
+		return
+	}
+	log.Println(
+		"ALERT: invalid node", alert.Node.Hex(),
+		"with", alert.Stakers, "stakers",
+		"is", alert.BlocksLeft, "blocks from its deadline;",
+		"the correct successor of", alert.Prev.Hex(), "is", alert.ValidNode.Hex(), "("+alert.Reason+")",
+	)
+}
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookAlerter posts alerts as JSON to a URL
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (w *WebhookAlerter) Alert(ctx context.Context, alert Alert) {
+	if err := w.post(ctx, alert); err != nil {
+		log.Println("Error sending alert to webhook", err)
+	}
+}
+
+func (w *WebhookAlerter) post(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors2.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
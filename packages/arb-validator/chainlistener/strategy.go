@@ -0,0 +1,142 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package chainlistener
+
+import (
+	"fmt"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/nodegraph"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// StakingStrategy decides where a ValidatorChainListener stakes and which
+// assertions it makes. Whatever the strategy, conflicting stakers are
+// challenged unless ValidatorConfig.InitiateChallenges is unset, challenges
+// started by others are always defended and confirmations and prunes are
+// always sent. ValidatorConfig.Validate rejects strategies which never assert
+// when challenges are disabled
+type StakingStrategy interface {
+	Name() string
+	// ShouldStake is called when a staking key has no stake down. validNode
+	// is the node the stake would be placed on
+	ShouldStake(nodeGraph *nodegraph.StakedNodeGraph, validNode *structures.Node) bool
+	// ShouldAssert is called when a staked key is able to make prepared
+	ShouldAssert(nodeGraph *nodegraph.StakedNodeGraph, prepared *PreparedAssertion) bool
+}
+
+const (
+	ActiveStrategyName        = "active"
+	DefensiveStrategyName     = "defensive"
+	ChallengeOnlyStrategyName = "challenge-only"
+	NonEmptyInboxStrategyName = "nonempty-inbox"
+)
+
+// NewStakingStrategy returns the strategy with the given name
+func NewStakingStrategy(name string) (StakingStrategy, error) {
+	switch name {
+	case ActiveStrategyName:
+		return ActiveStrategy{}, nil
+	case DefensiveStrategyName:
+		return DefensiveStrategy{}, nil
+	case ChallengeOnlyStrategyName:
+		return ChallengeOnlyStrategy{}, nil
+	case NonEmptyInboxStrategyName:
+		return NonEmptyInboxStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown staking strategy %v", name)
+	}
+}
+
+// ActiveStrategy stakes on the latest valid node and makes every assertion
+// it can
+type ActiveStrategy struct{}
+
+func (ActiveStrategy) Name() string {
+	return ActiveStrategyName
+}
+
+func (ActiveStrategy) ShouldStake(*nodegraph.StakedNodeGraph, *structures.Node) bool {
+	return true
+}
+
+func (ActiveStrategy) ShouldAssert(*nodegraph.StakedNodeGraph, *PreparedAssertion) bool {
+	return true
+}
+
+// DefensiveStrategy only stakes once another staker is on a node which
+// conflicts with the valid one, so that it can challenge them. It never
+// makes assertions
+type DefensiveStrategy struct{}
+
+func (DefensiveStrategy) Name() string {
+	return DefensiveStrategyName
+}
+
+func (DefensiveStrategy) ShouldStake(nodeGraph *nodegraph.StakedNodeGraph, validNode *structures.Node) bool {
+	return hasConflictingStaker(nodeGraph, validNode)
+}
+
+func (DefensiveStrategy) ShouldAssert(*nodegraph.StakedNodeGraph, *PreparedAssertion) bool {
+	return false
+}
+
+// ChallengeOnlyStrategy keeps a stake on the latest valid node so that it can
+// challenge conflicting stakers but never makes assertions
+type ChallengeOnlyStrategy struct{}
+
+func (ChallengeOnlyStrategy) Name() string {
+	return ChallengeOnlyStrategyName
+}
+
+func (ChallengeOnlyStrategy) ShouldStake(*nodegraph.StakedNodeGraph, *structures.Node) bool {
+	return true
+}
+
+func (ChallengeOnlyStrategy) ShouldAssert(*nodegraph.StakedNodeGraph, *PreparedAssertion) bool {
+	return false
+}
+
+// NonEmptyInboxStrategy behaves like ActiveStrategy except that it only
+// makes assertions which import messages from the inbox, so it doesn't pay
+// for nodes when the chain is idle
+type NonEmptyInboxStrategy struct{}
+
+func (NonEmptyInboxStrategy) Name() string {
+	return NonEmptyInboxStrategyName
+}
+
+func (NonEmptyInboxStrategy) ShouldStake(*nodegraph.StakedNodeGraph, *structures.Node) bool {
+	return true
+}
+
+func (NonEmptyInboxStrategy) ShouldAssert(_ *nodegraph.StakedNodeGraph, prepared *PreparedAssertion) bool {
+	return prepared.Params.ImportedMessageCount.Sign() > 0
+}
+
+// hasConflictingStaker returns true if any staker is on a node which is
+// neither an ancestor nor a descendant of validNode
+func hasConflictingStaker(nodeGraph *nodegraph.StakedNodeGraph, validNode *structures.Node) bool {
+	conflict := false
+	nodeGraph.Stakers().Forall(func(staker *nodegraph.Staker) {
+		location := staker.Location()
+		if structures.GeneratePathProof(location, validNode) == nil &&
+			structures.GeneratePathProof(validNode, location) == nil {
+			conflict = true
+		}
+	})
+	return conflict
+}
@@ -0,0 +1,321 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package chainlistener
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/nodegraph"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// mockMachine only supports what's needed to build a node graph
+type mockMachine struct {
+	machine.Machine
+	hash common.Hash
+}
+
+func (m mockMachine) Hash() common.Hash {
+	return m.hash
+}
+
+func (m mockMachine) Clone() machine.Machine {
+	return m
+}
+
+// mockRollup reports which transactions the listener sends
+type mockRollup struct {
+	arbbridge.ArbRollup
+	calls chan string
+}
+
+func newMockRollup() *mockRollup {
+	return &mockRollup{calls: make(chan string, 10)}
+}
+
+func (r *mockRollup) PlaceStake(context.Context, *big.Int, []common.Hash, []common.Hash) ([]arbbridge.Event, error) {
+	r.calls <- "PlaceStake"
+	return nil, nil
+}
+
+func (r *mockRollup) MakeAssertion(
+	context.Context,
+	common.Hash,
+	common.Hash,
+	common.TimeTicks,
+	valprotocol.ChildType,
+	*valprotocol.VMProtoData,
+	*valprotocol.AssertionParams,
+	*valprotocol.ExecutionAssertionStub,
+	[]common.Hash,
+	*common.BlockId,
+) ([]arbbridge.Event, error) {
+	r.calls <- "MakeAssertion"
+	return nil, nil
+}
+
+func (r *mockRollup) StartChallenge(
+	context.Context,
+	common.Address,
+	common.Address,
+	common.Hash,
+	*big.Int,
+	valprotocol.ChildType,
+	valprotocol.ChildType,
+	common.Hash,
+	common.Hash,
+	[]common.Hash,
+	[]common.Hash,
+	common.Hash,
+	common.Hash,
+	common.TimeTicks,
+) ([]arbbridge.Event, error) {
+	r.calls <- "StartChallenge"
+	return nil, nil
+}
+
+// expect checks that the only transaction sent is call, or that nothing is
+// sent if call is empty
+func (r *mockRollup) expect(t *testing.T, call string) {
+	t.Helper()
+	timeout := time.After(100 * time.Millisecond)
+	if call != "" {
+		select {
+		case got := <-r.calls:
+			if got != call {
+				t.Fatalf("expected %v but got %v", call, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v but nothing was sent", call)
+		}
+	}
+	select {
+	case <-timeout:
+	case got := <-r.calls:
+		t.Fatalf("unexpected %v", got)
+	}
+}
+
+type mockClient struct {
+	arbbridge.ArbAuthClient
+	address common.Address
+}
+
+func (c mockClient) Address() common.Address {
+	return c.address
+}
+
+func (c mockClient) CurrentBlockId(context.Context) (*common.BlockId, error) {
+	return &common.BlockId{Height: common.NewTimeBlocksInt(100)}, nil
+}
+
+type strategyTest struct {
+	graph   *nodegraph.StakedNodeGraph
+	initial *structures.Node
+	valid   *structures.Node
+	invalid *structures.Node
+	me      common.Address
+	other   common.Address
+}
+
+// newStrategyTest builds a graph with a single assertion made on the initial
+// node
+func newStrategyTest() *strategyTest {
+	params := valprotocol.NewRandomChainParams()
+	graph := nodegraph.NewStakedNodeGraph(mockMachine{hash: common.RandHash()}, params)
+	initial := graph.LatestConfirmed()
+	disputable := valprotocol.NewDisputableNode(
+		&valprotocol.AssertionParams{NumSteps: 10, ImportedMessageCount: big.NewInt(0)},
+		&valprotocol.ExecutionAssertionStub{},
+		common.Hash{},
+		big.NewInt(0),
+	)
+	graph.CreateNodesOnAssert(initial, disputable, common.NewTimeBlocksInt(10))
+	return &strategyTest{
+		graph:   graph,
+		initial: initial,
+		valid:   graph.GetSuccessor(initial, valprotocol.ValidChildType),
+		invalid: graph.GetSuccessor(initial, valprotocol.InvalidExecutionChildType),
+		me:      common.RandAddress(),
+		other:   common.RandAddress(),
+	}
+}
+
+func (st *strategyTest) stake(staker common.Address, node *structures.Node) {
+	st.graph.CreateStake(arbbridge.StakeCreatedEvent{
+		ChainInfo: arbbridge.ChainInfo{BlockId: &common.BlockId{Height: common.NewTimeBlocksInt(20)}},
+		Staker:    staker,
+		NodeHash:  node.Hash(),
+	})
+}
+
+func (st *strategyTest) listener(ctx context.Context, strategy StakingStrategy) (*ValidatorChainListener, *mockRollup) {
+	rollup := newMockRollup()
+	lis := NewValidatorChainListener(ctx, common.RandAddress(), rollup, ValidatorConfig{
+		PlaceStakes:        true,
+		StakeRetryBlocks:   3,
+		InitiateChallenges: true,
+		Strategy:           strategy,
+	})
+	lis.stakingKeys[st.me] = &StakingKey{
+		client:   mockClient{address: st.me},
+		contract: rollup,
+	}
+	return lis, rollup
+}
+
+func (st *strategyTest) prepared(importedCount int64) *PreparedAssertion {
+	return &PreparedAssertion{
+		Prev:        st.valid,
+		BeforeState: st.valid.VMProtoData(),
+		Params: &valprotocol.AssertionParams{
+			NumSteps:             10,
+			ImportedMessageCount: big.NewInt(importedCount),
+		},
+		AssertionStub: &valprotocol.ExecutionAssertionStub{},
+		ValidBlock:    &common.BlockId{Height: common.NewTimeBlocksInt(100)},
+	}
+}
+
+func TestNewStakingStrategy(t *testing.T) {
+	for _, name := range []string{
+		ActiveStrategyName,
+		DefensiveStrategyName,
+		ChallengeOnlyStrategyName,
+		NonEmptyInboxStrategyName,
+	} {
+		strategy, err := NewStakingStrategy(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strategy.Name() != name {
+			t.Errorf("expected %v strategy but got %v", name, strategy.Name())
+		}
+	}
+	if _, err := NewStakingStrategy("lazy"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
+
+func TestValidatorConfigValidate(t *testing.T) {
+	tests := []struct {
+		strategy StakingStrategy
+		initiate bool
+		valid    bool
+	}{
+		{nil, false, true},
+		{ActiveStrategy{}, false, true},
+		{NonEmptyInboxStrategy{}, false, true},
+		{DefensiveStrategy{}, false, false},
+		{ChallengeOnlyStrategy{}, false, false},
+		{DefensiveStrategy{}, true, true},
+		{ChallengeOnlyStrategy{}, true, true},
+	}
+	for _, test := range tests {
+		config := DefaultValidatorConfig
+		config.Strategy = test.strategy
+		config.InitiateChallenges = test.initiate
+		if err := config.Validate(); (err == nil) != test.valid {
+			t.Errorf("%v strategy with challenges initiated %v gave error %v", config.strategy().Name(), test.initiate, err)
+		}
+	}
+}
+
+func TestStrategyStaking(t *testing.T) {
+	tests := []struct {
+		strategy StakingStrategy
+		conflict bool
+		expected string
+	}{
+		{ActiveStrategy{}, false, "PlaceStake"},
+		{ChallengeOnlyStrategy{}, false, "PlaceStake"},
+		{NonEmptyInboxStrategy{}, false, "PlaceStake"},
+		{DefensiveStrategy{}, false, ""},
+		{DefensiveStrategy{}, true, "PlaceStake"},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		st := newStrategyTest()
+		if test.conflict {
+			st.stake(st.other, st.invalid)
+		} else {
+			st.stake(st.other, st.valid)
+		}
+		lis, rollup := st.listener(ctx, test.strategy)
+		lis.AssertionPrepared(ctx, st.graph.Params(), st.graph, st.valid, st.prepared(1))
+		rollup.expect(t, test.expected)
+		cancel()
+	}
+}
+
+func TestStrategyAsserting(t *testing.T) {
+	tests := []struct {
+		strategy      StakingStrategy
+		importedCount int64
+		expected      string
+	}{
+		{ActiveStrategy{}, 0, "MakeAssertion"},
+		{ActiveStrategy{}, 1, "MakeAssertion"},
+		{NonEmptyInboxStrategy{}, 0, ""},
+		{NonEmptyInboxStrategy{}, 1, "MakeAssertion"},
+		{ChallengeOnlyStrategy{}, 1, ""},
+		{DefensiveStrategy{}, 1, ""},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		st := newStrategyTest()
+		st.stake(st.me, st.initial)
+		lis, rollup := st.listener(ctx, test.strategy)
+		lis.AssertionPrepared(ctx, st.graph.Params(), st.graph, st.valid, st.prepared(test.importedCount))
+		rollup.expect(t, test.expected)
+		cancel()
+	}
+}
+
+// TestStrategyChallenging checks that conflicting stakers are challenged
+// whatever the strategy, and only InitiateChallenges turns that off
+func TestStrategyChallenging(t *testing.T) {
+	for _, initiate := range []bool{true, false} {
+		for _, strategy := range []StakingStrategy{
+			ActiveStrategy{},
+			DefensiveStrategy{},
+			ChallengeOnlyStrategy{},
+			NonEmptyInboxStrategy{},
+		} {
+			ctx, cancel := context.WithCancel(context.Background())
+			st := newStrategyTest()
+			st.stake(st.me, st.valid)
+			st.stake(st.other, st.invalid)
+			lis, rollup := st.listener(ctx, strategy)
+			lis.config.InitiateChallenges = initiate
+			lis.StakeCreated(ctx, st.graph, arbbridge.StakeCreatedEvent{Staker: st.other, NodeHash: st.invalid.Hash()})
+			if initiate {
+				rollup.expect(t, "StartChallenge")
+			} else {
+				rollup.expect(t, "")
+			}
+			cancel()
+		}
+	}
+}
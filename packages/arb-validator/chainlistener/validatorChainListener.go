@@ -18,6 +18,7 @@ package chainlistener
 
 import (
 	"context"
+	"fmt"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
@@ -40,8 +41,54 @@ type StakingKey struct {
 	contract arbbridge.ArbRollup
 }
 
+// ValidatorConfig controls which actions the validator takes on its own
+// initiative
+type ValidatorConfig struct {
+	// PlaceStakes lets the validator put down a stake so that it can make
+	// assertions
+	PlaceStakes bool
+	// StakeRetryBlocks is how many blocks to wait for a stake to show up
+	// before placing it again
+	StakeRetryBlocks int64
+	// InitiateChallenges lets the validator challenge stakers who disagree
+	// with it. Challenges started by others are always defended
+	InitiateChallenges bool
+	// Strategy decides when to stake, assert and challenge within the limits
+	// set above. ActiveStrategy is used if it's nil
+	Strategy StakingStrategy
+}
+
+var DefaultValidatorConfig = ValidatorConfig{
+	PlaceStakes:        true,
+	StakeRetryBlocks:   3,
+	InitiateChallenges: true,
+	Strategy:           ActiveStrategy{},
+}
+
+func (c ValidatorConfig) strategy() StakingStrategy {
+	if c.Strategy == nil {
+		return ActiveStrategy{}
+	}
+	return c.Strategy
+}
+
+// Validate returns an error if the strategy contradicts the limits set on it.
+// Strategies which never assert only stake in order to challenge, so they
+// can't be used with InitiateChallenges unset
+func (c ValidatorConfig) Validate() error {
+	if c.InitiateChallenges {
+		return nil
+	}
+	switch name := c.strategy().Name(); name {
+	case DefensiveStrategyName, ChallengeOnlyStrategyName:
+		return fmt.Errorf("the %v strategy only stakes in order to challenge so it requires challenges to be initiated", name)
+	}
+	return nil
+}
+
 type ValidatorChainListener struct {
 	sync.Mutex
+	config                 ValidatorConfig
 	actor                  arbbridge.ArbRollup
 	rollupAddress          common.Address
 	stakingKeys            map[common.Address]*StakingKey
@@ -56,8 +103,10 @@ func NewValidatorChainListener(
 	ctx context.Context,
 	rollupAddress common.Address,
 	actor arbbridge.ArbRollup,
+	config ValidatorConfig,
 ) *ValidatorChainListener {
 	ret := &ValidatorChainListener{
+		config:        config,
 		actor:         actor,
 		rollupAddress: rollupAddress,
 		stakingKeys:   make(map[common.Address]*StakingKey),
@@ -80,6 +129,10 @@ func NewValidatorChainListener(
 	return ret
 }
 
+func (lis *ValidatorChainListener) strategy() StakingStrategy {
+	return lis.config.strategy()
+}
+
 func (lis *ValidatorChainListener) resetBroadcastCache() {
 	lis.broadcastAssertions = make(map[common.Hash]*valprotocol.AssertionParams)
 	lis.broadcastConfirmations = make(map[common.Hash]bool)
@@ -170,6 +223,9 @@ func (lis *ValidatorChainListener) AssertionPrepared(
 			// staker can't move to new asertion
 			continue
 		}
+		if !lis.strategy().ShouldAssert(nodeGraph, prepared) {
+			return
+		}
 		lis.Lock()
 		lis.broadcastAssertions[prepared.Prev.Hash()] = prepared.Params
 		lis.Unlock()
@@ -188,7 +244,11 @@ func (lis *ValidatorChainListener) AssertionPrepared(
 		return
 	}
 
+	if !lis.config.PlaceStakes || !lis.strategy().ShouldStake(nodeGraph, nodeLocation) {
+		return
+	}
 	log.Println("Maybe putting down stake")
+	retryBlocks := big.NewInt(lis.config.StakeRetryBlocks)
 	for stakingAddress, stakingKey := range lis.stakingKeys {
 		stakerPos := nodeGraph.Stakers().Get(stakingAddress)
 		if stakerPos != nil {
@@ -203,9 +263,9 @@ func (lis *ValidatorChainListener) AssertionPrepared(
 		}
 		stakeTime, placedStake := lis.broadcastCreateStakes[stakingAddress]
 		if placedStake {
-			log.Println("Thinking about placing stake", currentTime.Height.AsInt(), new(big.Int).Add(stakeTime.AsInt(), big.NewInt(3)))
+			log.Println("Thinking about placing stake", currentTime.Height.AsInt(), new(big.Int).Add(stakeTime.AsInt(), retryBlocks))
 		}
-		if !placedStake || currentTime.Height.AsInt().Cmp(new(big.Int).Add(stakeTime.AsInt(), big.NewInt(3))) >= 0 {
+		if !placedStake || currentTime.Height.AsInt().Cmp(new(big.Int).Add(stakeTime.AsInt(), retryBlocks)) >= 0 {
 			lis.broadcastCreateStakes[stakingAddress] = currentTime.Height
 			log.Println("No stake is currently down, so setting up a stake")
 			lis.Unlock()
@@ -239,12 +299,12 @@ func (lis *ValidatorChainListener) StakeCreated(
 		}
 		opp := nodeGraph.CheckChallengeOpportunityAny(staker)
 		if opp != nil {
-			InitiateChallenge(ctx, lis.actor, opp)
+			lis.initiateChallenge(ctx, opp)
 		}
 	} else {
 		opp := lis.challengeStakerIfPossible(ctx, nodeGraph, ev.Staker)
 		if opp != nil {
-			InitiateChallenge(ctx, lis.actor, opp)
+			lis.initiateChallenge(ctx, opp)
 		}
 	}
 }
@@ -257,8 +317,21 @@ func (lis *ValidatorChainListener) StakeMoved(
 	opp := lis.challengeStakerIfPossible(ctx, nodeGraph, ev.Staker)
 
 	if opp != nil {
-		InitiateChallenge(ctx, lis.actor, opp)
+		lis.initiateChallenge(ctx, opp)
+	}
+}
+
+// initiateChallenge challenges the opportunity unless challenges are disabled
+// in which case it does nothing
+func (lis *ValidatorChainListener) initiateChallenge(
+	ctx context.Context,
+	opp *nodegraph.ChallengeOpportunity,
+) ([]arbbridge.Event, error) {
+	if !lis.config.InitiateChallenges {
+		log.Println("Not initiating challenge since challenges are disabled")
+		return nil, nil
 	}
+	return InitiateChallenge(ctx, lis.actor, opp)
 }
 
 func (lis *ValidatorChainListener) challengeStakerIfPossible(
@@ -354,6 +427,7 @@ func (lis *ValidatorChainListener) launchChallenge(
 					chal.ConflictNode().Disputable().AssertionParams.NumSteps,
 					50,
 					challenges.StandardExecutionChallenge(),
+					chal.DefenderProgress(),
 				)
 				if err != nil {
 					log.Println("Failed defending execution claim", err)
@@ -400,6 +474,7 @@ func (lis *ValidatorChainListener) launchChallenge(
 					chal.ConflictNode().VMProtoData().InboxTop,
 					false,
 					challenges.StandardExecutionChallenge(),
+					chal.ChallengerProgress(),
 				)
 				if err != nil {
 					log.Println("Failed challenging execution claim", err)
@@ -429,7 +504,7 @@ func (lis *ValidatorChainListener) CompletedChallenge(
 	}
 	opp := lis.challengeStakerIfPossible(ctx, nodeGraph, ev.Winner)
 	if opp != nil {
-		_, err := InitiateChallenge(ctx, lis.actor, opp)
+		_, err := lis.initiateChallenge(ctx, opp)
 		LogChallengeResult(err)
 	}
 }
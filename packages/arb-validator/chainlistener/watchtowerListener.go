@@ -0,0 +1,261 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package chainlistener
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/nodegraph"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+var (
+	assertionsCheckedCounter = arbmetrics.NewCounter("arb/watchtower/assertions/checked")
+	invalidAssertionsCounter = arbmetrics.NewCounter("arb/watchtower/assertions/invalid")
+	alertsCounter            = arbmetrics.NewCounter("arb/watchtower/alerts")
+)
+
+// DefaultAlertBlocks is how close to its deadline an invalid node must be
+// before a WatchtowerListener raises an alert
+const DefaultAlertBlocks = 20
+
+type invalidNode struct {
+	prev      common.Hash
+	validNode common.Hash
+	reason    valprotocol.ChildType
+	deadline  common.TimeTicks
+	stakers   uint64
+	// reported is set once InvalidNodeAlerters were told about the node
+	reported bool
+	alerted  bool
+}
+
+// WatchtowerListener follows a chain without a stake. It checks every
+// assertion against the chain observer's own execution and notifies its
+// alerters when an invalid node nears its deadline, since that node will be
+// confirmed unless someone challenges its stakers. Alerters which implement
+// InvalidNodeAlerter are also told as soon as an invalid node is found
+type WatchtowerListener struct {
+	NoopListener
+
+	sync.Mutex
+	client      arbbridge.ChainTimeGetter
+	alertBlocks int64
+	alerters    []Alerter
+	// invalidNodes holds the invalid nodes which are still in the graph,
+	// indexed by their hash
+	invalidNodes map[common.Hash]*invalidNode
+}
+
+// NewWatchtowerListener creates a listener which alerts once an invalid node
+// is within alertBlocks of its deadline. It runs until ctx is cancelled
+func NewWatchtowerListener(
+	ctx context.Context,
+	client arbbridge.ChainTimeGetter,
+	alertBlocks int64,
+	alerters []Alerter,
+) *WatchtowerListener {
+	lis := &WatchtowerListener{
+		client:       client,
+		alertBlocks:  alertBlocks,
+		alerters:     alerters,
+		invalidNodes: make(map[common.Hash]*invalidNode),
+	}
+	go func() {
+		ticker := time.NewTicker(common.NewTimeBlocksInt(1).Duration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := lis.checkDeadlines(ctx); err != nil {
+					log.Println("Error checking invalid node deadlines", err)
+				}
+			}
+		}
+	}()
+	return lis
+}
+
+func (lis *WatchtowerListener) RestartingFromLatestValid(context.Context, *structures.Node) {
+	// Opinions are formed again for every node after the latest valid one
+	lis.Lock()
+	lis.invalidNodes = make(map[common.Hash]*invalidNode)
+	lis.Unlock()
+}
+
+func (lis *WatchtowerListener) SawAssertion(_ context.Context, ev arbbridge.AssertedEvent) {
+	log.Println("Watchtower saw assertion on top of", ev.PrevLeafHash.ShortString())
+}
+
+// AdvancedKnownNode is called once the chain observer has executed the
+// assertion made on top of node's predecessor. The assertion is invalid
+// unless node is its valid child
+func (lis *WatchtowerListener) AdvancedKnownNode(
+	ctx context.Context,
+	nodeGraph *nodegraph.StakedNodeGraph,
+	node *structures.Node,
+) {
+	assertionsCheckedCounter.Inc(1)
+	if node.LinkType() == valprotocol.ValidChildType {
+		log.Println("Watchtower verified assertion", node.Hash().ShortString())
+		return
+	}
+	asserted := nodeGraph.GetSuccessor(node.Prev(), valprotocol.ValidChildType)
+	if asserted == nil {
+		return
+	}
+	invalidAssertionsCounter.Inc(1)
+	log.Println("Watchtower found invalid assertion", asserted.Hash().ShortString(), "("+invalidReason(node.LinkType())+")")
+	lis.Lock()
+	lis.invalidNodes[asserted.Hash()] = &invalidNode{
+		prev:      node.PrevHash(),
+		validNode: node.Hash(),
+		reason:    node.LinkType(),
+		deadline:  asserted.Deadline(),
+		stakers:   asserted.NumStakers(),
+	}
+	lis.Unlock()
+	// Report the node right away rather than on the next tick. If this
+	// fails it's retried on the next tick
+	if err := lis.checkDeadlines(ctx); err != nil {
+		log.Println("Error checking invalid node deadlines", err)
+	}
+}
+
+func (lis *WatchtowerListener) StakeCreated(_ context.Context, nodeGraph *nodegraph.StakedNodeGraph, _ arbbridge.StakeCreatedEvent) {
+	lis.updateStakers(nodeGraph)
+}
+
+func (lis *WatchtowerListener) StakeMoved(_ context.Context, nodeGraph *nodegraph.StakedNodeGraph, _ arbbridge.StakeMovedEvent) {
+	lis.updateStakers(nodeGraph)
+}
+
+func (lis *WatchtowerListener) updateStakers(nodeGraph *nodegraph.StakedNodeGraph) {
+	lis.Lock()
+	defer lis.Unlock()
+	for hash, invalid := range lis.invalidNodes {
+		if node := nodeGraph.NodeFromHash(hash); node != nil {
+			invalid.stakers = node.NumStakers()
+		}
+	}
+}
+
+func (lis *WatchtowerListener) PrunedLeaf(_ context.Context, ev arbbridge.PrunedEvent) {
+	lis.Lock()
+	defer lis.Unlock()
+	if _, ok := lis.invalidNodes[ev.Leaf]; ok {
+		log.Println("Invalid node", ev.Leaf.ShortString(), "was pruned")
+		delete(lis.invalidNodes, ev.Leaf)
+	}
+}
+
+func (lis *WatchtowerListener) ConfirmedNode(ctx context.Context, ev arbbridge.ConfirmedEvent) {
+	lis.Lock()
+	var confirmedInvalid *Alert
+	for hash, invalid := range lis.invalidNodes {
+		if hash == ev.NodeHash {
+			alert := invalid.alert(hash, 0)
+			alert.Confirmed = true
+			confirmedInvalid = &alert
+			delete(lis.invalidNodes, hash)
+		} else if invalid.validNode == ev.NodeHash {
+			// The invalid sibling can't be confirmed anymore
+			delete(lis.invalidNodes, hash)
+		}
+	}
+	lis.Unlock()
+	if confirmedInvalid != nil {
+		lis.raise(ctx, *confirmedInvalid)
+	}
+}
+
+func (lis *WatchtowerListener) checkDeadlines(ctx context.Context) error {
+	blockId, err := lis.client.CurrentBlockId(ctx)
+	if err != nil {
+		return err
+	}
+	now := common.TicksFromBlockNum(blockId.Height)
+	var found []Alert
+	var alerts []Alert
+	lis.Lock()
+	for hash, invalid := range lis.invalidNodes {
+		ticksLeft := new(big.Int).Sub(invalid.deadline.Val, now.Val)
+		blocksLeft := new(big.Int).Div(ticksLeft, big.NewInt(common.TicksPerBlock)).Int64()
+		if !invalid.reported {
+			invalid.reported = true
+			found = append(found, invalid.alert(hash, blocksLeft))
+		}
+		if invalid.alerted || blocksLeft > lis.alertBlocks {
+			continue
+		}
+		invalid.alerted = true
+		alerts = append(alerts, invalid.alert(hash, blocksLeft))
+	}
+	lis.Unlock()
+	for _, alert := range found {
+		for _, alerter := range lis.alerters {
+			if alerter, ok := alerter.(InvalidNodeAlerter); ok {
+				alerter.InvalidNodeFound(ctx, alert)
+			}
+		}
+	}
+	for _, alert := range alerts {
+		lis.raise(ctx, alert)
+	}
+	return nil
+}
+
+func (lis *WatchtowerListener) raise(ctx context.Context, alert Alert) {
+	alertsCounter.Inc(1)
+	for _, alerter := range lis.alerters {
+		alerter.Alert(ctx, alert)
+	}
+}
+
+func (n *invalidNode) alert(hash common.Hash, blocksLeft int64) Alert {
+	return Alert{
+		Node:       hash.ToEthHash(),
+		Prev:       n.prev.ToEthHash(),
+		ValidNode:  n.validNode.ToEthHash(),
+		Reason:     invalidReason(n.reason),
+		BlocksLeft: blocksLeft,
+		Stakers:    n.stakers,
+	}
+}
+
+// invalidReason describes why an assertion is invalid given the child type
+// of its valid sibling
+func invalidReason(linkType valprotocol.ChildType) string {
+	switch linkType {
+	case valprotocol.InvalidInboxTopChildType:
+		return "invalid inbox top"
+	case valprotocol.InvalidExecutionChildType:
+		return "invalid execution"
+	default:
+		return "valid"
+	}
+}
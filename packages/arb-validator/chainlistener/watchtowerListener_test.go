@@ -0,0 +1,172 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package chainlistener
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+)
+
+// recordingAlerter records the alerts raised and the invalid nodes found
+type recordingAlerter struct {
+	alerts []Alert
+	found  []Alert
+}
+
+func (a *recordingAlerter) Alert(_ context.Context, alert Alert) {
+	a.alerts = append(a.alerts, alert)
+}
+
+func (a *recordingAlerter) InvalidNodeFound(_ context.Context, alert Alert) {
+	a.found = append(a.found, alert)
+}
+
+// plainAlerter only counts alerts
+type plainAlerter struct {
+	alerts int
+}
+
+func (a *plainAlerter) Alert(context.Context, Alert) {
+	a.alerts++
+}
+
+// newTestWatchtower returns a listener without the goroutine checking
+// deadlines so that tests check them explicitly. The current block is 100
+func newTestWatchtower(alertBlocks int64) (*WatchtowerListener, *recordingAlerter, *plainAlerter) {
+	recorder := &recordingAlerter{}
+	plain := &plainAlerter{}
+	lis := &WatchtowerListener{
+		client:       mockClient{},
+		alertBlocks:  alertBlocks,
+		alerters:     []Alerter{recorder, plain},
+		invalidNodes: make(map[common.Hash]*invalidNode),
+	}
+	return lis, recorder, plain
+}
+
+// blocksLeft is how many blocks remain until the deadline of the node
+// asserted in st at the mock client's current block
+func (st *strategyTest) blocksLeft() int64 {
+	ticksLeft := new(big.Int).Sub(st.valid.Deadline().Val, common.TicksFromBlockNum(common.NewTimeBlocksInt(100)).Val)
+	return new(big.Int).Div(ticksLeft, big.NewInt(common.TicksPerBlock)).Int64()
+}
+
+func TestWatchtowerReportsInvalidNodeImmediately(t *testing.T) {
+	ctx := context.Background()
+	st := newStrategyTest()
+	// The assertion claimed st.valid is valid, but execution reached the
+	// invalid execution child
+	lis, recorder, plain := newTestWatchtower(st.blocksLeft() - 1)
+	lis.AdvancedKnownNode(ctx, st.graph, st.invalid)
+
+	if len(recorder.found) != 1 {
+		t.Fatal("invalid node wasn't reported when found", len(recorder.found))
+	}
+	found := recorder.found[0]
+	if found.Node != st.valid.Hash().ToEthHash() ||
+		found.ValidNode != st.invalid.Hash().ToEthHash() ||
+		found.Reason != "invalid execution" ||
+		found.BlocksLeft != st.blocksLeft() {
+		t.Errorf("wrong report %+v", found)
+	}
+	if len(recorder.alerts) != 0 || plain.alerts != 0 {
+		t.Error("alert raised before the node neared its deadline")
+	}
+
+	// Later checks don't report the node again
+	if err := lis.checkDeadlines(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.found) != 1 {
+		t.Error("invalid node was reported again")
+	}
+}
+
+func TestWatchtowerValidNode(t *testing.T) {
+	ctx := context.Background()
+	st := newStrategyTest()
+	lis, recorder, plain := newTestWatchtower(1 << 40)
+	lis.AdvancedKnownNode(ctx, st.graph, st.valid)
+	if len(recorder.found) != 0 || len(recorder.alerts) != 0 || plain.alerts != 0 {
+		t.Error("valid node was reported")
+	}
+}
+
+func TestWatchtowerAlertsNearDeadline(t *testing.T) {
+	ctx := context.Background()
+	st := newStrategyTest()
+	lis, recorder, plain := newTestWatchtower(st.blocksLeft() - 1)
+	lis.AdvancedKnownNode(ctx, st.graph, st.invalid)
+	if len(recorder.alerts) != 0 {
+		t.Fatal("alert raised too early")
+	}
+
+	// The chain moves on until the node is within alertBlocks
+	lis.alertBlocks = st.blocksLeft()
+	if err := lis.checkDeadlines(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.alerts) != 1 || plain.alerts != 1 {
+		t.Fatal("alert wasn't raised to every alerter", len(recorder.alerts), plain.alerts)
+	}
+	alert := recorder.alerts[0]
+	if alert.Node != st.valid.Hash().ToEthHash() || alert.BlocksLeft != st.blocksLeft() || alert.Confirmed {
+		t.Errorf("wrong alert %+v", alert)
+	}
+	if err := lis.checkDeadlines(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.alerts) != 1 {
+		t.Error("alert raised twice")
+	}
+
+	lis.ConfirmedNode(ctx, arbbridge.ConfirmedEvent{NodeHash: st.valid.Hash()})
+	if len(recorder.alerts) != 2 || !recorder.alerts[1].Confirmed {
+		t.Fatal("confirmation of invalid node wasn't alerted")
+	}
+	if len(lis.invalidNodes) != 0 {
+		t.Error("confirmed node is still watched")
+	}
+}
+
+func TestWatchtowerForgetsResolvedNodes(t *testing.T) {
+	ctx := context.Background()
+	for _, resolve := range []func(*WatchtowerListener, *strategyTest){
+		func(lis *WatchtowerListener, st *strategyTest) {
+			lis.PrunedLeaf(ctx, arbbridge.PrunedEvent{Leaf: st.valid.Hash()})
+		},
+		func(lis *WatchtowerListener, st *strategyTest) {
+			lis.ConfirmedNode(ctx, arbbridge.ConfirmedEvent{NodeHash: st.invalid.Hash()})
+		},
+	} {
+		st := newStrategyTest()
+		lis, recorder, _ := newTestWatchtower(st.blocksLeft() - 1)
+		lis.AdvancedKnownNode(ctx, st.graph, st.invalid)
+		resolve(lis, st)
+		lis.alertBlocks = st.blocksLeft()
+		if err := lis.checkDeadlines(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(recorder.alerts) != 0 {
+			t.Error("alert raised for resolved node", recorder.alerts)
+		}
+	}
+}
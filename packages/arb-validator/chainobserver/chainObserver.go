@@ -30,6 +30,7 @@ import (
 
 	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/checkpointing"
 	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
@@ -40,6 +41,14 @@ import (
 
 //go:generate protoc -I. -I ../.. --go_out=paths=source_relative:. chainobserver.proto
 
+var (
+	headLagGauge               = arbmetrics.NewGauge("arb/chainobserver/headlag")
+	stakesCreatedCounter       = arbmetrics.NewCounter("arb/chainobserver/stakes/created")
+	challengesStartedCounter   = arbmetrics.NewCounter("arb/chainobserver/challenges/started")
+	challengesCompletedCounter = arbmetrics.NewCounter("arb/chainobserver/challenges/completed")
+	nodesConfirmedCounter      = arbmetrics.NewCounter("arb/chainobserver/nodes/confirmed")
+)
+
 type ChainObserver struct {
 	sync.RWMutex
 	NodeGraph           *nodegraph.StakedNodeGraph
@@ -56,6 +65,10 @@ type ChainObserver struct {
 	checkpointer      checkpointing.RollupCheckpointer
 	isOpinionated     bool
 	atHead            bool
+	// latestCounted is the latest event which was counted in the metrics
+	// above. Observers restored from a checkpoint replay the events after
+	// it, and those must not be counted again
+	latestCounted arbbridge.ChainInfo
 }
 
 func tryRestoreFromCheckpoint(
@@ -333,14 +346,24 @@ func (chain *ChainObserver) DebugString(prefix string) string {
 func (chain *ChainObserver) HandleNotification(ctx context.Context, event arbbridge.Event) error {
 	chain.Lock()
 	defer chain.Unlock()
+	newEvent := chain.countEvent(event)
 	switch ev := event.(type) {
 	case arbbridge.MessageDeliveredEvent:
 		return chain.messageDelivered(ctx, ev)
 	case arbbridge.StakeCreatedEvent:
+		if newEvent {
+			stakesCreatedCounter.Inc(1)
+		}
 		chain.createStake(ctx, ev)
 	case arbbridge.ChallengeStartedEvent:
+		if newEvent {
+			challengesStartedCounter.Inc(1)
+		}
 		chain.newChallenge(ctx, ev)
 	case arbbridge.ChallengeCompletedEvent:
+		if newEvent {
+			challengesCompletedCounter.Inc(1)
+		}
 		chain.challengeResolved(ctx, ev)
 	case arbbridge.StakeRefundedEvent:
 		chain.removeStake(ctx, ev)
@@ -351,11 +374,39 @@ func (chain *ChainObserver) HandleNotification(ctx context.Context, event arbbri
 	case arbbridge.AssertedEvent:
 		chain.notifyAssert(ctx, ev)
 	case arbbridge.ConfirmedEvent:
+		if newEvent {
+			nodesConfirmedCounter.Inc(1)
+		}
 		return chain.confirmNode(ctx, ev)
 	}
 	return nil
 }
 
+// countEvent returns true if event is newer than every event which has
+// already been counted and records it as counted
+func (chain *ChainObserver) countEvent(event arbbridge.Event) bool {
+	info := event.GetChainInfo()
+	if info.BlockId == nil {
+		return true
+	}
+	if chain.latestCounted.BlockId != nil && info.Cmp(chain.latestCounted) <= 0 {
+		return false
+	}
+	chain.latestCounted = info
+	return true
+}
+
+// ContinueCountingFrom makes chain skip the events which prev has already
+// counted. It's used when chain replaces prev after a reorg
+func (chain *ChainObserver) ContinueCountingFrom(prev *ChainObserver) {
+	prev.RLock()
+	latestCounted := prev.latestCounted
+	prev.RUnlock()
+	chain.Lock()
+	defer chain.Unlock()
+	chain.latestCounted = latestCounted
+}
+
 func (chain *ChainObserver) UpdateAssumedValidBlock(ctx context.Context, clnt arbbridge.ChainTimeGetter, assumedValidDepth int64) error {
 	latestL1BlockId, err := clnt.CurrentBlockId(ctx)
 	if err != nil {
@@ -374,6 +425,8 @@ func (chain *ChainObserver) UpdateAssumedValidBlock(ctx context.Context, clnt ar
 	chain.Lock()
 	defer chain.Unlock()
 	chain.assumedValidBlock = assumedValidBlock
+	headLag := new(big.Int).Sub(latestL1BlockId.Height.AsInt(), chain.currentEventId.BlockId.Height.AsInt())
+	headLagGauge.Update(headLag.Int64())
 	return nil
 }
 
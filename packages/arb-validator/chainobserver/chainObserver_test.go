@@ -209,3 +209,36 @@ func createOneStaker(chain *ChainObserver, stakerAddr common.Address, nodeHash c
 		NodeHash: nodeHash,
 	})
 }
+
+func TestReplayedEventsNotCounted(t *testing.T) {
+	event := func(height int64, logIndex uint) arbbridge.Event {
+		return arbbridge.StakeCreatedEvent{
+			ChainInfo: arbbridge.ChainInfo{
+				BlockId:  &common.BlockId{Height: common.NewTimeBlocks(big.NewInt(height))},
+				LogIndex: logIndex,
+			},
+		}
+	}
+
+	chain := &ChainObserver{}
+	otherChain := &ChainObserver{}
+	if !chain.countEvent(event(10, 0)) {
+		t.Error("first event wasn't counted")
+	}
+	if !chain.countEvent(event(10, 1)) {
+		t.Error("later event in same block wasn't counted")
+	}
+	if !otherChain.countEvent(event(10, 0)) {
+		t.Error("event seen by another observer wasn't counted")
+	}
+
+	// Restoring from a checkpoint replays these events
+	restored := &ChainObserver{}
+	restored.ContinueCountingFrom(chain)
+	if restored.countEvent(event(10, 0)) || restored.countEvent(event(10, 1)) {
+		t.Error("replayed event was counted")
+	}
+	if !restored.countEvent(event(11, 0)) {
+		t.Error("event after restored height wasn't counted")
+	}
+}
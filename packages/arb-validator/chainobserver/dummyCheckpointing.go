@@ -57,6 +57,10 @@ func (dcp *DummyCheckpointer) RestoreLatestState(context.Context, arbbridge.Chai
 	return errors.New("no checkpoints in database")
 }
 
+func (dcp *DummyCheckpointer) RestoreStateAtOrBefore(context.Context, arbbridge.ChainTimeGetter, *common.TimeBlocks, func([]byte, ckptcontext.RestoreContext, *common.BlockId) error) error {
+	return errors.New("no checkpoints in database")
+}
+
 func (dcp *DummyCheckpointer) GetInitialMachine() (machine.Machine, error) {
 	return dcp.initialMachine.Clone(), nil
 }
@@ -68,3 +72,5 @@ func (dcp *DummyCheckpointer) AsyncSaveCheckpoint(_ *common.BlockId, _ []byte, _
 func (dcp DummyCheckpointer) MaxReorgHeight() *big.Int {
 	return big.NewInt(100)
 }
+
+func (dcp *DummyCheckpointer) Close() {}
@@ -59,6 +59,7 @@ func testExecutionChallenge(
 				numSteps,
 				4,
 				StandardExecutionChallenge(),
+				NewExecutionProgress(),
 			)
 		},
 		func(challengeAddress common.Address, client *ethbridge.EthArbAuthClient, blockId *common.BlockId) (ChallengeState, error) {
@@ -78,6 +79,7 @@ func testExecutionChallenge(
 					2,
 					0,
 				},
+				NewExecutionProgress(),
 			)
 		},
 		func(challengeAddress common.Address, client *ethbridge.EthArbAuthClient, blockId *common.BlockId) (ChallengeState, error) {
@@ -93,6 +95,7 @@ func testExecutionChallenge(
 				assertion.BeforeInboxHash,
 				true,
 				StandardExecutionChallenge(),
+				NewExecutionProgress(),
 			)
 		},
 		func(challengeAddress common.Address, client *ethbridge.EthArbAuthClient, blockId *common.BlockId) (ChallengeState, error) {
@@ -112,6 +115,7 @@ func testExecutionChallenge(
 					2,
 					0,
 				},
+				NewExecutionProgress(),
 			)
 		},
 		testerAddress,
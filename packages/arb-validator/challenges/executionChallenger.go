@@ -42,6 +42,7 @@ func ChallengeExecutionClaim(
 	beforeInboxHash common.Hash,
 	challengeEverything bool,
 	challengeType ExecutionChallengeInfo,
+	progress *ExecutionProgress,
 ) (ChallengeState, error) {
 	contractWatcher, err := client.NewExecutionChallengeWatcher(address)
 	if err != nil {
@@ -60,20 +61,21 @@ func ChallengeExecutionClaim(
 		log.Fatal("before inbox hash must be valid")
 	}
 
-	assertion, _ := startMachine.Clone().ExecuteAssertion(numSteps, messages, 0)
-	stub := structures.NewExecutionAssertionStubFromWholeAssertion(assertion, beforeInboxHash, inboxStack)
-
 	return challengeExecution(
 		reorgCtx,
 		eventChan,
 		contract,
 		client,
-		NewAssertionDefender(
-			numSteps,
-			startMachine,
-			inboxStack,
-			stub,
-		),
+		newSegmentTracker(progress, inboxStack, numSteps, func() AssertionDefender {
+			assertion, _ := startMachine.Clone().ExecuteAssertion(numSteps, messages, 0)
+			stub := structures.NewExecutionAssertionStubFromWholeAssertion(assertion, beforeInboxHash, inboxStack)
+			return NewAssertionDefender(
+				numSteps,
+				startMachine,
+				inboxStack,
+				stub,
+			)
+		}),
 		challengeEverything,
 		challengeType,
 	)
@@ -84,7 +86,7 @@ func challengeExecution(
 	eventChan <-chan arbbridge.Event,
 	contract arbbridge.ExecutionChallenge,
 	client arbbridge.ArbClient,
-	defender AssertionDefender,
+	tracker *segmentTracker,
 	challengeEverything bool,
 	challengeType ExecutionChallengeInfo,
 ) (ChallengeState, error) {
@@ -133,9 +135,11 @@ func challengeExecution(
 
 		chooseSegment, event, state, err := getNextEventIfExists(ctx, eventChan, replayTimeout)
 
+		var chosen *AssertionDefender
 		if chooseSegment {
-			var challengedAssertionNum int
-			challengedAssertionNum, defender, err = chooseDefender(defender, bisectionEvent, challengeEverything)
+			var challengedAssertionNum uint64
+			var defender AssertionDefender
+			challengedAssertionNum, defender, err = tracker.choose(bisectionEvent, challengeEverything)
 			if err != nil {
 				return state, err
 			}
@@ -146,6 +150,7 @@ func challengeExecution(
 			); err != nil {
 				return state, err
 			}
+			chosen = &defender
 			event, state, err = getNextEvent(eventChan)
 		}
 
@@ -159,10 +164,7 @@ func challengeExecution(
 		}
 
 		// Update mach, precondition, deadline
-		if !chooseSegment {
-			// Replayed from existing event
-			defender = defender.MoveDefender(bisectionEvent, continueEvent)
-		}
+		tracker.moved(bisectionEvent, continueEvent, chosen)
 		deadline = continueEvent.Deadline
 	}
 }
@@ -40,6 +40,7 @@ func DefendExecutionClaim(
 	numSteps uint64,
 	bisectionCount uint32,
 	challengeType ExecutionChallengeInfo,
+	progress *ExecutionProgress,
 ) (ChallengeState, error) {
 	contractWatcher, err := client.NewExecutionChallengeWatcher(address)
 	if err != nil {
@@ -61,12 +62,14 @@ func DefendExecutionClaim(
 		eventChan,
 		contract,
 		client,
-		NewAssertionDefender(
-			numSteps,
-			startMachine,
-			inboxStack,
-			assertion,
-		),
+		newSegmentTracker(progress, inboxStack, numSteps, func() AssertionDefender {
+			return NewAssertionDefender(
+				numSteps,
+				startMachine,
+				inboxStack,
+				assertion,
+			)
+		}),
 		bisectionCount,
 		challengeType,
 	)
@@ -77,7 +80,7 @@ func defendExecution(
 	eventChan <-chan arbbridge.Event,
 	contract arbbridge.ExecutionChallenge,
 	client arbbridge.ArbClient,
-	startDefender AssertionDefender,
+	tracker *segmentTracker,
 	bisectionCount uint32,
 	challengeType ExecutionChallengeInfo,
 ) (ChallengeState, error) {
@@ -90,8 +93,6 @@ func defendExecution(
 		return 0, fmt.Errorf("ExecutionChallenge expected InitiateChallengeEvent but got %T", event)
 	}
 
-	defender := startDefender
-
 	for {
 		cont := ContinueChallenge(challengeType)
 
@@ -103,15 +104,15 @@ func defendExecution(
 			return DefenderDiscontinued, nil
 		}
 
-		if defender.NumSteps() == 1 {
-			return runExecutionOneStepProof(ctx, eventChan, defender, contract)
+		if tracker.NumSteps() == 1 {
+			return runExecutionOneStepProof(ctx, eventChan, tracker, contract)
 		}
 
 		event, state, defenders, bisected, err := executionDefenderUpdate(
 			ctx,
 			eventChan,
 			contract,
-			defender,
+			tracker,
 			bisectionCount)
 
 		if challengeEnded(state, err) {
@@ -142,10 +143,10 @@ func defendExecution(
 
 		if bisected {
 			// Freshly bisected assertion
-			defender = defenders[continueEvent.SegmentIndex.Uint64()]
+			tracker.moved(bisectionEvent, continueEvent, &defenders[continueEvent.SegmentIndex.Uint64()])
 		} else {
 			// Replayed from existing event
-			defender = defender.MoveDefender(bisectionEvent, continueEvent)
+			tracker.moved(bisectionEvent, continueEvent, nil)
 		}
 	}
 }
@@ -154,13 +155,13 @@ func executionDefenderUpdate(
 	ctx context.Context,
 	eventChan <-chan arbbridge.Event,
 	contract arbbridge.ExecutionChallenge,
-	defender AssertionDefender,
+	tracker *segmentTracker,
 	bisectionCount uint32,
 ) (arbbridge.Event, ChallengeState, []AssertionDefender, bool, error) {
 	makeBisection, event, state, err := getNextEventIfExists(ctx, eventChan, replayTimeout)
 	var defenders []AssertionDefender = nil
 	if makeBisection {
-		defenders = defender.NBisect(uint64(bisectionCount))
+		defenders = tracker.bisect(uint64(bisectionCount))
 		assertions := make([]*valprotocol.ExecutionAssertionStub, 0, len(defenders))
 		for _, def := range defenders {
 			assertions = append(assertions, def.AssertionStub())
@@ -168,7 +169,7 @@ func executionDefenderUpdate(
 		err := contract.BisectAssertion(
 			ctx,
 			assertions,
-			defender.NumSteps())
+			tracker.NumSteps())
 		if err != nil {
 			return nil, 0, defenders, makeBisection, err
 		}
@@ -181,11 +182,12 @@ func executionDefenderUpdate(
 func runExecutionOneStepProof(
 	ctx context.Context,
 	eventChan <-chan arbbridge.Event,
-	defender AssertionDefender,
+	tracker *segmentTracker,
 	contract arbbridge.ExecutionChallenge,
 ) (ChallengeState, error) {
 	timedOut, event, state, err := getNextEventIfExists(ctx, eventChan, replayTimeout)
 	if timedOut {
+		defender := tracker.current()
 		proof, msg, err := defender.SolidityOneStepProof()
 		if err != nil {
 			return 0, err
@@ -208,6 +210,7 @@ func runExecutionOneStepProof(
 		if err != nil {
 			return 0, err
 		}
+		tracker.progress.provedStep()
 		event, state, err = getNextEvent(eventChan)
 	}
 
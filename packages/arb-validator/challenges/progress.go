@@ -0,0 +1,227 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package challenges
+
+//go:generate protoc -I. -I ../.. --go_out=paths=source_relative:. challenges.proto
+
+import (
+	"log"
+	"sync"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// ExecutionMove is the last move a validator made in an execution challenge
+type ExecutionMove uint8
+
+const (
+	NoMove ExecutionMove = iota
+	BisectedMove
+	ChoseSegmentMove
+	OneStepProofMove
+)
+
+// segment is an AssertionDefender without its inbox, which is rebuilt from
+// the chain rather than checkpointed
+type segment struct {
+	numSteps  uint64
+	initState machine.Machine
+	assertion *valprotocol.ExecutionAssertionStub
+}
+
+func newSegment(defender AssertionDefender) segment {
+	return segment{
+		numSteps:  defender.numSteps,
+		initState: defender.initState.Clone(),
+		assertion: defender.assertion,
+	}
+}
+
+func (s segment) defender(inbox *structures.MessageStack) AssertionDefender {
+	return NewAssertionDefender(s.numSteps, s.initState, inbox, s.assertion)
+}
+
+func (s segment) marshalForCheckpoint(ctx *ckptcontext.CheckpointContext, index uint64) *SegmentBuf {
+	ctx.AddMachine(s.initState)
+	return &SegmentBuf{
+		Index:         index,
+		NumSteps:      s.numSteps,
+		InitStateHash: s.initState.Hash().MarshalToBuf(),
+		Assertion:     s.assertion.MarshalToBuf(),
+	}
+}
+
+func (x *SegmentBuf) unmarshalFromCheckpoint(ctx ckptcontext.RestoreContext) (segment, bool) {
+	mach := ctx.GetMachine(x.InitStateHash.Unmarshal())
+	if mach == nil {
+		return segment{}, false
+	}
+	return segment{
+		numSteps:  x.NumSteps,
+		initState: mach,
+		assertion: x.Assertion.Unmarshal(),
+	}, true
+}
+
+// ExecutionProgress records how far a validator has got in an execution
+// challenge: the segment chosen in each completed round, our last move and
+// the machine states at the boundaries of the segments currently in play.
+// It is checkpointed along with the challenge so that after a restart the
+// challenge can be replayed from chain without re-executing the rounds that
+// were already played.
+//
+// Only execution challenges keep progress. An inbox top challenge is
+// resumed by replaying its events against the inbox, which is rebuilt from
+// the chain, so there's nothing expensive to save
+type ExecutionProgress struct {
+	sync.Mutex
+	chosenSegments []uint64
+	lastMove       ExecutionMove
+	current        *segment
+	nextSegments   map[uint64]segment
+}
+
+func NewExecutionProgress() *ExecutionProgress {
+	return &ExecutionProgress{
+		chosenSegments: make([]uint64, 0),
+		nextSegments:   make(map[uint64]segment),
+	}
+}
+
+// Round returns the number of bisection rounds which have been completed
+func (p *ExecutionProgress) Round() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.chosenSegments)
+}
+
+func (p *ExecutionProgress) LastMove() ExecutionMove {
+	p.Lock()
+	defer p.Unlock()
+	return p.lastMove
+}
+
+func (p *ExecutionProgress) snapshot() *ExecutionProgress {
+	p.Lock()
+	defer p.Unlock()
+	nextSegments := make(map[uint64]segment, len(p.nextSegments))
+	for index, seg := range p.nextSegments {
+		nextSegments[index] = seg
+	}
+	return &ExecutionProgress{
+		chosenSegments: append([]uint64{}, p.chosenSegments...),
+		lastMove:       p.lastMove,
+		current:        p.current,
+		nextSegments:   nextSegments,
+	}
+}
+
+func (p *ExecutionProgress) bisected(defenders []AssertionDefender) {
+	p.Lock()
+	defer p.Unlock()
+	p.lastMove = BisectedMove
+	p.nextSegments = make(map[uint64]segment, len(defenders))
+	for i, defender := range defenders {
+		p.nextSegments[uint64(i)] = newSegment(defender)
+	}
+}
+
+func (p *ExecutionProgress) choseSegment(index uint64, defender AssertionDefender) {
+	p.Lock()
+	defer p.Unlock()
+	p.lastMove = ChoseSegmentMove
+	p.nextSegments = map[uint64]segment{index: newSegment(defender)}
+}
+
+func (p *ExecutionProgress) provedStep() {
+	p.Lock()
+	defer p.Unlock()
+	p.lastMove = OneStepProofMove
+}
+
+// completedRound records that the given segment was chosen in the given
+// round, discarding any later rounds which were replaced by a reorg
+func (p *ExecutionProgress) completedRound(round int, index uint64, defender AssertionDefender) {
+	p.Lock()
+	defer p.Unlock()
+	if round < len(p.chosenSegments) {
+		p.chosenSegments = p.chosenSegments[:round]
+	}
+	p.chosenSegments = append(p.chosenSegments, index)
+	seg := newSegment(defender)
+	p.current = &seg
+	p.nextSegments = make(map[uint64]segment)
+}
+
+// MarshalForCheckpoint returns nil for nil progress
+func (p *ExecutionProgress) MarshalForCheckpoint(ctx *ckptcontext.CheckpointContext) *ExecutionProgressBuf {
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	defer p.Unlock()
+	var current *SegmentBuf
+	if p.current != nil {
+		current = p.current.marshalForCheckpoint(ctx, 0)
+	}
+	nextSegments := make([]*SegmentBuf, 0, len(p.nextSegments))
+	for index, seg := range p.nextSegments {
+		nextSegments = append(nextSegments, seg.marshalForCheckpoint(ctx, index))
+	}
+	return &ExecutionProgressBuf{
+		ChosenSegments: append([]uint64{}, p.chosenSegments...),
+		LastMove:       uint32(p.lastMove),
+		Current:        current,
+		NextSegments:   nextSegments,
+	}
+}
+
+// UnmarshalFromCheckpoint restores saved progress. If any of the machines
+// it refers to are missing, the challenge will be recomputed from scratch
+func (x *ExecutionProgressBuf) UnmarshalFromCheckpoint(ctx ckptcontext.RestoreContext) *ExecutionProgress {
+	p := NewExecutionProgress()
+	if x == nil {
+		return p
+	}
+	var current *segment
+	if x.Current != nil {
+		seg, ok := x.Current.unmarshalFromCheckpoint(ctx)
+		if !ok {
+			log.Println("Discarding challenge progress with missing machine")
+			return p
+		}
+		current = &seg
+	}
+	if len(x.ChosenSegments) > 0 && current == nil {
+		return p
+	}
+	for _, segBuf := range x.NextSegments {
+		seg, ok := segBuf.unmarshalFromCheckpoint(ctx)
+		if !ok {
+			log.Println("Discarding challenge progress with missing machine")
+			return NewExecutionProgress()
+		}
+		p.nextSegments[segBuf.Index] = seg
+	}
+	p.chosenSegments = append(p.chosenSegments, x.ChosenSegments...)
+	p.lastMove = ExecutionMove(x.LastMove)
+	p.current = current
+	return p
+}
@@ -0,0 +1,143 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package challenges
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+// playRounds bisects the segment under dispute and picks the segment at
+// index for each of the given indexes, returning the events that would have
+// been emitted on chain
+func playRounds(tracker *segmentTracker, indexes ...uint64) []replayedRound {
+	played := make([]replayedRound, 0, len(indexes))
+	for _, index := range indexes {
+		defenders := tracker.bisect(4)
+		hashes := make([]common.Hash, 0, len(defenders))
+		for _, defender := range defenders {
+			hashes = append(hashes, valprotocol.ExecutionDataHash(defender.NumSteps(), defender.AssertionStub()))
+		}
+		round := replayedRound{
+			bisectionEvent: arbbridge.ExecutionBisectionEvent{AssertionHashes: hashes},
+			continueEvent:  arbbridge.ContinueChallengeEvent{SegmentIndex: new(big.Int).SetUint64(index)},
+		}
+		tracker.moved(round.bisectionEvent, round.continueEvent, &defenders[index])
+		played = append(played, round)
+	}
+	return played
+}
+
+func checkpointProgress(progress *ExecutionProgress) *ExecutionProgress {
+	ctx := ckptcontext.NewCheckpointContext()
+	return progress.MarshalForCheckpoint(ctx).UnmarshalFromCheckpoint(ctx)
+}
+
+func TestResumeExecutionChallenge(t *testing.T) {
+	mach := getTestMachine(t)
+	_, assertion, inboxStack, numSteps := getExecutionChallengeData(mach)
+	start := func() AssertionDefender {
+		return NewAssertionDefender(numSteps, mach, inboxStack, assertion)
+	}
+
+	progress := NewExecutionProgress()
+	tracker := newSegmentTracker(progress, inboxStack, numSteps, start)
+	played := playRounds(tracker, 3, 1, 2)
+	// Crash after making a bisection which hasn't been answered yet
+	bisected := tracker.bisect(4)
+
+	restored := checkpointProgress(progress)
+	if restored.Round() != len(played) {
+		t.Fatal("restored progress has", restored.Round(), "rounds but", len(played), "were played")
+	}
+	if restored.LastMove() != BisectedMove {
+		t.Fatal("restored progress has wrong last move", restored.LastMove())
+	}
+
+	resumed := newSegmentTracker(restored, inboxStack, numSteps, func() AssertionDefender {
+		t.Fatal("resumed challenge was executed from the start")
+		return AssertionDefender{}
+	})
+	for _, round := range played {
+		resumed.moved(round.bisectionEvent, round.continueEvent, nil)
+	}
+	if resumed.NumSteps() != tracker.NumSteps() {
+		t.Fatal("resumed challenge has", resumed.NumSteps(), "steps instead of", tracker.NumSteps())
+	}
+	if !resumed.current().AssertionStub().Equals(tracker.current().AssertionStub()) {
+		t.Fatal("resumed challenge is defending the wrong segment")
+	}
+
+	resumedBisection := resumed.bisect(4)
+	if len(resumedBisection) != len(bisected) {
+		t.Fatal("resumed bisection has", len(resumedBisection), "segments instead of", len(bisected))
+	}
+	for i := range bisected {
+		if !resumedBisection[i].AssertionStub().Equals(bisected[i].AssertionStub()) {
+			t.Error("resumed bisection has wrong segment", i)
+		}
+	}
+}
+
+func TestResumeDivergedExecutionChallenge(t *testing.T) {
+	mach := getTestMachine(t)
+	_, assertion, inboxStack, numSteps := getExecutionChallengeData(mach)
+	start := func() AssertionDefender {
+		return NewAssertionDefender(numSteps, mach, inboxStack, assertion)
+	}
+
+	progress := NewExecutionProgress()
+	playRounds(newSegmentTracker(progress, inboxStack, numSteps, start), 3, 1, 2)
+
+	// After a reorg the challenger picked a different segment in the second round
+	expected := newSegmentTracker(nil, inboxStack, numSteps, start)
+	played := playRounds(expected, 3, 0)
+
+	resumed := newSegmentTracker(checkpointProgress(progress), inboxStack, numSteps, start)
+	for _, round := range played {
+		resumed.moved(round.bisectionEvent, round.continueEvent, nil)
+	}
+	if resumed.NumSteps() != expected.NumSteps() {
+		t.Fatal("resumed challenge has", resumed.NumSteps(), "steps instead of", expected.NumSteps())
+	}
+	if !resumed.current().AssertionStub().Equals(expected.current().AssertionStub()) {
+		t.Fatal("resumed challenge is defending the wrong segment")
+	}
+	if resumed.progress.Round() != len(played) {
+		t.Fatal("progress wasn't rewound to the diverging round")
+	}
+}
+
+// Inbox top challenges have no progress, and checkpoints from before
+// progress was saved have none either
+func TestCheckpointMissingProgress(t *testing.T) {
+	ctx := ckptcontext.NewCheckpointContext()
+	var progress *ExecutionProgress
+	buf := progress.MarshalForCheckpoint(ctx)
+	if buf != nil {
+		t.Fatal("nil progress was checkpointed")
+	}
+	restored := buf.UnmarshalFromCheckpoint(ctx)
+	if restored == nil || restored.Round() != 0 || restored.LastMove() != NoMove {
+		t.Error("missing progress wasn't restored as empty progress")
+	}
+}
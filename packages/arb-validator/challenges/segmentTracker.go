@@ -0,0 +1,204 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package challenges
+
+import (
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+type replayedRound struct {
+	bisectionEvent arbbridge.ExecutionBisectionEvent
+	continueEvent  arbbridge.ContinueChallengeEvent
+}
+
+// segmentTracker follows the segment under dispute in an execution
+// challenge. While events replayed from chain match the saved progress the
+// machine isn't run at all, and the saved segment is picked up once the
+// replay reaches the round it was saved in. If the chain diverges from the
+// saved progress the skipped rounds are executed as they would have been
+// without it
+type segmentTracker struct {
+	progress *ExecutionProgress
+	saved    *ExecutionProgress
+	inbox    *structures.MessageStack
+
+	// start builds the defender for the whole assertion. It is only called
+	// if the saved progress can't be used
+	start    func() AssertionDefender
+	defender *AssertionDefender
+	numSteps uint64
+	round    int
+	skipped  []replayedRound
+}
+
+func newSegmentTracker(
+	progress *ExecutionProgress,
+	inbox *structures.MessageStack,
+	numSteps uint64,
+	start func() AssertionDefender,
+) *segmentTracker {
+	if progress == nil {
+		progress = NewExecutionProgress()
+	}
+	return &segmentTracker{
+		progress: progress,
+		saved:    progress.snapshot(),
+		inbox:    inbox,
+		start:    start,
+		numSteps: numSteps,
+	}
+}
+
+func (t *segmentTracker) NumSteps() uint64 {
+	return t.numSteps
+}
+
+// current returns the defender for the segment under dispute, running the
+// machine through any rounds which were skipped during replay
+func (t *segmentTracker) current() AssertionDefender {
+	if t.defender == nil {
+		defender := t.start()
+		t.defender = &defender
+	}
+	round := t.round - len(t.skipped)
+	for _, skipped := range t.skipped {
+		defender := t.defender.MoveDefender(skipped.bisectionEvent, skipped.continueEvent)
+		t.progress.completedRound(round, skipped.continueEvent.SegmentIndex.Uint64(), defender)
+		t.defender = &defender
+		round++
+	}
+	t.skipped = nil
+	return *t.defender
+}
+
+// savedRound returns true if the saved progress chose the given segment in
+// the current round
+func (t *segmentTracker) savedRound(index uint64) bool {
+	return t.saved != nil &&
+		t.saved.current != nil &&
+		t.round < len(t.saved.chosenSegments) &&
+		t.saved.chosenSegments[t.round] == index
+}
+
+// savedNextSegment returns the given segment if it was saved while it was
+// in play in the current round
+func (t *segmentTracker) savedNextSegment(index uint64) (segment, bool) {
+	if t.saved == nil || t.round != len(t.saved.chosenSegments) {
+		return segment{}, false
+	}
+	seg, ok := t.saved.nextSegments[index]
+	return seg, ok
+}
+
+// bisect splits the segment under dispute, reusing the segments saved from
+// a bisection in this round which never made it on chain
+func (t *segmentTracker) bisect(bisectionCount uint64) []AssertionDefender {
+	if bisectionCount > t.numSteps {
+		bisectionCount = t.numSteps
+	}
+	defenders := make([]AssertionDefender, 0, bisectionCount)
+	if t.saved != nil && t.saved.lastMove == BisectedMove && uint64(len(t.saved.nextSegments)) == bisectionCount {
+		for i := uint64(0); i < bisectionCount; i++ {
+			seg, ok := t.savedNextSegment(i)
+			if !ok {
+				break
+			}
+			defenders = append(defenders, seg.defender(t.inbox))
+		}
+	}
+	if uint64(len(defenders)) != bisectionCount {
+		defenders = t.current().NBisect(bisectionCount)
+	}
+	t.progress.bisected(defenders)
+	return defenders
+}
+
+// savedChoice returns the segment chosen in this round before a restart if
+// the choice never made it on chain and the segment is still wrong
+func (t *segmentTracker) savedChoice(bisectionEvent arbbridge.ExecutionBisectionEvent) (uint64, segment, bool) {
+	if t.saved == nil || t.saved.lastMove != ChoseSegmentMove {
+		return 0, segment{}, false
+	}
+	for index := range t.saved.nextSegments {
+		seg, ok := t.savedNextSegment(index)
+		if ok &&
+			index < uint64(len(bisectionEvent.AssertionHashes)) &&
+			valprotocol.ExecutionDataHash(seg.numSteps, seg.assertion) != bisectionEvent.AssertionHashes[index] {
+			return index, seg, true
+		}
+	}
+	return 0, segment{}, false
+}
+
+// choose picks a segment of the bisection to challenge
+func (t *segmentTracker) choose(
+	bisectionEvent arbbridge.ExecutionBisectionEvent,
+	challengeEverything bool,
+) (uint64, AssertionDefender, error) {
+	if index, seg, ok := t.savedChoice(bisectionEvent); ok {
+		defender := seg.defender(t.inbox)
+		t.progress.choseSegment(index, defender)
+		return index, defender, nil
+	}
+	index, defender, err := chooseDefender(t.current(), bisectionEvent, challengeEverything)
+	if err != nil {
+		return 0, AssertionDefender{}, err
+	}
+	t.progress.choseSegment(uint64(index), defender)
+	return uint64(index), defender, nil
+}
+
+// moved updates the segment under dispute after the challenger picks a
+// segment. chosen is the new segment if it was computed by this validator
+// in this round
+func (t *segmentTracker) moved(
+	bisectionEvent arbbridge.ExecutionBisectionEvent,
+	continueEvent arbbridge.ContinueChallengeEvent,
+	chosen *AssertionDefender,
+) {
+	index := continueEvent.SegmentIndex.Uint64()
+	if chosen != nil {
+		t.defender = chosen
+		t.progress.completedRound(t.round, index, *chosen)
+	} else if t.savedRound(index) {
+		if t.round+1 == len(t.saved.chosenSegments) {
+			defender := t.saved.current.defender(t.inbox)
+			t.defender = &defender
+			t.skipped = nil
+		} else {
+			t.skipped = append(t.skipped, replayedRound{bisectionEvent, continueEvent})
+		}
+	} else if seg, ok := t.savedNextSegment(index); ok {
+		defender := seg.defender(t.inbox)
+		t.defender = &defender
+		t.progress.completedRound(t.round, index, defender)
+	} else {
+		// The chain no longer matches the saved progress
+		defender := t.current().MoveDefender(bisectionEvent, continueEvent)
+		t.saved = nil
+		t.defender = &defender
+		t.progress.completedRound(t.round, index, defender)
+	}
+	t.numSteps = valprotocol.CalculateBisectionStepCount(
+		index,
+		uint64(len(bisectionEvent.AssertionHashes)),
+		t.numSteps,
+	)
+	t.round++
+}
@@ -49,12 +49,13 @@ func main() {
 	}
 }
 
-func createStressedManager(rollupAddress common.Address, client arbbridge.ArbAuthClient, contractFile string, dbPath string) (*rollupmanager.Manager, error) {
+func createStressedManager(ctx context.Context, rollupAddress common.Address, client arbbridge.ArbAuthClient, contractFile string, dbPath string, maxReorgDepth int64) (*rollupmanager.Manager, error) {
 	return rollupmanager.CreateManager(
-		context.Background(),
+		ctx,
 		rollupAddress,
 		rollupmanager.NewStressTestClient(client, time.Second*10),
 		contractFile,
 		dbPath,
+		maxReorgDepth,
 	)
 }
@@ -53,6 +53,15 @@ func main() {
 		if err := cmdhelper.ValidateRollupChain("arb-validator", createManager); err != nil {
 			log.Fatal(err)
 		}
+	case "watch":
+		if err := cmdhelper.WatchRollupChain("arb-validator"); err != nil {
+			var alertErr *cmdhelper.AlertError
+			if errors.As(err, &alertErr) {
+				log.Println(err)
+				os.Exit(cmdhelper.AlertExitCode)
+			}
+			log.Fatal(err)
+		}
 	default:
 	}
 }
@@ -132,6 +141,6 @@ func createRollupChain() error {
 	return nil
 }
 
-func createManager(rollupAddress common.Address, client arbbridge.ArbAuthClient, contractFile string, dbPath string) (*rollupmanager.Manager, error) {
-	return rollupmanager.CreateManager(context.Background(), rollupAddress, client, contractFile, dbPath)
+func createManager(ctx context.Context, rollupAddress common.Address, client arbbridge.ArbAuthClient, contractFile string, dbPath string, maxReorgDepth int64) (*rollupmanager.Manager, error) {
+	return rollupmanager.CreateManager(ctx, rollupAddress, client, contractFile, dbPath, maxReorgDepth)
 }
@@ -51,18 +51,18 @@ func main() {
 	}
 }
 
-func createEvilManager(rollupAddress common.Address, client arbbridge.ArbAuthClient, contractFile string, dbPath string) (*rollupmanager.Manager, error) {
+func createEvilManager(ctx context.Context, rollupAddress common.Address, client arbbridge.ArbAuthClient, contractFile string, dbPath string, maxReorgDepth int64) (*rollupmanager.Manager, error) {
 	cp, err := rolluptest.NewEvilRollupCheckpointer(
 		rollupAddress,
 		dbPath,
-		big.NewInt(100),
+		big.NewInt(maxReorgDepth),
 		false,
 	)
 	if err != nil {
 		return nil, err
 	}
 	return rollupmanager.CreateManagerAdvanced(
-		context.Background(),
+		ctx,
 		rollupAddress,
 		true,
 		client,
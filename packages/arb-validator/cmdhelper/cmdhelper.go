@@ -20,12 +20,15 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
+	errors2 "github.com/pkg/errors"
 
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
@@ -42,20 +45,41 @@ var ContractName = "contract.mexe"
 func ValidateRollupChain(
 	execName string,
 	managerCreationFunc func(
+		ctx context.Context,
 		rollupAddress common.Address,
 		client arbbridge.ArbAuthClient,
-		contractFile string, dbPath string,
+		contractFile string, dbPath string, maxReorgDepth int64,
 	) (*rollupmanager.Manager, error),
 ) error {
 	// Check number of args
 
 	validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
 	walletVars := utils.AddWalletFlags(validateCmd)
+	configPath := validateCmd.String(
+		"config",
+		"",
+		"path to a YAML config file (settings can also be overridden by "+EnvPrefix+"_* environment variables)",
+	)
 	blocktime := validateCmd.Int64(
 		"blocktime",
 		2,
 		"blocktime=NumSeconds",
 	)
+	l1ResendInterval := validateCmd.Duration(
+		"l1ResendInterval",
+		0,
+		"resend stuck L1 transactions with a higher gas price after this long (0 to disable)",
+	)
+	strategy := validateCmd.String(
+		"strategy",
+		chainlistener.DefaultValidatorConfig.Strategy.Name(),
+		"when to stake, assert and challenge: active, defensive, challenge-only or nonempty-inbox",
+	)
+	metricsAddr := validateCmd.String(
+		"metricsAddr",
+		"",
+		"address to serve prometheus metrics on at /metrics (disabled if empty)",
+	)
 	err := validateCmd.Parse(os.Args[2:])
 	if err != nil {
 		return err
@@ -63,17 +87,50 @@ func ValidateRollupChain(
 
 	if validateCmd.NArg() != 3 {
 		return fmt.Errorf(
-			"usage: %v validate %v [--blocktime=NumSeconds] %v",
+			"usage: %v validate %v [--config=file.yaml] [--blocktime=NumSeconds] [--strategy=active] %v",
 			execName,
 			utils.WalletArgsString,
 			utils.RollupArgsString,
 		)
 	}
 
-	common.SetDurationPerBlock(time.Duration(*blocktime) * time.Second)
-
 	rollupArgs := utils.ParseRollupCommand(validateCmd, 0)
 
+	cfg := DefaultConfig()
+	cfg.Checkpoint.Path = filepath.Join(rollupArgs.ValidatorFolder, "checkpoint_db")
+	if err := utils.LoadConfig(*configPath, EnvPrefix, cfg); err != nil {
+		return err
+	}
+	// Flags given on the command line override the config file
+	validateCmd.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "blocktime":
+			cfg.BlockTime = time.Duration(*blocktime) * time.Second
+		case "l1ResendInterval":
+			cfg.L1.ResendInterval = *l1ResendInterval
+		case "metricsAddr":
+			cfg.MetricsAddr = *metricsAddr
+		case "strategy":
+			cfg.Staking.Strategy = *strategy
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return errors2.Wrap(err, "invalid config")
+	}
+
+	common.SetDurationPerBlock(cfg.BlockTime)
+
+	ctx, cancel := utils.SignalContext()
+	defer cancel()
+
+	if cfg.MetricsAddr != "" {
+		metricsDone := arbmetrics.Launch(ctx, cfg.MetricsAddr)
+		defer func() {
+			cancel()
+			<-metricsDone
+		}()
+	}
+
 	auth, err := utils.GetKeystore(
 		rollupArgs.ValidatorFolder,
 		walletVars,
@@ -89,25 +146,29 @@ func ValidateRollupChain(
 		return err
 	}
 	client := ethbridge.NewEthAuthClient(ethclint, auth)
+	if cfg.L1.ResendInterval > 0 {
+		client.EnableTxManager(ctx, cfg.L1.TxManagerConfig())
+	}
 
 	rollup, err := client.NewRollup(rollupArgs.Address)
 	if err != nil {
 		return err
 	}
 
-	params, err := rollup.GetParams(context.Background())
+	params, err := rollup.GetParams(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := arbbridge.WaitForBalance(context.Background(), client, params.StakeToken, common.NewAddressFromEth(auth.From)); err != nil {
+	if err := arbbridge.WaitForBalance(ctx, client, params.StakeToken, common.NewAddressFromEth(auth.From)); err != nil {
 		return err
 	}
 
 	validatorListener := chainlistener.NewValidatorChainListener(
-		context.Background(),
+		ctx,
 		rollupArgs.Address,
 		rollup,
+		cfg.ValidatorConfig(),
 	)
 	err = validatorListener.AddStaker(client)
 	if err != nil {
@@ -115,13 +176,13 @@ func ValidateRollupChain(
 	}
 
 	contractFile := filepath.Join(rollupArgs.ValidatorFolder, ContractName)
-	dbPath := filepath.Join(rollupArgs.ValidatorFolder, "checkpoint_db")
-
 	manager, err := managerCreationFunc(
+		ctx,
 		rollupArgs.Address,
 		client,
 		contractFile,
-		dbPath,
+		cfg.Checkpoint.Path,
+		cfg.Checkpoint.MaxReorgDepth,
 	)
 
 	if err != nil {
@@ -130,7 +191,11 @@ func ValidateRollupChain(
 	manager.AddListener(&chainlistener.AnnouncerListener{})
 	manager.AddListener(validatorListener)
 
-	wait := make(chan bool)
-	<-wait
+	<-ctx.Done()
+	manager.Wait()
+	// Flush the latest checkpoint and close the database now that nothing
+	// else is writing to it
+	manager.GetCheckpointer().Close()
+	log.Println("Validator shut down")
 	return nil
 }
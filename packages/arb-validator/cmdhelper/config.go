@@ -0,0 +1,146 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmdhelper
+
+import (
+	"time"
+
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/utils"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/chainlistener"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/rollupmanager"
+)
+
+// EnvPrefix is prepended to the names of environment variables which
+// override the validator config
+const EnvPrefix = "ARB_VALIDATOR"
+
+// Config is the validator's config file. Any of its settings can be
+// overridden from the environment as described by utils.LoadConfig
+type Config struct {
+	BlockTime   time.Duration `yaml:"blockTime"`
+	MetricsAddr string        `yaml:"metricsAddr"`
+	// L1 transactions are only resent if l1.resendInterval is set
+	L1         utils.L1Config   `yaml:"l1"`
+	Checkpoint CheckpointConfig `yaml:"checkpoint"`
+	Staking    StakingConfig    `yaml:"staking"`
+	Challenges ChallengeConfig  `yaml:"challenges"`
+	Watch      WatchConfig      `yaml:"watch"`
+}
+
+type CheckpointConfig struct {
+	// Path is the checkpoint database. It defaults to checkpoint_db in the
+	// validator folder
+	Path string `yaml:"path"`
+	// MaxReorgDepth is how many blocks of checkpoints are kept
+	MaxReorgDepth int64 `yaml:"maxReorgDepth"`
+}
+
+type StakingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// RetryBlocks is how many blocks to wait for a stake to show up before
+	// placing it again
+	RetryBlocks int64 `yaml:"retryBlocks"`
+	// Strategy is active, defensive, challenge-only or nonempty-inbox
+	Strategy string `yaml:"strategy"`
+}
+
+type ChallengeConfig struct {
+	// Initiate lets the validator challenge stakers who disagree with it
+	Initiate bool `yaml:"initiate"`
+}
+
+// WatchConfig controls the watch subcommand which follows the chain without
+// a stake
+type WatchConfig struct {
+	// AlertBlocks is how close to its deadline an invalid node must be before
+	// an alert is raised
+	AlertBlocks int64 `yaml:"alertBlocks"`
+	// Webhook receives alerts as JSON if set
+	Webhook string `yaml:"webhook"`
+	// ExitOnAlert stops the watcher with AlertExitCode once an alert is
+	// raised
+	ExitOnAlert bool `yaml:"exitOnAlert"`
+	// Handoff loads the wallet and uses it to stake and challenge as soon
+	// as an invalid node is found
+	Handoff bool `yaml:"handoff"`
+}
+
+func DefaultConfig() *Config {
+	l1 := utils.DefaultL1Config
+	l1.ResendInterval = 0
+	return &Config{
+		BlockTime: 2 * time.Second,
+		L1:        l1,
+		Checkpoint: CheckpointConfig{
+			MaxReorgDepth: rollupmanager.DefaultMaxReorgDepth,
+		},
+		Staking: StakingConfig{
+			Enabled:     chainlistener.DefaultValidatorConfig.PlaceStakes,
+			RetryBlocks: chainlistener.DefaultValidatorConfig.StakeRetryBlocks,
+			Strategy:    chainlistener.DefaultValidatorConfig.Strategy.Name(),
+		},
+		Challenges: ChallengeConfig{
+			Initiate: chainlistener.DefaultValidatorConfig.InitiateChallenges,
+		},
+		Watch: WatchConfig{
+			AlertBlocks: chainlistener.DefaultAlertBlocks,
+		},
+	}
+}
+
+// Validate returns an error describing the first invalid setting
+func (c *Config) Validate() error {
+	if c.BlockTime <= 0 {
+		return errors2.New("blockTime must be positive")
+	}
+	if c.L1.ResendInterval < 0 {
+		return errors2.New("l1.resendInterval can't be negative")
+	}
+	if c.Checkpoint.Path == "" {
+		return errors2.New("checkpoint.path must be set")
+	}
+	if c.Checkpoint.MaxReorgDepth <= 0 {
+		return errors2.New("checkpoint.maxReorgDepth must be positive")
+	}
+	if c.Staking.RetryBlocks <= 0 {
+		return errors2.New("staking.retryBlocks must be positive")
+	}
+	if _, err := chainlistener.NewStakingStrategy(c.Staking.Strategy); err != nil {
+		return errors2.Wrap(err, "invalid staking.strategy")
+	}
+	if err := c.ValidatorConfig().Validate(); err != nil {
+		return errors2.Wrap(err, "staking.strategy conflicts with challenges.initiate")
+	}
+	if c.Watch.AlertBlocks < 0 {
+		return errors2.New("watch.alertBlocks can't be negative")
+	}
+	return nil
+}
+
+// ValidatorConfig converts the staking and challenge sections to the
+// validator's config. The config must have been validated
+func (c *Config) ValidatorConfig() chainlistener.ValidatorConfig {
+	strategy, _ := chainlistener.NewStakingStrategy(c.Staking.Strategy)
+	return chainlistener.ValidatorConfig{
+		PlaceStakes:        c.Staking.Enabled,
+		StakeRetryBlocks:   c.Staking.RetryBlocks,
+		InitiateChallenges: c.Challenges.Initiate,
+		Strategy:           strategy,
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmdhelper
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbmetrics"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/utils"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/chainlistener"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/rollupmanager"
+)
+
+// AlertExitCode is the exit status of a watcher stopped by an alert
+const AlertExitCode = 3
+
+// AlertError is returned by WatchRollupChain when it stops because of an
+// alert
+type AlertError struct {
+	Alert chainlistener.Alert
+}
+
+func (e *AlertError) Error() string {
+	if e.Alert.Confirmed {
+		return fmt.Sprintf("invalid node %v was confirmed", e.Alert.Node.Hex())
+	}
+	return fmt.Sprintf("invalid node %v is %v blocks from its deadline", e.Alert.Node.Hex(), e.Alert.BlocksLeft)
+}
+
+// WatchRollupChain follows a rollup chain without staking and alerts when an
+// invalid assertion nears confirmation. A wallet is only loaded if handoff is
+// enabled, in which case it's used to stake and challenge as soon as an
+// invalid assertion is found
+func WatchRollupChain(execName string) error {
+	watchCmd := flag.NewFlagSet("watch", flag.ExitOnError)
+	walletVars := utils.AddWalletFlags(watchCmd)
+	configPath := watchCmd.String(
+		"config",
+		"",
+		"path to a YAML config file (settings can also be overridden by "+EnvPrefix+"_* environment variables)",
+	)
+	blocktime := watchCmd.Int64(
+		"blocktime",
+		2,
+		"blocktime=NumSeconds",
+	)
+	metricsAddr := watchCmd.String(
+		"metricsAddr",
+		"",
+		"address to serve prometheus metrics on at /metrics (disabled if empty)",
+	)
+	alertBlocks := watchCmd.Int64(
+		"alertBlocks",
+		chainlistener.DefaultAlertBlocks,
+		"alert when an invalid node is this many blocks from its deadline",
+	)
+	webhook := watchCmd.String(
+		"webhook",
+		"",
+		"url to post alerts to as JSON (disabled if empty)",
+	)
+	exitOnAlert := watchCmd.Bool(
+		"exitOnAlert",
+		false,
+		fmt.Sprintf("exit with status %v when an alert is raised", AlertExitCode),
+	)
+	handoff := watchCmd.Bool(
+		"handoff",
+		false,
+		"load the wallet and use it to stake and challenge as soon as an invalid node is found",
+	)
+	err := watchCmd.Parse(os.Args[2:])
+	if err != nil {
+		return err
+	}
+
+	if watchCmd.NArg() != 3 {
+		return fmt.Errorf(
+			"usage: %v watch [--config=file.yaml] [--blocktime=NumSeconds] [--alertBlocks=NumBlocks] [--webhook=url] [--exitOnAlert] [--handoff %v] %v",
+			execName,
+			utils.WalletArgsString,
+			utils.RollupArgsString,
+		)
+	}
+
+	rollupArgs := utils.ParseRollupCommand(watchCmd, 0)
+
+	cfg := DefaultConfig()
+	cfg.Checkpoint.Path = filepath.Join(rollupArgs.ValidatorFolder, "checkpoint_db")
+	if err := utils.LoadConfig(*configPath, EnvPrefix, cfg); err != nil {
+		return err
+	}
+	// Flags given on the command line override the config file
+	watchCmd.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "blocktime":
+			cfg.BlockTime = time.Duration(*blocktime) * time.Second
+		case "metricsAddr":
+			cfg.MetricsAddr = *metricsAddr
+		case "alertBlocks":
+			cfg.Watch.AlertBlocks = *alertBlocks
+		case "webhook":
+			cfg.Watch.Webhook = *webhook
+		case "exitOnAlert":
+			cfg.Watch.ExitOnAlert = *exitOnAlert
+		case "handoff":
+			cfg.Watch.Handoff = *handoff
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return errors2.Wrap(err, "invalid config")
+	}
+
+	common.SetDurationPerBlock(cfg.BlockTime)
+
+	ctx, cancel := utils.SignalContext()
+	defer cancel()
+
+	if cfg.MetricsAddr != "" {
+		metricsDone := arbmetrics.Launch(ctx, cfg.MetricsAddr)
+		defer func() {
+			cancel()
+			<-metricsDone
+		}()
+	}
+
+	ethclint, err := ethclient.Dial(rollupArgs.EthURL)
+	if err != nil {
+		return err
+	}
+	client := ethbridge.NewEthClient(ethclint)
+
+	alerted := make(chan chainlistener.Alert, 1)
+	alerters := []chainlistener.Alerter{chainlistener.LogAlerter{}}
+	if cfg.Watch.Webhook != "" {
+		alerters = append(alerters, chainlistener.NewWebhookAlerter(cfg.Watch.Webhook))
+	}
+	var handoffAlerter *stakerHandoff
+	if cfg.Watch.Handoff {
+		auth, err := utils.GetKeystore(rollupArgs.ValidatorFolder, walletVars, watchCmd)
+		if err != nil {
+			return err
+		}
+		authClient := ethbridge.NewEthAuthClient(ethclint, auth)
+		if cfg.L1.ResendInterval > 0 {
+			authClient.EnableTxManager(ctx, cfg.L1.TxManagerConfig())
+		}
+		handoffAlerter = &stakerHandoff{
+			client:        authClient,
+			rollupAddress: rollupArgs.Address,
+			config:        cfg.ValidatorConfig(),
+		}
+		alerters = append(alerters, handoffAlerter)
+	}
+	if cfg.Watch.ExitOnAlert {
+		alerters = append(alerters, exitAlerter(alerted))
+	}
+
+	contractFile := filepath.Join(rollupArgs.ValidatorFolder, ContractName)
+	manager, err := rollupmanager.CreateManager(
+		ctx,
+		rollupArgs.Address,
+		client,
+		contractFile,
+		cfg.Checkpoint.Path,
+		cfg.Checkpoint.MaxReorgDepth,
+	)
+	if err != nil {
+		return err
+	}
+	if handoffAlerter != nil {
+		handoffAlerter.manager = manager
+	}
+
+	manager.AddListener(&chainlistener.AnnouncerListener{})
+	manager.AddListener(chainlistener.NewWatchtowerListener(ctx, client, cfg.Watch.AlertBlocks, alerters))
+
+	var alertErr error
+	select {
+	case alert := <-alerted:
+		alertErr = &AlertError{Alert: alert}
+		cancel()
+	case <-ctx.Done():
+	}
+	manager.Wait()
+	manager.GetCheckpointer().Close()
+	log.Println("Watcher shut down")
+	return alertErr
+}
+
+// exitAlerter passes the first alert to alerted
+type exitAlerter chan<- chainlistener.Alert
+
+func (a exitAlerter) Alert(_ context.Context, alert chainlistener.Alert) {
+	select {
+	case a <- alert:
+	default:
+	}
+}
+
+// stakerHandoff starts validating with a staking key as soon as an invalid
+// node is found so that its stakers are challenged with as much of the
+// challenge period left as possible. Alerts are only raised for the node
+// once it's within alertBlocks of its deadline
+type stakerHandoff struct {
+	once          sync.Once
+	client        arbbridge.ArbAuthClient
+	rollupAddress common.Address
+	config        chainlistener.ValidatorConfig
+	manager       *rollupmanager.Manager
+}
+
+// Alert does nothing since the handoff started when the node was found
+func (h *stakerHandoff) Alert(context.Context, chainlistener.Alert) {}
+
+func (h *stakerHandoff) InvalidNodeFound(ctx context.Context, _ chainlistener.Alert) {
+	h.once.Do(func() {
+		go func() {
+			if err := h.start(ctx); err != nil {
+				log.Println("Error handing off to staker", err)
+			}
+		}()
+	})
+}
+
+func (h *stakerHandoff) start(ctx context.Context) error {
+	log.Println("Handing off to staker", h.client.Address(), "to challenge the invalid node")
+	rollup, err := h.client.NewRollup(h.rollupAddress)
+	if err != nil {
+		return err
+	}
+	params, err := rollup.GetParams(ctx)
+	if err != nil {
+		return err
+	}
+	if err := arbbridge.WaitForBalance(ctx, h.client, params.StakeToken, h.client.Address()); err != nil {
+		return err
+	}
+	// Only stake to challenge the invalid node rather than start asserting
+	config := h.config
+	config.PlaceStakes = true
+	config.InitiateChallenges = true
+	config.Strategy = chainlistener.DefensiveStrategy{}
+	validatorListener := chainlistener.NewValidatorChainListener(ctx, h.rollupAddress, rollup, config)
+	if err := validatorListener.AddStaker(h.client); err != nil {
+		return err
+	}
+	h.manager.AddListener(validatorListener)
+	return nil
+}
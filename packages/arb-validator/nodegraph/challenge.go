@@ -19,6 +19,8 @@ package nodegraph
 import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/challenges"
 	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
 )
 
@@ -29,6 +31,13 @@ type Challenge struct {
 	challenger   common.Address
 	contract     common.Address
 	conflictNode *structures.Node
+
+	// Progress made by this validator on each side of an execution
+	// challenge. They're nil for inbox top challenges which aren't
+	// checkpointed since they only need the inbox, which is rebuilt from the
+	// chain, and replaying them never runs the machine
+	defenderProgress   *challenges.ExecutionProgress
+	challengerProgress *challenges.ExecutionProgress
 }
 
 func NewChallenge(
@@ -40,23 +49,27 @@ func NewChallenge(
 	conflictNode *structures.Node,
 ) *Challenge {
 	return &Challenge{
-		blockId:      blockId,
-		logIndex:     logIndex,
-		asserter:     asserter,
-		challenger:   challenger,
-		contract:     contract,
-		conflictNode: conflictNode,
+		blockId:            blockId,
+		logIndex:           logIndex,
+		asserter:           asserter,
+		challenger:         challenger,
+		contract:           contract,
+		conflictNode:       conflictNode,
+		defenderProgress:   newProgress(conflictNode),
+		challengerProgress: newProgress(conflictNode),
 	}
 }
 
 func NewChallengeFromEvent(event arbbridge.ChallengeStartedEvent, challengerAncestor *structures.Node) *Challenge {
 	return &Challenge{
-		blockId:      event.BlockId,
-		logIndex:     event.LogIndex,
-		asserter:     event.Asserter,
-		challenger:   event.Challenger,
-		contract:     event.ChallengeContract,
-		conflictNode: challengerAncestor,
+		blockId:            event.BlockId,
+		logIndex:           event.LogIndex,
+		asserter:           event.Asserter,
+		challenger:         event.Challenger,
+		contract:           event.ChallengeContract,
+		conflictNode:       challengerAncestor,
+		defenderProgress:   newProgress(challengerAncestor),
+		challengerProgress: newProgress(challengerAncestor),
 	}
 }
 
@@ -83,3 +96,24 @@ func (c *Challenge) LogIndex() uint {
 func (c *Challenge) BlockId() *common.BlockId {
 	return c.blockId
 }
+
+// newProgress returns empty progress for an execution challenge over
+// conflictNode, or nil if it's an inbox top challenge
+func newProgress(conflictNode *structures.Node) *challenges.ExecutionProgress {
+	if conflictNode.LinkType() != valprotocol.InvalidExecutionChildType {
+		return nil
+	}
+	return challenges.NewExecutionProgress()
+}
+
+// DefenderProgress returns the asserter's progress in an execution
+// challenge or nil if it's an inbox top challenge
+func (c *Challenge) DefenderProgress() *challenges.ExecutionProgress {
+	return c.defenderProgress
+}
+
+// ChallengerProgress returns the challenger's progress in an execution
+// challenge or nil if it's an inbox top challenge
+func (c *Challenge) ChallengerProgress() *challenges.ExecutionProgress {
+	return c.challengerProgress
+}
@@ -19,7 +19,10 @@ package nodegraph
 import (
 	"log"
 
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/ckptcontext"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/challenges"
 )
 
 type ChallengeSet struct {
@@ -55,27 +58,37 @@ func (cs *ChallengeSet) Forall(f func(*Challenge)) {
 	}
 }
 
-func (c *Challenge) MarshalToBuf() *ChallengeBuf {
+func (c *Challenge) MarshalForCheckpoint(ctx *ckptcontext.CheckpointContext) *ChallengeBuf {
 	return &ChallengeBuf{
-		BlockId:          c.blockId.MarshalToBuf(),
-		LogIndex:         uint64(c.logIndex),
-		Asserter:         c.asserter.MarshallToBuf(),
-		Challenger:       c.challenger.MarshallToBuf(),
-		Contract:         c.contract.MarshallToBuf(),
-		ConflictNodeHash: c.conflictNode.Hash().MarshalToBuf(),
+		BlockId:            c.blockId.MarshalToBuf(),
+		LogIndex:           uint64(c.logIndex),
+		Asserter:           c.asserter.MarshallToBuf(),
+		Challenger:         c.challenger.MarshallToBuf(),
+		Contract:           c.contract.MarshallToBuf(),
+		ConflictNodeHash:   c.conflictNode.Hash().MarshalToBuf(),
+		DefenderProgress:   c.defenderProgress.MarshalForCheckpoint(ctx),
+		ChallengerProgress: c.challengerProgress.MarshalForCheckpoint(ctx),
 	}
 }
 
-func (m *ChallengeBuf) Unmarshal(chain *NodeGraph) *Challenge {
+func (m *ChallengeBuf) UnmarshalFromCheckpoint(ctx ckptcontext.RestoreContext, chain *NodeGraph) *Challenge {
 	// chain.nodeFromHash must have already been unmarshaled
 	conflictNodeHash := m.ConflictNodeHash.Unmarshal()
+	conflictNode := chain.nodeFromHash[conflictNodeHash]
+	var defenderProgress, challengerProgress *challenges.ExecutionProgress
+	if conflictNode.LinkType() == valprotocol.InvalidExecutionChildType {
+		defenderProgress = m.DefenderProgress.UnmarshalFromCheckpoint(ctx)
+		challengerProgress = m.ChallengerProgress.UnmarshalFromCheckpoint(ctx)
+	}
 	return &Challenge{
-		blockId:      m.BlockId.Unmarshal(),
-		logIndex:     uint(m.LogIndex),
-		asserter:     m.Asserter.Unmarshal(),
-		challenger:   m.Challenger.Unmarshal(),
-		contract:     m.Contract.Unmarshal(),
-		conflictNode: chain.nodeFromHash[conflictNodeHash],
+		blockId:            m.BlockId.Unmarshal(),
+		logIndex:           uint(m.LogIndex),
+		asserter:           m.Asserter.Unmarshal(),
+		challenger:         m.Challenger.Unmarshal(),
+		contract:           m.Contract.Unmarshal(),
+		conflictNode:       conflictNode,
+		defenderProgress:   defenderProgress,
+		challengerProgress: challengerProgress,
 	}
 }
 
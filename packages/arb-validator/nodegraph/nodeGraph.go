@@ -167,7 +167,7 @@ func (ng *NodeGraph) DebugStringForNodeRecursive(node *structures.Node, stakers
 		ret = ret + " " + label
 	}
 
-	stakers.forall(func(s *Staker) {
+	stakers.Forall(func(s *Staker) {
 		if s.location.Equals(node) {
 			ret = ret + " stake:" + s.address.ShortString()
 		}
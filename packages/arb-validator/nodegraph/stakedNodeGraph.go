@@ -67,12 +67,12 @@ func NewStakedNodeGraph(machine machine.Machine, params valprotocol.ChainParams)
 
 func (sng *StakedNodeGraph) MarshalForCheckpoint(ctx *ckptcontext.CheckpointContext) *StakedNodeGraphBuf {
 	var allStakers []*StakerBuf
-	sng.stakers.forall(func(staker *Staker) {
+	sng.stakers.Forall(func(staker *Staker) {
 		allStakers = append(allStakers, staker.MarshalToBuf())
 	})
 	var allChallenges []*ChallengeBuf
 	sng.Challenges.Forall(func(c *Challenge) {
-		allChallenges = append(allChallenges, c.MarshalToBuf())
+		allChallenges = append(allChallenges, c.MarshalForCheckpoint(ctx))
 	})
 	return &StakedNodeGraphBuf{
 		NodeGraph:  sng.NodeGraph.MarshalForCheckpoint(ctx),
@@ -95,7 +95,7 @@ func (x *StakedNodeGraphBuf) UnmarshalFromCheckpoint(ctx ckptcontext.RestoreCont
 		chain.stakers.Add(stakerBuf.Unmarshal(chain.NodeGraph))
 	}
 	for _, challengeBuf := range x.Challenges {
-		chain.Challenges.Add(challengeBuf.Unmarshal(chain.NodeGraph))
+		chain.Challenges.Add(challengeBuf.UnmarshalFromCheckpoint(ctx, chain.NodeGraph))
 	}
 	return chain, nil
 }
@@ -166,7 +166,7 @@ func (sng *StakedNodeGraph) GenerateNodePruneInfo(stakers *StakerSet) []valproto
 			leafAncestor, _, err := structures.GetConflictAncestor(leaf, sng.latestConfirmed)
 			if err == nil {
 				noStakersOnLeaf := true
-				sng.stakers.forall(func(s *Staker) {
+				sng.stakers.Forall(func(s *Staker) {
 					if s.location.Equals(leaf) {
 						noStakersOnLeaf = false
 					}
@@ -184,7 +184,7 @@ func (sng *StakedNodeGraph) GenerateNextConfProof(
 	currentTime common.TimeTicks,
 ) (*valprotocol.ConfirmOpportunity, []*structures.Node) {
 	stakerAddrs := make([]common.Address, 0)
-	sng.stakers.forall(func(st *Staker) {
+	sng.stakers.Forall(func(st *Staker) {
 		stakerAddrs = append(stakerAddrs, st.address)
 	})
 	sort.Sort(SortableAddressList(stakerAddrs))
@@ -282,7 +282,7 @@ func (sng *StakedNodeGraph) isConfirmableNode(
 func (sng *StakedNodeGraph) GenerateStakerPruneInfo() ([]RecoverStakeMootedParams, []RecoverStakeOldParams) {
 	var mootedToDo []RecoverStakeMootedParams
 	var oldToDo []RecoverStakeOldParams
-	sng.stakers.forall(func(staker *Staker) {
+	sng.stakers.Forall(func(staker *Staker) {
 		stakerAncestor, _, _, err := GetConflictAncestor(staker.location, sng.latestConfirmed)
 		if err == nil {
 			prev := stakerAncestor.Prev()
@@ -353,7 +353,7 @@ func (sng *StakedNodeGraph) CheckChallengeOpportunityAny(staker *Staker) *Challe
 		return nil
 	}
 	var ret *ChallengeOpportunity
-	sng.stakers.forall(func(staker2 *Staker) {
+	sng.stakers.Forall(func(staker2 *Staker) {
 		if !staker2.Equals(staker) {
 			opp := sng.CheckChallengeOpportunityPair(staker, staker2)
 			if opp != nil {
@@ -368,7 +368,7 @@ func (sng *StakedNodeGraph) CheckChallengeOpportunityAny(staker *Staker) *Challe
 func (sng *StakedNodeGraph) checkChallengeOpportunityAllPairs() []*ChallengeOpportunity {
 	var ret []*ChallengeOpportunity
 	var stakers []*Staker
-	sng.stakers.forall(func(s *Staker) {
+	sng.stakers.Forall(func(s *Staker) {
 		stakers = append(stakers, s)
 	})
 	for i, s1 := range stakers {
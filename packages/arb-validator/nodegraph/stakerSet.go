@@ -49,7 +49,7 @@ func (sl *StakerSet) GetSize() int {
 	return len(sl.idx)
 }
 
-func (sl *StakerSet) forall(f func(*Staker)) {
+func (sl *StakerSet) Forall(f func(*Staker)) {
 	for _, v := range sl.idx {
 		f(v)
 	}
@@ -58,7 +58,7 @@ func (sl *StakerSet) forall(f func(*Staker)) {
 func (ss *StakerSet) DebugString(prefix string) string {
 	ret := prefix + "stakers:\n"
 	subPrefix := prefix + "  "
-	ss.forall(func(s *Staker) {
+	ss.Forall(func(s *Staker) {
 		ret = ret + s.DebugString(subPrefix)
 	})
 	return ret
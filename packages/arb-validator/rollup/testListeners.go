@@ -49,7 +49,7 @@ func NewEvil_WrongAssertionListener(
 	actor arbbridge.ArbRollup,
 	kind WrongAssertionType,
 ) *evil_WrongAssertionListener {
-	return &evil_WrongAssertionListener{chainlistener.NewValidatorChainListener(context.Background(), rollupAddress, actor), kind}
+	return &evil_WrongAssertionListener{chainlistener.NewValidatorChainListener(context.Background(), rollupAddress, actor, chainlistener.DefaultValidatorConfig), kind}
 }
 
 func (lis *evil_WrongAssertionListener) AssertionPrepared(
@@ -39,13 +39,22 @@ type Manager struct {
 
 	listeners   []chainlistener.ChainListener
 	activeChain *chainobserver.ChainObserver
+	// processedHeight is the latest L1 block whose events have all been
+	// handed to the listeners since the manager reached the head
+	processedHeight *big.Int
 
 	// These variables are only written by the constructor
 	RollupAddress common.Address
 	checkpointer  checkpointing.RollupCheckpointer
+
+	// done is closed once the manager has stopped after its context is
+	// cancelled
+	done chan struct{}
 }
 
-const defaultMaxReorgDepth = 100
+// DefaultMaxReorgDepth is how many blocks of checkpoints are kept to recover
+// from an L1 reorg
+const DefaultMaxReorgDepth = 100
 
 const assumedValidThreshold = 2
 
@@ -55,11 +64,12 @@ func CreateManager(
 	clnt arbbridge.ArbClient,
 	aoFilePath string,
 	dbPath string,
+	maxReorgDepth int64,
 ) (*Manager, error) {
 	checkpointer, err := checkpointing.NewIndexedCheckpointer(
 		rollupAddr,
 		dbPath,
-		big.NewInt(defaultMaxReorgDepth),
+		big.NewInt(maxReorgDepth),
 		false,
 	)
 	if err != nil {
@@ -105,8 +115,10 @@ func CreateManagerAdvanced(
 	man := &Manager{
 		RollupAddress: rollupAddr,
 		checkpointer:  checkpointer,
+		done:          make(chan struct{}),
 	}
 	go func() {
+		defer close(man.done)
 		for {
 			runCtx, cancelFunc := context.WithCancel(ctx)
 
@@ -139,6 +151,9 @@ func CreateManagerAdvanced(
 			}
 
 			man.Lock()
+			if man.activeChain != nil {
+				chain.ContinueCountingFrom(man.activeChain)
+			}
 			man.activeChain = chain
 			// Add manager's listeners
 			for _, listener := range man.listeners {
@@ -285,6 +300,12 @@ func CreateManagerAdvanced(
 							return errors2.Wrap(err, "Manager hit error processing event")
 						}
 					}
+
+					if caughtUpToL1 {
+						man.Lock()
+						man.processedHeight = blockId.Height.AsInt()
+						man.Unlock()
+					}
 				}
 				return nil
 			}()
@@ -320,6 +341,20 @@ func (man *Manager) AddListener(listener chainlistener.ChainListener) {
 	}
 }
 
+// ProcessedHeight returns the latest L1 block whose events have all been
+// handled, or nil if the manager hasn't caught up to the head of the chain
+func (man *Manager) ProcessedHeight() *big.Int {
+	man.Lock()
+	defer man.Unlock()
+	return man.processedHeight
+}
+
+// Wait blocks until the manager has stopped processing events after the
+// context it was created with is cancelled
+func (man *Manager) Wait() {
+	<-man.done
+}
+
 func (man *Manager) GetCheckpointer() checkpointing.RollupCheckpointer {
 	return man.checkpointer
 }
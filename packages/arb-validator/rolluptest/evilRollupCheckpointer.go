@@ -82,6 +82,22 @@ func (e EvilRollupCheckpointer) RestoreLatestState(
 	)
 }
 
+func (e EvilRollupCheckpointer) RestoreStateAtOrBefore(
+	ctx context.Context,
+	clnt arbbridge.ChainTimeGetter,
+	height *common.TimeBlocks,
+	unmarshalFunc func([]byte, ckptcontext.RestoreContext, *common.BlockId) error,
+) error {
+	return e.cp.RestoreStateAtOrBefore(
+		ctx,
+		clnt,
+		height,
+		func(contents []byte, resCtx ckptcontext.RestoreContext, blockId *common.BlockId) error {
+			return unmarshalFunc(contents, &evilRestoreContext{resCtx}, blockId)
+		},
+	)
+}
+
 type evilRestoreContext struct {
 	rc ckptcontext.RestoreContext
 }
@@ -109,3 +125,7 @@ func (e EvilRollupCheckpointer) AsyncSaveCheckpoint(blockId *common.BlockId, con
 func (e EvilRollupCheckpointer) MaxReorgHeight() *big.Int {
 	return e.cp.MaxReorgHeight()
 }
+
+func (e EvilRollupCheckpointer) Close() {
+	e.cp.Close()
+}
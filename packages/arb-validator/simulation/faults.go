@@ -0,0 +1,311 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package simulation
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/chainlistener"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/nodegraph"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// WARNING: The code in this file is badly behaved, on purpose. It is for testing only.
+
+// Fault is a set of ways in which a validator misbehaves
+type Fault uint
+
+const Honest Fault = 0
+
+const (
+	// WrongLogs asserts a different log accumulator than the machine produced
+	WrongLogs Fault = 1 << iota
+	// WrongSends asserts a different outgoing message accumulator than the
+	// machine produced
+	WrongSends
+	// WrongInboxTop asserts a different inbox top than the one on chain
+	WrongInboxTop
+	// WrongExecution asserts a different machine hash than the machine
+	// reached
+	WrongExecution
+	// WithholdResponses never makes a move in challenges, so the validator
+	// loses every challenge it is part of by timeout
+	WithholdResponses
+	// DeliberateTimeout makes ValidatorSpec.ChallengeMoves moves in each
+	// challenge and then stops responding
+	DeliberateTimeout
+)
+
+var faultNames = []struct {
+	fault Fault
+	name  string
+}{
+	{WrongLogs, "wrong-logs"},
+	{WrongSends, "wrong-sends"},
+	{WrongInboxTop, "wrong-inbox-top"},
+	{WrongExecution, "wrong-execution"},
+	{WithholdResponses, "withhold-responses"},
+	{DeliberateTimeout, "deliberate-timeout"},
+}
+
+func (f Fault) String() string {
+	if f == Honest {
+		return "honest"
+	}
+	names := make([]string, 0)
+	for _, fn := range faultNames {
+		if f&fn.fault != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// tampersAssertions returns true if the fault changes the assertions the
+// validator makes
+func (f Fault) tampersAssertions() bool {
+	return f&(WrongLogs|WrongSends|WrongInboxTop|WrongExecution) != 0
+}
+
+// challengeMoveLimit returns how many moves the validator makes in each
+// challenge or -1 if it plays every challenge to the end
+func (f Fault) challengeMoveLimit(spec ValidatorSpec) int {
+	switch {
+	case f&WithholdResponses != 0:
+		return 0
+	case f&DeliberateTimeout != 0:
+		return spec.ChallengeMoves
+	default:
+		return -1
+	}
+}
+
+func tweakHash(h common.Hash) common.Hash {
+	h[31] ^= 1
+	return h
+}
+
+// faultyListener tampers with assertions before the validator makes them
+type faultyListener struct {
+	*chainlistener.ValidatorChainListener
+	fault Fault
+}
+
+func (lis *faultyListener) AssertionPrepared(
+	ctx context.Context,
+	params valprotocol.ChainParams,
+	nodeGraph *nodegraph.StakedNodeGraph,
+	nodeLocation *structures.Node,
+	prepared *chainlistener.PreparedAssertion,
+) {
+	// The prepared assertion is shared with the chain observer so it must
+	// not be modified in place
+	prepared = prepared.Clone()
+	stub := prepared.AssertionStub
+	if lis.fault&WrongLogs != 0 {
+		stub.LastLogHash = tweakHash(stub.LastLogHash)
+	}
+	if lis.fault&WrongSends != 0 {
+		stub.LastMessageHash = tweakHash(stub.LastMessageHash)
+	}
+	if lis.fault&WrongInboxTop != 0 {
+		stub.AfterInboxHash = tweakHash(stub.AfterInboxHash)
+	}
+	if lis.fault&WrongExecution != 0 {
+		stub.AfterMachineHash = tweakHash(stub.AfterMachineHash)
+	}
+	log.Println("Prepared", lis.fault, "assertion")
+	lis.ValidatorChainListener.AssertionPrepared(ctx, params, nodeGraph, nodeLocation, prepared)
+}
+
+// lateStrategy delays placing a stake until the chain reaches stakeHeight
+type lateStrategy struct {
+	chainlistener.StakingStrategy
+	client      arbbridge.ArbClient
+	stakeHeight *big.Int
+}
+
+func (s lateStrategy) ShouldStake(nodeGraph *nodegraph.StakedNodeGraph, validNode *structures.Node) bool {
+	blockId, err := s.client.CurrentBlockId(context.Background())
+	if err != nil || blockId.Height.AsInt().Cmp(s.stakeHeight) < 0 {
+		return false
+	}
+	return s.StakingStrategy.ShouldStake(nodeGraph, validNode)
+}
+
+// moveBudget is the number of challenge moves a validator has left in a
+// single challenge
+type moveBudget struct {
+	sync.Mutex
+	remaining int
+}
+
+func (b *moveBudget) spend(address common.Address) bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.remaining == 0 {
+		log.Println("Withholding move in challenge", address)
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// withholdingClient stops sending challenge transactions once the
+// validator has made its allotted number of moves in a challenge. Withheld
+// transactions are reported as sent
+type withholdingClient struct {
+	arbbridge.ArbAuthClient
+	moves int
+}
+
+func (c *withholdingClient) NewExecutionChallenge(address common.Address) (arbbridge.ExecutionChallenge, error) {
+	con, err := c.ArbAuthClient.NewExecutionChallenge(address)
+	if err != nil {
+		return nil, err
+	}
+	return &withholdingExecutionChallenge{
+		ExecutionChallenge: con,
+		address:            address,
+		budget:             &moveBudget{remaining: c.moves},
+	}, nil
+}
+
+func (c *withholdingClient) NewInboxTopChallenge(address common.Address) (arbbridge.InboxTopChallenge, error) {
+	con, err := c.ArbAuthClient.NewInboxTopChallenge(address)
+	if err != nil {
+		return nil, err
+	}
+	return &withholdingInboxTopChallenge{
+		InboxTopChallenge: con,
+		address:           address,
+		budget:            &moveBudget{remaining: c.moves},
+	}, nil
+}
+
+type withholdingExecutionChallenge struct {
+	arbbridge.ExecutionChallenge
+	address common.Address
+	budget  *moveBudget
+}
+
+func (c *withholdingExecutionChallenge) TimeoutChallenge(ctx context.Context) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.ExecutionChallenge.TimeoutChallenge(ctx)
+}
+
+func (c *withholdingExecutionChallenge) BisectAssertion(
+	ctx context.Context,
+	assertions []*valprotocol.ExecutionAssertionStub,
+	totalSteps uint64,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.ExecutionChallenge.BisectAssertion(ctx, assertions, totalSteps)
+}
+
+func (c *withholdingExecutionChallenge) OneStepProof(
+	ctx context.Context,
+	assertion *valprotocol.ExecutionAssertionStub,
+	proof []byte,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.ExecutionChallenge.OneStepProof(ctx, assertion, proof)
+}
+
+func (c *withholdingExecutionChallenge) OneStepProofWithMessage(
+	ctx context.Context,
+	assertion *valprotocol.ExecutionAssertionStub,
+	proof []byte,
+	msg inbox.InboxMessage,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.ExecutionChallenge.OneStepProofWithMessage(ctx, assertion, proof, msg)
+}
+
+func (c *withholdingExecutionChallenge) ChooseSegment(
+	ctx context.Context,
+	assertionToChallenge uint16,
+	assertionHashes []common.Hash,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.ExecutionChallenge.ChooseSegment(ctx, assertionToChallenge, assertionHashes)
+}
+
+type withholdingInboxTopChallenge struct {
+	arbbridge.InboxTopChallenge
+	address common.Address
+	budget  *moveBudget
+}
+
+func (c *withholdingInboxTopChallenge) TimeoutChallenge(ctx context.Context) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.InboxTopChallenge.TimeoutChallenge(ctx)
+}
+
+func (c *withholdingInboxTopChallenge) Bisect(
+	ctx context.Context,
+	chainHashes []common.Hash,
+	chainLength *big.Int,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.InboxTopChallenge.Bisect(ctx, chainHashes, chainLength)
+}
+
+func (c *withholdingInboxTopChallenge) OneStepProof(
+	ctx context.Context,
+	lowerHashA common.Hash,
+	value common.Hash,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.InboxTopChallenge.OneStepProof(ctx, lowerHashA, value)
+}
+
+func (c *withholdingInboxTopChallenge) ChooseSegment(
+	ctx context.Context,
+	assertionToChallenge uint16,
+	chainHashes []common.Hash,
+	chainLength uint64,
+) error {
+	if !c.budget.spend(c.address) {
+		return nil
+	}
+	return c.InboxTopChallenge.ChooseSegment(ctx, assertionToChallenge, chainHashes, chainLength)
+}
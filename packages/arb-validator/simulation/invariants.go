@@ -0,0 +1,172 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+// Violation is a broken invariant
+type Violation struct {
+	BlockId     *common.BlockId
+	Description string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v: %v", v.BlockId, v.Description)
+}
+
+type challengeRecord struct {
+	started   arbbridge.ChallengeStartedEvent
+	completed *arbbridge.ChallengeCompletedEvent
+}
+
+// CheckInvariants looks through everything that has happened on chain and
+// reports any time that
+//   - an honest staker lost a challenge
+//   - a node that the referee considers invalid was confirmed
+//   - a challenge wasn't resolved within TimeoutSlackBlocks of its deadline
+func (s *Simulation) CheckInvariants(ctx context.Context) ([]Violation, error) {
+	rollupWatcher, err := s.client.NewRollupWatcher(s.rollupAddress)
+	if err != nil {
+		return nil, err
+	}
+	events, err := rollupWatcher.GetAllEvents(ctx, big.NewInt(0), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	honest := make(map[common.Address]bool)
+	for _, v := range s.validators {
+		if v.Honest() {
+			honest[v.Address] = true
+		}
+	}
+
+	violations := make([]Violation, 0)
+	challenges := make([]*challengeRecord, 0)
+	challengesByContract := make(map[common.Address]*challengeRecord)
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case arbbridge.ChallengeStartedEvent:
+			record := &challengeRecord{started: ev}
+			challenges = append(challenges, record)
+			challengesByContract[ev.ChallengeContract] = record
+		case arbbridge.ChallengeCompletedEvent:
+			if honest[ev.Loser] {
+				violations = append(violations, Violation{
+					BlockId:     ev.BlockId,
+					Description: fmt.Sprintf("honest staker %v lost challenge %v", ev.Loser, ev.ChallengeContract),
+				})
+			}
+			if record, ok := challengesByContract[ev.ChallengeContract]; ok {
+				completed := ev
+				record.completed = &completed
+			}
+		case arbbridge.ConfirmedEvent:
+			if !s.referee.isValid(ev.NodeHash) {
+				violations = append(violations, Violation{
+					BlockId:     ev.BlockId,
+					Description: fmt.Sprintf("invalid node %v was confirmed", ev.NodeHash),
+				})
+			}
+		}
+	}
+
+	head, err := s.client.CurrentBlockId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slack := common.TicksFromBlockNum(common.NewTimeBlocks(s.timeoutSlack))
+	for _, record := range challenges {
+		end := head
+		if record.completed != nil {
+			end = record.completed.BlockId
+		}
+		deadline, err := s.challengeDeadline(ctx, record.started, end)
+		if err != nil {
+			return nil, err
+		}
+		limit := deadline.Add(slack)
+		if common.TicksFromBlockNum(end.Height).Cmp(limit) <= 0 {
+			continue
+		}
+		description := fmt.Sprintf("challenge %v is still open past its deadline %v", record.started.ChallengeContract, deadline.Val)
+		if record.completed != nil {
+			description = fmt.Sprintf("challenge %v completed after its deadline %v", record.started.ChallengeContract, deadline.Val)
+		}
+		violations = append(violations, Violation{BlockId: end, Description: description})
+	}
+	return violations, nil
+}
+
+// challengeDeadline returns the deadline of the latest move in the challenge
+// up to the given block
+func (s *Simulation) challengeDeadline(
+	ctx context.Context,
+	started arbbridge.ChallengeStartedEvent,
+	end *common.BlockId,
+) (common.TimeTicks, error) {
+	var watcher arbbridge.ContractWatcher
+	var err error
+	switch started.ChallengeType {
+	case valprotocol.InvalidInboxTopChildType:
+		watcher, err = s.client.NewInboxTopChallengeWatcher(started.ChallengeContract)
+	case valprotocol.InvalidExecutionChildType:
+		watcher, err = s.client.NewExecutionChallengeWatcher(started.ChallengeContract)
+	default:
+		err = fmt.Errorf("unexpected challenge type %v", started.ChallengeType)
+	}
+	if err != nil {
+		return common.TimeTicks{}, err
+	}
+
+	deadline := common.TimeTicks{Val: big.NewInt(0)}
+	height := started.BlockId.Height.AsInt()
+	for height.Cmp(end.Height.AsInt()) <= 0 {
+		blockId, err := s.client.BlockIdForHeight(ctx, common.NewTimeBlocks(height))
+		if err != nil {
+			return common.TimeTicks{}, err
+		}
+		events, err := watcher.GetEvents(ctx, blockId, nil)
+		if err != nil {
+			return common.TimeTicks{}, err
+		}
+		for _, ev := range events {
+			switch ev := ev.(type) {
+			case arbbridge.InitiateChallengeEvent:
+				deadline = ev.Deadline
+			case arbbridge.ContinueChallengeEvent:
+				deadline = ev.Deadline
+			case arbbridge.InboxTopBisectionEvent:
+				deadline = ev.Deadline
+			case arbbridge.MessagesBisectionEvent:
+				deadline = ev.Deadline
+			case arbbridge.ExecutionBisectionEvent:
+				deadline = ev.Deadline
+			}
+		}
+		height = new(big.Int).Add(height, big.NewInt(1))
+	}
+	return deadline, nil
+}
@@ -0,0 +1,370 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+// Package simulation runs several validators with configurable faults
+// against an in-memory L1 and checks that the honest ones are protected
+package simulation
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/big"
+	"path/filepath"
+	"sync"
+	"time"
+
+	errors2 "github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-checkpointer/checkpointing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/membridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/chainlistener"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/loader"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/nodegraph"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/rollupmanager"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// ValidatorSpec describes how a single validator behaves
+type ValidatorSpec struct {
+	Fault Fault
+	// Strategy decides when the validator stakes, asserts and challenges.
+	// ActiveStrategy is used if it's nil
+	Strategy chainlistener.StakingStrategy
+	// StakeDelay is how many blocks after the simulation starts the
+	// validator waits before placing a stake
+	StakeDelay int64
+	// ChallengeMoves is how many moves a DeliberateTimeout validator makes
+	// in each challenge before it stops responding
+	ChallengeMoves int
+}
+
+// Config describes a simulation
+type Config struct {
+	Params valprotocol.ChainParams
+	// ContractPath is the compiled machine run by the rollup
+	ContractPath string
+	// DBPath is the directory under which each validator keeps its
+	// checkpoint database
+	DBPath     string
+	Validators []ValidatorSpec
+	// Executor checks execution one step proofs. membridge.TrustingExecutor
+	// is used if it's nil
+	Executor membridge.OneStepExecutor
+	// TimeoutSlackBlocks is how many blocks past a challenge deadline an
+	// honest validator is given to time out its opponent
+	TimeoutSlackBlocks int64
+}
+
+const defaultTimeoutSlackBlocks = 5
+
+// Validator is a validator taking part in the simulation
+type Validator struct {
+	Spec    ValidatorSpec
+	Address common.Address
+}
+
+// Honest returns true if the validator follows the protocol, even if it is
+// slow to stake
+func (v *Validator) Honest() bool {
+	return v.Spec.Fault == Honest
+}
+
+// Simulation runs validators in a single process against a membridge chain.
+// L1 blocks are only mined by Step once every validator has finished reacting
+// to the previous one, so every run of a simulation sees the same sequence of
+// blocks whatever the wall clock time taken by the validators. Transactions
+// sent during a step are included in the block mined at the end of it
+type Simulation struct {
+	chain         *membridge.Chain
+	client        *membridge.ArbClient
+	rollupAddress common.Address
+	params        valprotocol.ChainParams
+	contractPath  string
+	startHeight   *big.Int
+	timeoutSlack  *big.Int
+	validators    []*Validator
+	referee       *referee
+	managers      []*rollupmanager.Manager
+	cancel        context.CancelFunc
+}
+
+// validatorAddress returns the address used by the validator at index i so
+// that transactions are ordered the same way in every run
+func validatorAddress(i int) common.Address {
+	var address common.Address
+	binary.BigEndian.PutUint64(address[12:], uint64(i+1))
+	return address
+}
+
+// New creates the rollup and starts every validator along with a referee
+// which follows the chain honestly without staking
+func New(ctx context.Context, config Config) (*Simulation, error) {
+	mach, err := loader.LoadMachineFromFile(config.ContractPath, false, "cpp")
+	if err != nil {
+		return nil, err
+	}
+
+	chain := membridge.NewChain()
+	if config.Executor != nil {
+		chain.SetOneStepExecutor(config.Executor)
+	}
+	owner := validatorAddress(len(config.Validators))
+	factory, err := membridge.NewArbAuthClient(chain, owner).NewArbFactory(chain.ArbFactoryAddress())
+	if err != nil {
+		return nil, err
+	}
+	rollupAddress, _, err := factory.CreateRollup(ctx, mach.Hash(), config.Params, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutSlack := config.TimeoutSlackBlocks
+	if timeoutSlack == 0 {
+		timeoutSlack = defaultTimeoutSlackBlocks
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	s := &Simulation{
+		chain:         chain,
+		client:        membridge.NewArbClient(chain),
+		rollupAddress: rollupAddress,
+		params:        config.Params,
+		contractPath:  config.ContractPath,
+		timeoutSlack:  big.NewInt(timeoutSlack),
+		referee:       newReferee(),
+		cancel:        cancel,
+	}
+
+	funding := new(big.Int).Mul(config.Params.StakeRequirement, big.NewInt(10))
+	for i, spec := range config.Validators {
+		address := validatorAddress(i)
+		chain.Fund(address, funding)
+		s.validators = append(s.validators, &Validator{Spec: spec, Address: address})
+	}
+
+	// From here on L1 time only moves forward when the simulation steps
+	chain.SetAutomine(false)
+	startBlockId, err := s.client.CurrentBlockId(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.startHeight = startBlockId.Height.AsInt()
+
+	refereeManager, err := s.createManager(runCtx, membridge.NewArbClient(chain), filepath.Join(config.DBPath, "referee"))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	refereeManager.AddListener(s.referee)
+
+	for i, v := range s.validators {
+		if err := s.startValidator(runCtx, v, filepath.Join(config.DBPath, fmt.Sprintf("validator%v", i))); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Simulation) createManager(
+	ctx context.Context,
+	client arbbridge.ArbClient,
+	dbPath string,
+) (*rollupmanager.Manager, error) {
+	checkpointer, err := checkpointing.NewIndexedCheckpointer(
+		s.rollupAddress,
+		dbPath,
+		big.NewInt(rollupmanager.DefaultMaxReorgDepth),
+		true,
+	)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := rollupmanager.CreateManagerAdvanced(ctx, s.rollupAddress, true, client, checkpointer, s.contractPath)
+	if err != nil {
+		checkpointer.Close()
+		return nil, err
+	}
+	s.managers = append(s.managers, manager)
+	return manager, nil
+}
+
+func (s *Simulation) startValidator(ctx context.Context, v *Validator, dbPath string) error {
+	authClient := membridge.NewArbAuthClient(s.chain, v.Address)
+	var client arbbridge.ArbAuthClient = authClient
+	if moves := v.Spec.Fault.challengeMoveLimit(v.Spec); moves >= 0 {
+		client = &withholdingClient{ArbAuthClient: authClient, moves: moves}
+	}
+
+	actor, err := client.NewRollup(s.rollupAddress)
+	if err != nil {
+		return err
+	}
+
+	strategy := v.Spec.Strategy
+	if strategy == nil {
+		strategy = chainlistener.ActiveStrategy{}
+	}
+	if v.Spec.StakeDelay > 0 {
+		strategy = lateStrategy{
+			StakingStrategy: strategy,
+			client:          client,
+			stakeHeight:     new(big.Int).Add(s.startHeight, big.NewInt(v.Spec.StakeDelay)),
+		}
+	}
+	config := chainlistener.DefaultValidatorConfig
+	config.Strategy = strategy
+	validatorListener := chainlistener.NewValidatorChainListener(ctx, s.rollupAddress, actor, config)
+	if err := validatorListener.AddStaker(client); err != nil {
+		return err
+	}
+
+	manager, err := s.createManager(ctx, client, dbPath)
+	if err != nil {
+		return err
+	}
+	if v.Spec.Fault.tampersAssertions() {
+		manager.AddListener(&faultyListener{ValidatorChainListener: validatorListener, fault: v.Spec.Fault})
+	} else {
+		manager.AddListener(validatorListener)
+	}
+	return nil
+}
+
+// Chain returns the simulated L1 so that tests can deliver messages to the
+// rollup
+func (s *Simulation) Chain() *membridge.Chain {
+	return s.chain
+}
+
+func (s *Simulation) RollupAddress() common.Address {
+	return s.rollupAddress
+}
+
+func (s *Simulation) Validators() []*Validator {
+	return s.validators
+}
+
+// stepTimeout is how long Step waits for the validators to process a block
+const stepTimeout = time.Minute
+
+// Step waits until every validator has processed the head and the chain has
+// settled, meaning that every header was received and no transaction was sent
+// for a block time, and then mines a block containing every transaction the
+// validators sent. The block time gives the validators' own timers a chance
+// to fire before L1 time moves on
+func (s *Simulation) Step(ctx context.Context) error {
+	head, err := s.client.CurrentBlockId(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, stepTimeout)
+	defer cancel()
+	for {
+		if err := s.chain.WaitSettled(ctx, common.GetDurationPerBlock()); err != nil {
+			return errors2.Wrapf(err, "validators didn't finish processing block %v", head.Height.AsInt())
+		}
+		if s.processedHeight(head.Height.AsInt()) {
+			break
+		}
+	}
+	s.chain.AdvanceBlocks(1)
+	return nil
+}
+
+// processedHeight returns true if every manager has handled the events of
+// the block at height
+func (s *Simulation) processedHeight(height *big.Int) bool {
+	for _, manager := range s.managers {
+		processed := manager.ProcessedHeight()
+		if processed == nil || processed.Cmp(height) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Run steps the simulation count times
+func (s *Simulation) Run(ctx context.Context, count int) error {
+	for i := 0; i < count; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err := s.Step(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops every validator and closes their databases
+func (s *Simulation) Close() {
+	s.cancel()
+	// Validators waiting on pending transactions need blocks to be mined in
+	// order to notice they've been stopped
+	s.chain.SetAutomine(true)
+	for _, manager := range s.managers {
+		manager.Wait()
+		manager.GetCheckpointer().Close()
+	}
+	log.Println("Simulation shut down")
+}
+
+// referee follows the chain without staking and records every node that it
+// considers valid
+type referee struct {
+	chainlistener.NoopListener
+
+	sync.Mutex
+	validNodes map[common.Hash]bool
+}
+
+func newReferee() *referee {
+	return &referee{validNodes: make(map[common.Hash]bool)}
+}
+
+func (r *referee) addValid(nodes ...*structures.Node) {
+	r.Lock()
+	defer r.Unlock()
+	for _, node := range nodes {
+		r.validNodes[node.Hash()] = true
+	}
+}
+
+func (r *referee) isValid(nodeHash common.Hash) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.validNodes[nodeHash]
+}
+
+func (r *referee) AddedToChain(_ context.Context, nodes []*structures.Node) {
+	r.addValid(nodes...)
+}
+
+func (r *referee) RestartingFromLatestValid(_ context.Context, node *structures.Node) {
+	r.addValid(node)
+}
+
+func (r *referee) AdvancedKnownNode(_ context.Context, _ *nodegraph.StakedNodeGraph, node *structures.Node) {
+	r.addValid(node)
+}
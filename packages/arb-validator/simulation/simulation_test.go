@@ -0,0 +1,118 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package simulation
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/arbbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/membridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator-core/valprotocol"
+)
+
+const simulationBlocks = 80
+
+func TestFaultsAreCaught(t *testing.T) {
+	// Blocks are only mined once every validator is done with the previous
+	// one, so the block time only paces the validators' own timers
+	prevDuration := common.GetDurationPerBlock()
+	common.SetDurationPerBlock(100 * time.Millisecond)
+	defer common.SetDurationPerBlock(prevDuration)
+
+	tests := []struct {
+		name       string
+		validators []ValidatorSpec
+	}{
+		{"WrongExecution", []ValidatorSpec{{Fault: Honest}, {Fault: WrongExecution}}},
+		{"WrongLogs", []ValidatorSpec{{Fault: Honest}, {Fault: WrongLogs}}},
+		{"WrongSends", []ValidatorSpec{{Fault: Honest}, {Fault: WrongSends}}},
+		{"WrongInboxTop", []ValidatorSpec{{Fault: Honest}, {Fault: WrongInboxTop}}},
+		{"Withhold", []ValidatorSpec{{Fault: Honest}, {Fault: WrongExecution | WithholdResponses}}},
+		{"DeliberateTimeout", []ValidatorSpec{{Fault: Honest}, {Fault: WrongExecution | DeliberateTimeout, ChallengeMoves: 2}}},
+		{"LateStake", []ValidatorSpec{{Fault: WrongExecution}, {Fault: Honest, StakeDelay: 5}}},
+		{"Outnumbered", []ValidatorSpec{{Fault: WrongLogs}, {Fault: WrongExecution}, {Fault: Honest}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSimulation(t, tt.validators)
+		})
+	}
+}
+
+func runSimulation(t *testing.T, validators []ValidatorSpec) {
+	ctx := context.Background()
+	dbPath, err := ioutil.TempDir("", "simulation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	sim, err := New(ctx, Config{
+		Params: valprotocol.ChainParams{
+			StakeRequirement:        big.NewInt(10),
+			GracePeriod:             common.TicksFromBlockNum(common.NewTimeBlocksInt(10)),
+			MaxExecutionSteps:       100000,
+			ArbGasSpeedLimitPerTick: 100000,
+		},
+		ContractPath: arbos.Path(),
+		DBPath:       dbPath,
+		Validators:   validators,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	if err := sim.Run(ctx, simulationBlocks); err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := sim.CheckInvariants(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, violation := range violations {
+		t.Error(violation)
+	}
+
+	rollup, err := membridge.NewArbClient(sim.Chain()).NewRollupWatcher(sim.RollupAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := rollup.GetAllEvents(ctx, big.NewInt(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := make(map[common.Address]bool)
+	for _, ev := range events {
+		if ev, ok := ev.(arbbridge.ChallengeCompletedEvent); ok {
+			lost[ev.Loser] = true
+		}
+	}
+	for _, v := range sim.Validators() {
+		if !v.Honest() && !lost[v.Address] {
+			t.Errorf("%v validator %v never lost a challenge", v.Spec.Fault, v.Address)
+		}
+	}
+}
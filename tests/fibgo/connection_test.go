@@ -7,7 +7,6 @@ import (
 	"fmt"
 	goarbitrum "github.com/offchainlabs/arbitrum/packages/arb-provider-go"
 	"github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/rpc"
-	utils2 "github.com/offchainlabs/arbitrum/packages/arb-tx-aggregator/utils"
 	"log"
 	"math/big"
 	"math/rand"
@@ -105,6 +104,7 @@ func setupValidators(
 			rollupmanager.NewStressTestClient(client, time.Second*15),
 			contract,
 			dbName,
+			rollupmanager.DefaultMaxReorgDepth,
 		)
 		if err != nil {
 			return err
@@ -116,6 +116,7 @@ func setupValidators(
 			context.Background(),
 			rollupAddress,
 			rollupActor,
+			chainlistener.DefaultValidatorConfig,
 		)
 		err = validatorListener.AddStaker(client)
 		if err != nil {
@@ -129,6 +130,13 @@ func setupValidators(
 }
 
 func launchAggregator(client ethutils.EthClient, auth *bind.TransactOpts, rollupAddress common.Address) error {
+	cfg := rpc.DefaultConfig()
+	cfg.RPC.AggregatorAddr = ":2235"
+	cfg.RPC.Web3Addr = ":9546"
+	cfg.RPC.Web3WSAddr = ""
+	cfg.Batcher.MaxBatchTime = time.Second
+	cfg.Batcher.KeepPendingState = true
+	cfg.Checkpoint.Path = db + "/aggregator"
 	go func() {
 		if err := rpc.LaunchAggregator(
 			context.Background(),
@@ -136,12 +144,7 @@ func launchAggregator(client ethutils.EthClient, auth *bind.TransactOpts, rollup
 			auth,
 			rollupAddress,
 			contract,
-			db+"/aggregator",
-			"2235",
-			"9546",
-			utils2.RPCFlags{},
-			time.Second,
-			true,
+			cfg,
 		); err != nil {
 			log.Fatal(err)
 		}